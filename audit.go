@@ -0,0 +1,251 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// The outcomes recorded in the audit journal.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+var (
+	// secretWords mark the flags and environment variables whose values
+	// are never written to the audit journal.
+	secretWords = []string{"password", "passwd", "secret", "token", "credential"}
+	// publicFlags contain a secret word but only say where a secret is
+	// kept, so their values are written to the audit journal.
+	publicFlags = []string{"--credential-provider", "--credential-key"}
+)
+
+// AuditEntry is one line of the append only audit journal kept in each
+// deployment directory.
+type AuditEntry struct {
+	Command         string    `json:"command"`
+	Args            []string  `json:"args,omitempty"`
+	User            string    `json:"user,omitempty"`
+	GravitonVersion string    `json:"graviton_version,omitempty"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	Outcome         string    `json:"outcome"`
+	Error           string    `json:"error,omitempty"`
+	Resources       []string  `json:"resources,omitempty"`
+}
+
+// AuditJournalPath returns the location of the audit journal of a
+// deployment.
+func AuditJournalPath(confDir string, name string) string {
+	return path.Join(DeploymentDir(confDir, name), "audit.jsonl")
+}
+
+// auditArchivePath is where the journal is kept once the deployment
+// directory has been removed.
+func auditArchivePath(confDir string, name string) string {
+	return path.Join(confDir, "history", fmt.Sprintf("%s.jsonl", name))
+}
+
+// AppendAuditEntry adds the entry to the journal of the deployment.  If the
+// deployment has been destroyed the entry goes to the archived journal.
+func AppendAuditEntry(context AppContext, name string, entry *AuditEntry) error {
+	journal := AuditJournalPath(context.GetConfigDir(), name)
+	if !PathExists(DeploymentDir(context.GetConfigDir(), name)) {
+		journal = auditArchivePath(context.GetConfigDir(), name)
+		os.MkdirAll(path.Dir(journal), 0755)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(journal, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// archiveAuditJournal appends the journal of a deployment that is about to
+// be removed to its archived journal.
+func archiveAuditJournal(context AppContext, name string) error {
+	journal := AuditJournalPath(context.GetConfigDir(), name)
+	if !PathExists(journal) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(journal)
+	if err != nil {
+		return err
+	}
+	archive := auditArchivePath(context.GetConfigDir(), name)
+	os.MkdirAll(path.Dir(archive), 0755)
+	f, err := os.OpenFile(archive, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
+
+// LoadAuditJournal reads every entry of the journal of a deployment.  The
+// archived journal is used if the deployment no longer exists.
+func LoadAuditJournal(context AppContext, name string) ([]AuditEntry, error) {
+	journal := AuditJournalPath(context.GetConfigDir(), name)
+	if !PathExists(journal) {
+		journal = auditArchivePath(context.GetConfigDir(), name)
+	}
+	if !PathExists(journal) {
+		return nil, fmt.Errorf("No history exists for the deployment %s", name)
+	}
+	f, err := os.Open(journal)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry AuditEntry
+		err = json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			context.Logf(WARN, "Skipping a bad line in %s: %s", journal, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, f := range publicFlags {
+		if name == f {
+			return false
+		}
+	}
+	for _, w := range secretWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactArgs returns a copy of the command line arguments with the values
+// of secret flags and secret environment variables replaced.  Everything
+// after -- is passed on to another program, such as a Stardog client, whose
+// secrets cannot be recognized, so it is all replaced.
+func RedactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	hideNext := false
+	hideRest := false
+	for i, a := range args {
+		if hideRest {
+			redacted[i] = "*****"
+			continue
+		}
+		if a == "--" && !hideNext {
+			redacted[i] = a
+			hideRest = true
+			continue
+		}
+		if hideNext {
+			redacted[i] = redactEnv(args[i-1], a)
+			hideNext = false
+			continue
+		}
+		redacted[i] = a
+		if !strings.HasPrefix(a, "--") {
+			continue
+		}
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) == 2 {
+			redacted[i] = kv[0] + "=" + redactEnv(kv[0], kv[1])
+		} else if isSecret(a) || a == "--env" {
+			hideNext = true
+		}
+	}
+	return redacted
+}
+
+// redactEnv hides the value for a secret flag.  The value of --env is a
+// key=value pair and is only hidden if the key is secret.
+func redactEnv(flag string, value string) string {
+	if flag == "--env" {
+		kv := strings.SplitN(value, "=", 2)
+		if len(kv) == 2 && isSecret(kv[0]) {
+			return kv[0] + "=*****"
+		}
+		return value
+	}
+	if isSecret(flag) {
+		return "*****"
+	}
+	return value
+}
+
+// DescribeChanges lists the resources of the deployment that differ between
+// the two summaries.  A nil summary is a deployment that does not exist.
+func DescribeChanges(before *DeploymentSummary, after *DeploymentSummary) []string {
+	if before == nil {
+		before = &DeploymentSummary{}
+	}
+	if after == nil {
+		after = &DeploymentSummary{}
+	}
+	changes := []string{}
+	describe := func(resource string, was bool, is bool) {
+		if !was && is {
+			changes = append(changes, fmt.Sprintf("%s created", resource))
+		} else if was && !is {
+			changes = append(changes, fmt.Sprintf("%s deleted", resource))
+		}
+	}
+	describe("deployment", before.Name != "", after.Name != "")
+	describe("volumes", before.VolumesExist, after.VolumesExist)
+	describe("instance", before.InstanceExists, after.InstanceExists)
+	changed := func(resource string, was string, is string) {
+		if was != "" && is != "" && was != is {
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", resource, was, is))
+		}
+	}
+	changed("version", before.Version, after.Version)
+	changed("image", before.Image, after.Image)
+	if before.ClusterSize > 0 && after.ClusterSize > 0 {
+		changed("cluster size", fmt.Sprintf("%d", before.ClusterSize), fmt.Sprintf("%d", after.ClusterSize))
+	}
+	if before.ZkSize > 0 && after.ZkSize > 0 {
+		changed("zookeeper size", fmt.Sprintf("%d", before.ZkSize), fmt.Sprintf("%d", after.ZkSize))
+	}
+	changed("state", before.State, after.State)
+	return changes
+}
@@ -0,0 +1,92 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"passwd", "--admin-password", "s3cret", "--token=abc", "--env", "AWS_SECRET_ACCESS_KEY=xyz", "--env=LEVEL=debug", "--name", "dep"}
+	redacted := strings.Join(RedactArgs(args), " ")
+	if redacted != "passwd --admin-password ***** --token=***** --env AWS_SECRET_ACCESS_KEY=***** --env=LEVEL=debug --name dep" {
+		t.Fatalf("The arguments were not redacted properly %s", redacted)
+	}
+	if args[2] != "s3cret" {
+		t.Fatal("The original arguments should not be changed")
+	}
+	args = []string{"client", "dep", "--cli", "stardog-admin", "--", "user", "passwd", "-N", "s3cret", "admin"}
+	redacted = strings.Join(RedactArgs(args), " ")
+	if redacted != "client dep --cli stardog-admin -- ***** ***** ***** ***** *****" {
+		t.Fatalf("The client arguments should be hidden %s", redacted)
+	}
+	args = []string{"launch", "--credential-provider", "file", "--credential-key=prod-admin", "--credential-option", "helper=pass", "dep"}
+	redacted = strings.Join(RedactArgs(args), " ")
+	if redacted != "launch --credential-provider file --credential-key=prod-admin --credential-option ***** dep" {
+		t.Fatalf("The credential provider and key should be kept %s", redacted)
+	}
+}
+
+func TestDescribeChanges(t *testing.T) {
+	before := DeploymentSummary{Name: "d", VolumesExist: true, ClusterSize: 3, Image: "ami-1", State: StateVolumesCreated}
+	after := DeploymentSummary{Name: "d", VolumesExist: true, InstanceExists: true, ClusterSize: 5, Image: "ami-2", State: StateVolumesCreated}
+	changes := strings.Join(DescribeChanges(&before, &after), ", ")
+	if changes != "instance created, image ami-1 -> ami-2, cluster size 3 -> 5" {
+		t.Fatalf("The changes are wrong %s", changes)
+	}
+	changes = strings.Join(DescribeChanges(&after, nil), ", ")
+	if changes != "deployment deleted, volumes deleted, instance deleted" {
+		t.Fatalf("The changes are wrong %s", changes)
+	}
+}
+
+func TestAuditJournal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(dir)
+	ctx := TestContext{ConfigDir: dir}
+	os.MkdirAll(DeploymentDir(dir, "d"), 0755)
+
+	_, err := LoadAuditJournal(&ctx, "d")
+	if err == nil {
+		t.Fatal("There is no history yet")
+	}
+	start := time.Now()
+	for _, c := range []string{"deployment new", "volume new"} {
+		err = AppendAuditEntry(&ctx, "d", &AuditEntry{Command: c, Start: start, End: start, Outcome: AuditSuccess})
+		if err != nil {
+			t.Fatalf("Failed to append %s", err)
+		}
+	}
+	DeleteDeployment(&ctx, "d")
+	if PathExists(DeploymentDir(dir, "d")) {
+		t.Fatal("The deployment should be gone")
+	}
+	err = AppendAuditEntry(&ctx, "d", &AuditEntry{Command: "deployment destroy", Start: start, End: start, Outcome: AuditSuccess})
+	if err != nil {
+		t.Fatalf("Failed to append %s", err)
+	}
+	entries, err := LoadAuditJournal(&ctx, "d")
+	if err != nil {
+		t.Fatalf("Failed to load the journal %s", err)
+	}
+	if len(entries) != 3 || entries[0].Command != "deployment new" || entries[2].Command != "deployment destroy" {
+		t.Fatalf("The journal is wrong %v", entries)
+	}
+}
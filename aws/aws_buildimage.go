@@ -100,6 +100,11 @@ func (a *awsPlugin) HaveImage(c sdutils.AppContext) bool {
 func (a *awsPlugin) BuildImage(context sdutils.AppContext, sdReleaseFilePath string, version string) error {
 	context.Logf(sdutils.DEBUG, "Build AMI image\n")
 
+	err := ValidateRegion(a.Region)
+	if err != nil {
+		return err
+	}
+
 	neededEnvs := []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"}
 	for _, e := range neededEnvs {
 		if os.Getenv(e) == "" {
@@ -107,7 +112,7 @@ func (a *awsPlugin) BuildImage(context sdutils.AppContext, sdReleaseFilePath str
 		}
 	}
 	packerURL := fmt.Sprintf("https://releases.hashicorp.com/packer/%s/packer_%s_%s_%s.zip", PackerVersion, PackerVersion, runtime.GOOS, runtime.GOARCH)
-	err := sdutils.FindProgramVersion(context, "packer", PackerVersion, packerURL)
+	err = sdutils.FindProgramVersion(context, "packer", PackerVersion, packerURL)
 	if err != nil {
 		return fmt.Errorf("We could not get a proper version of packer %s", err.Error())
 	}
@@ -179,5 +184,57 @@ func (a *awsPlugin) BuildImage(context sdutils.AppContext, sdReleaseFilePath str
 	if err != nil {
 		return err
 	}
+	context.SetResult(&sdutils.ImageDescription{Version: version, Region: a.Region, Image: (*results)[0].Value})
+	return nil
+}
+
+// CopyImage copies the base AMI built for the selected region to each of the
+// given regions and records the copies in the AMI map.
+func (a *awsPlugin) CopyImage(context sdutils.AppContext, regions []string) error {
+	neededEnvs := []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"}
+	for _, e := range neededEnvs {
+		if os.Getenv(e) == "" {
+			return fmt.Errorf("The environment variable %s must be set", e)
+		}
+	}
+	err := ValidateRegion(a.Region)
+	if err != nil {
+		return err
+	}
+	for _, r := range regions {
+		err = ValidateRegion(r)
+		if err != nil {
+			return err
+		}
+	}
+	amiMap, err := loadAmiAmp(context)
+	if err != nil {
+		return err
+	}
+	ami, ok := amiMap[a.Region]
+	if !ok {
+		return fmt.Errorf("No base AMI has been built for %s, please see the 'baseami' subcommand", a.Region)
+	}
+	copies := []sdutils.ImageDescription{}
+	for _, r := range regions {
+		if r == a.Region {
+			continue
+		}
+		spin := sdutils.NewSpinner(context, 1, fmt.Sprintf("Copying the AMI %s to %s", ami, r))
+		newAmi, err := CopyAmi(context, a.Region, ami, r)
+		spin.Close()
+		if err != nil {
+			context.ConsoleLog(0, "Failed to copy the AMI to %s.\n", r)
+			return err
+		}
+		amiMap[r] = newAmi
+		err = saveAmiMap(context, amiMap)
+		if err != nil {
+			return err
+		}
+		copies = append(copies, sdutils.ImageDescription{Version: context.GetVersion(), Region: r, Image: newAmi})
+		context.ConsoleLog(1, "Successfully copied the AMI to %s: %s\n", r, newAmi)
+	}
+	context.SetResult(copies)
 	return nil
 }
@@ -0,0 +1,225 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/stardog-union/stardog-graviton"
+)
+
+// The credential providers backed by AWS services.
+const (
+	CredentialProviderSSM            = "ssm"
+	CredentialProviderSecretsManager = "secretsmanager"
+)
+
+func init() {
+	sdutils.AddCredentialProvider(CredentialProviderSSM, NewSSMCredentialProvider)
+	sdutils.AddCredentialProvider(CredentialProviderSecretsManager, NewSecretsManagerCredentialProvider)
+}
+
+// credentialRegion picks the region of a secret store.  The region option
+// wins, then AWS_REGION, then the region of the deployment and finally the
+// default region of the plugin.
+func credentialRegion(baseD *sdutils.BaseDeployment, ref *sdutils.CredentialRef) string {
+	if region := ref.Options["region"]; region != "" {
+		return region
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	p := GetPlugin().(*awsPlugin)
+	if region := p.DeploymentRegion(baseD); region != "" {
+		return region
+	}
+	return p.Region
+}
+
+// SSMCredentialProvider keeps the admin password in a SecureString parameter
+// of the SSM Parameter Store.  The parameter is encrypted with the default
+// KMS key of the account unless the kms_key option names another.
+type SSMCredentialProvider struct {
+	Name     string
+	Region   string
+	KMSKeyID string
+}
+
+// NewSSMCredentialProvider makes the provider for a deployment.  The
+// parameter is /graviton/<deployment>/admin-password unless the key names
+// another.
+func NewSSMCredentialProvider(c sdutils.AppContext, baseD *sdutils.BaseDeployment, ref *sdutils.CredentialRef) (sdutils.CredentialProvider, error) {
+	name := ref.Key
+	if name == "" {
+		name = fmt.Sprintf("/graviton/%s/admin-password", baseD.Name)
+	}
+	return &SSMCredentialProvider{
+		Name:     name,
+		Region:   credentialRegion(baseD, ref),
+		KMSKeyID: ref.Options["kms_key"],
+	}, nil
+}
+
+func (p *SSMCredentialProvider) client() (*ssm.SSM, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	return ssm.New(sess, &aws.Config{Region: aws.String(p.Region)}), nil
+}
+
+// GetPassword reads and decrypts the parameter.
+func (p *SSMCredentialProvider) GetPassword() (string, error) {
+	svc, err := p.client()
+	if err != nil {
+		return "", err
+	}
+	out, err := svc.GetParameters(&ssm.GetParametersInput{
+		Names:          []*string{aws.String(p.Name)},
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(out.Parameters) == 0 {
+		return "", nil
+	}
+	return aws.StringValue(out.Parameters[0].Value), nil
+}
+
+// SetPassword creates or overwrites the parameter.
+func (p *SSMCredentialProvider) SetPassword(password string) error {
+	svc, err := p.client()
+	if err != nil {
+		return err
+	}
+	input := &ssm.PutParameterInput{
+		Name:        aws.String(p.Name),
+		Description: aws.String("The Stardog admin password of a graviton deployment"),
+		Type:        aws.String(ssm.ParameterTypeSecureString),
+		Value:       aws.String(password),
+		Overwrite:   aws.Bool(true),
+	}
+	if p.KMSKeyID != "" {
+		input.KeyId = aws.String(p.KMSKeyID)
+	}
+	_, err = svc.PutParameter(input)
+	return err
+}
+
+// SecretsManagerCredentialProvider keeps the admin password as the string
+// value of a secret in AWS Secrets Manager.
+type SecretsManagerCredentialProvider struct {
+	SecretID string
+	Region   string
+}
+
+// NewSecretsManagerCredentialProvider makes the provider for a deployment.
+// The secret is graviton/<deployment>/admin-password unless the key names
+// another.
+func NewSecretsManagerCredentialProvider(c sdutils.AppContext, baseD *sdutils.BaseDeployment, ref *sdutils.CredentialRef) (sdutils.CredentialProvider, error) {
+	id := ref.Key
+	if id == "" {
+		id = fmt.Sprintf("graviton/%s/admin-password", baseD.Name)
+	}
+	return &SecretsManagerCredentialProvider{
+		SecretID: id,
+		Region:   credentialRegion(baseD, ref),
+	}, nil
+}
+
+// The vendored SDK predates Secrets Manager so the few calls that are needed
+// are made with a JSON RPC client set up the way the generated clients are.
+type secretValueInput struct {
+	SecretId     *string
+	SecretString *string
+	Name         *string
+}
+
+type secretValueOutput struct {
+	SecretString *string
+}
+
+func (p *SecretsManagerCredentialProvider) call(operation string, input *secretValueInput, output *secretValueOutput) error {
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	const serviceName = "secretsmanager"
+	endpoint := fmt.Sprintf("https://%s.%s.amazonaws.com", serviceName, p.Region)
+	c := sess.ClientConfig(serviceName, &aws.Config{Region: aws.String(p.Region), Endpoint: aws.String(endpoint)})
+	svc := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   serviceName,
+			SigningName:   serviceName,
+			SigningRegion: p.Region,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2017-10-17",
+			JSONVersion:   "1.1",
+			TargetPrefix:  "secretsmanager",
+		},
+		c.Handlers,
+	)
+	svc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	svc.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	svc.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	svc.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	svc.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+
+	op := &request.Operation{Name: operation, HTTPMethod: "POST", HTTPPath: "/"}
+	if output == nil {
+		output = &secretValueOutput{}
+	}
+	return svc.NewRequest(op, input, output).Send()
+}
+
+func isNotFound(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == "ResourceNotFoundException"
+}
+
+// GetPassword reads the current value of the secret.
+func (p *SecretsManagerCredentialProvider) GetPassword() (string, error) {
+	var out secretValueOutput
+	err := p.call("GetSecretValue", &secretValueInput{SecretId: aws.String(p.SecretID)}, &out)
+	if isNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.SecretString), nil
+}
+
+// SetPassword adds a new value to the secret, creating it the first time.
+func (p *SecretsManagerCredentialProvider) SetPassword(password string) error {
+	err := p.call("PutSecretValue", &secretValueInput{SecretId: aws.String(p.SecretID), SecretString: aws.String(password)}, nil)
+	if isNotFound(err) {
+		err = p.call("CreateSecret", &secretValueInput{Name: aws.String(p.SecretID), SecretString: aws.String(password)}, nil)
+	}
+	return err
+}
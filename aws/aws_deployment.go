@@ -43,6 +43,8 @@ type awsDeploymentDescription struct {
 	HTTPMask        string `json:"http_mask,omitempty"`
 	CustomScript    string `json:"custom_script,omitempty"`
 	CustomZkScript  string `json:"custom_zk_script,omitempty"`
+	TLSCertArn      string `json:"tls_cert_arn,omitempty"`
+	ImportedCert    bool   `json:"imported_cert,omitempty"`
 	Version         string `json:"-"`
 	Name            string `json:"-"`
 	deployDir       string
@@ -50,6 +52,9 @@ type awsDeploymentDescription struct {
 	customLog4J     string
 	environment     []string
 	disableSecurity bool
+	tlsPending      bool
+	keyPending      bool
+	replacedCert    string
 	ctx             sdutils.AppContext
 	plugin          *awsPlugin
 }
@@ -59,10 +64,25 @@ var (
 	PackerVersion    = "1.2.3"
 )
 
-func newAwsDeploymentDescription(c sdutils.AppContext, baseD *sdutils.BaseDeployment, a *awsPlugin) (*awsDeploymentDescription, error) {
+// newAwsDeploymentDescription defines a new deployment.  When plan is set
+// nothing is created in AWS.  A key pair that would be imported is only
+// generated locally in baseD.Directory so that terraform can plan with it,
+// and the deployment works in that directory.
+func newAwsDeploymentDescription(c sdutils.AppContext, baseD *sdutils.BaseDeployment, a *awsPlugin, plan bool) (*awsDeploymentDescription, error) {
 	var err error
 	createdKey := false
+	keyPending := false
 
+	if a.Region == "" {
+		a.Region, err = sdutils.AskUser("Region", "us-west-1")
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = ValidateRegion(a.Region)
+	if err != nil {
+		return nil, err
+	}
 	if a.AmiID == "" {
 		// If the ami is not specified look it up
 		amiMap, err := loadAmiAmp(c)
@@ -84,34 +104,10 @@ func newAwsDeploymentDescription(c sdutils.AppContext, baseD *sdutils.BaseDeploy
 		a.AmiID = ami
 	}
 
-	if a.Region == "" {
-		a.AwsKeyName, err = sdutils.AskUser("Region", "us-west-1")
-		if err != nil {
-			return nil, err
-		}
-	}
-	amiVersion, err := GetAmiVersion(c, a.Region, &a.AmiID)
+	err = checkAmiVersion(c, a.Region, a.AmiID)
 	if err != nil {
 		return nil, err
 	}
-	var vx int
-	var vy int
-	var vz int
-
-	sc, err := fmt.Sscanf(*amiVersion, "%d.%d.%d", &vx, &vy, &vz)
-	if sc != 3 {
-		return nil, fmt.Errorf("Unknown version in base AMI %s", *amiVersion)
-	}
-	var px int
-	var py int
-	var pz int
-	sc, err = fmt.Sscanf(imageVersion, "%d.%d.%d", &px, &py, &pz)
-	if sc != 3 {
-		return nil, fmt.Errorf("Unknown version in base AMI %s", *amiVersion)
-	}
-	if vx != px {
-		return nil, fmt.Errorf("This version of graviton cannot work with AMI version %s, please rebuild a base AMI with version %s", *amiVersion, imageVersion)
-	}
 	if a.AwsKeyName == "" && baseD.PrivateKey == "" {
 		if !c.GetInteractive() || sdutils.AskUserYesOrNo("Would you like to create an SSH key pair?") {
 			newKeyName := baseD.Name + "key"
@@ -119,11 +115,15 @@ func newAwsDeploymentDescription(c sdutils.AppContext, baseD *sdutils.BaseDeploy
 			if err != nil {
 				return nil, err
 			}
-			err = ImportKeyName(c, a, newKeyName, public)
-			if err != nil {
-				return nil, err
+			if plan {
+				keyPending = true
+			} else {
+				err = ImportKeyName(c, a, newKeyName, public)
+				if err != nil {
+					return nil, err
+				}
+				createdKey = true
 			}
-			createdKey = true
 			a.AwsKeyName = newKeyName
 			baseD.PrivateKey = privateKeyFilename
 		}
@@ -151,15 +151,20 @@ func newAwsDeploymentDescription(c sdutils.AppContext, baseD *sdutils.BaseDeploy
 	if fi.Mode()&0077 != 0 {
 		return nil, fmt.Errorf("The permissions on the private key %s must only allow for user access", baseD.PrivateKey)
 	}
-	b, err := CheckKeyName(c, a, a.AwsKeyName)
-	if err != nil {
-		return nil, fmt.Errorf("There was an error checking the AWS environment: %s", err)
-	}
-	if !b {
-		return nil, fmt.Errorf("The AWS keyname %s does not exist", a.AwsKeyName)
+	if !keyPending {
+		b, err := CheckKeyName(c, a, a.AwsKeyName)
+		if err != nil {
+			return nil, fmt.Errorf("There was an error checking the AWS environment: %s", err)
+		}
+		if !b {
+			return nil, fmt.Errorf("The AWS keyname %s does not exist", a.AwsKeyName)
+		}
 	}
 
 	deployDir := sdutils.DeploymentDir(c.GetConfigDir(), baseD.Name)
+	if plan {
+		deployDir = baseD.Directory
+	}
 	assertDir, err := PlaceAsset(c, deployDir, "etc/terraform", false)
 	if err != nil {
 		return nil, err
@@ -182,11 +187,72 @@ func newAwsDeploymentDescription(c sdutils.AppContext, baseD *sdutils.BaseDeploy
 		environment:     baseD.Environment,
 		disableSecurity: baseD.DisableSecurity,
 		CreatedKey:      createdKey,
+		keyPending:      keyPending,
 	}
 	return &dd, nil
 }
 
+// checkAmiVersion makes sure that the base AMI was built for a compatible
+// version of graviton.
+func checkAmiVersion(c sdutils.AppContext, region string, ami string) error {
+	amiVersion, err := GetAmiVersion(c, region, &ami)
+	if err != nil {
+		return err
+	}
+	if amiVersion == nil {
+		return fmt.Errorf("No version tag found for AMI %s", ami)
+	}
+	var vx int
+	var vy int
+	var vz int
+
+	sc, err := fmt.Sscanf(*amiVersion, "%d.%d.%d", &vx, &vy, &vz)
+	if sc != 3 {
+		return fmt.Errorf("Unknown version in base AMI %s", *amiVersion)
+	}
+	var px int
+	var py int
+	var pz int
+	sc, err = fmt.Sscanf(imageVersion, "%d.%d.%d", &px, &py, &pz)
+	if sc != 3 {
+		return fmt.Errorf("Unknown version in base AMI %s", *amiVersion)
+	}
+	if vx != px {
+		return fmt.Errorf("This version of graviton cannot work with AMI version %s, please rebuild a base AMI with version %s", *amiVersion, imageVersion)
+	}
+	return nil
+}
+
+// save rewrites the plugin section of the deployment's config.json file.
+func (dd *awsDeploymentDescription) save() error {
+	confPath := path.Join(dd.deployDir, "config.json")
+	data, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return err
+	}
+	conf := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return err
+	}
+	conf["cloud_opts"], err = json.Marshal(dd)
+	if err != nil {
+		return err
+	}
+	data, err = json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(confPath, data, 0600)
+}
+
 func (dd *awsDeploymentDescription) DestroyDeployment() error {
+	if dd.ImportedCert {
+		err := DeleteCertificate(dd.ctx, dd.Region, dd.TLSCertArn)
+		if err != nil {
+			dd.ctx.ConsoleLog(1, "Failed to delete the imported certificate %s: %s\n", dd.TLSCertArn, err)
+		}
+	}
 	if dd.CreatedKey {
 		err := DeleteKeyPair(dd.ctx, dd.plugin, dd.AwsKeyName)
 		return err
@@ -199,6 +265,11 @@ func (dd *awsDeploymentDescription) CreateVolumeSet(licensePath string, sizeOfEa
 	return vm.CreateSet(licensePath, sizeOfEachVolume, clusterSize)
 }
 
+func (dd *awsDeploymentDescription) PlanVolumeSet(licensePath string, sizeOfEachVolume int, clusterSize int) (*sdutils.PlanSummary, error) {
+	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
+	return vm.PlanSet(licensePath, sizeOfEachVolume, clusterSize)
+}
+
 func (dd *awsDeploymentDescription) DeleteVolumeSet() error {
 	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
 	if !vm.VolumeExists() {
@@ -207,6 +278,14 @@ func (dd *awsDeploymentDescription) DeleteVolumeSet() error {
 	return vm.DeleteSet()
 }
 
+func (dd *awsDeploymentDescription) PlanDeleteVolumeSet() (*sdutils.PlanSummary, error) {
+	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
+	if !vm.VolumeExists() {
+		return nil, fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	return vm.PlanDeleteSet()
+}
+
 func (dd *awsDeploymentDescription) ClusterSize() (int, error) {
 	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
 	if !vm.VolumeExists() {
@@ -227,6 +306,51 @@ func (dd *awsDeploymentDescription) ClusterSize() (int, error) {
 	return size, nil
 }
 
+// ResizeCluster grows the volumes before adding Stardog nodes and removes
+// Stardog nodes before destroying their volumes.
+func (dd *awsDeploymentDescription) ResizeCluster(clusterSize int) error {
+	current, err := dd.ClusterSize()
+	if err != nil {
+		return err
+	}
+	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	if clusterSize > current {
+		err = vm.Resize(clusterSize)
+		if err != nil || !im.InstanceExists() {
+			return err
+		}
+		return im.Resize(clusterSize)
+	}
+	if im.InstanceExists() {
+		err = im.Resize(clusterSize)
+		if err != nil {
+			return err
+		}
+	}
+	return vm.Resize(clusterSize)
+}
+
+func (dd *awsDeploymentDescription) SnapshotVolumeSet(tag string) ([]string, error) {
+	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
+	if !vm.VolumeExists() {
+		return nil, fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	return vm.Snapshot(tag)
+}
+
+func (dd *awsDeploymentDescription) CreateVolumeSetFromSnapshots(snapshotIDs []string, sizeOfEachVolume int) error {
+	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
+	return vm.CreateSetFromSnapshots(snapshotIDs, sizeOfEachVolume)
+}
+
+func (dd *awsDeploymentDescription) DeleteVolumeSnapshots(snapshotIDs []string) error {
+	return DeleteSnapshots(dd.ctx, dd.Region, snapshotIDs)
+}
+
 func (dd *awsDeploymentDescription) StatusVolumeSet() error {
 	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
 	if !vm.VolumeExists() {
@@ -241,11 +365,32 @@ func (dd *awsDeploymentDescription) VolumeExists() bool {
 }
 
 func (dd *awsDeploymentDescription) CreateInstance(volumeSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) error {
+	err := dd.configureTLS(false)
+	if err != nil {
+		return err
+	}
 	im, err := NewEc2Instance(dd.ctx, dd)
 	if err != nil {
 		return err
 	}
-	return im.CreateInstance(volumeSize, zookeeperSize, idleTimeout, bastionVolSnapshotId)
+	err = im.CreateInstance(volumeSize, zookeeperSize, idleTimeout, bastionVolSnapshotId)
+	if err != nil {
+		return err
+	}
+	dd.deleteReplacedCert()
+	return nil
+}
+
+func (dd *awsDeploymentDescription) PlanInstance(clusterSize int, volumeSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) (*sdutils.PlanSummary, error) {
+	err := dd.configureTLS(true)
+	if err != nil {
+		return nil, err
+	}
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return nil, err
+	}
+	return im.PlanInstance(clusterSize, volumeSize, zookeeperSize, idleTimeout, bastionVolSnapshotId)
 }
 
 func (dd *awsDeploymentDescription) OpenInstance(volumeSize int, zookeeperSize int, mask string, idleTimeout int) error {
@@ -264,6 +409,30 @@ func (dd *awsDeploymentDescription) DeleteInstance() error {
 	return im.DeleteInstance()
 }
 
+func (dd *awsDeploymentDescription) PlanDeleteInstance() (*sdutils.PlanSummary, error) {
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return nil, err
+	}
+	return im.PlanDelete()
+}
+
+func (dd *awsDeploymentDescription) StopInstance() error {
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return im.Stop()
+}
+
+func (dd *awsDeploymentDescription) StartInstance() error {
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return im.Start()
+}
+
 func (dd *awsDeploymentDescription) StatusInstance() error {
 	im, err := NewEc2Instance(dd.ctx, dd)
 	if err != nil {
@@ -272,6 +441,38 @@ func (dd *awsDeploymentDescription) StatusInstance() error {
 	return im.Status()
 }
 
+// EstimateCost prices the deployment with the offline price table.  The
+// volumes and the instance that were already created are priced from their
+// recorded configuration.
+func (dd *awsDeploymentDescription) EstimateCost(sizeOfEachVolume int, clusterSize int, rootVolumeSize int, zookeeperSize int) (*sdutils.CostEstimate, error) {
+	prices, err := loadPriceTable(dd.ctx)
+	if err != nil {
+		return nil, err
+	}
+	vols := NewAwsEbsVolumeManager(dd.ctx, dd)
+	if vols.VolumeExists() {
+		vols, err = LoadEbsVolume(dd.ctx, vols.VolumeDir)
+	} else {
+		err = vols.configure("", sizeOfEachVolume, clusterSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return nil, err
+	}
+	if im.InstanceExists() {
+		err = im.loadRunning()
+	} else {
+		err = im.configure(vols.ClusterSize, rootVolumeSize, zookeeperSize, "", 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return estimateCost(prices, dd.Region, vols, im)
+}
+
 func (dd *awsDeploymentDescription) FullStatus() (*sdutils.StardogDescription, error) {
 	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
 	volumeStatus, err := vm.getStatusInformation()
@@ -290,16 +491,81 @@ func (dd *awsDeploymentDescription) FullStatus() (*sdutils.StardogDescription, e
 
 	sD := sdutils.StardogDescription{
 		SSHHost:             im.BastionContact,
-		StardogURL:          fmt.Sprintf("http://%s:5821", im.StardogContact),
+		StardogURL:          im.stardogURL(),
 		StardogInternalURL:  fmt.Sprintf("http://%s:5821", im.StardogInternalContact),
 		VolumeDescription:   volumeStatus,
 		InstanceDescription: instS,
 		TimeStamp:           time.Now(),
 	}
+	// Each zookeeper node runs a monitor that only answers while the node
+	// is serving requests.
+	for _, zk := range im.ZkNodesContact {
+		sD.ZookeeperHealthURLs = append(sD.ZookeeperHealthURLs, fmt.Sprintf("http://%s:9000/", zk))
+	}
 
 	return &sD, nil
 }
 
+func (dd *awsDeploymentDescription) ZookeeperSize() (int, error) {
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return -1, err
+	}
+	return im.ZookeeperSize()
+}
+
+func (dd *awsDeploymentDescription) ReplaceZookeeperNode(zookeeperSize int, ndx int) error {
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return im.ReplaceZookeeperNode(zookeeperSize, ndx)
+}
+
+// UpdateImage switches the deployment to the AMI given with --ami, or to the
+// one last built for the region, and applies a new launch configuration.
+// Running Stardog nodes keep the old AMI until they are replaced.
+func (dd *awsDeploymentDescription) UpdateImage() error {
+	ami := ""
+	if dd.plugin != nil {
+		ami = dd.plugin.ReimageAmiID
+	}
+	if ami == "" {
+		amiMap, err := loadAmiAmp(dd.ctx)
+		if err != nil {
+			return fmt.Errorf("Could not load the ami map: %s", err)
+		}
+		ami = amiMap[dd.Region]
+		if ami == "" {
+			return fmt.Errorf("No base AMI has been built for %s, please see the 'baseami' subcommand or use --ami", dd.Region)
+		}
+	}
+	err := checkAmiVersion(dd.ctx, dd.Region, ami)
+	if err != nil {
+		return err
+	}
+	if ami == dd.AmiID {
+		dd.ctx.ConsoleLog(1, "The deployment already uses the AMI %s.\n", ami)
+	} else {
+		dd.ctx.ConsoleLog(1, "Moving the deployment from the AMI %s to %s.\n", dd.AmiID, ami)
+	}
+	dd.AmiID = ami
+	err = dd.save()
+	if err != nil {
+		return err
+	}
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return im.UpdateImage()
+}
+
+func (dd *awsDeploymentDescription) ReplaceStardogNode(ndx int) error {
+	asgName := fmt.Sprintf("%ssdasg%d", dd.Name, ndx)
+	return ReplaceAsgInstances(dd.ctx, dd.Region, asgName)
+}
+
 func (dd *awsDeploymentDescription) InstanceExists() bool {
 	im, err := NewEc2Instance(dd.ctx, dd)
 	if err != nil {
@@ -315,6 +581,10 @@ type awsPlugin struct {
 	ZkInstanceType string `json:"zk_instance_type,omitempty"`
 	SdInstanceType string `json:"sd_instance_type,omitempty"`
 	BastionType    string `json:"bastion_instance_type,omitempty"`
+	ReimageAmiID   string `json:"-"`
+	TLSCertArn     string `json:"-"`
+	TLSCert        string `json:"-"`
+	TLSKey         string `json:"-"`
 }
 
 // GetPlugin returns the plugin interface that this module represents.
@@ -349,6 +619,19 @@ func (a *awsPlugin) Register(cmdOpts *sdutils.CommandOpts) error {
 	cmdOpts.LaunchCmd.Flag("zk-instance-type", "The instance type to use for zookeeper VMs").Default(a.ZkInstanceType).StringVar(&a.ZkInstanceType)
 	cmdOpts.LaunchCmd.Flag("sd-instance-type", "The instance type to use for stardog VMs").Default(a.SdInstanceType).StringVar(&a.SdInstanceType)
 	cmdOpts.LaunchCmd.Flag("aws-key-name", "The AWS ssh key name.").Default(a.AwsKeyName).StringVar(&a.AwsKeyName)
+	cmdOpts.LaunchCmd.Flag("tls-cert-arn", "The ARN of an ACM or IAM certificate.  The load balancer will serve Stardog over https with it.").StringVar(&a.TLSCertArn)
+	cmdOpts.LaunchCmd.Flag("tls-cert", "A PEM certificate, followed by any intermediate certificates, to import into ACM and serve Stardog over https with.  Needs --tls-key.").StringVar(&a.TLSCert)
+	cmdOpts.LaunchCmd.Flag("tls-key", "The PEM private key of the certificate given with --tls-cert.").StringVar(&a.TLSKey)
+
+	cmdOpts.LaunchInstanceCmd.Flag("tls-cert-arn", "The ARN of an ACM or IAM certificate.  The load balancer will serve Stardog over https with it.").StringVar(&a.TLSCertArn)
+	cmdOpts.LaunchInstanceCmd.Flag("tls-cert", "A PEM certificate, followed by any intermediate certificates, to import into ACM and serve Stardog over https with.  Needs --tls-key.").StringVar(&a.TLSCert)
+	cmdOpts.LaunchInstanceCmd.Flag("tls-key", "The PEM private key of the certificate given with --tls-cert.").StringVar(&a.TLSKey)
+
+	cmdOpts.ReimageCmd.Flag("ami", "The AMI to move the Stardog nodes to.  The last one built with baseami is used by default.").StringVar(&a.ReimageAmiID)
+
+	cmdOpts.CopyImageCmd.Flag("region", fmt.Sprintf("The aws region holding the AMI to copy [%s].", strings.Join(ValidRegions, " | "))).Default(a.Region).StringVar(&a.Region)
+
+	cmdOpts.ListDeploymentCmd.Flag("region", fmt.Sprintf("The aws region to list deployments for [%s].", strings.Join(ValidRegions, " | "))).Default(a.Region).StringVar(&a.Region)
 
 	cmdOpts.LeaksCmd.Flag("region", fmt.Sprintf("The aws region to use [%s]", strings.Join(ValidRegions, " | "))).Default(a.Region).StringVar(&a.Region)
 
@@ -360,24 +643,56 @@ func (a *awsPlugin) Register(cmdOpts *sdutils.CommandOpts) error {
 	return nil
 }
 
-func (a *awsPlugin) DeploymentLoader(context sdutils.AppContext, baseD *sdutils.BaseDeployment, new bool) (sdutils.Deployment, error) {
-	var err error
-
+// checkEnvironment makes sure that the AWS credentials are set and that
+// terraform can be found.
+func checkEnvironment(context sdutils.AppContext) error {
 	neededEnvs := []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"}
 	for _, e := range neededEnvs {
 		if os.Getenv(e) == "" {
-			return nil, fmt.Errorf("The environment variable %s must be set", e)
+			return fmt.Errorf("The environment variable %s must be set", e)
 		}
 	}
 	terraformOutputVersion := fmt.Sprintf("Terraform v%s", TerraformVersion)
 	terraformURL := fmt.Sprintf("https://releases.hashicorp.com/terraform/%s/terraform_%s_%s_%s.zip", TerraformVersion, TerraformVersion, runtime.GOOS, runtime.GOARCH)
-	err = sdutils.FindProgramVersion(context, "terraform", terraformOutputVersion, terraformURL)
+	err := sdutils.FindProgramVersion(context, "terraform", terraformOutputVersion, terraformURL)
 	if err != nil {
-		return nil, fmt.Errorf("We could not get a proper version of terraform %s", err.Error())
+		return fmt.Errorf("We could not get a proper version of terraform %s", err.Error())
+	}
+	return nil
+}
+
+// PlanDeployment plans a new deployment without creating anything in AWS.
+// The key pair that would be created is reported as a pending add.
+func (a *awsPlugin) PlanDeployment(context sdutils.AppContext, baseD *sdutils.BaseDeployment) (sdutils.Deployment, *sdutils.PlanSummary, error) {
+	err := checkEnvironment(context)
+	if err != nil {
+		return nil, nil, err
+	}
+	dd, err := newAwsDeploymentDescription(context, baseD, a, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	dd.CustomScript = baseD.CustomScript
+	dd.CustomZkScript = baseD.CustomZkScript
+	dd.plugin = a
+	plan := sdutils.NewPlanSummary()
+	if dd.keyPending {
+		context.ConsoleLog(1, "The key pair %s will be created with the deployment.\n", dd.AwsKeyName)
+		plan.Record(sdutils.PlanAdd, "aws_key_pair", 1)
+	}
+	return dd, plan, nil
+}
+
+func (a *awsPlugin) DeploymentLoader(context sdutils.AppContext, baseD *sdutils.BaseDeployment, new bool) (sdutils.Deployment, error) {
+	var err error
+
+	err = checkEnvironment(context)
+	if err != nil {
+		return nil, err
 	}
 
 	if new {
-		awsDD, err := newAwsDeploymentDescription(context, baseD, a)
+		awsDD, err := newAwsDeploymentDescription(context, baseD, a, false)
 		if err != nil {
 			return nil, err
 		}
@@ -411,6 +726,8 @@ func (a *awsPlugin) DeploymentLoader(context sdutils.AppContext, baseD *sdutils.
 	dd.Version = baseD.Version
 	dd.ctx = context
 	dd.deployDir = sdutils.DeploymentDir(context.GetConfigDir(), baseD.Name)
+	dd.CustomScript = baseD.CustomScript
+	dd.CustomZkScript = baseD.CustomZkScript
 	dd.environment = baseD.Environment
 	dd.disableSecurity = baseD.DisableSecurity
 	dd.plugin = a
@@ -422,6 +739,55 @@ func (a *awsPlugin) GetName() string {
 	return "aws"
 }
 
+func (a *awsPlugin) GetRegion() string {
+	return a.Region
+}
+
+func (a *awsPlugin) DeploymentRegion(baseD *sdutils.BaseDeployment) string {
+	data, err := json.Marshal(baseD.CloudOpts)
+	if err != nil {
+		return ""
+	}
+	var dd awsDeploymentDescription
+	err = json.Unmarshal(data, &dd)
+	if err != nil {
+		return ""
+	}
+	return dd.Region
+}
+
+func (a *awsPlugin) DeploymentImage(baseD *sdutils.BaseDeployment) string {
+	data, err := json.Marshal(baseD.CloudOpts)
+	if err != nil {
+		return ""
+	}
+	var dd awsDeploymentDescription
+	err = json.Unmarshal(data, &dd)
+	if err != nil {
+		return ""
+	}
+	return dd.AmiID
+}
+
+func (a *awsPlugin) DeploymentOptions(baseD *sdutils.BaseDeployment) map[string]interface{} {
+	data, err := json.Marshal(baseD.CloudOpts)
+	if err != nil {
+		return nil
+	}
+	var dd awsDeploymentDescription
+	err = json.Unmarshal(data, &dd)
+	if err != nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"region":           dd.Region,
+		"ami_id":           dd.AmiID,
+		"aws_key_name":     dd.AwsKeyName,
+		"zk_instance_type": dd.ZkInstanceType,
+		"sd_instance_type": dd.SdInstanceType,
+	}
+}
+
 func GetGravitonDependencyExe(context sdutils.AppContext, program string) (string, error) {
 	aPath := filepath.Join(context.GetConfigDir(), program)
 	if !sdutils.PathExists(aPath) {
@@ -167,3 +167,77 @@ func TestDeploymentLoadNew(t *testing.T) {
 		t.Fatalf("The deployment should not have failed %s", err)
 	}
 }
+
+func TestPlanNewDeploymentKeyPair(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(confDir)
+	planDir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(planDir)
+	keySave := os.Getenv("AWS_ACCESS_KEY_ID")
+	defer os.Setenv("AWS_ACCESS_KEY_ID", keySave)
+	os.Setenv("AWS_ACCESS_KEY_ID", "gravitontest")
+
+	// Agree to creating a key pair.
+	stdinPath := path.Join(confDir, "stdin")
+	ioutil.WriteFile(stdinPath, []byte("yes\n"), 0600)
+	stdin, err := os.Open(stdinPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	savedStdin := os.Stdin
+	defer func() { os.Stdin = savedStdin }()
+	os.Stdin = stdin
+
+	plugin := &awsPlugin{
+		Region:         "us-west-1",
+		AmiID:          "notreal",
+		ZkInstanceType: "m3.large",
+		SdInstanceType: "m3.large",
+	}
+	app := sdutils.TestContext{ConfigDir: confDir, Version: "4.2"}
+	baseD := sdutils.BaseDeployment{
+		Type:      plugin.GetName(),
+		Name:      "plandep",
+		Directory: planDir,
+		Version:   "4.2",
+	}
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, true)
+	if err != nil {
+		t.Fatalf("Failed to plan the deployment %s", err)
+	}
+	if !dd.keyPending || dd.CreatedKey || dd.AwsKeyName != "plandepkey" {
+		t.Fatalf("The key pair should only be planned %v", dd)
+	}
+	if dd.deployDir != planDir || dd.PrivateKeyPath != path.Join(planDir, "plandepkey") {
+		t.Fatalf("The plan should work in the scratch directory %s %s", dd.deployDir, dd.PrivateKeyPath)
+	}
+	if sdutils.PathExists(sdutils.DeploymentDir(confDir, "plandep")) {
+		t.Fatal("The plan should not write the deployment directory")
+	}
+}
+
+func TestLoadStateIDs(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+
+	ids := make(map[string]bool)
+	err := loadStateIDs(dir, ids)
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("A missing state should be empty %v %s", ids, err)
+	}
+	state := `{"modules": [{"resources": {
+		"aws_elb.stardog": {"type": "aws_elb", "primary": {"id": "sdelb-x"}},
+		"aws_autoscaling_group.stardog": {"type": "aws_autoscaling_group", "primary": {"id": "sdasg-x"}}}}]}`
+	err = ioutil.WriteFile(path.Join(dir, "terraform.tfstate"), []byte(state), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write the state %s", err)
+	}
+	err = loadStateIDs(dir, ids)
+	if err != nil {
+		t.Fatalf("Failed to load the state %s", err)
+	}
+	if len(ids) != 2 || !ids[stateKey("aws_elb", "sdelb-x")] || !ids[stateKey("aws_autoscaling_group", "sdasg-x")] {
+		t.Fatalf("The state ids are wrong %v", ids)
+	}
+}
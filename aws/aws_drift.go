@@ -0,0 +1,167 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stardog-union/stardog-graviton"
+)
+
+// terraformState is the part of a terraform 0.11 state file that is needed
+// to know which cloud resources terraform manages.
+type terraformState struct {
+	Modules []struct {
+		Resources map[string]struct {
+			Type    string `json:"type"`
+			Primary struct {
+				ID string `json:"id"`
+			} `json:"primary"`
+		} `json:"resources"`
+	} `json:"modules"`
+}
+
+// taggedResource is a cloud resource that carries the tag of a deployment.
+// Group is the autoscaling group that launched an instance.
+type taggedResource struct {
+	Type  string
+	ID    string
+	Group string
+}
+
+func stateKey(resourceType string, id string) string {
+	return fmt.Sprintf("%s %s", resourceType, id)
+}
+
+// loadStateIDs adds the type and id of every resource in the terraform state
+// of workingDir to ids.
+func loadStateIDs(workingDir string, ids map[string]bool) error {
+	statePath := path.Join(workingDir, "terraform.tfstate")
+	if !sdutils.PathExists(statePath) {
+		return nil
+	}
+	var state terraformState
+	err := sdutils.LoadJSON(&state, statePath)
+	if err != nil {
+		return err
+	}
+	for _, m := range state.Modules {
+		for _, r := range m.Resources {
+			ids[stateKey(r.Type, r.Primary.ID)] = true
+		}
+	}
+	return nil
+}
+
+// findTaggedResources finds the resources of the deployment the same way
+// that FindLeaks does.
+func findTaggedResources(c sdutils.AppContext, region string, deploymentName string) ([]taggedResource, error) {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "gravitontest" {
+		return nil, nil
+	}
+	conf := aws.Config{Region: aws.String(region)}
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	possibleDeployNames := map[string]bool{deploymentName: true}
+
+	resources := []taggedResource{}
+	lcList, asgList := getAsgLc(c, sess, &conf, deploymentName, &possibleDeployNames)
+	for _, asg := range asgList {
+		resources = append(resources, taggedResource{Type: "aws_autoscaling_group", ID: *asg.AutoScalingGroupName})
+	}
+	for _, lc := range lcList {
+		resources = append(resources, taggedResource{Type: "aws_launch_configuration", ID: *lc.LaunchConfigurationName})
+	}
+	for _, inst := range getInstances(c, sess, &conf, deploymentName, &possibleDeployNames) {
+		r := taggedResource{Type: "aws_instance", ID: *inst.InstanceId}
+		for _, t := range inst.Tags {
+			if t.Key != nil && *t.Key == "aws:autoscaling:groupName" && t.Value != nil {
+				r.Group = *t.Value
+			}
+		}
+		resources = append(resources, r)
+	}
+	for _, sg := range getSecurityGroups(c, sess, &conf, deploymentName, &possibleDeployNames) {
+		resources = append(resources, taggedResource{Type: "aws_security_group", ID: *sg.GroupId})
+	}
+	for _, e := range getElbs(c, sess, &conf, deploymentName) {
+		resources = append(resources, taggedResource{Type: "aws_elb", ID: *e.LoadBalancerName})
+	}
+	return resources, nil
+}
+
+// Drift runs terraform plan -detailed-exitcode in the volumes and instance
+// workspaces and then looks for tagged resources that are in neither
+// terraform state.  Instances launched by a known autoscaling group are
+// expected.
+func (dd *awsDeploymentDescription) Drift() ([]sdutils.DriftItem, error) {
+	items := []sdutils.DriftItem{}
+	ids := make(map[string]bool)
+
+	vm := NewAwsEbsVolumeManager(dd.ctx, dd)
+	if vm.VolumeExists() {
+		results, err := runTerraformPlan(dd.ctx, vm.VolumeDir, "config.json", nil, "Comparing the volumes with terraform", nil, "-detailed-exitcode")
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, sdutils.DriftFromPlan("volumes", results)...)
+		err = loadStateIDs(vm.VolumeDir, ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+	im, err := NewEc2Instance(dd.ctx, dd)
+	if err != nil {
+		return nil, err
+	}
+	if im.InstanceExists() {
+		instanceWorkingDir := path.Join(dd.deployDir, "etc", "terraform", "instance")
+		results, err := runTerraformPlan(dd.ctx, instanceWorkingDir, "instance.json", nil, "Comparing the instance with terraform", nil, "-detailed-exitcode")
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, sdutils.DriftFromPlan("instance", results)...)
+		err = loadStateIDs(instanceWorkingDir, ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tagged, err := findTaggedResources(dd.ctx, dd.Region, dd.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range tagged {
+		if r.Group != "" && ids[stateKey("aws_autoscaling_group", r.Group)] {
+			continue
+		}
+		if !ids[stateKey(r.Type, r.ID)] {
+			items = append(items, sdutils.DriftItem{
+				Kind:     sdutils.DriftExtra,
+				Source:   "cloud",
+				Resource: stateKey(r.Type, r.ID),
+				Detail:   "tagged for the deployment but not in the terraform state",
+			})
+		}
+	}
+	return items, nil
+}
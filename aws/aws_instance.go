@@ -27,6 +27,9 @@ import (
 	"strings"
 	"strconv"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/stardog-union/stardog-graviton"
 	"errors"
 )
@@ -51,8 +54,11 @@ type Ec2Instance struct {
 	StartOpts              string             `json:"stardog_start_opts,omitempty"`
 	RootVolumeSize         int                `json:"root_volume_size"`
 	RootVolumeIops         int                `json:"root_volume_iops,omitempty"`
+	StardogCapacity        string             `json:"stardog_capacity,omitempty"`
 	CustomScript           string             `json:"custom_script,omitempty"`
 	CustomZkScript         string             `json:"custom_zk_script,omitempty"`
+	ExternalProtocol       string             `json:"external_protocol,omitempty"`
+	SSLCertArn             string             `json:"ssl_cert_arn,omitempty"`
 	DeployDir              string             `json:"-"`
 	Ctx                    sdutils.AppContext `json:"-"`
 	BastionContact         string             `json:"-"`
@@ -142,6 +148,10 @@ func NewEc2Instance(ctx sdutils.AppContext, dd *awsDeploymentDescription) (*Ec2I
 	if dd.disableSecurity {
 		instance.StartOpts = "--disable-security"
 	}
+	if dd.TLSCertArn != "" || dd.tlsPending {
+		instance.ExternalProtocol = "https"
+		instance.SSLCertArn = dd.TLSCertArn
+	}
 	return &instance, nil
 }
 
@@ -179,36 +189,40 @@ func (awsI *Ec2Instance) runTerraformInit() error {
 	return nil
 }
 
-func (awsI *Ec2Instance) runTerraformApply(volumeSize int, zookeeperSize int, mask string, idleTimeout int, message string) error {
+// configure sets the values that are written to instance.json.
+func (awsI *Ec2Instance) configure(clusterSize string, volumeSize int, zookeeperSize int, mask string, idleTimeout int) error {
 	awsI.ZkSize = fmt.Sprintf("%d", zookeeperSize)
 	awsI.ELBIdleTimeout = fmt.Sprintf("%d", idleTimeout)
-
-	vol, err := LoadEbsVolume(awsI.Ctx, path.Join(awsI.DeployDir, "etc", "terraform", "volumes"))
-	if err != nil {
-		return err
-	}
-
-	awsI.SdSize = vol.ClusterSize
+	awsI.SdSize = clusterSize
 	awsI.HTTPMask = mask
 	awsI.RootVolumeSize = volumeSize
 
 	envVolType := os.Getenv("TF_VAR_root_volume_type")
 	if envVolType != "" && envVolType != "io1" {
 		awsI.RootVolumeIops = 0
-	} else {
-		envVolIops := os.Getenv("TF_VAR_root_volume_iops")
-		var iops int
-
-		if envVolIops != "" {
-			iops, err = strconv.Atoi(envVolIops)
-			if err != nil {
-				return err
-			}
-		} else {
-			iops = volumeSize * sdutils.GetMaxIopsRatio()
+		return nil
+	}
+	envVolIops := os.Getenv("TF_VAR_root_volume_iops")
+	iops := volumeSize * sdutils.GetMaxIopsRatio()
+	if envVolIops != "" {
+		var err error
+		iops, err = strconv.Atoi(envVolIops)
+		if err != nil {
+			return err
 		}
+	}
+	awsI.RootVolumeIops = iops
+	return nil
+}
 
-		awsI.RootVolumeIops = iops
+func (awsI *Ec2Instance) runTerraformApply(volumeSize int, zookeeperSize int, mask string, idleTimeout int, message string) error {
+	vol, err := LoadEbsVolume(awsI.Ctx, path.Join(awsI.DeployDir, "etc", "terraform", "volumes"))
+	if err != nil {
+		return err
+	}
+	err = awsI.configure(vol.ClusterSize, volumeSize, zookeeperSize, mask, idleTimeout)
+	if err != nil {
+		return err
 	}
 
 	instanceWorkingDir := path.Join(awsI.DeployDir, "etc", "terraform", "instance")
@@ -217,7 +231,13 @@ func (awsI *Ec2Instance) runTerraformApply(volumeSize int, zookeeperSize int, ma
 		awsI.Ctx.ConsoleLog(1, "The instance already exists.\n")
 		awsI.Ctx.Logf(sdutils.INFO, "The instance already exists.")
 	}
-	err = sdutils.WriteJSON(awsI, instanceConfPath)
+	return awsI.applyConfig(message)
+}
+
+func (awsI *Ec2Instance) applyConfig(message string, opts ...string) error {
+	instanceWorkingDir := path.Join(awsI.DeployDir, "etc", "terraform", "instance")
+	instanceConfPath := path.Join(instanceWorkingDir, "instance.json")
+	err := sdutils.WriteJSON(awsI, instanceConfPath)
 	if err != nil {
 		return err
 	}
@@ -229,6 +249,7 @@ func (awsI *Ec2Instance) runTerraformApply(volumeSize int, zookeeperSize int, ma
 
 	cmdArray := []string{terraformPath, "apply", "-input=false", "-auto-approve", "-var-file",
 		instanceConfPath}
+	cmdArray = append(cmdArray, opts...)
 	cmd := exec.Cmd{
 		Path: cmdArray[0],
 		Args: cmdArray,
@@ -267,6 +288,176 @@ func (awsI *Ec2Instance) CreateInstance(volumeSize int, zookeeperSize int, idleT
 	return nil
 }
 
+// PlanInstance reports what CreateInstance would do for a cluster of
+// clusterSize Stardog nodes.
+func (awsI *Ec2Instance) PlanInstance(clusterSize int, volumeSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) (*sdutils.PlanSummary, error) {
+	err := awsI.configure(fmt.Sprintf("%d", clusterSize), volumeSize, zookeeperSize, "0.0.0.0/32", idleTimeout)
+	if err != nil {
+		return nil, err
+	}
+	var addBastionVolume func(planDir string) error
+	if bastionVolSnapshotId != "" {
+		bastionVolData, err := Asset("etc/extras/bastion_volume.tf")
+		if err != nil {
+			return nil, err
+		}
+		addBastionVolume = func(planDir string) error {
+			return sdutils.WriteFile(path.Join(planDir, "bastion_volume.tf"), fmt.Sprintf(string(bastionVolData), bastionVolSnapshotId, awsI.PrivateKey))
+		}
+	}
+	instanceWorkingDir := path.Join(awsI.DeployDir, "etc", "terraform", "instance")
+	return planTerraform(awsI.Ctx, instanceWorkingDir, "instance.json", awsI, "Planning the instance VMs...", addBastionVolume)
+}
+
+// PlanDelete reports what DeleteInstance would destroy.
+func (awsI *Ec2Instance) PlanDelete() (*sdutils.PlanSummary, error) {
+	if !awsI.InstanceExists() {
+		return nil, errors.New("There is no configured instance")
+	}
+	instanceWorkingDir := path.Join(awsI.DeployDir, "etc", "terraform", "instance")
+	return planTerraform(awsI.Ctx, instanceWorkingDir, "instance.json", nil, "Planning the deletion of the instance VMs...", nil, "-destroy")
+}
+
+// Resize changes the number of Stardog autoscaling groups in the running
+// instance.  Everything else is kept as it was last applied.
+func (awsI *Ec2Instance) Resize(clusterSize int) error {
+	err := awsI.loadRunning()
+	if err != nil {
+		return err
+	}
+	awsI.SdSize = fmt.Sprintf("%d", clusterSize)
+	err = awsI.applyConfig("Resizing the Stardog nodes...")
+	if err != nil {
+		awsI.Ctx.ConsoleLog(1, "Failed to resize the instance.\n")
+		return err
+	}
+	awsI.Ctx.ConsoleLog(1, "Successfully resized the instance.\n")
+	return nil
+}
+
+// loadRunning copies the settings that were last applied to the instance so
+// that a targeted change does not alter anything else.
+func (awsI *Ec2Instance) loadRunning() error {
+	instanceConfPath := path.Join(awsI.DeployDir, "etc", "terraform", "instance", "instance.json")
+	if !sdutils.PathExists(instanceConfPath) {
+		return errors.New("There is no configured instance")
+	}
+	var running Ec2Instance
+	err := sdutils.LoadJSON(&running, instanceConfPath)
+	if err != nil {
+		return err
+	}
+	awsI.ZkSize = running.ZkSize
+	awsI.SdSize = running.SdSize
+	awsI.ELBIdleTimeout = running.ELBIdleTimeout
+	awsI.HTTPMask = running.HTTPMask
+	awsI.RootVolumeSize = running.RootVolumeSize
+	awsI.RootVolumeIops = running.RootVolumeIops
+	awsI.StardogCapacity = running.StardogCapacity
+	return nil
+}
+
+// ZookeeperSize returns the number of zookeeper nodes last applied.
+func (awsI *Ec2Instance) ZookeeperSize() (int, error) {
+	err := awsI.loadRunning()
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(awsI.ZkSize)
+}
+
+// restoreLifecycleRules rewrites the terraform files that carry the lifecycle
+// rules needed for a rolling replacement and the capacity used to stop the
+// Stardog nodes.  Deployments made by older versions do not have them.
+func (awsI *Ec2Instance) restoreLifecycleRules() error {
+	instanceWorkingDir := path.Join(awsI.DeployDir, "etc", "terraform", "instance")
+	for _, f := range []string{"zookeeper.tf", "stardog.tf", "bastion.tf", "variables.tf"} {
+		data, err := Asset(path.Join("etc", "terraform", "instance", f))
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(path.Join(instanceWorkingDir, f), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateImage applies a launch configuration that uses the current AMI to the
+// Stardog autoscaling groups.  The running Stardog nodes, the zookeeper nodes
+// and the bastion node are not touched.
+func (awsI *Ec2Instance) UpdateImage() error {
+	err := awsI.loadRunning()
+	if err != nil {
+		return err
+	}
+	err = awsI.restoreLifecycleRules()
+	if err != nil {
+		return err
+	}
+	err = awsI.applyConfig("Applying the new launch configuration...", "-target", "aws_autoscaling_group.stardog")
+	if err != nil {
+		awsI.Ctx.ConsoleLog(1, "Failed to apply the new launch configuration.\n")
+		return err
+	}
+	awsI.Ctx.ConsoleLog(1, "Successfully applied the new launch configuration.\n")
+	return nil
+}
+
+// ReplaceZookeeperNode recreates the zookeeper VM at index ndx for an ensemble
+// of zookeeperSize nodes, or destroys it if ndx is outside of the new
+// ensemble.  Only that VM and the Stardog launch configuration are applied so
+// the rest of the ensemble keeps its quorum.  Running Stardog nodes pick up
+// the new connection string when they are replaced, which ResizeZookeeper
+// does once the ensemble is complete.
+func (awsI *Ec2Instance) ReplaceZookeeperNode(zookeeperSize int, ndx int) error {
+	err := awsI.loadRunning()
+	if err != nil {
+		return err
+	}
+	current, err := strconv.Atoi(awsI.ZkSize)
+	if err != nil {
+		return err
+	}
+	instanceWorkingDir := path.Join(awsI.DeployDir, "etc", "terraform", "instance")
+	err = awsI.restoreLifecycleRules()
+	if err != nil {
+		return err
+	}
+	terraformPath, err := GetTerraformPath(awsI.Ctx)
+	if err != nil {
+		return err
+	}
+	resource := fmt.Sprintf("aws_instance.zookeeper.%d", ndx)
+	if ndx < current && ndx < zookeeperSize {
+		cmdArray := []string{terraformPath, "taint", resource}
+		cmd := exec.Cmd{
+			Path: cmdArray[0],
+			Args: cmdArray,
+			Dir:  instanceWorkingDir,
+		}
+		spin := sdutils.NewSpinner(awsI.Ctx, 1, fmt.Sprintf("Marking zookeeper node %d for replacement", ndx))
+		_, err = sdutils.RunCommand(awsI.Ctx, cmd, nil, spin)
+		if err != nil {
+			return err
+		}
+	}
+	target := fmt.Sprintf("aws_instance.zookeeper[%d]", ndx)
+	if ndx >= zookeeperSize {
+		target = "aws_instance.zookeeper"
+	}
+	awsI.ZkSize = fmt.Sprintf("%d", zookeeperSize)
+	err = awsI.applyConfig(fmt.Sprintf("Replacing zookeeper node %d...", ndx),
+		"-target", target, "-target", "aws_subnet.zk", "-target", "aws_autoscaling_group.stardog")
+	if err != nil {
+		awsI.Ctx.ConsoleLog(1, "Failed to replace the zookeeper node.\n")
+		return err
+	}
+	awsI.Ctx.ConsoleLog(1, "Successfully replaced zookeeper node %d.\n", ndx)
+	return nil
+}
+
 // OpenInstance will open the firewall to allow incoming traffic to port 5821 from
 // the give CIDR.
 func (awsI *Ec2Instance) OpenInstance(volumeSize int, zookeeperSize int, mask string, idleTimeout int) error {
@@ -279,6 +470,117 @@ func (awsI *Ec2Instance) OpenInstance(volumeSize int, zookeeperSize int, mask st
 	return nil
 }
 
+// zookeeperInstanceIDs returns the ids of the zookeeper nodes recorded in the
+// terraform state.
+func (awsI *Ec2Instance) zookeeperInstanceIDs() ([]*string, error) {
+	statePath := path.Join(awsI.DeployDir, "etc", "terraform", "instance", "terraform.tfstate")
+	var state terraformState
+	err := sdutils.LoadJSON(&state, statePath)
+	if err != nil {
+		return nil, err
+	}
+	ids := []*string{}
+	for _, m := range state.Modules {
+		for address, r := range m.Resources {
+			if strings.HasPrefix(address, "aws_instance.zookeeper") && r.Primary.ID != "" {
+				ids = append(ids, aws.String(r.Primary.ID))
+			}
+		}
+	}
+	return ids, nil
+}
+
+// zookeeperService returns an ec2 client for the region of the instance and
+// the ids of the zookeeper nodes.  The client is nil in test mode.
+func (awsI *Ec2Instance) zookeeperService() (*ec2.EC2, []*string, error) {
+	ids, err := awsI.zookeeperInstanceIDs()
+	if err != nil {
+		return nil, nil, err
+	}
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "gravitontest" || len(ids) == 0 {
+		return nil, ids, nil
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ec2.New(sess, &aws.Config{Region: aws.String(awsI.Region)}), ids, nil
+}
+
+// Stop scales the Stardog autoscaling groups to zero and then stops the
+// zookeeper nodes.  The data volumes and the terraform state are kept.
+func (awsI *Ec2Instance) Stop() error {
+	err := awsI.loadRunning()
+	if err != nil {
+		return err
+	}
+	err = awsI.restoreLifecycleRules()
+	if err != nil {
+		return err
+	}
+	awsI.StardogCapacity = "0"
+	err = awsI.applyConfig("Stopping the Stardog nodes...")
+	if err != nil {
+		awsI.Ctx.ConsoleLog(1, "Failed to stop the Stardog nodes.\n")
+		return err
+	}
+	svc, ids, err := awsI.zookeeperService()
+	if err != nil {
+		return err
+	}
+	if svc != nil {
+		spin := sdutils.NewSpinner(awsI.Ctx, 1, "Stopping the zookeeper nodes")
+		_, err = svc.StopInstances(&ec2.StopInstancesInput{InstanceIds: ids})
+		if err == nil {
+			err = svc.WaitUntilInstanceStopped(&ec2.DescribeInstancesInput{InstanceIds: ids})
+		}
+		spin.Close()
+		if err != nil {
+			awsI.Ctx.ConsoleLog(1, "Failed to stop the zookeeper nodes.\n")
+			return err
+		}
+	}
+	awsI.Ctx.ConsoleLog(1, "Successfully stopped the instance.\n")
+	return nil
+}
+
+// Start starts the zookeeper nodes and then brings the Stardog autoscaling
+// groups back to one node each.
+func (awsI *Ec2Instance) Start() error {
+	err := awsI.loadRunning()
+	if err != nil {
+		return err
+	}
+	err = awsI.restoreLifecycleRules()
+	if err != nil {
+		return err
+	}
+	svc, ids, err := awsI.zookeeperService()
+	if err != nil {
+		return err
+	}
+	if svc != nil {
+		spin := sdutils.NewSpinner(awsI.Ctx, 1, "Starting the zookeeper nodes")
+		_, err = svc.StartInstances(&ec2.StartInstancesInput{InstanceIds: ids})
+		if err == nil {
+			err = svc.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{InstanceIds: ids})
+		}
+		spin.Close()
+		if err != nil {
+			awsI.Ctx.ConsoleLog(1, "Failed to start the zookeeper nodes.\n")
+			return err
+		}
+	}
+	awsI.StardogCapacity = ""
+	err = awsI.applyConfig("Starting the Stardog nodes...")
+	if err != nil {
+		awsI.Ctx.ConsoleLog(1, "Failed to start the Stardog nodes.\n")
+		return err
+	}
+	awsI.Ctx.ConsoleLog(1, "Successfully started the instance.\n")
+	return nil
+}
+
 // DeleteInstance will teardown the Stardog service.
 func (awsI *Ec2Instance) DeleteInstance() error {
 	instanceWorkingDir := path.Join(awsI.DeployDir, "etc", "terraform", "instance")
@@ -367,14 +669,30 @@ func getInstanceValues(awsI *Ec2Instance) (*InstanceStatusDescription, error) {
 	return &s, nil
 }
 
+// stardogURL returns the URL of the external load balancer.  It uses https
+// when the load balancer terminates TLS.
+func (awsI *Ec2Instance) stardogURL() string {
+	protocol := "http"
+	if awsI.ExternalProtocol == "https" {
+		protocol = "https"
+	}
+	return fmt.Sprintf("%s://%s:5821", protocol, awsI.StardogContact)
+}
+
 // Status will print the status of the ec2 instance.
 func (awsI *Ec2Instance) Status() error {
-	_, err := getInstanceValues(awsI)
+	s, err := getInstanceValues(awsI)
 	if err != nil {
 		return err
 	}
+	awsI.Ctx.SetResult(&sdutils.StardogDescription{
+		StardogURL:          awsI.stardogURL(),
+		StardogInternalURL:  fmt.Sprintf("http://%s:5821", awsI.StardogInternalContact),
+		SSHHost:             awsI.BastionContact,
+		InstanceDescription: s,
+	})
 
-	awsI.Ctx.ConsoleLog(1, "Stardog: %s\n", fmt.Sprintf("http://%s:5821", awsI.StardogContact))
+	awsI.Ctx.ConsoleLog(1, "Stardog: %s\n", awsI.stardogURL())
 	awsI.Ctx.ConsoleLog(1, "SSH: %s\n", awsI.BastionContact)
 	return nil
 }
@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/stardog-union/stardog-graviton"
@@ -57,7 +58,7 @@ func TestInstanceNotThere(t *testing.T) {
 		Version:    version,
 		PrivateKey: sshKeyFile,
 	}
-	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin)
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, false)
 	if err != nil {
 		t.Fatalf("Failed to make the deployment manager %s", err)
 	}
@@ -116,7 +117,7 @@ func TestInstanceFakeTerraform(t *testing.T) {
 		Version:    version,
 		PrivateKey: sshKeyFile,
 	}
-	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin)
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, false)
 	if err != nil {
 		t.Fatalf("Failed to make the deployment manager %s", err)
 	}
@@ -181,6 +182,38 @@ func TestInstanceFakeTerraform(t *testing.T) {
 	if err != nil {
 		t.Fatalf("The instance should exist for status %s", err)
 	}
+
+	instanceWorkingDir := path.Join(inst.DeployDir, "etc", "terraform", "instance")
+	state := `{"modules": [{"resources": {
+        "aws_instance.zookeeper.0": {"type": "aws_instance", "primary": {"id": "i-zk0"}},
+        "aws_elb.stardog": {"type": "aws_elb", "primary": {"id": "sdelb"}}}}]}`
+	err = ioutil.WriteFile(path.Join(instanceWorkingDir, "terraform.tfstate"), []byte(state), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write the state %s", err)
+	}
+	ids, err := inst.zookeeperInstanceIDs()
+	if err != nil || len(ids) != 1 || *ids[0] != "i-zk0" {
+		t.Fatalf("Only the zookeeper node should be found %v %s", ids, err)
+	}
+	err = inst.Stop()
+	if err != nil {
+		t.Fatalf("The instance should stop %s", err)
+	}
+	stopped := Ec2Instance{}
+	err = sdutils.LoadJSON(&stopped, path.Join(instanceWorkingDir, "instance.json"))
+	if err != nil || stopped.StardogCapacity != "0" {
+		t.Fatalf("The Stardog nodes should be scaled to zero %v %s", stopped.StardogCapacity, err)
+	}
+	err = inst.Start()
+	if err != nil {
+		t.Fatalf("The instance should start %s", err)
+	}
+	started := Ec2Instance{}
+	err = sdutils.LoadJSON(&started, path.Join(instanceWorkingDir, "instance.json"))
+	if err != nil || started.StardogCapacity != "" {
+		t.Fatalf("The Stardog nodes should use the default capacity %v %s", started.StardogCapacity, err)
+	}
+
 	err = inst.DeleteInstance()
 	if err != nil {
 		t.Fatalf("The instance should exist for deletion %s", err)
@@ -219,7 +252,7 @@ func TestInstanceFakeTerraformThroughDeployment(t *testing.T) {
 		Version:    version,
 		PrivateKey: sshKeyFile,
 	}
-	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin)
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, false)
 	if err != nil {
 		t.Fatalf("Failed to make the deployment manager %s", err)
 	}
@@ -293,6 +326,93 @@ func TestInstanceFakeTerraformThroughDeployment(t *testing.T) {
 	}
 }
 
+func TestInstanceReimage(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	sshKeyFile := path.Join(dir, "keyfile")
+	ioutil.WriteFile(sshKeyFile, []byte("xxx"), 0600)
+	keySave := os.Getenv("AWS_ACCESS_KEY_ID")
+	defer os.Setenv("AWS_ACCESS_KEY_ID", keySave)
+	os.Setenv("AWS_ACCESS_KEY_ID", "gravitontest")
+
+	version := "4.2"
+	app := sdutils.TestContext{
+		ConfigDir: dir,
+		Version:   version,
+	}
+	plugin := &awsPlugin{
+		Region:         "us-west-1",
+		AmiID:          "ami-old",
+		AwsKeyName:     "somekey",
+		ZkInstanceType: "m3.large",
+		SdInstanceType: "m3.large",
+	}
+	baseD := sdutils.BaseDeployment{
+		Type:       plugin.GetName(),
+		Name:       "testdep",
+		Directory:  dir,
+		Version:    version,
+		PrivateKey: sshKeyFile,
+	}
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, false)
+	if err != nil {
+		t.Fatalf("Failed to make the deployment manager %s", err)
+	}
+	dd.plugin = plugin
+	baseD.CloudOpts = dd
+	err = sdutils.WriteJSON(&baseD, path.Join(dd.deployDir, "config.json"))
+	if err != nil {
+		t.Fatalf("Failed to write the config %s", err)
+	}
+
+	startPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", startPath)
+	exedir, _, err := MakeTestTerraform(0, "{}", dir)
+	if err != nil {
+		t.Fatalf("Failed to write the file %s", err)
+	}
+	os.Setenv("PATH", fmt.Sprintf("%s:%s", exedir, startPath))
+
+	ebs := NewAwsEbsVolumeManager(&app, dd)
+	err = ebs.CreateSet("/path/", 1, 3)
+	if err != nil {
+		t.Fatal("The create should have worked")
+	}
+	err = dd.CreateInstance(8, 1, 60, "")
+	if err != nil {
+		t.Fatalf("The instance should have been created %s", err)
+	}
+
+	err = dd.UpdateImage()
+	if err == nil {
+		t.Fatal("There is no AMI for the region")
+	}
+	plugin.ReimageAmiID = "ami-new"
+	err = dd.UpdateImage()
+	if err != nil {
+		t.Fatalf("The image should have been updated %s", err)
+	}
+	params, _ := ioutil.ReadFile(path.Join(exedir, "params"))
+	if !strings.Contains(string(params), "-target aws_autoscaling_group.stardog") {
+		t.Fatalf("Only the Stardog nodes should be applied %s", string(params))
+	}
+	var inst Ec2Instance
+	sdutils.LoadJSON(&inst, path.Join(dd.deployDir, "etc", "terraform", "instance", "instance.json"))
+	if inst.AmiID != "ami-new" {
+		t.Fatalf("The new AMI was not applied %s", inst.AmiID)
+	}
+	var saved sdutils.BaseDeployment
+	saved.CloudOpts = &awsDeploymentDescription{}
+	sdutils.LoadJSON(&saved, path.Join(dd.deployDir, "config.json"))
+	if saved.CloudOpts.(*awsDeploymentDescription).AmiID != "ami-new" {
+		t.Fatal("The new AMI was not saved")
+	}
+	err = dd.ReplaceStardogNode(0)
+	if err != nil {
+		t.Fatalf("The node should have been replaced %s", err)
+	}
+}
+
 func TestInstanceNotThereThroughDd(t *testing.T) {
 	dir, _ := ioutil.TempDir("", "stardogtest")
 	defer os.RemoveAll(dir)
@@ -325,7 +445,7 @@ func TestInstanceNotThereThroughDd(t *testing.T) {
 		Version:    version,
 		PrivateKey: sshKeyFile,
 	}
-	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin)
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, false)
 	if err != nil {
 		t.Fatalf("Failed to make the deployment manager %s", err)
 	}
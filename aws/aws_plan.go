@@ -0,0 +1,147 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+// copyPlanDir copies the terraform files and state of workingDir into
+// planDir.  The providers that were already initialized are linked rather
+// than copied.
+func copyPlanDir(workingDir string, planDir string) error {
+	entries, err := ioutil.ReadDir(workingDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		src := path.Join(workingDir, e.Name())
+		dst := path.Join(planDir, e.Name())
+		if e.IsDir() {
+			if e.Name() == ".terraform" {
+				err = os.Symlink(src, dst)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		err = sdutils.CopyFile(src, dst)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runTerraformPlan runs terraform plan against a copy of workingDir so that
+// neither the deployment files nor the terraform state are touched.  When
+// vars is nil the varFile already in workingDir is used, otherwise vars is
+// written to it in the copy.  edit may change the copied files before the
+// plan is made.  Terraform 0.11 cannot write a plan as JSON so the resource
+// lines of the plain text output are returned as parsed by
+// TerraformPlanScanner.  With -detailed-exitcode the exit status 2, which
+// means that there are changes, is not an error.
+func runTerraformPlan(c sdutils.AppContext, workingDir string, varFile string, vars interface{}, message string, edit func(planDir string) error, opts ...string) ([]sdutils.ScanResult, error) {
+	terraformPath, err := GetTerraformPath(c)
+	if err != nil {
+		return nil, err
+	}
+	planDir, err := ioutil.TempDir("", "graviton-plan")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(planDir)
+
+	err = copyPlanDir(workingDir, planDir)
+	if err != nil {
+		return nil, err
+	}
+	planVarFile := path.Join(planDir, varFile)
+	if vars != nil {
+		err = sdutils.WriteJSON(vars, planVarFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if edit != nil {
+		err = edit(planDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !sdutils.PathExists(path.Join(planDir, ".terraform")) {
+		cmdInitArray := []string{terraformPath, "init", "-input=false"}
+		cmdInit := exec.Cmd{
+			Path: cmdInitArray[0],
+			Args: cmdInitArray,
+			Dir:  planDir,
+		}
+		spin := sdutils.NewSpinner(c, 1, "Initializing terraform...")
+		_, err = sdutils.RunCommand(c, cmdInit, nil, spin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cmdArray := []string{terraformPath, "plan", "-input=false", "-no-color", "-lock=false",
+		"-var-file", planVarFile}
+	cmdArray = append(cmdArray, opts...)
+	cmd := exec.Cmd{
+		Path: cmdArray[0],
+		Args: cmdArray,
+		Dir:  planDir,
+	}
+	// RunCommand drops the results when the program fails so they are
+	// collected here instead.
+	results := []sdutils.ScanResult{}
+	scanner := func(cliContext sdutils.AppContext, line string) *sdutils.ScanResult {
+		r := sdutils.TerraformPlanScanner(cliContext, line)
+		if r != nil {
+			results = append(results, *r)
+		}
+		return r
+	}
+	spin := sdutils.NewSpinner(c, 1, message)
+	_, err = sdutils.RunCommand(c, cmd, scanner, spin)
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+		for _, o := range opts {
+			if o == "-detailed-exitcode" {
+				return results, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// planTerraform counts the resources that terraform plan would touch by
+// resource type.  The arguments are those of runTerraformPlan.
+func planTerraform(c sdutils.AppContext, workingDir string, varFile string, vars interface{}, message string, edit func(planDir string) error, opts ...string) (*sdutils.PlanSummary, error) {
+	results, err := runTerraformPlan(c, workingDir, varFile, vars, message, edit, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sdutils.NewTerraformPlanSummary(&results), nil
+}
@@ -0,0 +1,216 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+// ebsPrice is the monthly price of a volume type per gigabyte and, for
+// provisioned IOPS volumes, per IOPS.
+type ebsPrice struct {
+	GBMonth   float64 `json:"gb_month"`
+	IopsMonth float64 `json:"iops_month,omitempty"`
+}
+
+// regionPrices holds the on demand prices of a region.  EC2 maps instance
+// types to their hourly price and EBS maps volume types to their price.
+type regionPrices struct {
+	EC2     map[string]float64  `json:"ec2,omitempty"`
+	EBS     map[string]ebsPrice `json:"ebs,omitempty"`
+	ELBHour float64             `json:"elb_hour,omitempty"`
+}
+
+// priceTable is the offline price list used to estimate the cost of a
+// deployment.  The table compiled into graviton can be overridden entry by
+// entry with the file aws-pricing.json in the configuration directory.
+type priceTable struct {
+	Currency string                   `json:"currency,omitempty"`
+	Regions  map[string]*regionPrices `json:"regions,omitempty"`
+}
+
+func pricingFileName(c sdutils.AppContext) string {
+	return path.Join(c.GetConfigDir(), "aws-pricing.json")
+}
+
+func loadPriceTable(c sdutils.AppContext) (*priceTable, error) {
+	data, err := Asset("etc/pricing.json")
+	if err != nil {
+		return nil, err
+	}
+	var prices priceTable
+	err = json.Unmarshal(data, &prices)
+	if err != nil {
+		return nil, err
+	}
+	overrideFile := pricingFileName(c)
+	if !sdutils.PathExists(overrideFile) {
+		return &prices, nil
+	}
+	c.Logf(sdutils.DEBUG, "Loading the prices in %s", overrideFile)
+	var override priceTable
+	err = sdutils.LoadJSON(&override, overrideFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the prices in %s: %s", overrideFile, err)
+	}
+	prices.merge(&override)
+	return &prices, nil
+}
+
+// merge replaces the prices of p with the ones set in other.
+func (p *priceTable) merge(other *priceTable) {
+	if other.Currency != "" {
+		p.Currency = other.Currency
+	}
+	if p.Regions == nil {
+		p.Regions = make(map[string]*regionPrices)
+	}
+	for name, o := range other.Regions {
+		r, ok := p.Regions[name]
+		if !ok {
+			r = &regionPrices{}
+			p.Regions[name] = r
+		}
+		if r.EC2 == nil {
+			r.EC2 = make(map[string]float64)
+		}
+		for t, price := range o.EC2 {
+			r.EC2[t] = price
+		}
+		if r.EBS == nil {
+			r.EBS = make(map[string]ebsPrice)
+		}
+		for t, price := range o.EBS {
+			r.EBS[t] = price
+		}
+		if o.ELBHour > 0 {
+			r.ELBHour = o.ELBHour
+		}
+	}
+}
+
+// terraformVar returns the value of a terraform variable that can be
+// overridden in the environment.
+func terraformVar(name string, defaultValue string) string {
+	v := os.Getenv(fmt.Sprintf("TF_VAR_%s", name))
+	if v == "" {
+		return defaultValue
+	}
+	return v
+}
+
+func (r *regionPrices) addInstances(e *sdutils.CostEstimate, resource string, instanceType string, count int) error {
+	price, ok := r.EC2[instanceType]
+	if !ok {
+		return fmt.Errorf("There is no price for the instance type %s in %s", instanceType, e.Region)
+	}
+	e.AddHourly(resource, instanceType, count, price)
+	return nil
+}
+
+func (r *regionPrices) addVolumes(e *sdutils.CostEstimate, resource string, volumeType string, size string, iops string, count int) error {
+	price, ok := r.EBS[volumeType]
+	if !ok {
+		return fmt.Errorf("There is no price for the volume type %s in %s", volumeType, e.Region)
+	}
+	sizeGB, err := strconv.Atoi(size)
+	if err != nil {
+		return err
+	}
+	e.AddMonthly(fmt.Sprintf("%s storage", resource), fmt.Sprintf("%s %d GB", volumeType, sizeGB), count, price.GBMonth*float64(sizeGB))
+	if volumeType != "io1" {
+		return nil
+	}
+	provisioned, err := strconv.Atoi(iops)
+	if err != nil {
+		return err
+	}
+	e.AddMonthly(fmt.Sprintf("%s IOPS", resource), fmt.Sprintf("%d IOPS", provisioned), count, price.IopsMonth*float64(provisioned))
+	return nil
+}
+
+// estimateCost prices the resources that terraform makes for the volume and
+// instance configurations: the stardog, zookeeper and bastion instances with
+// their root volumes, the stardog home volumes and the two load balancers.
+func estimateCost(prices *priceTable, region string, vols *EbsVolumes, inst *Ec2Instance) (*sdutils.CostEstimate, error) {
+	r, ok := prices.Regions[region]
+	if !ok {
+		return nil, fmt.Errorf("There are no prices for the region %s", region)
+	}
+	e := sdutils.NewCostEstimate(region, prices.Currency)
+
+	clusterSize, err := strconv.Atoi(vols.ClusterSize)
+	if err != nil {
+		return nil, fmt.Errorf("The cluster size %s is not valid", vols.ClusterSize)
+	}
+	zkSize, err := strconv.Atoi(inst.ZkSize)
+	if err != nil {
+		return nil, fmt.Errorf("The zookeeper size %s is not valid", inst.ZkSize)
+	}
+	// A stopped deployment has no Stardog nodes and only pays for the
+	// storage of its zookeeper nodes.
+	runningNodes := clusterSize
+	runningZk := zkSize
+	if inst.StardogCapacity == "0" {
+		runningNodes = 0
+		runningZk = 0
+	}
+	err = r.addInstances(e, "stardog node", inst.SdInstanceType, runningNodes)
+	if err != nil {
+		return nil, err
+	}
+	err = r.addInstances(e, "zookeeper node", inst.ZkInstanceType, runningZk)
+	if err != nil {
+		return nil, err
+	}
+	err = r.addInstances(e, "bastion", terraformVar("bastion_instance_type", "t2.medium"), 1)
+	if err != nil {
+		return nil, err
+	}
+
+	homeVolumeType := vols.VolumeType
+	if homeVolumeType == "" {
+		homeVolumeType = terraformVar("stardog_home_volume_type", "io1")
+	}
+	err = r.addVolumes(e, "stardog home", homeVolumeType, vols.SizeOfEachVolume, vols.IoPs, clusterSize)
+	if err != nil {
+		return nil, err
+	}
+	err = r.addVolumes(e, "stardog root", terraformVar("root_volume_type", "io1"),
+		fmt.Sprintf("%d", inst.RootVolumeSize), fmt.Sprintf("%d", inst.RootVolumeIops), runningNodes)
+	if err != nil {
+		return nil, err
+	}
+	err = r.addVolumes(e, "zookeeper root", terraformVar("zk_root_volume_type", "io1"),
+		terraformVar("zk_root_volume_size", "16"), terraformVar("zk_root_volume_iops", "800"), zkSize)
+	if err != nil {
+		return nil, err
+	}
+	err = r.addVolumes(e, "bastion root", terraformVar("bastion_root_volume_type", "gp2"),
+		terraformVar("bastion_root_volume_size", "16"), terraformVar("bastion_root_volume_iops", "800"), 1)
+	if err != nil {
+		return nil, err
+	}
+
+	e.AddHourly("load balancer", "classic", 2, r.ELBHour)
+	return e, nil
+}
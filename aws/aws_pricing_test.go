@@ -0,0 +1,135 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+func TestLoadPriceTable(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	app := sdutils.TestContext{ConfigDir: dir}
+
+	prices, err := loadPriceTable(&app)
+	if err != nil {
+		t.Fatalf("Failed to load the prices %s", err)
+	}
+	if prices.Regions["us-west-1"] == nil || prices.Regions["us-west-1"].EC2["t2.medium"] == 0 {
+		t.Fatalf("The shipped prices are missing %v", prices)
+	}
+	elbPrice := prices.Regions["us-west-1"].ELBHour
+
+	override := `{"regions": {"us-west-1": {"ec2": {"t2.medium": 1.5}}, "mars-1": {"elb_hour": 2}}}`
+	err = ioutil.WriteFile(path.Join(dir, "aws-pricing.json"), []byte(override), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write the prices %s", err)
+	}
+	prices, err = loadPriceTable(&app)
+	if err != nil {
+		t.Fatalf("Failed to load the prices %s", err)
+	}
+	r := prices.Regions["us-west-1"]
+	if r.EC2["t2.medium"] != 1.5 || r.EC2["t2.small"] == 0 || r.ELBHour != elbPrice {
+		t.Fatalf("The override was not merged %v", r)
+	}
+	if prices.Regions["mars-1"] == nil || prices.Regions["mars-1"].ELBHour != 2 {
+		t.Fatal("The new region was not added")
+	}
+}
+
+func TestPriceTableRegions(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	app := sdutils.TestContext{ConfigDir: dir}
+
+	prices, err := loadPriceTable(&app)
+	if err != nil {
+		t.Fatalf("Failed to load the prices %s", err)
+	}
+	for _, region := range ValidRegions {
+		r := prices.Regions[region]
+		if r == nil || r.EC2["t2.small"] == 0 || r.EBS["gp2"].GBMonth == 0 || r.ELBHour == 0 {
+			t.Fatalf("The shipped prices are missing the region %s", region)
+		}
+		for instanceType := range prices.Regions["us-east-1"].EC2 {
+			if r.EC2[instanceType] == 0 {
+				t.Fatalf("The shipped prices of %s are missing %s", region, instanceType)
+			}
+		}
+	}
+	if len(prices.Regions) != len(ValidRegions) {
+		t.Fatalf("The shipped prices have %d regions but %d are valid", len(prices.Regions), len(ValidRegions))
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	prices := &priceTable{
+		Currency: "USD",
+		Regions: map[string]*regionPrices{
+			"us-west-1": {
+				EC2: map[string]float64{"t2.small": 0.02, "t2.medium": 0.04, "m4.large": 0.1},
+				EBS: map[string]ebsPrice{
+					"gp2": {GBMonth: 0.1},
+					"io1": {GBMonth: 0.125, IopsMonth: 0.065},
+				},
+				ELBHour: 0.025,
+			},
+		},
+	}
+	vols := &EbsVolumes{ClusterSize: "3", SizeOfEachVolume: "100", IoPs: "5000"}
+	inst := &Ec2Instance{SdInstanceType: "m4.large", ZkInstanceType: "t2.small", ZkSize: "3", RootVolumeSize: 16, RootVolumeIops: 800}
+
+	e, err := estimateCost(prices, "us-west-1", vols, inst)
+	if err != nil {
+		t.Fatalf("Failed to estimate %s", err)
+	}
+	if e.Currency != "USD" || e.Region != "us-west-1" {
+		t.Fatalf("The estimate is not labeled %v", e)
+	}
+	found := make(map[string]sdutils.CostItem)
+	for _, i := range e.Items {
+		found[i.Resource] = i
+	}
+	if found["stardog node"].Count != 3 || found["stardog node"].Hourly < 0.2999 || found["stardog node"].Hourly > 0.3001 {
+		t.Fatalf("The stardog nodes are wrong %v", found["stardog node"])
+	}
+	homeIops := found["stardog home IOPS"]
+	if homeIops.Monthly < 974.99 || homeIops.Monthly > 975.01 {
+		t.Fatalf("The IOPS are wrong %v", homeIops)
+	}
+	if _, ok := found["bastion root IOPS"]; ok {
+		t.Fatal("gp2 volumes have no provisioned IOPS")
+	}
+	if found["load balancer"].Count != 2 {
+		t.Fatalf("The load balancers are wrong %v", found["load balancer"])
+	}
+
+	_, err = estimateCost(prices, "eu-west-1", vols, inst)
+	if err == nil {
+		t.Fatal("A region without prices should fail")
+	}
+	inst.SdInstanceType = "x1.32xlarge"
+	_, err = estimateCost(prices, "us-west-1", vols, inst)
+	if err == nil {
+		t.Fatal("An instance type without a price should fail")
+	}
+}
@@ -0,0 +1,183 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/stardog-union/stardog-graviton"
+)
+
+// splitCertificateChain separates the first certificate of a PEM file from
+// the intermediate certificates that follow it.
+func splitCertificateChain(data []byte) ([]byte, []byte, error) {
+	var cert bytes.Buffer
+	var chain bytes.Buffer
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert.Len() == 0 {
+			pem.Encode(&cert, block)
+		} else {
+			pem.Encode(&chain, block)
+		}
+	}
+	if cert.Len() == 0 {
+		return nil, nil, errors.New("No PEM certificate was found")
+	}
+	return cert.Bytes(), chain.Bytes(), nil
+}
+
+// ImportCertificate imports a PEM certificate, with any intermediate
+// certificates, and its private key into ACM and returns the ARN.
+func ImportCertificate(c sdutils.AppContext, region string, certPath string, keyPath string) (string, error) {
+	certData, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the certificate %s: %s", certPath, err)
+	}
+	cert, chain, err := splitCertificateChain(certData)
+	if err != nil {
+		return "", fmt.Errorf("The certificate %s is not valid: %s", certPath, err)
+	}
+	keyData, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the private key %s: %s", keyPath, err)
+	}
+	if block, _ := pem.Decode(keyData); block == nil || !strings.Contains(block.Type, "PRIVATE KEY") {
+		return "", fmt.Errorf("The private key %s is not a PEM private key", keyPath)
+	}
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "gravitontest" {
+		return fmt.Sprintf("arn:aws:acm:%s:000000000000:certificate/gravitontest", region), nil
+	}
+
+	sess, err := session.NewSession()
+	if err != nil {
+		return "", err
+	}
+	svc := acm.New(sess, &aws.Config{Region: aws.String(region)})
+	input := &acm.ImportCertificateInput{
+		Certificate: cert,
+		PrivateKey:  keyData,
+	}
+	if len(chain) > 0 {
+		input.CertificateChain = chain
+	}
+	out, err := svc.ImportCertificate(input)
+	if err != nil {
+		return "", err
+	}
+	c.Logf(sdutils.INFO, "Imported the certificate %s as %s", certPath, aws.StringValue(out.CertificateArn))
+	return aws.StringValue(out.CertificateArn), nil
+}
+
+// DeleteCertificate removes a certificate that graviton imported into ACM.
+func DeleteCertificate(c sdutils.AppContext, region string, arn string) error {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "gravitontest" {
+		return nil
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	svc := acm.New(sess, &aws.Config{Region: aws.String(region)})
+	_, err = svc.DeleteCertificate(&acm.DeleteCertificateInput{CertificateArn: aws.String(arn)})
+	return err
+}
+
+// configureTLS applies the TLS options given on the command line to the
+// deployment.  A certificate given with --tls-cert and --tls-key is imported
+// into ACM unless plan is set, and the ARN is recorded so that later changes
+// to the instance keep the https listener.  A certificate that graviton
+// imported earlier is remembered in replacedCert so that it can be deleted
+// once the new listener is in place.
+func (dd *awsDeploymentDescription) configureTLS(plan bool) error {
+	if dd.plugin == nil || (dd.plugin.TLSCertArn == "" && dd.plugin.TLSCert == "" && dd.plugin.TLSKey == "") {
+		return nil
+	}
+	if dd.plugin.TLSCertArn != "" && (dd.plugin.TLSCert != "" || dd.plugin.TLSKey != "") {
+		return errors.New("Use either a certificate ARN or a certificate to import, not both")
+	}
+	arn := dd.plugin.TLSCertArn
+	imported := false
+	if arn != "" {
+		if !strings.HasPrefix(arn, "arn:") {
+			return fmt.Errorf("%s is not a certificate ARN", arn)
+		}
+	} else {
+		if dd.plugin.TLSCert == "" || dd.plugin.TLSKey == "" {
+			return errors.New("Importing a certificate needs both --tls-cert and --tls-key")
+		}
+		if plan {
+			dd.ctx.ConsoleLog(1, "The certificate %s will be imported into ACM when the instance is created.\n", dd.plugin.TLSCert)
+			if dd.ImportedCert {
+				dd.ctx.ConsoleLog(1, "The previously imported certificate %s will then be deleted.\n", dd.TLSCertArn)
+			}
+			dd.tlsPending = true
+			return nil
+		}
+		var err error
+		arn, err = ImportCertificate(dd.ctx, dd.Region, dd.plugin.TLSCert, dd.plugin.TLSKey)
+		if err != nil {
+			return fmt.Errorf("Failed to import the certificate into ACM: %s", err)
+		}
+		imported = true
+		dd.ctx.ConsoleLog(1, "Successfully imported the certificate %s\n", arn)
+	}
+	if dd.ImportedCert && dd.TLSCertArn != arn {
+		if plan {
+			dd.ctx.ConsoleLog(1, "The previously imported certificate %s will be deleted.\n", dd.TLSCertArn)
+		} else {
+			dd.replacedCert = dd.TLSCertArn
+		}
+	}
+	dd.TLSCertArn = arn
+	dd.ImportedCert = imported
+	if plan {
+		return nil
+	}
+	return dd.save()
+}
+
+// deleteReplacedCert deletes the certificate that configureTLS replaced.  It
+// is called once the listener uses the new certificate, ACM refuses to
+// delete a certificate that is still in use.
+func (dd *awsDeploymentDescription) deleteReplacedCert() {
+	if dd.replacedCert == "" {
+		return
+	}
+	err := DeleteCertificate(dd.ctx, dd.Region, dd.replacedCert)
+	if err != nil {
+		dd.ctx.ConsoleLog(0, "Failed to delete the previously imported certificate %s: %s\n", dd.replacedCert, err)
+	} else {
+		dd.ctx.ConsoleLog(1, "Successfully deleted the previously imported certificate %s\n", dd.replacedCert)
+	}
+	dd.replacedCert = ""
+}
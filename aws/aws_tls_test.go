@@ -0,0 +1,167 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+// writeTstCertificate writes a self signed certificate, followed by a second
+// one standing in for the chain, and its private key.
+func writeTstCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "stardog.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certPath := path.Join(dir, "cert.pem")
+	keyPath := path.Join(dir, "key.pem")
+	ioutil.WriteFile(certPath, append(certPEM, certPEM...), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certPath, keyPath
+}
+
+func TestSplitCertificateChain(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	certPath, keyPath := writeTstCertificate(t, dir)
+
+	data, _ := ioutil.ReadFile(certPath)
+	cert, chain, err := splitCertificateChain(data)
+	if err != nil {
+		t.Fatalf("Failed to split the certificate %s", err)
+	}
+	if strings.Count(string(cert), "BEGIN CERTIFICATE") != 1 || strings.Count(string(chain), "BEGIN CERTIFICATE") != 1 {
+		t.Fatalf("The chain was not split %s %s", cert, chain)
+	}
+	data, _ = ioutil.ReadFile(keyPath)
+	_, _, err = splitCertificateChain(data)
+	if err == nil {
+		t.Fatal("A key is not a certificate")
+	}
+}
+
+func TestConfigureTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	keySave := os.Getenv("AWS_ACCESS_KEY_ID")
+	defer os.Setenv("AWS_ACCESS_KEY_ID", keySave)
+	os.Setenv("AWS_ACCESS_KEY_ID", "gravitontest")
+	ioutil.WriteFile(path.Join(dir, "config.json"), []byte(`{"name": "tlsdep"}`), 0600)
+	certPath, keyPath := writeTstCertificate(t, dir)
+
+	app := sdutils.TestContext{ConfigDir: dir}
+	dd := &awsDeploymentDescription{
+		Region:    "us-west-1",
+		Name:      "tlsdep",
+		ctx:       &app,
+		deployDir: dir,
+		plugin:    &awsPlugin{TLSCert: certPath},
+	}
+	err := dd.configureTLS(true)
+	if err == nil {
+		t.Fatal("A certificate cannot be imported without its key")
+	}
+	dd.plugin.TLSKey = keyPath
+	err = dd.configureTLS(true)
+	if err != nil || dd.TLSCertArn != "" {
+		t.Fatalf("A plan should not import the certificate %s %s", dd.TLSCertArn, err)
+	}
+	inst, err := NewEc2Instance(&app, dd)
+	if err != nil || inst.ExternalProtocol != "https" {
+		t.Fatalf("The planned listener should use https %v %s", inst, err)
+	}
+
+	dd.tlsPending = false
+	err = dd.configureTLS(false)
+	if err != nil || !strings.HasPrefix(dd.TLSCertArn, "arn:aws:acm:us-west-1:") || !dd.ImportedCert {
+		t.Fatalf("The certificate was not imported %s %s", dd.TLSCertArn, err)
+	}
+	var conf map[string]json.RawMessage
+	err = sdutils.LoadJSON(&conf, path.Join(dir, "config.json"))
+	if err != nil || !strings.Contains(string(conf["cloud_opts"]), dd.TLSCertArn) {
+		t.Fatalf("The ARN should be recorded in config.json %s %s", conf["cloud_opts"], err)
+	}
+
+	inst, err = NewEc2Instance(&app, dd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst.StardogContact = "stardog.example.com"
+	if inst.ExternalProtocol != "https" || inst.SSLCertArn != dd.TLSCertArn || inst.stardogURL() != "https://stardog.example.com:5821" {
+		t.Fatalf("The instance should serve https %s %s %s", inst.ExternalProtocol, inst.SSLCertArn, inst.stardogURL())
+	}
+
+	dd.plugin.TLSCertArn = "arn:aws:acm:us-west-1:000000000000:certificate/other"
+	err = dd.configureTLS(false)
+	if err == nil {
+		t.Fatal("An ARN and an import cannot both be given")
+	}
+	importedArn := dd.TLSCertArn
+	dd.plugin.TLSCert = ""
+	dd.plugin.TLSKey = ""
+	err = dd.configureTLS(false)
+	if err != nil || dd.TLSCertArn != dd.plugin.TLSCertArn || dd.ImportedCert {
+		t.Fatalf("The given ARN should be used %s %s", dd.TLSCertArn, err)
+	}
+	if dd.replacedCert != importedArn {
+		t.Fatalf("The imported certificate should be deleted once it is replaced %s", dd.replacedCert)
+	}
+	dd.deleteReplacedCert()
+	if dd.replacedCert != "" {
+		t.Fatal("The replaced certificate should only be deleted once")
+	}
+
+	dd.plugin.TLSCertArn = ""
+	dd.TLSCertArn = ""
+	inst, err = NewEc2Instance(&app, dd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst.StardogContact = "stardog.example.com"
+	if inst.ExternalProtocol != "" || inst.stardogURL() != "http://stardog.example.com:5821" {
+		t.Fatalf("Without a certificate the instance should serve http %s", inst.stardogURL())
+	}
+}
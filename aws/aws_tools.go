@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -33,22 +34,36 @@ import (
 )
 
 var (
-	// ValidRegions is the list of regions that are supported by this plugin
-	ValidRegions = []string{
-		"us-west-1", "us-west-2", "us-east-1",
-		"us-east-2", "eu-central-1", "eu-west-1",
-	}
+	// ValidRegions is the list of regions that are supported by this plugin.
+	// It is every region that has a base Ubuntu AMI to build on.
+	ValidRegions = []string{}
 	// ValidVolumeTypes is the list of volume types that are supported by this plugin and
 	// their default iops values
 	ValidVolumeTypes = make(map[string]int)
 )
 
 func init() {
+	for r := range baseUbuntu1604 {
+		ValidRegions = append(ValidRegions, r)
+	}
+	sort.Strings(ValidRegions)
+
 	ValidVolumeTypes["standard"] = 0
 	ValidVolumeTypes["gp2"] = 0
 	ValidVolumeTypes["io1"] = 20
 }
 
+// ValidateRegion returns an error if the region is not supported by this
+// plugin.
+func ValidateRegion(region string) error {
+	for _, r := range ValidRegions {
+		if r == region {
+			return nil
+		}
+	}
+	return fmt.Errorf("The region %s is not supported, please use one of: %s", region, strings.Join(ValidRegions, ", "))
+}
+
 // GetValidVolumeTypes returns a list of the volume types that are supported
 func GetValidVolumeTypes() []string {
 	keys := []string{}
@@ -184,6 +199,51 @@ func GetAmiVersion(c sdutils.AppContext, region string, ami *string) (*string, e
 	return nil, nil
 }
 
+// CopyAmi copies an AMI to another region and waits for the copy to become
+// available.  The tags, which hold the image version, are copied as well.
+func CopyAmi(c sdutils.AppContext, srcRegion string, ami string, dstRegion string) (string, error) {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "gravitontest" {
+		return fmt.Sprintf("%s-%s", ami, dstRegion), nil
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return "", err
+	}
+	srcSvc := ec2.New(sess, &aws.Config{Region: aws.String(srcRegion)})
+	output, err := srcSvc.DescribeImages(&ec2.DescribeImagesInput{ImageIds: []*string{aws.String(ami)}})
+	if err != nil {
+		return "", err
+	}
+	if len(output.Images) != 1 {
+		return "", fmt.Errorf("The AMI %s was not found in %s", ami, srcRegion)
+	}
+	src := output.Images[0]
+
+	dstSvc := ec2.New(sess, &aws.Config{Region: aws.String(dstRegion)})
+	input := ec2.CopyImageInput{
+		SourceImageId: aws.String(ami),
+		SourceRegion:  aws.String(srcRegion),
+		Name:          src.Name,
+		Description:   src.Description,
+	}
+	copied, err := dstSvc.CopyImage(&input)
+	if err != nil {
+		return "", err
+	}
+	c.Logf(sdutils.INFO, "Copying %s from %s to %s as %s", ami, srcRegion, dstRegion, *copied.ImageId)
+	err = dstSvc.WaitUntilImageAvailable(&ec2.DescribeImagesInput{ImageIds: []*string{copied.ImageId}})
+	if err != nil {
+		return "", err
+	}
+	if len(src.Tags) > 0 {
+		_, err = dstSvc.CreateTags(&ec2.CreateTagsInput{Resources: []*string{copied.ImageId}, Tags: src.Tags})
+		if err != nil {
+			return "", err
+		}
+	}
+	return *copied.ImageId, nil
+}
+
 // CheckKeyName will return true or false based on the existance of the keyname in the
 // configured AWS environment.  If an error occurs while communicating with AWS an
 // error will be returned.
@@ -251,6 +311,147 @@ func DeleteKeyPair(c sdutils.AppContext, a *awsPlugin, keyname string) error {
 	return nil
 }
 
+// SnapshotVolumes takes an EBS snapshot of each volume and blocks until they
+// have all completed.  The snapshots are tagged with the deployment name and
+// the optional tag.
+func SnapshotVolumes(c sdutils.AppContext, region string, deploymentName string, tag string, volumeIDs []string) ([]string, error) {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "gravitontest" {
+		snapshotIDs := make([]string, len(volumeIDs))
+		for i, v := range volumeIDs {
+			snapshotIDs[i] = strings.Replace(v, "vol-", "snap-", 1)
+		}
+		return snapshotIDs, nil
+	}
+	conf := aws.Config{Region: aws.String(region)}
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	svc := ec2.New(sess, &conf)
+
+	snapshotIDs := make([]string, len(volumeIDs))
+	for i, v := range volumeIDs {
+		input := ec2.CreateSnapshotInput{
+			VolumeId:    aws.String(v),
+			Description: aws.String(fmt.Sprintf("Stardog data volume %d of %s", i, deploymentName)),
+		}
+		snap, err := svc.CreateSnapshot(&input)
+		if err != nil {
+			return nil, err
+		}
+		snapshotIDs[i] = *snap.SnapshotId
+		tags := []*ec2.Tag{
+			{Key: aws.String("DeploymentName"), Value: aws.String(deploymentName)},
+			{Key: aws.String("Name"), Value: aws.String("Stardog data snapshot")},
+		}
+		if tag != "" {
+			tags = append(tags, &ec2.Tag{Key: aws.String("GravitonTag"), Value: aws.String(tag)})
+		}
+		_, err = svc.CreateTags(&ec2.CreateTagsInput{Resources: []*string{snap.SnapshotId}, Tags: tags})
+		if err != nil {
+			return nil, err
+		}
+		c.Logf(sdutils.INFO, "Started the snapshot %s of %s", snapshotIDs[i], v)
+	}
+	err = svc.WaitUntilSnapshotCompleted(&ec2.DescribeSnapshotsInput{SnapshotIds: aws.StringSlice(snapshotIDs)})
+	if err != nil {
+		return nil, err
+	}
+	return snapshotIDs, nil
+}
+
+// GetSnapshotSize returns the size in gigabytes of the largest of the given
+// snapshots.
+func GetSnapshotSize(c sdutils.AppContext, region string, snapshotIDs []string) (int, error) {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "gravitontest" {
+		return 10, nil
+	}
+	conf := aws.Config{Region: aws.String(region)}
+	sess, err := session.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	svc := ec2.New(sess, &conf)
+	output, err := svc.DescribeSnapshots(&ec2.DescribeSnapshotsInput{SnapshotIds: aws.StringSlice(snapshotIDs)})
+	if err != nil {
+		return -1, err
+	}
+	size := 0
+	for _, s := range output.Snapshots {
+		if s.VolumeSize != nil && int(*s.VolumeSize) > size {
+			size = int(*s.VolumeSize)
+		}
+	}
+	return size, nil
+}
+
+// DeleteSnapshots deletes the EBS snapshots.
+func DeleteSnapshots(c sdutils.AppContext, region string, snapshotIDs []string) error {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "gravitontest" {
+		return nil
+	}
+	conf := aws.Config{Region: aws.String(region)}
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	svc := ec2.New(sess, &conf)
+	for _, id := range snapshotIDs {
+		_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(id)})
+		if err != nil {
+			return err
+		}
+		c.Logf(sdutils.INFO, "Deleted the snapshot %s", id)
+	}
+	return nil
+}
+
+// ReplaceAsgInstances terminates the instances of an autoscaling group without
+// lowering its desired capacity so that the group launches new ones from its
+// current launch configuration.  It returns once the old instances are gone
+// and their data volumes are free to be attached to the new ones.
+func ReplaceAsgInstances(c sdutils.AppContext, region string, asgName string) error {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "gravitontest" {
+		return nil
+	}
+	conf := aws.Config{Region: aws.String(region)}
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	autoscaleSvc := autoscaling.New(sess, &conf)
+	groups, err := autoscaleSvc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(asgName)},
+	})
+	if err != nil {
+		return err
+	}
+	instanceIDs := []*string{}
+	for _, g := range groups.AutoScalingGroups {
+		for _, i := range g.Instances {
+			instanceIDs = append(instanceIDs, i.InstanceId)
+		}
+	}
+	if len(instanceIDs) == 0 {
+		return fmt.Errorf("The autoscaling group %s has no instances", asgName)
+	}
+	for _, id := range instanceIDs {
+		input := autoscaling.TerminateInstanceInAutoScalingGroupInput{
+			InstanceId:                     id,
+			ShouldDecrementDesiredCapacity: aws.Bool(false),
+		}
+		_, err = autoscaleSvc.TerminateInstanceInAutoScalingGroup(&input)
+		if err != nil {
+			return err
+		}
+		c.Logf(sdutils.INFO, "Terminated the instance %s of %s", *id, asgName)
+	}
+	spin := sdutils.NewSpinner(c, 1, fmt.Sprintf("Waiting for the old instance of %s to terminate", asgName))
+	defer spin.Close()
+	svc := ec2.New(sess, &conf)
+	return svc.WaitUntilInstanceTerminated(&ec2.DescribeInstancesInput{InstanceIds: instanceIDs})
+}
+
 func destroyInstances(c sdutils.AppContext, sess *session.Session, conf *aws.Config, instList []*ec2.Instance) error {
 	svc := ec2.New(sess, conf)
 	for _, inst := range instList {
@@ -321,6 +522,10 @@ func destroyLoadBalancers(c sdutils.AppContext, sess *session.Session, conf *aws
 }
 
 func (a *awsPlugin) FindLeaks(c sdutils.AppContext, deploymentName string, destroy bool, force bool) error {
+	err := ValidateRegion(a.Region)
+	if err != nil {
+		return err
+	}
 	possibleDeployNames := make(map[string]bool)
 
 	if deploymentName != "" {
@@ -345,26 +550,39 @@ func (a *awsPlugin) FindLeaks(c sdutils.AppContext, deploymentName string, destr
 		elbList = append(elbList, tmpElbList...)
 	}
 
+	leaks := map[string][]string{
+		"autoscaling_groups":    {},
+		"launch_configurations": {},
+		"load_balancers":        {},
+		"instances":             {},
+		"security_groups":       {},
+	}
 	c.ConsoleLog(1, "Found %d autoscaling groups\n", len(asgList))
 	for _, asg := range asgList {
 		c.ConsoleLog(1, "\t%s\n", *asg.AutoScalingGroupName)
+		leaks["autoscaling_groups"] = append(leaks["autoscaling_groups"], *asg.AutoScalingGroupName)
 	}
 	c.ConsoleLog(1, "Found %d launch configurations\n", len(lcList))
 	for _, lc := range lcList {
 		c.ConsoleLog(1, "\t%s\n", *lc.LaunchConfigurationName)
+		leaks["launch_configurations"] = append(leaks["launch_configurations"], *lc.LaunchConfigurationName)
 	}
 	c.ConsoleLog(1, "Found %d load balancers\n", len(elbList))
 	for _, aElb := range elbList {
 		c.ConsoleLog(1, "\t%s\n", *aElb.LoadBalancerName)
+		leaks["load_balancers"] = append(leaks["load_balancers"], *aElb.LoadBalancerName)
 	}
 	c.ConsoleLog(1, "Found %d instances\n", len(instList))
 	for _, inst := range instList {
 		c.ConsoleLog(1, "\t%s\n", *inst.InstanceId)
+		leaks["instances"] = append(leaks["instances"], *inst.InstanceId)
 	}
 	c.ConsoleLog(1, "Found %d security groups\n", len(sgList))
 	for _, sg := range sgList {
 		c.ConsoleLog(1, "\t%s\n", *sg.GroupName)
+		leaks["security_groups"] = append(leaks["security_groups"], *sg.GroupName)
 	}
+	c.SetResult(leaks)
 
 	if !destroy {
 		return nil
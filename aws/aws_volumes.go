@@ -18,10 +18,12 @@ package aws
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/stardog-union/stardog-graviton"
 	"errors"
@@ -46,6 +48,8 @@ type EbsVolumes struct {
 	LicensePath      string `json:"stardog_license,omitempty"`
 	VolumeType       string `json:"stardog_home_volume_type,omitempty"`
 	IoPs             string `json:"stardog_home_volume_iops,omitempty"`
+	FormatFrom       string `json:"format_from,omitempty"`
+	SnapshotIDs      string `json:"snapshot_ids,omitempty"`
 	VolumeDir        string `json:"-"`
 	appContext       sdutils.AppContext
 }
@@ -90,10 +94,48 @@ func (v *EbsVolumes) VolumeExists() bool {
 func (v *EbsVolumes) CreateSet(licensePath string, sizeOfEachVolume int, clusterSize int) error {
 	// TODO make sure we clean up resources on failure
 	v.appContext.ConsoleLog(2, "Creating an aws volume set in directory %s\n", v.VolumeDir)
-	terraformPath, err := GetTerraformPath(v.appContext)
+	_, err := GetTerraformPath(v.appContext)
+	if err != nil {
+		return err
+	}
+	err = v.configure(licensePath, sizeOfEachVolume, clusterSize)
+	if err != nil {
+		return err
+	}
+
+	confFile := path.Join(v.VolumeDir, "config.json")
+	if _, err := os.Stat(confFile); err == nil {
+		v.appContext.ConsoleLog(1, "Volumes have already been created for the %s deployment, running terraform apply again.", v.DeploymentName)
+		v.appContext.Logf(sdutils.WARN, "Volumes have already been created for the %s deployment, running terraform apply again.", v.DeploymentName)
+	}
+	err = sdutils.WriteJSON(v, confFile)
+	if err != nil {
+		return err
+	}
+
+	err = v.runTerraformInit()
+	if err != nil {
+		return err
+	}
+
+	err = v.runTerraformApply("Calling out to terraform to create the volumes")
 	if err != nil {
 		return err
 	}
+	err = os.Remove(path.Join(v.VolumeDir, "builder.tf"))
+	if err != nil {
+		return err
+	}
+	err = v.runTerraformApply("Calling out to terraform to stop builder instances")
+	if err != nil {
+		return err
+	}
+	v.appContext.ConsoleLog(1, "Successfully created the volumes.\n")
+	return nil
+}
+
+// configure sets the values that are written to config.json.
+func (v *EbsVolumes) configure(licensePath string, sizeOfEachVolume int, clusterSize int) error {
 	v.ClusterSize = fmt.Sprintf("%d", clusterSize)
 	v.SizeOfEachVolume = fmt.Sprintf("%d", sizeOfEachVolume)
 	v.LicensePath = licensePath
@@ -101,32 +143,48 @@ func (v *EbsVolumes) CreateSet(licensePath string, sizeOfEachVolume int, cluster
 	envVolType := os.Getenv("TF_VAR_stardog_home_volume_type")
 	if envVolType != "" && envVolType != "io1" {
 		v.IoPs = fmt.Sprintf("%d", 0)
-	} else {
-		envVolIops := os.Getenv("TF_VAR_stardog_home_volume_iops")
-		var iops int
-
-		if envVolIops != "" {
-			iops, err = strconv.Atoi(envVolIops)
-			if err != nil {
-				return err
-			}
-		} else {
-			iops = sizeOfEachVolume * sdutils.GetMaxIopsRatio()
+		return nil
+	}
+	envVolIops := os.Getenv("TF_VAR_stardog_home_volume_iops")
+	iops := sizeOfEachVolume * sdutils.GetMaxIopsRatio()
+	if envVolIops != "" {
+		var err error
+		iops, err = strconv.Atoi(envVolIops)
+		if err != nil {
+			return err
 		}
-
-		v.IoPs = fmt.Sprintf("%d", iops)
 	}
+	v.IoPs = fmt.Sprintf("%d", iops)
+	return nil
+}
 
-	confFile := path.Join(v.VolumeDir, "config.json")
-	if _, err := os.Stat(confFile); err == nil {
-		v.appContext.ConsoleLog(1, "Volumes have already been created for the %s deployment, running terraform apply again.", v.DeploymentName)
-		v.appContext.Logf(sdutils.WARN, "Volumes have already been created for the %s deployment, running terraform apply again.", v.DeploymentName)
+// PlanSet reports what CreateSet would do.  The builder instances only exist
+// while the volumes are formatted so builder.tf is left out of the plan.
+func (v *EbsVolumes) PlanSet(licensePath string, sizeOfEachVolume int, clusterSize int) (*sdutils.PlanSummary, error) {
+	err := v.configure(licensePath, sizeOfEachVolume, clusterSize)
+	if err != nil {
+		return nil, err
 	}
-	err = sdutils.WriteJSON(v, confFile)
+	removeBuilder := func(planDir string) error {
+		builder := path.Join(planDir, "builder.tf")
+		if sdutils.PathExists(builder) {
+			return os.Remove(builder)
+		}
+		return nil
+	}
+	return planTerraform(v.appContext, v.VolumeDir, "config.json", v, "Calling out to terraform to plan the volumes", removeBuilder)
+}
+
+// PlanDeleteSet reports what DeleteSet would destroy.
+func (v *EbsVolumes) PlanDeleteSet() (*sdutils.PlanSummary, error) {
+	return planTerraform(v.appContext, v.VolumeDir, "config.json", nil, "Calling out to terraform to plan the deletion of the volumes", nil, "-destroy")
+}
+
+func (v *EbsVolumes) runTerraformInit() error {
+	terraformPath, err := GetTerraformPath(v.appContext)
 	if err != nil {
 		return err
 	}
-
 	cmdInitArray := []string{terraformPath, "init", "-input=false"}
 	cmdInit := exec.Cmd{
 		Path: cmdInitArray[0],
@@ -135,10 +193,15 @@ func (v *EbsVolumes) CreateSet(licensePath string, sizeOfEachVolume int, cluster
 	}
 	spin := sdutils.NewSpinner(v.appContext, 1, "Initializing terraform...")
 	_, err = sdutils.RunCommand(v.appContext, cmdInit, nil, spin)
+	return err
+}
+
+func (v *EbsVolumes) runTerraformApply(message string) error {
+	terraformPath, err := GetTerraformPath(v.appContext)
 	if err != nil {
 		return err
 	}
-
+	confFile := path.Join(v.VolumeDir, "config.json")
 	cmdArray := []string{terraformPath, "apply", "-input=false", "-auto-approve",
 		"-var-file", confFile}
 	cmd := exec.Cmd{
@@ -146,17 +209,133 @@ func (v *EbsVolumes) CreateSet(licensePath string, sizeOfEachVolume int, cluster
 		Args: cmdArray,
 		Dir:  v.VolumeDir,
 	}
-	spin = sdutils.NewSpinner(v.appContext, 1, "Calling out to terraform to create the volumes")
+	spin := sdutils.NewSpinner(v.appContext, 1, message)
 	_, err = sdutils.RunCommand(v.appContext, cmd, nil, spin)
+	return err
+}
+
+// Resize changes the number of EBS volumes in the set.  When volumes are
+// added the builder instances are brought back to format only the new ones.
+// When volumes are removed the ones with the highest index are destroyed.
+func (v *EbsVolumes) Resize(clusterSize int) error {
+	if clusterSize < 1 {
+		return errors.New("At least one volume is required")
+	}
+	current, err := LoadEbsVolume(v.appContext, v.VolumeDir)
 	if err != nil {
 		return err
 	}
-	err = os.Remove(path.Join(v.VolumeDir, "builder.tf"))
+	var currentSize int
+	_, err = fmt.Sscanf(current.ClusterSize, "%d", &currentSize)
 	if err != nil {
 		return err
 	}
-	spin = sdutils.NewSpinner(v.appContext, 1, "Calling out to terraform to stop builder instances")
-	_, err = sdutils.RunCommand(v.appContext, cmd, nil, spin)
+	v.SizeOfEachVolume = current.SizeOfEachVolume
+	v.LicensePath = current.LicensePath
+	v.VolumeType = current.VolumeType
+	v.IoPs = current.IoPs
+	v.SnapshotIDs = current.SnapshotIDs
+	v.ClusterSize = fmt.Sprintf("%d", clusterSize)
+
+	builderPath := path.Join(v.VolumeDir, "builder.tf")
+	if clusterSize > currentSize {
+		for _, f := range []string{"builder.tf", "variables.tf"} {
+			data, err := Asset(path.Join("etc", "terraform", "volumes", f))
+			if err != nil {
+				return err
+			}
+			err = ioutil.WriteFile(path.Join(v.VolumeDir, f), data, 0644)
+			if err != nil {
+				return err
+			}
+		}
+		v.FormatFrom = current.ClusterSize
+	}
+	confFile := path.Join(v.VolumeDir, "config.json")
+	err = sdutils.WriteJSON(v, confFile)
+	if err != nil {
+		return err
+	}
+	err = v.runTerraformApply("Calling out to terraform to resize the volumes")
+	if err != nil {
+		return err
+	}
+	if sdutils.PathExists(builderPath) {
+		err = os.Remove(builderPath)
+		if err != nil {
+			return err
+		}
+		v.FormatFrom = ""
+		err = sdutils.WriteJSON(v, confFile)
+		if err != nil {
+			return err
+		}
+		err = v.runTerraformApply("Calling out to terraform to stop builder instances")
+		if err != nil {
+			return err
+		}
+	}
+	v.appContext.ConsoleLog(1, "Successfully resized the volumes.\n")
+	return nil
+}
+
+// Snapshot takes an EBS snapshot of every volume in the set and returns the
+// snapshot ids in the order of the volumes.
+func (v *EbsVolumes) Snapshot(tag string) ([]string, error) {
+	vD, err := v.getStatusInformation()
+	if err != nil {
+		return nil, err
+	}
+	spin := sdutils.NewSpinner(v.appContext, 1, "Waiting for the volume snapshots to complete")
+	defer spin.Close()
+	snapshotIDs, err := SnapshotVolumes(v.appContext, v.Region, v.DeploymentName, tag, vD.VolumeIds)
+	if err != nil {
+		return nil, err
+	}
+	v.appContext.ConsoleLog(1, "Successfully snapshotted the volumes.\n")
+	return snapshotIDs, nil
+}
+
+// CreateSetFromSnapshots uses terraform to create one EBS volume from each
+// of the snapshots.  The volumes already hold a formatted STARDOG_HOME with a
+// license so the builder instances are not used.
+func (v *EbsVolumes) CreateSetFromSnapshots(snapshotIDs []string, sizeOfEachVolume int) error {
+	if len(snapshotIDs) < 1 {
+		return errors.New("At least one volume is required")
+	}
+	var err error
+	if sizeOfEachVolume < 1 {
+		sizeOfEachVolume, err = GetSnapshotSize(v.appContext, v.Region, snapshotIDs)
+		if err != nil {
+			return err
+		}
+	}
+	v.ClusterSize = fmt.Sprintf("%d", len(snapshotIDs))
+	v.SizeOfEachVolume = fmt.Sprintf("%d", sizeOfEachVolume)
+	v.SnapshotIDs = strings.Join(snapshotIDs, ",")
+	v.IoPs = fmt.Sprintf("%d", sizeOfEachVolume*sdutils.GetMaxIopsRatio())
+	if envVolIops := os.Getenv("TF_VAR_stardog_home_volume_iops"); envVolIops != "" {
+		v.IoPs = envVolIops
+	}
+
+	confFile := path.Join(v.VolumeDir, "config.json")
+	err = sdutils.WriteJSON(v, confFile)
+	if err != nil {
+		return err
+	}
+	builderPath := path.Join(v.VolumeDir, "builder.tf")
+	if sdutils.PathExists(builderPath) {
+		err = os.Remove(builderPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = v.runTerraformInit()
+	if err != nil {
+		return err
+	}
+	err = v.runTerraformApply("Calling out to terraform to create the volumes from the snapshots")
 	if err != nil {
 		return err
 	}
@@ -234,6 +413,7 @@ func (v *EbsVolumes) Status() error {
 	if err != nil {
 		return err
 	}
+	v.appContext.SetResult(vD)
 	v.appContext.ConsoleLog(1, "Volumes:\n")
 	for _, x := range vD.VolumeIds {
 		v.appContext.ConsoleLog(1, "%s\n", x)
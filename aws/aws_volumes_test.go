@@ -57,7 +57,7 @@ func TestVolumesNotThere(t *testing.T) {
 		Version:    version,
 		PrivateKey: sshKeyFile,
 	}
-	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin)
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, false)
 	if err != nil {
 		t.Fatalf("Failed to make the deployment manager %s", err)
 	}
@@ -165,7 +165,7 @@ func TestVolumesThroughDD(t *testing.T) {
 		Version:    version,
 		PrivateKey: sshKeyFile,
 	}
-	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin)
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, false)
 	if err != nil {
 		t.Fatalf("Failed to make the deployment manager %s", err)
 	}
@@ -239,3 +239,154 @@ func TestVolumesThroughDD(t *testing.T) {
 		t.Fatal("The delete should not have failed")
 	}
 }
+
+func TestVolumesResize(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	sshKeyFile := path.Join(dir, "keyfile")
+	ioutil.WriteFile(sshKeyFile, []byte("xxx"), 0600)
+	keySave := os.Getenv("AWS_ACCESS_KEY_ID")
+	defer os.Setenv("AWS_ACCESS_KEY_ID", keySave)
+	os.Setenv("AWS_ACCESS_KEY_ID", "gravitontest")
+	secretSave := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	defer os.Setenv("AWS_SECRET_ACCESS_KEY", secretSave)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "somesecret")
+
+	version := "4.2"
+	app := sdutils.TestContext{
+		ConfigDir: dir,
+		Version:   version,
+	}
+	plugin := &awsPlugin{
+		Region:         "us-west-1",
+		AmiID:          "notreal",
+		AwsKeyName:     "somekey",
+		ZkInstanceType: "m3.large",
+		SdInstanceType: "m3.large",
+	}
+	baseD := sdutils.BaseDeployment{
+		Type:       plugin.GetName(),
+		Name:       "testdep",
+		Directory:  dir,
+		Version:    version,
+		PrivateKey: sshKeyFile,
+	}
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, false)
+	if err != nil {
+		t.Fatalf("Failed to make the deployment manager %s", err)
+	}
+	err = dd.ResizeCluster(5)
+	if err == nil {
+		t.Fatal("The resize should fail without volumes")
+	}
+
+	startPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", startPath)
+	exedir, _, err := MakeTestTerraform(0, "data", dir)
+	if err != nil {
+		t.Fatalf("Failed to write the file %s", err)
+	}
+	os.Setenv("PATH", fmt.Sprintf("%s:%s", exedir, startPath))
+
+	err = dd.CreateVolumeSet("/path/", 1, 3)
+	if err != nil {
+		t.Fatalf("The create should have worked %s", err)
+	}
+	volumeDir := path.Join(sdutils.DeploymentDir(dir, baseD.Name), "etc", "terraform", "volumes")
+	if sdutils.PathExists(path.Join(volumeDir, "builder.tf")) {
+		t.Fatal("The builder should have been removed")
+	}
+
+	err = dd.ResizeCluster(5)
+	if err != nil {
+		t.Fatalf("The resize should have worked %s", err)
+	}
+	vols, err := LoadEbsVolume(&app, volumeDir)
+	if err != nil {
+		t.Fatalf("The re-load should not have failed %s", err)
+	}
+	if vols.ClusterSize != "5" || vols.FormatFrom != "" || vols.SizeOfEachVolume != "1" {
+		t.Fatalf("The volumes were not resized %v", vols)
+	}
+	if sdutils.PathExists(path.Join(volumeDir, "builder.tf")) {
+		t.Fatal("The builder should have been removed after the resize")
+	}
+	sz, err := dd.ClusterSize()
+	if err != nil || sz != 5 {
+		t.Fatalf("The cluster size should be 5 %d %s", sz, err)
+	}
+
+	err = dd.ResizeCluster(3)
+	if err != nil {
+		t.Fatalf("The resize should have worked %s", err)
+	}
+	sz, err = dd.ClusterSize()
+	if err != nil || sz != 3 {
+		t.Fatalf("The cluster size should be 3 %d %s", sz, err)
+	}
+}
+
+func TestVolumesFromSnapshots(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	sshKeyFile := path.Join(dir, "keyfile")
+	ioutil.WriteFile(sshKeyFile, []byte("xxx"), 0600)
+	keySave := os.Getenv("AWS_ACCESS_KEY_ID")
+	defer os.Setenv("AWS_ACCESS_KEY_ID", keySave)
+	os.Setenv("AWS_ACCESS_KEY_ID", "gravitontest")
+	secretSave := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	defer os.Setenv("AWS_SECRET_ACCESS_KEY", secretSave)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "somesecret")
+
+	version := "4.2"
+	app := sdutils.TestContext{
+		ConfigDir: dir,
+		Version:   version,
+	}
+	plugin := &awsPlugin{
+		Region:         "us-west-1",
+		AmiID:          "notreal",
+		AwsKeyName:     "somekey",
+		ZkInstanceType: "m3.large",
+		SdInstanceType: "m3.large",
+	}
+	baseD := sdutils.BaseDeployment{
+		Type:       plugin.GetName(),
+		Name:       "testdep",
+		Directory:  dir,
+		Version:    version,
+		PrivateKey: sshKeyFile,
+	}
+	dd, err := newAwsDeploymentDescription(&app, &baseD, plugin, false)
+	if err != nil {
+		t.Fatalf("Failed to make the deployment manager %s", err)
+	}
+	_, err = dd.SnapshotVolumeSet("")
+	if err == nil {
+		t.Fatal("The snapshot should fail without volumes")
+	}
+
+	startPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", startPath)
+	exedir, _, err := MakeTestTerraform(0, "data", dir)
+	if err != nil {
+		t.Fatalf("Failed to write the file %s", err)
+	}
+	os.Setenv("PATH", fmt.Sprintf("%s:%s", exedir, startPath))
+
+	err = dd.CreateVolumeSetFromSnapshots([]string{"snap-1", "snap-2", "snap-3"}, 0)
+	if err != nil {
+		t.Fatalf("The create should have worked %s", err)
+	}
+	volumeDir := path.Join(sdutils.DeploymentDir(dir, baseD.Name), "etc", "terraform", "volumes")
+	if sdutils.PathExists(path.Join(volumeDir, "builder.tf")) {
+		t.Fatal("The builder should not be used for snapshots")
+	}
+	vols, err := LoadEbsVolume(&app, volumeDir)
+	if err != nil {
+		t.Fatalf("The re-load should not have failed %s", err)
+	}
+	if vols.ClusterSize != "3" || vols.SnapshotIDs != "snap-1,snap-2,snap-3" || vols.SizeOfEachVolume != "10" || vols.LicensePath != "" {
+		t.Fatalf("The volumes were not created from the snapshots %v", vols)
+	}
+}
@@ -20,6 +20,7 @@ setuptools.setup(name='stardog-cluster-utils',
               "stardog-wait-for-socket=stardog.cluster.wait_for_socket:main",
               "stardog-wait-for-pgm=stardog.cluster.test_program:main",
               "stardog-update=stardog.cluster.update_stardog:main",
+              "stardog-update-node=stardog.cluster.update_node:main",
               "stardog-refresh-binaries=stardog.cluster.refresh_stardog_binaries:main",
               "stardog-gather-logs=stardog.cluster.gather_log:main",
               "stardog-monitor-zk=stardog.cluster.monitor_zk:main",
@@ -8,11 +8,17 @@ import stardog.cluster.utils as utils
 
 
 # Stardog should be stopped before refreshing the binaries,
-# see update_stardog.py for the general process.
+# see update_stardog.py for the general process.  The previous release is
+# moved to the backup directory given as the second argument, or to one
+# named after the current time.
 def main():
     cur_time = datetime.datetime.now().strftime('%Y%m%d-%H%M%S')
 
     release_file = sys.argv[1]
+    backup_dir = "/usr/local/stardog.%s" % cur_time
+    if len(sys.argv) > 2:
+        backup_dir = sys.argv[2]
+    logging.debug("Backup directory: %s" % backup_dir)
     logging.debug("Release file: %s" % release_file)
     base_zip_file = os.path.basename(release_file)
     logging.debug("Base zip file: %s" % base_zip_file)
@@ -30,7 +36,7 @@ def main():
     if rc != 0:
         errors.append(err)
 
-    backup_cmd = "mv /usr/local/stardog /usr/local/stardog.%s" % cur_time
+    backup_cmd = "mv /usr/local/stardog %s" % backup_dir
     rc, err = utils.command(backup_cmd, cmd_dir="/usr/local/")
     if rc != 0:
         errors.append(err)
@@ -0,0 +1,83 @@
+import datetime
+import logging
+import sys
+
+import stardog.cluster.update_stardog as update_stardog
+import stardog.cluster.utils as utils
+
+
+# update_node prints this marker, followed by the backup directory, right
+# before the binaries are swapped.  Graviton passes the directory back to
+# --rollback so that exactly that release is restored.
+BACKUP_MARKER = "stardog-update-node backup:"
+
+
+def restore_stardog_binaries(ip, backup_dir):
+    # refresh_stardog_binaries.py moved the previous release to backup_dir,
+    # it is put back in place.  Nothing is touched if the move never
+    # happened.
+    cur_time = datetime.datetime.now().strftime('%Y%m%d-%H%M%S')
+    ssh_opts = "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null"
+    restore_cmd = "if [ -d %s ]; then " \
+                  "if [ -e /usr/local/stardog ]; then mv /usr/local/stardog /usr/local/stardog.failed-%s; fi && " \
+                  "mv %s /usr/local/stardog; fi" % (backup_dir, cur_time, backup_dir)
+    cmd = "ssh %s %s '%s'" % (ssh_opts, ip, restore_cmd)
+    return utils.command(cmd)
+
+
+def update_node(ip, release_file):
+    cur_time = datetime.datetime.now().strftime('%Y%m%d-%H%M%S')
+    backup_dir = "/usr/local/stardog.%s" % cur_time
+
+    def refresh():
+        print("%s %s" % (BACKUP_MARKER, backup_dir))
+        sys.stdout.flush()
+        return update_stardog.refresh_stardog_binaries(ip, release_file, backup_dir)
+
+    steps = [
+        lambda: update_stardog.upload_file(ip, release_file),
+        lambda: update_stardog.stop_stardog(ip),
+        refresh,
+        lambda: update_stardog.start_stardog(ip),
+    ]
+    for step in steps:
+        rc, err = step()
+        if rc != 0:
+            raise Exception(err)
+
+
+def rollback_node(ip, backup_dir=None):
+    steps = [update_stardog.stop_stardog]
+    if backup_dir:
+        steps.append(lambda ip: restore_stardog_binaries(ip, backup_dir))
+    steps.append(update_stardog.start_stardog)
+    errors = []
+    for step in steps:
+        rc, err = step(ip)
+        if rc != 0:
+            errors.append(err)
+    if errors:
+        raise Exception(errors)
+
+
+# Update the Stardog binaries of a single node:
+#   stardog-update-node <ip> <release file>
+# or restart a node after a failed update, putting back the binaries that
+# were moved to the backup directory if the update got that far:
+#   stardog-update-node --rollback <ip> [<backup directory>]
+def main():
+    if sys.argv[1] == "--rollback":
+        ip = sys.argv[2]
+        backup_dir = None
+        if len(sys.argv) > 3:
+            backup_dir = sys.argv[3]
+        logging.debug("Rolling back: %s to %s" % (ip, backup_dir))
+        rollback_node(ip, backup_dir)
+        return 0
+
+    ip = sys.argv[1]
+    logging.debug("Updating: %s" % ip)
+    release_file = sys.argv[2]
+    logging.debug("Release file: %s" % release_file)
+    update_node(ip, release_file)
+    return 0
@@ -11,10 +11,10 @@ def upload_file(ip, upload_file):
     return utils.command(cmd)
 
 
-def refresh_stardog_binaries(ip, release_file):
+def refresh_stardog_binaries(ip, release_file, backup_dir=""):
     ssh_opts = "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null"
     refresh_cmd = "/usr/local/bin/stardog-refresh-binaries"
-    cmd = "ssh %s %s '%s %s'" % (ssh_opts, ip, refresh_cmd, release_file)
+    cmd = "ssh %s %s '%s %s %s'" % (ssh_opts, ip, refresh_cmd, release_file, backup_dir)
     return utils.command(cmd)
 
 
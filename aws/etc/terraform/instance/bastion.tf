@@ -27,6 +27,11 @@ resource "aws_instance" "bastion" {
 	  DeploymentName = "${var.deployment_name}"
 	  StardogVirtualAppliance = "${var.deployment_name}"
 	}
+
+  # instance reimage only moves the Stardog nodes to a new AMI.
+  lifecycle {
+    ignore_changes = ["ami"]
+  }
 }
 
 resource "aws_security_group" "bastion" {
@@ -31,9 +31,9 @@ resource "aws_autoscaling_group" "stardog" {
   count = "${var.stardog_size}"
   vpc_zone_identifier = ["${element(aws_subnet.stardog.*.id, count.index % length(aws_subnet.stardog.*.id))}"]
   name = "${var.deployment_name}sdasg${count.index}"
-  max_size = "1"
-  min_size = "1"
-  desired_capacity = "1"
+  max_size = "${var.stardog_capacity}"
+  min_size = "${var.stardog_capacity}"
+  desired_capacity = "${var.stardog_capacity}"
   launch_configuration = "${aws_launch_configuration.stardog.name}"
   load_balancers = ["${aws_elb.stardog.name}", "${aws_elb.stardoginternal.name}"]
   health_check_grace_period = "${var.sd_health_grace_period}"
@@ -67,6 +67,10 @@ resource "aws_launch_configuration" "stardog" {
     iops = "${var.root_volume_type == "io1" ? var.root_volume_iops : 0}"
     delete_on_termination = "true"
   }
+
+  lifecycle {
+    create_before_destroy = true
+  }
 }
 
 resource "aws_iam_instance_profile" "stardog" {
@@ -116,7 +120,8 @@ resource "aws_iam_role_policy" "stardog" {
             "Effect": "Allow",
             "Action": [
               "s3:List*",
-              "s3:Get*"
+              "s3:Get*",
+              "s3:PutObject"
             ],
             "Resource": "*"
         }
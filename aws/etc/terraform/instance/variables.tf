@@ -29,6 +29,12 @@ variable "stardog_size" {
   description = "The number of stardog nodes to use (must be odd and greater than 1)"
 }
 
+variable "stardog_capacity" {
+  type = "string"
+  description = "The number of instances in each stardog autoscaling group, 0 when the deployment is stopped"
+  default = "1"
+}
+
 variable "baseami" {
   type = "string"
 }
@@ -73,6 +73,14 @@ resource "aws_instance" "zookeeper" {
 	  DeploymentName = "${var.deployment_name}"
 	  StardogVirtualAppliance = "${var.deployment_name}"
 	}
+
+  # The server list in the user data changes whenever the ensemble is resized.
+  # graviton replaces the nodes one at a time by tainting them so that the
+  # quorum is kept.  A new AMI from instance reimage is also only picked up
+  # when a node is replaced.
+  lifecycle {
+    ignore_changes = ["user_data", "ami"]
+  }
 }
 
 resource "aws_security_group" "zookeeper" {
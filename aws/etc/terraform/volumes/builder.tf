@@ -46,10 +46,10 @@ resource "aws_security_group" "stardog_data" {
 }
 
 resource "aws_subnet" "stardog" {
-  count = "${var.cluster_size}"
+  count = "${var.cluster_size - var.format_from}"
   vpc_id = "${aws_vpc.main.id}"
   cidr_block = "${format("10.0.%d.0/24", count.index)}"
-  availability_zone = "${element(data.aws_availability_zones.available.names, count.index)}"
+  availability_zone = "${element(data.aws_availability_zones.available.names, count.index + var.format_from)}"
 
   tags {
     StardogVirtualAppliance = "${var.deployment_name}"
@@ -57,8 +57,8 @@ resource "aws_subnet" "stardog" {
 }
 
 resource "aws_instance" "stardog_data" {
-  availability_zone = "${element(data.aws_availability_zones.available.names, count.index % length(data.aws_availability_zones.available.names))}"
-  count = "${var.cluster_size}"
+  availability_zone = "${element(data.aws_availability_zones.available.names, (count.index + var.format_from) % length(data.aws_availability_zones.available.names))}"
+  count = "${var.cluster_size - var.format_from}"
 
   timeouts {
     create = "30m"
@@ -81,14 +81,14 @@ resource "aws_instance" "stardog_data" {
 }
 
 resource "aws_volume_attachment" "stardog_data" {
-  count = "${var.cluster_size}"
+  count = "${var.cluster_size - var.format_from}"
   device_name = "/dev/xvdh"
-  volume_id = "${element(aws_ebs_volume.stardog_data.*.id, count.index)}"
+  volume_id = "${element(aws_ebs_volume.stardog_data.*.id, count.index + var.format_from)}"
   instance_id = "${element(aws_instance.stardog_data.*.id, count.index)}"
 }
 
 resource "null_resource" "stardog_data" {
-  count = "${var.cluster_size}"
+  count = "${var.cluster_size - var.format_from}"
 
   # Settings for SSH connection
   connection {
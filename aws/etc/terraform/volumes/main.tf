@@ -10,6 +10,8 @@ resource "aws_ebs_volume" "stardog_data" {
   availability_zone = "${element(data.aws_availability_zones.available.names, count.index % length(data.aws_availability_zones.available.names))}"
   count = "${var.cluster_size}"
   size = "${var.stardog_home_volume_size}"
+  # Volumes added after a restore are empty and formatted by the builder.
+  snapshot_id = "${count.index < length(split(",", var.snapshot_ids)) ? element(split(",", var.snapshot_ids), count.index) : ""}"
   type = "${var.stardog_home_volume_type}"
   iops = "${var.stardog_home_volume_type == "io1" ? var.stardog_home_volume_iops : 0}"
   tags {
@@ -3,6 +3,12 @@ variable "cluster_size" {
   description = "The number of stardog nodes to use (must be odd and greater than 1)."
 }
 
+variable "format_from" {
+  type = "string"
+  description = "The index of the first volume that needs to be formatted."
+  default = "0"
+}
+
 variable "aws_region" {
   type = "string"
   description = "The AWS region to create things in."
@@ -36,6 +42,13 @@ variable "instance_type" {
 variable "stardog_license" {
   type = "string"
   description = "The path to your stardog license"
+  default = ""
+}
+
+variable "snapshot_ids" {
+  type = "string"
+  description = "A comma separated list of snapshots from which the volumes are created."
+  default = ""
 }
 
 variable "stardog_home_volume_type" {
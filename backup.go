@@ -0,0 +1,383 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The ways in which a deployment can be backed up.
+const (
+	BackupMethodSnapshot = "snapshot"
+	BackupMethodDatabase = "db"
+)
+
+var (
+	backupStoreMap = make(map[string]BackupStoreFactory)
+)
+
+// BackupStore is a place outside of the deployment where backups are kept.
+type BackupStore interface {
+	// StardogLocation returns the location given to stardog-admin db
+	// backup for the backup id.  Stores that the Stardog nodes cannot
+	// write to return an error.
+	StardogLocation(id string) (string, error)
+	// Put copies a local file into the store under the backup id.
+	Put(id string, localPath string) error
+	// Delete removes everything stored under the backup id.
+	Delete(id string) error
+}
+
+// BackupStoreFactory makes a BackupStore from a destination URL.
+type BackupStoreFactory func(context AppContext, destination string) (BackupStore, error)
+
+// AddBackupStore associates a URL scheme with a backup store.  Destinations
+// without a registered scheme are local directories.
+func AddBackupStore(scheme string, factory BackupStoreFactory) {
+	backupStoreMap[scheme] = factory
+}
+
+// GetBackupStore returns the store for the destination URL.
+func GetBackupStore(context AppContext, destination string) (BackupStore, error) {
+	if destination == "" {
+		return nil, errors.New("A backup destination is required")
+	}
+	ndx := strings.Index(destination, "://")
+	if ndx > 0 && destination[:ndx] != "file" {
+		factory, ok := backupStoreMap[destination[:ndx]]
+		if !ok {
+			return nil, fmt.Errorf("The backup destination %s is not supported", destination)
+		}
+		return factory(context, destination)
+	}
+	dir, err := filepath.Abs(strings.TrimPrefix(destination, "file://"))
+	if err != nil {
+		return nil, err
+	}
+	return &dirBackupStore{dir: dir}, nil
+}
+
+type dirBackupStore struct {
+	dir string
+}
+
+func (s *dirBackupStore) StardogLocation(id string) (string, error) {
+	return "", fmt.Errorf("The Stardog nodes cannot write to the local directory %s, use the snapshot method or an s3 destination", s.dir)
+}
+
+func (s *dirBackupStore) Put(id string, localPath string) error {
+	dir := path.Join(s.dir, id)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	return CopyFile(localPath, path.Join(dir, path.Base(localPath)))
+}
+
+func (s *dirBackupStore) Delete(id string) error {
+	return os.RemoveAll(path.Join(s.dir, id))
+}
+
+// BackupPolicy describes how a deployment is backed up, how often and how
+// many backups are kept.
+type BackupPolicy struct {
+	Every       string   `json:"every,omitempty"`
+	Keep        int      `json:"keep,omitempty"`
+	Method      string   `json:"method,omitempty"`
+	Databases   []string `json:"databases,omitempty"`
+	Destination string   `json:"destination,omitempty"`
+}
+
+// BackupRecord describes a single completed backup.
+type BackupRecord struct {
+	ID            string    `json:"id,omitempty"`
+	Method        string    `json:"method,omitempty"`
+	Destination   string    `json:"destination,omitempty"`
+	Location      string    `json:"location,omitempty"`
+	Databases     []string  `json:"databases,omitempty"`
+	SnapshotSetID string    `json:"snapshot_set,omitempty"`
+	TimeStamp     time.Time `json:"timestamp,omitempty"`
+}
+
+// BackupCatalog is the backup metadata of a deployment.  It is kept in
+// backups.json next to the config.json of the deployment.
+type BackupCatalog struct {
+	Policy  *BackupPolicy  `json:"policy,omitempty"`
+	Backups []BackupRecord `json:"backups,omitempty"`
+}
+
+func backupCatalogPath(baseD *BaseDeployment) string {
+	return path.Join(baseD.Directory, "backups.json")
+}
+
+// LoadBackupCatalog reads the backup metadata of the deployment.  An empty
+// catalog is returned if no backup was ever made.
+func LoadBackupCatalog(baseD *BaseDeployment) (*BackupCatalog, error) {
+	var catalog BackupCatalog
+	if !PathExists(backupCatalogPath(baseD)) {
+		return &catalog, nil
+	}
+	err := LoadJSON(&catalog, backupCatalogPath(baseD))
+	if err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+func (catalog *BackupCatalog) save(baseD *BaseDeployment) error {
+	return WriteJSON(catalog, backupCatalogPath(baseD))
+}
+
+func (catalog *BackupCatalog) find(id string) (*BackupRecord, error) {
+	for i := range catalog.Backups {
+		if catalog.Backups[i].ID == id {
+			return &catalog.Backups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("The backup %s does not exist", id)
+}
+
+// ValidateBackupPolicy checks that the policy can be run.
+func ValidateBackupPolicy(policy *BackupPolicy) error {
+	every, err := time.ParseDuration(policy.Every)
+	if err != nil {
+		return fmt.Errorf("Invalid backup interval %s: %s", policy.Every, err)
+	}
+	if every < time.Minute {
+		return errors.New("Backups cannot run more often than once a minute")
+	}
+	if policy.Keep < 1 {
+		return errors.New("At least one backup must be kept")
+	}
+	switch policy.Method {
+	case BackupMethodSnapshot:
+	case BackupMethodDatabase:
+		if len(policy.Databases) == 0 {
+			return errors.New("At least one database is required for database backups")
+		}
+	default:
+		return fmt.Errorf("The backup method %s is not supported", policy.Method)
+	}
+	if policy.Destination == "" {
+		return errors.New("A backup destination is required")
+	}
+	return nil
+}
+
+// RunBackup makes a single backup of the deployment according to the policy,
+// ships it to the destination and records it in the catalog.
+func RunBackup(context AppContext, baseD *BaseDeployment, dep Deployment, policy *BackupPolicy) (*BackupRecord, error) {
+	store, err := GetBackupStore(context, policy.Destination)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	record := BackupRecord{
+		ID:          fmt.Sprintf("%s-%s", baseD.Name, now.Format("20060102T150405Z")),
+		Method:      policy.Method,
+		Destination: policy.Destination,
+		Databases:   policy.Databases,
+		TimeStamp:   now,
+	}
+	switch policy.Method {
+	case BackupMethodSnapshot:
+		set, err := SnapshotVolumes(context, baseD, dep, record.ID)
+		if err != nil {
+			return nil, err
+		}
+		record.SnapshotSetID = set.ID
+		err = store.Put(record.ID, path.Join(SnapshotDir(context.GetConfigDir(), baseD.Name), fmt.Sprintf("%s.json", set.ID)))
+		if err != nil {
+			return nil, err
+		}
+	case BackupMethodDatabase:
+		record.Location, err = store.StardogLocation(record.ID)
+		if err != nil {
+			return nil, err
+		}
+		sd, err := dep.FullStatus()
+		if err != nil {
+			return nil, err
+		}
+		for _, db := range policy.Databases {
+			context.ConsoleLog(1, "Backing up the database %s...\n", db)
+			err = runClient(context, sd, baseD, dep, []string{"db", "backup", "--to", record.Location, db})
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("The backup method %s is not supported", policy.Method)
+	}
+
+	catalog, err := LoadBackupCatalog(baseD)
+	if err != nil {
+		return nil, err
+	}
+	catalog.Backups = append(catalog.Backups, record)
+	err = catalog.save(baseD)
+	if err != nil {
+		return nil, err
+	}
+	context.ConsoleLog(1, "Successfully created the backup %s.\n", context.HighlightString(record.ID))
+	return &record, nil
+}
+
+// PruneBackups deletes the oldest backups so that only keep remain.
+func PruneBackups(context AppContext, baseD *BaseDeployment, dep Deployment, keep int) error {
+	catalog, err := LoadBackupCatalog(baseD)
+	if err != nil {
+		return err
+	}
+	sort.Slice(catalog.Backups, func(i, j int) bool {
+		return catalog.Backups[i].TimeStamp.Before(catalog.Backups[j].TimeStamp)
+	})
+	for len(catalog.Backups) > keep {
+		record := catalog.Backups[0]
+		context.ConsoleLog(1, "Removing the backup %s.\n", record.ID)
+		store, err := GetBackupStore(context, record.Destination)
+		if err != nil {
+			return err
+		}
+		if record.SnapshotSetID != "" {
+			set, err := FindSnapshotSet(context, record.SnapshotSetID)
+			if err != nil {
+				return err
+			}
+			err = dep.DeleteVolumeSnapshots(set.SnapshotIDs)
+			if err != nil {
+				return err
+			}
+			err = os.Remove(path.Join(SnapshotDir(context.GetConfigDir(), set.Deployment), fmt.Sprintf("%s.json", set.ID)))
+			if err != nil {
+				return err
+			}
+		}
+		err = store.Delete(record.ID)
+		if err != nil {
+			return err
+		}
+		catalog.Backups = catalog.Backups[1:]
+		err = catalog.save(baseD)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScheduleBackups records the policy and then backs up the deployment every
+// interval, pruning old backups each time, until the process is stopped.  If
+// once is true a single backup is made, which is useful when graviton is
+// driven by cron.
+func ScheduleBackups(context AppContext, baseD *BaseDeployment, dep Deployment, policy *BackupPolicy, once bool) error {
+	err := ValidateBackupPolicy(policy)
+	if err != nil {
+		return err
+	}
+	_, err = GetBackupStore(context, policy.Destination)
+	if err != nil {
+		return err
+	}
+	catalog, err := LoadBackupCatalog(baseD)
+	if err != nil {
+		return err
+	}
+	catalog.Policy = policy
+	err = catalog.save(baseD)
+	if err != nil {
+		return err
+	}
+	every, _ := time.ParseDuration(policy.Every)
+	for {
+		_, err = RunBackup(context, baseD, dep, policy)
+		if err == nil {
+			err = PruneBackups(context, baseD, dep, policy.Keep)
+		}
+		if once {
+			return err
+		}
+		if err != nil {
+			context.Logf(ERROR, "The backup of %s failed: %s", baseD.Name, err)
+			context.ConsoleLog(0, "%s %s\n", context.FailString("The backup failed:"), err)
+		}
+		context.ConsoleLog(1, "The next backup will run at %s.\n", time.Now().Add(every).Format(time.RFC1123))
+		time.Sleep(every)
+	}
+}
+
+// ListBackups prints the policy and the backups of the deployment.
+func ListBackups(context AppContext, baseD *BaseDeployment) error {
+	catalog, err := LoadBackupCatalog(baseD)
+	if err != nil {
+		return err
+	}
+	if catalog.Policy != nil {
+		context.ConsoleLog(1, "Policy: %s backup every %s to %s, keeping %d\n",
+			catalog.Policy.Method, catalog.Policy.Every, catalog.Policy.Destination, catalog.Policy.Keep)
+	}
+	if len(catalog.Backups) == 0 {
+		context.ConsoleLog(1, "There are no backups.\n")
+		return nil
+	}
+	for _, b := range catalog.Backups {
+		context.ConsoleLog(1, "%s\t%s\t%s\t%s\n", b.ID, b.TimeStamp.Format(time.RFC3339), b.Method, b.Destination)
+	}
+	return nil
+}
+
+// RestoreBackup restores the deployment from one of its backups.  Snapshot
+// backups recreate the volumes, which must have been destroyed first.
+// Database backups are restored into the running cluster.
+func RestoreBackup(context AppContext, baseD *BaseDeployment, dep Deployment, id string) error {
+	catalog, err := LoadBackupCatalog(baseD)
+	if err != nil {
+		return err
+	}
+	record, err := catalog.find(id)
+	if err != nil {
+		return err
+	}
+	switch record.Method {
+	case BackupMethodSnapshot:
+		if dep.VolumeExists() {
+			return fmt.Errorf("The volumes of %s must be destroyed before a snapshot backup can be restored", baseD.Name)
+		}
+		return CreateVolumesFromSnapshots(context, baseD, dep, record.SnapshotSetID)
+	case BackupMethodDatabase:
+		sd, err := dep.FullStatus()
+		if err != nil {
+			return err
+		}
+		for _, db := range record.Databases {
+			context.ConsoleLog(1, "Restoring the database %s...\n", db)
+			err = runClient(context, sd, baseD, dep, []string{"db", "restore", "--overwrite", fmt.Sprintf("%s/%s", record.Location, db)})
+			if err != nil {
+				return err
+			}
+		}
+		context.ConsoleLog(1, "Successfully restored the backup %s.\n", id)
+		return nil
+	}
+	return fmt.Errorf("The backup method %s is not supported", record.Method)
+}
@@ -0,0 +1,75 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestValidateBackupPolicy(t *testing.T) {
+	policy := BackupPolicy{Every: "6h", Keep: 14, Method: BackupMethodSnapshot, Destination: "/tmp"}
+	if err := ValidateBackupPolicy(&policy); err != nil {
+		t.Fatalf("The policy should be valid %s", err)
+	}
+	bad := []BackupPolicy{
+		{Every: "often", Keep: 14, Method: BackupMethodSnapshot, Destination: "/tmp"},
+		{Every: "1s", Keep: 14, Method: BackupMethodSnapshot, Destination: "/tmp"},
+		{Every: "6h", Keep: 0, Method: BackupMethodSnapshot, Destination: "/tmp"},
+		{Every: "6h", Keep: 14, Method: BackupMethodDatabase, Destination: "/tmp"},
+		{Every: "6h", Keep: 14, Method: "tape", Destination: "/tmp"},
+		{Every: "6h", Keep: 14, Method: BackupMethodSnapshot},
+	}
+	for _, p := range bad {
+		if ValidateBackupPolicy(&p) == nil {
+			t.Fatalf("The policy should be invalid %v", p)
+		}
+	}
+}
+
+func TestDirBackupStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	context := &TestContext{ConfigDir: dir}
+
+	_, err := GetBackupStore(context, "ftp://nowhere/backups")
+	if err == nil {
+		t.Fatal("An unknown scheme should fail")
+	}
+	store, err := GetBackupStore(context, "file://"+path.Join(dir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to get the store %s", err)
+	}
+	_, err = store.StardogLocation("b1")
+	if err == nil {
+		t.Fatal("Stardog cannot write to a local directory")
+	}
+	src := path.Join(dir, "set.json")
+	ioutil.WriteFile(src, []byte("{}"), 0644)
+	err = store.Put("b1", src)
+	if err != nil {
+		t.Fatalf("Failed to put the backup %s", err)
+	}
+	if !PathExists(path.Join(dir, "backups", "b1", "set.json")) {
+		t.Fatal("The backup was not copied")
+	}
+	err = store.Delete("b1")
+	if err != nil || PathExists(path.Join(dir, "backups", "b1")) {
+		t.Fatalf("The backup was not deleted %v", err)
+	}
+}
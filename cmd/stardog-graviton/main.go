@@ -16,75 +16,129 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/fatih/color"
-	"github.com/stardog-union/stardog-graviton/aws"
 	"github.com/stardog-union/stardog-graviton"
+	"github.com/stardog-union/stardog-graviton/aws"
+	"github.com/stardog-union/stardog-graviton/docker"
 	"gopkg.in/alecthomas/kingpin.v2"
-	"errors"
+)
+
+const (
+	// logBackups is the number of rotated log files that are kept
+	logBackups = 5
+	// configDirEnv names the environment variable that sets the default
+	// configuration directory.
+	configDirEnv = "STARDOG_VIRTUAL_APPLIANCE_CONFIG_DIR"
 )
 
 var (
 	pluginsMap  map[string]sdutils.Plugin
 	consoleFile *os.File
+	logFile     *sdutils.RotatingFile
+	// pluginFactories makes a fresh instance of every supported cloud type
+	// each time the command line is parsed.
+	pluginFactories = []func() sdutils.Plugin{aws.GetPlugin, docker.GetPlugin}
 )
 
 // CliContext is everything that can come into the CLI
 type CliContext struct {
 	// Common options
-	LicensePath       string             `json:"license_path,omitempty"`
-	PrivateKeyPath    string             `json:"private_key,omitempty"`
-	LogLevel          string             `json:"log_level,omitempty"`
-	CloudType         string             `json:"cloud_type,omitempty"`
-	VolumeSize        int                `json:"volume_size,omitempty"`
-	RootVolumeSize    int                `json:"root_volume_size,omitempty"`
-	Quiet             bool               `json:"quiet,omitempty"`
-	ClusterSize       int                `json:"cluster_size,omitempty"`
-	SdReleaseFilePath string             `json:"release_file,omitempty"`
-	ZkClusterSize     int                `json:"zookeeper_size,omitempty"`
-	Version           string             `json:"sd_version,omitempty"`
-	CustomSdProps     string             `json:"custom_stardog_properties,omitempty"`
-	CustomLog4J       string             `json:"custom_log4j,omitempty"`
-	OutputFile        string             `json:"output_file,omitempty"`
-	BastionVolSnapshotId  string         `json:"bastion_volume_snapshot_id,omitempty"`
-	HTTPMask          string             `json:"http_mask,omitempty"`
-	ConnectionTimeout int                `json:"connection_timeout,omitempty"`
-	Memory            string             `json:"memory,omitempty"`
-	MemoryStart       string             `json:"memory_start,omitempty"`
-	MemoryMax         string             `json:"memory_max,omitempty"`
-	MemoryDirect      string             `json:"memory_direct,omitempty"`
-	DisableSecurity   bool               `json:"disable_security,omitempty"`
-	CloudOpts         interface{}        `json:"cloud_options"`
-	DeploymentName    string             `json:"-"`
-	CommandList       []string           `json:"-"`
-	ConfigDir         string             `json:"-"`
-	LogFilePath       string             `json:"-"`
-	VerboseLevel      int                `json:"-"`
-	ConsoleLevel      int                `json:"-"`
-	Logger            sdutils.SdVaLogger `json:"-"`
-	InternalHealth    bool               `json:"-"`
-	Force             bool               `json:"-"`
-	Interactive       bool               `json:"-"`
-	Destroy           bool               `json:"-"`
-	NoWaitForHealthy  bool               `json:"-"`
-	WaitMaxTimeSec    int                `json:"-"`
-	ConsoleFile       string             `json:"-"`
-	ConsoleWriter     io.Writer          `json:"-"`
-	EnvList           []string           `json:"-"`
-	CustomExec        string             `json:"-"`
-	CustomZkExec      string             `json:"-"`
-	highlight         sdutils.ConsoleEffect
-	red               sdutils.ConsoleEffect
-	green             sdutils.ConsoleEffect
+	LicensePath          string                `json:"license_path,omitempty"`
+	PrivateKeyPath       string                `json:"private_key,omitempty"`
+	LogLevel             string                `json:"log_level,omitempty"`
+	LogFormat            string                `json:"log_format,omitempty"`
+	LogMaxSize           int                   `json:"log_max_size,omitempty"`
+	CloudType            string                `json:"cloud_type,omitempty"`
+	VolumeSize           int                   `json:"volume_size,omitempty"`
+	RootVolumeSize       int                   `json:"root_volume_size,omitempty"`
+	Quiet                bool                  `json:"quiet,omitempty"`
+	ClusterSize          int                   `json:"cluster_size,omitempty"`
+	SdReleaseFilePath    string                `json:"release_file,omitempty"`
+	ZkClusterSize        int                   `json:"zookeeper_size,omitempty"`
+	Version              string                `json:"sd_version,omitempty"`
+	CustomSdProps        string                `json:"custom_stardog_properties,omitempty"`
+	CustomLog4J          string                `json:"custom_log4j,omitempty"`
+	OutputFile           string                `json:"output_file,omitempty"`
+	BastionVolSnapshotId string                `json:"bastion_volume_snapshot_id,omitempty"`
+	HTTPMask             string                `json:"http_mask,omitempty"`
+	ConnectionTimeout    int                   `json:"connection_timeout,omitempty"`
+	Memory               string                `json:"memory,omitempty"`
+	MemoryStart          string                `json:"memory_start,omitempty"`
+	MemoryMax            string                `json:"memory_max,omitempty"`
+	MemoryDirect         string                `json:"memory_direct,omitempty"`
+	DisableSecurity      bool                  `json:"disable_security,omitempty"`
+	CredentialProvider   string                `json:"credential_provider,omitempty"`
+	CredentialKey        string                `json:"credential_key,omitempty"`
+	CredentialOptions    map[string]string     `json:"credential_options,omitempty"`
+	TLSCABundle          string                `json:"tls_ca_bundle,omitempty"`
+	CloudOpts            interface{}           `json:"cloud_options"`
+	DeploymentName       string                `json:"-"`
+	SnapshotSetID        string                `json:"-"`
+	SnapshotTag          string                `json:"-"`
+	BackupPolicy         sdutils.BackupPolicy  `json:"-"`
+	BackupEvery          time.Duration         `json:"-"`
+	BackupOnce           bool                  `json:"-"`
+	BackupID             string                `json:"-"`
+	ZkNodeID             int                   `json:"-"`
+	CommandList          []string              `json:"-"`
+	ConfigDir            string                `json:"-"`
+	LogFilePath          string                `json:"-"`
+	VerboseLevel         int                   `json:"-"`
+	ConsoleLevel         int                   `json:"-"`
+	Logger               sdutils.SdFieldLogger `json:"-"`
+	InternalHealth       bool                  `json:"-"`
+	Force                bool                  `json:"-"`
+	DryRun               bool                  `json:"-"`
+	TTL                  time.Duration         `json:"-"`
+	StopExpired          bool                  `json:"-"`
+	SpecFile             string                `json:"-"`
+	ConfigFile           string                `json:"-"`
+	ShowEffective        bool                  `json:"-"`
+	SpecFormat           string                `json:"-"`
+	StardogUser          string                `json:"-"`
+	ClientCLI            string                `json:"-"`
+	ClientArgs           []string              `json:"-"`
+	Database             string                `json:"-"`
+	Query                string                `json:"-"`
+	QueryFormat          string                `json:"-"`
+	Variables            map[string]string     `json:"-"`
+	Interactive          bool                  `json:"-"`
+	Destroy              bool                  `json:"-"`
+	NoWaitForHealthy     bool                  `json:"-"`
+	WaitMaxTimeSec       int                   `json:"-"`
+	RollingUpdate        bool                  `json:"-"`
+	AllRegions           bool                  `json:"-"`
+	CheckHealth          bool                  `json:"-"`
+	CopyRegions          []string              `json:"-"`
+	ConsoleFile          string                `json:"-"`
+	ConsoleWriter        io.Writer             `json:"-"`
+	OutputFormat         string                `json:"-"`
+	OutputWriter         io.Writer             `json:"-"`
+	Command              string                `json:"-"`
+	Result               interface{}           `json:"-"`
+	auditStart           time.Time
+	auditBefore          *sdutils.DeploymentSummary
+	EnvList              []string `json:"-"`
+	CustomExec           string   `json:"-"`
+	CustomZkExec         string   `json:"-"`
+	highlight            sdutils.ConsoleEffect
+	red                  sdutils.ConsoleEffect
+	green                sdutils.ConsoleEffect
 }
 
 func main() {
@@ -94,28 +148,97 @@ func main() {
 
 func realMain(args []string) int {
 	pluginsMap = make(map[string]sdutils.Plugin)
-	awsPlugin := aws.GetPlugin()
-	pluginsMap[awsPlugin.GetName()] = awsPlugin
+	for _, newPlugin := range pluginFactories {
+		p := newPlugin()
+		pluginsMap[p.GetName()] = p
+	}
 
+	logFile = nil
 	app, err := parseParameters(args)
+	app.writeAudit(args, err)
+	if logFile != nil {
+		defer logFile.Close()
+	}
+	if app.structuredOutput() {
+		rc := app.writeResult(err)
+		if consoleFile != nil {
+			consoleFile.Close()
+		}
+		return rc
+	}
 	if consoleFile != nil {
 		consoleFile.Close()
 	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s %s\n", app.FailString("Failed:"), err.Error())
 		fmt.Fprint(os.Stderr, "Please check the log files:\n")
-		baseLog := fmt.Sprintf("%s/logs/graviton.log", app.ConfigDir)
-		fmt.Fprintf(os.Stderr, "\t%s\n", app.FailString(baseLog))
-		if app.DeploymentName != "" {
-			depLog := fmt.Sprintf("%s/deployments/%s/logs/graviton.log", app.ConfigDir, app.DeploymentName)
-			fmt.Fprintf(os.Stderr, "\t%s\n", app.FailString(depLog))
+		for _, logFile := range app.logFiles() {
+			fmt.Fprintf(os.Stderr, "\t%s\n", app.FailString(logFile))
 		}
+		return exitCode(err)
+	}
+	app.ConsoleLog(1, "%s", app.SuccessString("Success.\n"))
+	return 0
+}
+
+// commandResult is the single document written for --output json|yaml.
+type commandResult struct {
+	Command string        `json:"command,omitempty"`
+	Success bool          `json:"success"`
+	Result  interface{}   `json:"result,omitempty"`
+	Error   *commandError `json:"error,omitempty"`
+}
+
+type commandError struct {
+	Message  string   `json:"message"`
+	LogFiles []string `json:"log_files,omitempty"`
+}
+
+func (cliContext *CliContext) structuredOutput() bool {
+	return cliContext.OutputFormat != "" && cliContext.OutputFormat != "text"
+}
+
+func (cliContext *CliContext) logFiles() []string {
+	logs := []string{fmt.Sprintf("%s/logs/graviton.log", cliContext.ConfigDir)}
+	if cliContext.DeploymentName != "" {
+		logs = append(logs, fmt.Sprintf("%s/deployments/%s/logs/graviton.log", cliContext.ConfigDir, cliContext.DeploymentName))
+	}
+	return logs
+}
+
+func (cliContext *CliContext) writeResult(cmdErr error) int {
+	doc := commandResult{
+		Command: cliContext.Command,
+		Success: cmdErr == nil,
+		Result:  cliContext.Result,
+	}
+	if cmdErr != nil {
+		doc.Error = &commandError{Message: cmdErr.Error(), LogFiles: cliContext.logFiles()}
+	}
+	w := cliContext.OutputWriter
+	if w == nil {
+		w = os.Stdout
+	}
+	err := sdutils.WriteOutput(w, cliContext.OutputFormat, &doc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write the %s output %s\n", cliContext.OutputFormat, err)
 		return 1
 	}
-	app.ConsoleLog(1, app.SuccessString("Success.\n"))
+	if cmdErr != nil {
+		return exitCode(cmdErr)
+	}
 	return 0
 }
 
+// exitCode is the exit code for a failed command.  A failing remote client
+// passes its own code on.
+func exitCode(err error) int {
+	if remoteErr, ok := err.(*sdutils.RemoteExitError); ok && remoteErr.Code > 0 {
+		return remoteErr.Code
+	}
+	return 1
+}
+
 func (cliContext *CliContext) sshIn(c *kingpin.ParseContext) error {
 	baseD := sdutils.BaseDeployment{
 		Name:            cliContext.DeploymentName,
@@ -133,6 +256,77 @@ func (cliContext *CliContext) sshIn(c *kingpin.ParseContext) error {
 	return sdutils.RunSSH(cliContext, &baseD, d)
 }
 
+func (cliContext *CliContext) passwd(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	if !d.InstanceExists() {
+		return fmt.Errorf("The deployment %s has no instance", baseD.Name)
+	}
+	newPw, err := sdutils.ReadNewPassword(fmt.Sprintf("New password for %s", cliContext.StardogUser))
+	if err != nil {
+		return err
+	}
+	err = sdutils.ChangeUserPassword(cliContext, baseD, d, cliContext.StardogUser, newPw)
+	if err != nil {
+		return err
+	}
+	cliContext.ConsoleLog(1, "Successfully changed the password of %s.\n", cliContext.StardogUser)
+	return nil
+}
+
+// client streams the output of the Stardog client as it runs, so it cannot
+// be wrapped in a json or yaml result.
+func (cliContext *CliContext) client(c *kingpin.ParseContext) error {
+	if cliContext.structuredOutput() {
+		return fmt.Errorf("The client writes the output of %s as it runs and cannot use --output %s, use query for structured results", cliContext.ClientCLI, cliContext.OutputFormat)
+	}
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	return sdutils.RunStardogClient(cliContext, baseD, d, cliContext.ClientCLI, cliContext.ClientArgs)
+}
+
+// queryFormats maps the names accepted by query --format to media types.
+var queryFormats = map[string]string{
+	"csv":    "text/csv",
+	"tsv":    "text/tab-separated-values",
+	"json":   "application/sparql-results+json",
+	"xml":    "application/sparql-results+xml",
+	"turtle": "text/turtle",
+}
+
+func (cliContext *CliContext) query(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	query := cliContext.Query
+	if sdutils.PathExists(query) {
+		data, err := ioutil.ReadFile(query)
+		if err != nil {
+			return err
+		}
+		query = string(data)
+	}
+	results, err := sdutils.QueryDeployment(cliContext, baseD, d, cliContext.Database, query, queryFormats[cliContext.QueryFormat])
+	if err != nil {
+		return err
+	}
+	cliContext.ConsoleLog(0, "%s", results)
+	if len(results) > 0 && results[len(results)-1] != '\n' {
+		cliContext.ConsoleLog(0, "\n")
+	}
+	var doc interface{}
+	if cliContext.QueryFormat != "json" || json.Unmarshal(results, &doc) != nil {
+		doc = string(results)
+	}
+	cliContext.SetResult(doc)
+	return nil
+}
+
 func (cliContext *CliContext) aboutCommand(c *kingpin.ParseContext) error {
 	v, err := sdutils.Asset("etc/version")
 	if err != nil {
@@ -190,7 +384,7 @@ func envNormalize(cliContext *CliContext) error {
 		}
 		if ms > mx {
 			warnMsg := fmt.Sprintf("Memory start was larger than memory max.  Increasing the max to %s", cliContext.MemoryStart)
-			cliContext.Logf(sdutils.WARN, warnMsg)
+			cliContext.Logf(sdutils.WARN, "%s", warnMsg)
 			cliContext.ConsoleLog(1, "%s\n", warnMsg)
 			cliContext.MemoryMax = cliContext.MemoryStart
 		}
@@ -226,7 +420,9 @@ func (cliContext *CliContext) interactive(c *kingpin.ParseContext) error {
 
 	if !plugin.HaveImage(cliContext) {
 		cliContext.ConsoleLog(0, "There is no base image for version %s.\n", cliContext.Version)
-		if cliContext.Force || sdutils.AskUserYesOrNo("Do you wish to build one?") {
+		if cliContext.DryRun {
+			cliContext.ConsoleLog(1, "A launch would build one first.\n")
+		} else if cliContext.Force || sdutils.AskUserYesOrNo("Do you wish to build one?") {
 			err = sdutils.AskUserInteractiveString("What is the path to the Stardog release?", cliContext.SdReleaseFilePath, !cliContext.Interactive, &cliContext.SdReleaseFilePath)
 			if err != nil {
 				return err
@@ -261,8 +457,35 @@ func (cliContext *CliContext) interactive(c *kingpin.ParseContext) error {
 		DisableSecurity: cliContext.DisableSecurity,
 		CustomScript:    cliContext.CustomExec,
 		CustomZkScript:  cliContext.CustomZkExec,
+		Variables:       cliContext.Variables,
+	}
+	baseD.Credentials, err = sdutils.ParseCredentialRef(cliContext.CredentialProvider, cliContext.CredentialKey, cliContext.CredentialOptions)
+	if err != nil {
+		return err
+	}
+	if cliContext.TLSCABundle != "" {
+		cliContext.TLSCABundle, err = sdutils.CheckTLSCABundle(cliContext.TLSCABundle)
+		if err != nil {
+			return err
+		}
 	}
+	plan := sdutils.NewPlanSummary()
 	dep, err := sdutils.LoadDeployment(cliContext, &baseD, false)
+	if err != nil && cliContext.DryRun {
+		// Defining a deployment may create a key pair in the cloud, so it
+		// is only planned.
+		var deploymentPlan *sdutils.PlanSummary
+		deploymentDir := baseD.Directory
+		dep, deploymentPlan, err = sdutils.PlanNewDeployment(cliContext, &baseD)
+		if baseD.Directory != deploymentDir {
+			defer os.RemoveAll(baseD.Directory)
+		}
+		if err != nil {
+			return err
+		}
+		cliContext.ConsoleLog(1, "The deployment %s does not exist, planning it as new.\n", cliContext.DeploymentName)
+		plan.Merge(deploymentPlan)
+	}
 	if err != nil {
 		cliContext.ConsoleLog(1, "Creating the new deployment %s\n", cliContext.DeploymentName)
 		dep, err = sdutils.LoadDeployment(cliContext, &baseD, true)
@@ -270,6 +493,21 @@ func (cliContext *CliContext) interactive(c *kingpin.ParseContext) error {
 			return err
 		}
 	}
+	if cliContext.TTL > 0 && !cliContext.DryRun {
+		expires := time.Now().Add(cliContext.TTL)
+		baseD.Expires = &expires
+		err = sdutils.SetDeploymentState(cliContext, &baseD, sdutils.CurrentState(&baseD))
+		if err != nil {
+			return err
+		}
+		cliContext.ConsoleLog(1, "The deployment %s expires at %s.\n", baseD.Name, expires.Format(time.RFC1123))
+	}
+	if cliContext.TLSCABundle != "" && !cliContext.DryRun {
+		err = sdutils.RecordTLSCABundle(&baseD, cliContext.TLSCABundle)
+		if err != nil {
+			return err
+		}
+	}
 	if !dep.VolumeExists() {
 		err = sdutils.AskUserInteractiveString("What is the path to your Stardog license?", cliContext.LicensePath, !cliContext.Interactive, &cliContext.LicensePath)
 		if err != nil {
@@ -283,7 +521,8 @@ func (cliContext *CliContext) interactive(c *kingpin.ParseContext) error {
 		if err != nil {
 			return err
 		}
-		err = dep.CreateVolumeSet(cliContext.LicensePath, cliContext.VolumeSize, cliContext.ClusterSize)
+	} else {
+		cliContext.ClusterSize, err = dep.ClusterSize()
 		if err != nil {
 			return err
 		}
@@ -292,6 +531,33 @@ func (cliContext *CliContext) interactive(c *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	err = cliContext.confirmCost(dep)
+	if err != nil {
+		return err
+	}
+	if !dep.VolumeExists() {
+		if cliContext.DryRun {
+			volumePlan, err := dep.PlanVolumeSet(cliContext.LicensePath, cliContext.VolumeSize, cliContext.ClusterSize)
+			if err != nil {
+				return err
+			}
+			plan.Merge(volumePlan)
+		} else {
+			err = sdutils.CreateVolumes(cliContext, &baseD, dep, cliContext.LicensePath, cliContext.VolumeSize, cliContext.ClusterSize)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if cliContext.DryRun {
+		instancePlan, err := dep.PlanInstance(cliContext.ClusterSize, cliContext.RootVolumeSize, cliContext.ZkClusterSize, cliContext.ConnectionTimeout, cliContext.BastionVolSnapshotId)
+		if err != nil {
+			return err
+		}
+		plan.Merge(instancePlan)
+		sdutils.ShowPlan(cliContext, plan)
+		return nil
+	}
 	err = sdutils.CreateInstance(cliContext, &baseD, dep, cliContext.RootVolumeSize, cliContext.ZkClusterSize, cliContext.WaitMaxTimeSec, cliContext.ConnectionTimeout, cliContext.HTTPMask, cliContext.BastionVolSnapshotId, cliContext.NoWaitForHealthy)
 	if err != nil {
 		return err
@@ -299,6 +565,26 @@ func (cliContext *CliContext) interactive(c *kingpin.ParseContext) error {
 	return sdutils.FullStatus(cliContext, &baseD, dep, false, cliContext.OutputFile)
 }
 
+// confirmCost shows what the launch is expected to cost and, when the launch
+// is interactive, asks the user whether to go on.  A deployment that cannot
+// be priced is still launched.
+func (cliContext *CliContext) confirmCost(dep sdutils.Deployment) error {
+	estimate, err := dep.EstimateCost(cliContext.VolumeSize, cliContext.ClusterSize, cliContext.RootVolumeSize, cliContext.ZkClusterSize)
+	if err != nil {
+		cliContext.ConsoleLog(1, "The cost could not be estimated: %s\n", err)
+		cliContext.Logf(sdutils.WARN, "The cost could not be estimated: %s", err)
+		return nil
+	}
+	if len(estimate.Items) == 0 {
+		return nil
+	}
+	showCost(cliContext, 1, estimate)
+	if cliContext.Interactive && !cliContext.DryRun && !sdutils.AskUserYesOrNo("Do you wish to launch the deployment?") {
+		return errors.New("The launch was cancelled")
+	}
+	return nil
+}
+
 func (cliContext *CliContext) baseAmiAction(c *kingpin.ParseContext) error {
 	p, err := sdutils.GetPlugin(cliContext.CloudType)
 	if err != nil {
@@ -313,14 +599,57 @@ func (cliContext *CliContext) baseAmiAction(c *kingpin.ParseContext) error {
 	return nil
 }
 
+func (cliContext *CliContext) copyImage(c *kingpin.ParseContext) error {
+	p, err := sdutils.GetPlugin(cliContext.CloudType)
+	if err != nil {
+		return err
+	}
+	return p.CopyImage(cliContext, cliContext.CopyRegions)
+}
+
 func (cliContext *CliContext) leaks(c *kingpin.ParseContext) error {
 	p, err := sdutils.GetPlugin(cliContext.CloudType)
 	if err != nil {
 		return err
 	}
+	err = cliContext.expired(p.GetName())
+	if err != nil {
+		return err
+	}
 	return p.FindLeaks(cliContext, cliContext.DeploymentName, cliContext.Destroy, cliContext.Force)
 }
 
+// expired reports the deployments of the cloud type whose time to live has
+// passed and stops them when asked to.
+func (cliContext *CliContext) expired(cloudType string) error {
+	expired, err := sdutils.ExpiredDeployments(cliContext, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, baseD := range expired {
+		if baseD.Type != cloudType || (cliContext.DeploymentName != "" && baseD.Name != cliContext.DeploymentName) {
+			continue
+		}
+		cliContext.ConsoleLog(1, "The deployment %s expired at %s.\n", baseD.Name, baseD.Expires.Local().Format(time.RFC1123))
+		if !cliContext.StopExpired {
+			continue
+		}
+		dep, err := sdutils.LoadDeployment(cliContext, baseD, false)
+		if err != nil {
+			return err
+		}
+		if !dep.InstanceExists() {
+			continue
+		}
+		cliContext.LogWith(sdutils.INFO, sdutils.LogFields{"deployment": baseD.Name}, "Stopping the expired deployment %s", baseD.Name)
+		err = sdutils.StopDeployment(cliContext, baseD, dep)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (cliContext *CliContext) newDeployment(c *kingpin.ParseContext) error {
 	err := envNormalize(cliContext)
 	if err != nil {
@@ -341,26 +670,108 @@ func (cliContext *CliContext) newDeployment(c *kingpin.ParseContext) error {
 		CustomScript:    cliContext.CustomExec,
 		CustomZkScript:  cliContext.CustomZkExec,
 	}
+	baseD.Credentials, err = sdutils.ParseCredentialRef(cliContext.CredentialProvider, cliContext.CredentialKey, cliContext.CredentialOptions)
+	if err != nil {
+		return err
+	}
+	if cliContext.TLSCABundle != "" {
+		cliContext.TLSCABundle, err = sdutils.CheckTLSCABundle(cliContext.TLSCABundle)
+		if err != nil {
+			return err
+		}
+	}
+	baseD.TLSCABundle = cliContext.TLSCABundle
 	_, err = sdutils.LoadDeployment(cliContext, &baseD, true)
 	return err
 }
 
 func (cliContext *CliContext) deploymentList(c *kingpin.ParseContext) error {
-	depDir := sdutils.DeploymentDir(cliContext.GetConfigDir(), cliContext.DeploymentName)
-	files, _ := ioutil.ReadDir(depDir)
-	for _, f := range files {
-		if f.IsDir() {
-			cliContext.ConsoleLog(0, "%s\n", f.Name())
+	deployments, err := sdutils.ListDeployments(cliContext)
+	if err != nil {
+		return err
+	}
+	summaries := []*sdutils.DeploymentSummary{}
+	for _, baseD := range deployments {
+		p, err := sdutils.GetPlugin(baseD.Type)
+		if err == nil {
+			region := p.DeploymentRegion(baseD)
+			// Deployments in other regions are only shown when asked for
+			if !cliContext.AllRegions && region != "" && region != p.GetRegion() {
+				continue
+			}
+		}
+		summaries = append(summaries, sdutils.SummarizeDeployment(cliContext, baseD))
+	}
+	if cliContext.CheckHealth {
+		spin := sdutils.NewSpinner(cliContext, 1, "Checking the health of the deployments")
+		sdutils.CheckDeploymentsHealth(cliContext, summaries)
+		spin.Close()
+	}
+	cliContext.SetResult(summaries)
+	if len(summaries) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	header := "NAME\tREGION\tTYPE\tVERSION\tIMAGE\tSTATE\tVOLUMES\tINSTANCE\tNODES\tZK\tCREATED"
+	if cliContext.CheckHealth {
+		header = header + "\tHEALTH"
+	}
+	fmt.Fprintln(w, header)
+	for _, s := range summaries {
+		created := "-"
+		if s.Created != nil {
+			created = s.Created.Local().Format("2006-01-02 15:04")
+		}
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
+			s.Name, dashIfEmpty(s.Region), dashIfEmpty(s.Type), dashIfEmpty(s.Version), dashIfEmpty(s.Image), s.State,
+			yesOrNo(s.VolumesExist), yesOrNo(s.InstanceExists), countOrDash(s.ClusterSize), countOrDash(s.ZkSize), created)
+		if s.Healthy != nil {
+			if *s.Healthy {
+				line = line + "\thealthy"
+			} else {
+				line = line + "\tunhealthy"
+			}
 		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	// The header is left out of --quiet so that the names can be scripted
+	cliContext.ConsoleLog(1, "%s\n", lines[0])
+	for _, l := range lines[1:] {
+		cliContext.ConsoleLog(0, "%s\n", l)
 	}
 	return nil
 }
 
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func yesOrNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func countOrDash(n int) string {
+	if n < 1 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", n)
+}
+
 func (cliContext *CliContext) destroyDeployment(c *kingpin.ParseContext) error {
 	if !cliContext.Force && !sdutils.AskUserYesOrNo("Do you really want to destroy?") {
 		return nil
 	}
-	d, err := loadDepWrapper(cliContext, false)
+	_, d, err := loadDepWrapper(cliContext, false)
 	if err != nil {
 		return err
 	}
@@ -402,6 +813,9 @@ func (cliContext *CliContext) updateStardog(c *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	if cliContext.RollingUpdate {
+		return sdutils.UpdateStardogRolling(cliContext, &baseD, d, cliContext.SdReleaseFilePath, cliContext.WaitMaxTimeSec)
+	}
 	return sdutils.UpdateStardog(cliContext, &baseD, d, cliContext.SdReleaseFilePath)
 }
 
@@ -440,10 +854,29 @@ func (cliContext *CliContext) fullStatus(c *kingpin.ParseContext) error {
 }
 
 func (cliContext *CliContext) destroyFullDeployment(c *kingpin.ParseContext) error {
-	d, err := loadDepWrapper(cliContext, false)
+	_, d, err := loadDepWrapper(cliContext, false)
 	if err != nil {
 		return err
 	}
+	if cliContext.DryRun {
+		plan := sdutils.NewPlanSummary()
+		if d.InstanceExists() {
+			instancePlan, err := d.PlanDeleteInstance()
+			if err != nil {
+				return err
+			}
+			plan.Merge(instancePlan)
+		}
+		if d.VolumeExists() {
+			volumePlan, err := d.PlanDeleteVolumeSet()
+			if err != nil {
+				return err
+			}
+			plan.Merge(volumePlan)
+		}
+		sdutils.ShowPlan(cliContext, plan)
+		return nil
+	}
 	cliContext.ConsoleLog(0, "This will destroy all volumes and instances associated with this deployment.\n")
 	if !cliContext.Force && !sdutils.AskUserYesOrNo("Do you really want to destroy?") {
 		return nil
@@ -467,26 +900,103 @@ func (cliContext *CliContext) destroyFullDeployment(c *kingpin.ParseContext) err
 }
 
 func (cliContext *CliContext) newVolumes(c *kingpin.ParseContext) error {
-	d, err := loadDepWrapper(cliContext, false)
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	// The deployment is the only argument when restoring from snapshots.
+	argCount := 0
+	for _, e := range c.Elements {
+		if _, ok := e.Clause.(*kingpin.ArgClause); ok {
+			argCount++
+		}
+	}
+	if cliContext.SnapshotSetID != "" {
+		if argCount > 1 {
+			return errors.New("The license, size and count cannot be used with --from-snapshot-set")
+		}
+		if cliContext.DryRun {
+			return errors.New("A dry run cannot be used with --from-snapshot-set")
+		}
+		return sdutils.CreateVolumesFromSnapshots(cliContext, baseD, d, cliContext.SnapshotSetID)
+	}
+	if argCount < 4 {
+		return errors.New("The license, size and count are required unless --from-snapshot-set is used")
+	}
+	if cliContext.DryRun {
+		plan, err := d.PlanVolumeSet(cliContext.LicensePath, cliContext.VolumeSize, cliContext.ClusterSize)
+		if err != nil {
+			return err
+		}
+		sdutils.ShowPlan(cliContext, plan)
+		return nil
+	}
+	return sdutils.CreateVolumes(cliContext, baseD, d, cliContext.LicensePath, cliContext.VolumeSize, cliContext.ClusterSize)
+}
+
+func (cliContext *CliContext) snapshotVolumes(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	_, err = sdutils.SnapshotVolumes(cliContext, baseD, d, cliContext.SnapshotTag)
+	return err
+}
+
+func (cliContext *CliContext) backupSchedule(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	policy := cliContext.BackupPolicy
+	policy.Every = cliContext.BackupEvery.String()
+	if policy.Destination == "" {
+		policy.Destination = path.Join(baseD.Directory, "backups")
+	}
+	return sdutils.ScheduleBackups(cliContext, baseD, d, &policy, cliContext.BackupOnce)
+}
+
+func (cliContext *CliContext) backupList(c *kingpin.ParseContext) error {
+	baseD, _, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	return sdutils.ListBackups(cliContext, baseD)
+}
+
+func (cliContext *CliContext) backupRestore(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
 	if err != nil {
 		return err
 	}
-	return d.CreateVolumeSet(cliContext.LicensePath, cliContext.VolumeSize, cliContext.ClusterSize)
+	return sdutils.RestoreBackup(cliContext, baseD, d, cliContext.BackupID)
 }
 
 func (cliContext *CliContext) destroyVolumes(c *kingpin.ParseContext) error {
+	if cliContext.DryRun {
+		_, d, err := loadDepWrapper(cliContext, false)
+		if err != nil {
+			return err
+		}
+		plan, err := d.PlanDeleteVolumeSet()
+		if err != nil {
+			return err
+		}
+		sdutils.ShowPlan(cliContext, plan)
+		return nil
+	}
 	if !cliContext.Force && !sdutils.AskUserYesOrNo("Do you really want to destroy?") {
 		return nil
 	}
-	d, err := loadDepWrapper(cliContext, false)
+	baseD, d, err := loadDepWrapper(cliContext, false)
 	if err != nil {
 		return err
 	}
-	return d.DeleteVolumeSet()
+	return sdutils.DeleteVolumes(cliContext, baseD, d)
 }
 
 func (cliContext *CliContext) statusVolumes(c *kingpin.ParseContext) error {
-	d, err := loadDepWrapper(cliContext, false)
+	_, d, err := loadDepWrapper(cliContext, false)
 	if err != nil {
 		return err
 	}
@@ -507,47 +1017,562 @@ func (cliContext *CliContext) launchInstance(c *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	if cliContext.DryRun {
+		clusterSize, err := dep.ClusterSize()
+		if err != nil {
+			return err
+		}
+		plan, err := dep.PlanInstance(clusterSize, cliContext.RootVolumeSize, cliContext.ZkClusterSize, cliContext.ConnectionTimeout, cliContext.BastionVolSnapshotId)
+		if err != nil {
+			return err
+		}
+		sdutils.ShowPlan(cliContext, plan)
+		return nil
+	}
+	if cliContext.TLSCABundle != "" {
+		err = sdutils.RecordTLSCABundle(&baseD, cliContext.TLSCABundle)
+		if err != nil {
+			return err
+		}
+	}
 
 	return sdutils.CreateInstance(cliContext, &baseD, dep, cliContext.RootVolumeSize, cliContext.ZkClusterSize, cliContext.WaitMaxTimeSec, cliContext.ConnectionTimeout, cliContext.HTTPMask, cliContext.BastionVolSnapshotId, cliContext.NoWaitForHealthy)
 }
 
 func (cliContext *CliContext) destroyInstance(c *kingpin.ParseContext) error {
+	if cliContext.DryRun {
+		_, d, err := loadDepWrapper(cliContext, false)
+		if err != nil {
+			return err
+		}
+		plan, err := d.PlanDeleteInstance()
+		if err != nil {
+			return err
+		}
+		sdutils.ShowPlan(cliContext, plan)
+		return nil
+	}
 	if !cliContext.Force && !sdutils.AskUserYesOrNo("Do you really want to destroy?") {
 		return nil
 	}
-	d, err := loadDepWrapper(cliContext, false)
+	baseD, d, err := loadDepWrapper(cliContext, false)
 	if err != nil {
 		return err
 	}
-	return d.DeleteInstance()
+	return sdutils.DeleteInstance(cliContext, baseD, d)
 }
 
 func (cliContext *CliContext) statusInstance(c *kingpin.ParseContext) error {
-	d, err := loadDepWrapper(cliContext, false)
+	_, d, err := loadDepWrapper(cliContext, false)
 	if err != nil {
 		return err
 	}
 	return d.StatusInstance()
 }
 
-// GetInteractive returns a bool indicating whether or not the user should be bothered
-// with questions.
-func (cliContext *CliContext) GetInteractive() bool {
-	return !cliContext.Force
+func (cliContext *CliContext) stopInstance(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	return sdutils.StopDeployment(cliContext, baseD, d)
 }
 
-// ConsoleLog will write the formatted string to the console if the user is interested
-// in information at the associated level (regaring --versbose --quiet)
-func (cliContext *CliContext) ConsoleLog(level int, format string, v ...interface{}) {
-	if level > cliContext.ConsoleLevel {
-		return
-	}
-	_, err := fmt.Fprintf(cliContext.ConsoleWriter, format, v...)
+func (cliContext *CliContext) startInstance(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	err = sdutils.StartDeployment(cliContext, baseD, d, cliContext.WaitMaxTimeSec)
+	if err != nil {
+		return err
+	}
+	return sdutils.FullStatus(cliContext, baseD, d, false, cliContext.OutputFile)
+}
+
+func (cliContext *CliContext) resume(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	err = sdutils.ResumeDeployment(cliContext, baseD, d, cliContext.WaitMaxTimeSec)
+	if err != nil {
+		return err
+	}
+	return sdutils.FullStatus(cliContext, baseD, d, false, cliContext.OutputFile)
+}
+
+func (cliContext *CliContext) scale(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	return sdutils.ScaleDeployment(cliContext, baseD, d, cliContext.ClusterSize, cliContext.WaitMaxTimeSec)
+}
+
+func (cliContext *CliContext) reimage(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	return sdutils.ReimageDeployment(cliContext, baseD, d, cliContext.WaitMaxTimeSec)
+}
+
+func (cliContext *CliContext) zkResize(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	return sdutils.ResizeZookeeper(cliContext, baseD, d, cliContext.ZkClusterSize, cliContext.WaitMaxTimeSec)
+}
+
+func (cliContext *CliContext) zkReplace(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	return sdutils.ReplaceZookeeper(cliContext, baseD, d, cliContext.ZkNodeID, cliContext.WaitMaxTimeSec)
+}
+
+// readOnlyCommands do not change a deployment and are left out of its
+// audit journal.
+var readOnlyCommands = map[string]bool{
+	"status":          true,
+	"logs":            true,
+	"history":         true,
+	"drift":           true,
+	"cost":            true,
+	"export":          true,
+	"query":           true,
+	"config schema":   true,
+	"config validate": true,
+	"config show":     true,
+	"volume status":   true,
+	"instance status": true,
+	"backup list":     true,
+	"deployment list": true,
+}
+
+func (cliContext *CliContext) audited() bool {
+	return cliContext.Logger != nil && cliContext.Command != "" && !readOnlyCommands[cliContext.Command] && !cliContext.DryRun
+}
+
+// auditSummary describes the deployment so that the resources touched by a
+// command can be found by comparing the summaries from before and after it.
+func (cliContext *CliContext) auditSummary() *sdutils.DeploymentSummary {
+	if cliContext.DeploymentName == "" {
+		return nil
+	}
+	baseD, err := sdutils.ReadBaseDeployment(cliContext, cliContext.DeploymentName)
+	if err != nil {
+		return nil
+	}
+	return sdutils.SummarizeDeployment(cliContext, baseD)
+}
+
+func (cliContext *CliContext) startAudit() {
+	cliContext.auditStart = time.Now()
+	if cliContext.audited() {
+		cliContext.auditBefore = cliContext.auditSummary()
+	}
+}
+
+// writeAudit appends the outcome of the command to the audit journal of the
+// deployment it worked on.
+func (cliContext *CliContext) writeAudit(args []string, cmdErr error) {
+	if !cliContext.audited() || cliContext.DeploymentName == "" {
+		return
+	}
+	after := cliContext.auditSummary()
+	if cliContext.auditBefore == nil && after == nil {
+		// Nothing was ever created for this name
+		return
+	}
+	entry := sdutils.AuditEntry{
+		Command:   cliContext.Command,
+		Args:      sdutils.RedactArgs(args),
+		Start:     cliContext.auditStart,
+		End:       time.Now(),
+		Outcome:   sdutils.AuditSuccess,
+		Resources: sdutils.DescribeChanges(cliContext.auditBefore, after),
+	}
+	if cmdErr != nil {
+		entry.Outcome = sdutils.AuditFailure
+		entry.Error = cmdErr.Error()
+	}
+	if usr, err := user.Current(); err == nil {
+		entry.User = usr.Username
+	}
+	if v, err := sdutils.Asset("etc/version"); err == nil {
+		entry.GravitonVersion = strings.TrimSpace(string(v))
+	}
+	err := sdutils.AppendAuditEntry(cliContext, cliContext.DeploymentName, &entry)
+	if err != nil {
+		cliContext.Logf(sdutils.WARN, "Failed to write the audit journal: %s", err)
+	}
+}
+
+func (cliContext *CliContext) history(c *kingpin.ParseContext) error {
+	entries, err := sdutils.LoadAuditJournal(cliContext, cliContext.DeploymentName)
+	if err != nil {
+		return err
+	}
+	cliContext.SetResult(entries)
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tDURATION\tUSER\tOUTCOME\tCOMMAND\tCHANGES")
+	for _, e := range entries {
+		changes := strings.Join(e.Resources, ", ")
+		if changes == "" {
+			changes = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Start.Local().Format("2006-01-02 15:04:05"), e.End.Sub(e.Start).Round(time.Second), dashIfEmpty(e.User),
+			e.Outcome, strings.Join(e.Args, " "), changes)
+	}
+	w.Flush()
+	cliContext.ConsoleLog(0, "%s", buf.String())
+	return nil
+}
+
+// showCost prints the items of the estimate and the totals at the given
+// console level.
+func showCost(cliContext *CliContext, level int, estimate *sdutils.CostEstimate) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE\tDETAIL\tCOUNT\tHOURLY\tMONTHLY")
+	for _, i := range estimate.Items {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.4f\t%.2f\n", i.Resource, dashIfEmpty(i.Detail), i.Count, i.Hourly, i.Monthly)
+	}
+	w.Flush()
+	cliContext.ConsoleLog(level, "Estimated cost in %s:\n", estimate.Region)
+	cliContext.ConsoleLog(level, "%s", buf.String())
+	cliContext.ConsoleLog(level, "Total: %.4f %s per hour, %.2f %s per month.\n", estimate.Hourly, estimate.Currency, estimate.Monthly, estimate.Currency)
+}
+
+func (cliContext *CliContext) cost(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	defaults := sdutils.LaunchParameters{
+		VolumeSize:     cliContext.VolumeSize,
+		ClusterSize:    cliContext.ClusterSize,
+		RootVolumeSize: cliContext.RootVolumeSize,
+		ZkSize:         cliContext.ZkClusterSize,
+	}
+	estimate, err := sdutils.DeploymentCost(baseD, d, defaults)
+	if err != nil {
+		return err
+	}
+	cliContext.SetResult(estimate)
+	if len(estimate.Items) == 0 {
+		cliContext.ConsoleLog(1, "The deployment %s has no cloud resources to pay for.\n", baseD.Name)
+		return nil
+	}
+	showCost(cliContext, 0, estimate)
+	return nil
+}
+
+// drift fails when the deployment no longer matches what graviton recorded
+// so that it can be used as a check.
+func (cliContext *CliContext) drift(c *kingpin.ParseContext) error {
+	baseD, d, err := loadDepWrapper(cliContext, false)
+	if err != nil {
+		return err
+	}
+	items, err := sdutils.DetectDrift(cliContext, baseD, d)
+	if err != nil {
+		return err
+	}
+	cliContext.SetResult(items)
+	if len(items) == 0 {
+		cliContext.ConsoleLog(1, "The deployment %s matches its recorded state.\n", baseD.Name)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tSOURCE\tRESOURCE\tDETAIL")
+	for _, i := range items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", i.Kind, i.Source, i.Resource, dashIfEmpty(i.Detail))
+	}
+	w.Flush()
+	cliContext.ConsoleLog(0, "%s", buf.String())
+	return fmt.Errorf("The deployment %s has drifted from its recorded state", baseD.Name)
+}
+
+// applySpec sets the launch options from a deployment spec.  The sizes and
+// paths that the spec leaves out keep their defaults.
+func (cliContext *CliContext) applySpec(spec *sdutils.DeploymentSpec) error {
+	cliContext.DeploymentName = spec.Name
+	cliContext.CloudType = spec.Type
+	cliContext.Version = spec.Version
+	if spec.License != "" {
+		cliContext.LicensePath = spec.License
+	}
+	if spec.PrivateKey != "" {
+		cliContext.PrivateKeyPath = spec.PrivateKey
+	}
+	if spec.ClusterSize > 0 {
+		cliContext.ClusterSize = spec.ClusterSize
+	}
+	if spec.ZookeeperSize > 0 {
+		cliContext.ZkClusterSize = spec.ZookeeperSize
+	}
+	if spec.VolumeSize > 0 {
+		cliContext.VolumeSize = spec.VolumeSize
+	}
+	if spec.RootVolumeSize > 0 {
+		cliContext.RootVolumeSize = spec.RootVolumeSize
+	}
+	if spec.IdleTimeout > 0 {
+		cliContext.ConnectionTimeout = spec.IdleTimeout
+	}
+	if spec.HTTPMask != "" {
+		cliContext.HTTPMask = spec.HTTPMask
+	}
+	if spec.Memory != "" {
+		cliContext.Memory = spec.Memory
+	}
+	cliContext.EnvList = append([]string{}, spec.Environment...)
+	cliContext.CustomSdProps = spec.CustomProperties
+	cliContext.CustomLog4J = spec.CustomLog4J
+	cliContext.CustomExec = spec.CustomScript
+	cliContext.CustomZkExec = spec.CustomZkScript
+	cliContext.DisableSecurity = spec.DisableSecurity
+	cliContext.Variables = spec.Variables
+	cliContext.Force = true
+	cliContext.Interactive = false
+
+	err := cliContext.envValidate(nil)
+	if err != nil {
+		return err
+	}
+	plugin, err := sdutils.GetPlugin(spec.Type)
+	if err != nil {
+		return err
+	}
+	if spec.Cloud != nil {
+		err = plugin.LoadDefaults(spec.Cloud)
+		if err != nil {
+			return err
+		}
+	}
+	sdutils.SetVariables(spec.Variables)
+	return nil
+}
+
+func showSpecChanges(cliContext *CliContext, changes []sdutils.SpecChange) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tCURRENT\tDESIRED\tIN PLACE")
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Field, dashIfEmpty(c.Current), dashIfEmpty(c.Desired), yesOrNo(c.InPlace))
+	}
+	w.Flush()
+	cliContext.ConsoleLog(1, "%s", buf.String())
+}
+
+// apply converges a deployment to a spec.  A deployment that does not exist
+// or has no instance is launched from the spec.  On an existing deployment
+// the Stardog cluster and the ZooKeeper ensemble are resized, a new mask or
+// idle timeout opens the instance again, a new configuration replaces the
+// Stardog nodes one at a time and a new version is rolled out from the
+// release given with --release.  The fields that cannot change in place are
+// an error.
+func (cliContext *CliContext) apply(c *kingpin.ParseContext) error {
+	spec, err := sdutils.ReadSpec(cliContext.SpecFile)
+	if err != nil {
+		return err
+	}
+	err = cliContext.applySpec(spec)
+	if err != nil {
+		return err
+	}
+	if cliContext.audited() {
+		cliContext.auditBefore = cliContext.auditSummary()
+	}
+
+	baseD, err := sdutils.ReadBaseDeployment(cliContext, spec.Name)
+	if err != nil {
+		cliContext.ConsoleLog(1, "The deployment %s does not exist yet.\n", spec.Name)
+		return cliContext.interactive(c)
+	}
+	dep, err := sdutils.LoadDeployment(cliContext, baseD, false)
+	if err != nil {
+		return err
+	}
+	plugin, err := sdutils.GetPlugin(baseD.Type)
+	if err != nil {
+		return err
+	}
+	err = envNormalize(cliContext)
+	if err != nil {
+		return err
+	}
+	desired := *spec
+	desired.Memory = ""
+	desired.Environment = cliContext.EnvList
+	changes := sdutils.DiffSpec(sdutils.ExportSpec(baseD, dep, plugin), &desired)
+	cliContext.SetResult(changes)
+	if len(changes) > 0 {
+		showSpecChanges(cliContext, changes)
+	}
+	fixed := []string{}
+	for _, change := range changes {
+		if !change.InPlace {
+			fixed = append(fixed, change.Field)
+		}
+	}
+	if len(fixed) > 0 {
+		return fmt.Errorf("The deployment %s cannot be changed in place (%s).  Destroy it and apply the spec again", spec.Name, strings.Join(fixed, ", "))
+	}
+	for _, change := range changes {
+		if change.Field == "stardog_version" && cliContext.SdReleaseFilePath == "" {
+			return fmt.Errorf("The Stardog version changes from %s to %s, pass the release with --release", change.Current, change.Desired)
+		}
+	}
+
+	if !dep.InstanceExists() {
+		cliContext.ConsoleLog(1, "The deployment %s is not complete.\n", spec.Name)
+		err = cliContext.interactive(c)
+		if err != nil || cliContext.DryRun {
+			return err
+		}
+		baseD, err = sdutils.ReadBaseDeployment(cliContext, spec.Name)
+		if err != nil {
+			return err
+		}
+		dep, err = sdutils.LoadDeployment(cliContext, baseD, false)
+		if err != nil {
+			return err
+		}
+	}
+	if len(changes) == 0 {
+		cliContext.ConsoleLog(1, "The deployment %s already matches the spec.\n", spec.Name)
+		return nil
+	}
+	if cliContext.DryRun {
+		return nil
+	}
+	reopen, reconfigure, update := false, false, false
+	for _, change := range changes {
+		switch change.Field {
+		case "zookeeper_size":
+			err = sdutils.ResizeZookeeper(cliContext, baseD, dep, spec.ZookeeperSize, cliContext.WaitMaxTimeSec)
+		case "cluster_size":
+			err = sdutils.ScaleDeployment(cliContext, baseD, dep, spec.ClusterSize, cliContext.WaitMaxTimeSec)
+		case "http_mask", "idle_timeout":
+			reopen = true
+		case "stardog_version":
+			update = true
+		default:
+			reconfigure = true
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if reopen {
+		err = sdutils.ReopenInstance(cliContext, baseD, dep, spec.HTTPMask, spec.IdleTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	if reconfigure {
+		baseD.Environment = cliContext.EnvList
+		baseD.CustomPropsFile = cliContext.CustomSdProps
+		baseD.CustomLog4J = cliContext.CustomLog4J
+		baseD.CustomScript = cliContext.CustomExec
+		baseD.CustomZkScript = cliContext.CustomZkExec
+		baseD.DisableSecurity = cliContext.DisableSecurity
+		err = sdutils.ReconfigureDeployment(cliContext, baseD, cliContext.WaitMaxTimeSec)
+		if err != nil {
+			return err
+		}
+		dep, err = sdutils.LoadDeployment(cliContext, baseD, false)
+		if err != nil {
+			return err
+		}
+	}
+	// The new binaries are rolled out last because replacing a node starts
+	// it from the image again.
+	if update {
+		err = sdutils.UpdateStardogRolling(cliContext, baseD, dep, cliContext.SdReleaseFilePath, cliContext.WaitMaxTimeSec)
+		if err != nil {
+			return err
+		}
+		baseD.Version = spec.Version
+		err = sdutils.SetDeploymentSettings(baseD)
+		if err != nil {
+			return err
+		}
+	}
+	cliContext.ConsoleLog(1, "Successfully applied the spec to the deployment %s.\n", spec.Name)
+	return nil
+}
+
+// export writes the spec of an existing deployment so that it can be applied
+// again later or elsewhere.
+func (cliContext *CliContext) export(c *kingpin.ParseContext) error {
+	baseD, err := sdutils.ReadBaseDeployment(cliContext, cliContext.DeploymentName)
+	if err != nil {
+		return fmt.Errorf("The deployment %s does not exist", cliContext.DeploymentName)
+	}
+	dep, err := sdutils.LoadDeployment(cliContext, baseD, false)
+	if err != nil {
+		return err
+	}
+	plugin, err := sdutils.GetPlugin(baseD.Type)
+	if err != nil {
+		return err
+	}
+	spec := sdutils.ExportSpec(baseD, dep, plugin)
+	cliContext.SetResult(spec)
+
+	var buf bytes.Buffer
+	err = sdutils.WriteOutput(&buf, cliContext.SpecFormat, spec)
+	if err != nil {
+		return err
+	}
+	if cliContext.SpecFile == "" {
+		cliContext.ConsoleLog(0, "%s", buf.String())
+		return nil
+	}
+	err = ioutil.WriteFile(cliContext.SpecFile, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	cliContext.ConsoleLog(1, "Successfully exported the deployment %s to %s.\n", baseD.Name, cliContext.SpecFile)
+	return nil
+}
+
+// GetInteractive returns a bool indicating whether or not the user should be bothered
+// with questions.
+func (cliContext *CliContext) GetInteractive() bool {
+	return !cliContext.Force
+}
+
+// ConsoleLog will write the formatted string to the console if the user is interested
+// in information at the associated level (regaring --versbose --quiet)
+func (cliContext *CliContext) ConsoleLog(level int, format string, v ...interface{}) {
+	if level > cliContext.ConsoleLevel {
+		return
+	}
+	_, err := fmt.Fprintf(cliContext.ConsoleWriter, format, v...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to write to the file %s\n", err)
 	}
 }
 
+// SetResult records the structured result of the command.  It is only
+// written out when a json or yaml output format was requested.
+func (cliContext *CliContext) SetResult(result interface{}) {
+	cliContext.Result = result
+}
+
 // HighlightString writes the formatted string to the console in a bright display.
 func (cliContext *CliContext) HighlightString(a ...interface{}) string {
 	return cliContext.highlight(a...)
@@ -578,6 +1603,11 @@ func (cliContext *CliContext) Logf(level int, format string, v ...interface{}) {
 	cliContext.Logger.Logf(level, format, v...)
 }
 
+// LogWith writes a log line with structured fields to the configured logger.
+func (cliContext *CliContext) LogWith(level int, fields sdutils.LogFields, format string, v ...interface{}) {
+	cliContext.Logger.LogWith(level, fields, format, v...)
+}
+
 func (cliContext *CliContext) nameValidate(a *kingpin.CmdClause) error {
 	if len(cliContext.DeploymentName) > 20 {
 		return errors.New("The deployment name must be less than 20 characters")
@@ -620,54 +1650,296 @@ func (cliContext *CliContext) topValidate(a *kingpin.Application) error {
 	if cliContext.ConsoleFile == "" {
 		cliContext.ConsoleWriter = os.Stdout
 	} else {
-		consoleFile, err = os.OpenFile(cliContext.ConsoleFile, os.O_CREATE|os.O_WRONLY, 0644)
+		consoleFile, err = os.OpenFile(cliContext.ConsoleFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 		if err != nil {
 			return fmt.Errorf("Failed to create the console file %s", cliContext.ConsoleFile)
 		}
 		cliContext.ConsoleWriter = consoleFile
 	}
+	if cliContext.structuredOutput() {
+		// The document owns stdout (or the console file) so the free text
+		// console lines are moved to stderr.
+		cliContext.OutputWriter = cliContext.ConsoleWriter
+		cliContext.ConsoleWriter = os.Stderr
+	}
 
 	logDir := path.Dir(cliContext.LogFilePath)
 	if _, err := os.Stat(logDir); os.IsNotExist(err) {
 		os.MkdirAll(logDir, 0755)
 	}
-	logWriter, err := os.OpenFile(cliContext.LogFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	logFile, err = sdutils.NewRotatingFile(cliContext.LogFilePath, int64(cliContext.LogMaxSize)*1024*1024, logBackups)
 	if err != nil {
 		fmt.Printf("COULDNT OPEN %s\n", cliContext.LogFilePath)
 		return fmt.Errorf("Could not open the file %s.  %s", cliContext.LogFilePath, err.Error())
 	}
 	cliContext.LogLevel = strings.ToUpper(cliContext.LogLevel)
-	baseLogger := log.New(logWriter, "", log.Ldate|log.Ltime)
-	cliContext.Logger, err = sdutils.NewSdVaLogger(baseLogger, cliContext.LogLevel)
+	logger, err := sdutils.NewSdFieldLogger(logFile, cliContext.LogLevel, cliContext.LogFormat)
+	if err != nil {
+		return err
+	}
+	cliContext.Logger = logger.With(sdutils.LogFields{"command": cliContext.Command, "deployment": cliContext.DeploymentName})
 
 	cliContext.ConsoleLevel = cliContext.VerboseLevel + 1
 	if cliContext.Quiet {
 		cliContext.ConsoleLevel = 0
 	}
 	cliContext.ConsoleLog(2, "Logging to the file %s\n", cliContext.LogFilePath)
+	cliContext.startAudit()
 	return nil
 }
 
-func loadDefaultCliOptions(confDir string) *CliContext {
-	var err error
+// The sources of the options shown by config show --effective.
+const (
+	sourceDefault = "default"
+	sourceFile    = "default.json"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
 
-	usr, err := user.Current()
-	if confDir == "" {
-		confDir = os.Getenv("STARDOG_VIRTUAL_APPLIANCE_CONFIG_DIR")
-		if confDir == "" {
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to get a current user home directory. Using the current directory. Error: %s\n", err)
-				confDir = ".graviton"
-			} else {
-				confDir = filepath.Join(usr.HomeDir, ".graviton")
+// configValue is an option of the effective configuration and where its
+// value came from.
+type configValue struct {
+	Option string      `json:"option"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// sortedPlugins returns the registered plugins ordered by name.
+func sortedPlugins() []sdutils.Plugin {
+	names := make([]string, 0, len(pluginsMap))
+	for name := range pluginsMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	plugins := make([]sdutils.Plugin, len(names))
+	for i, name := range names {
+		plugins[i] = pluginsMap[name]
+	}
+	return plugins
+}
+
+// configSchema describes default.json.  The cloud_options may be those of
+// any of the plugins.
+func configSchema(plugins []sdutils.Plugin) *sdutils.JSONSchema {
+	schema := sdutils.SchemaFor(CliContext{})
+	schema.Schema = sdutils.SchemaDraft
+	schema.Title = "stardog-graviton default.json"
+	cloud := &sdutils.JSONSchema{}
+	cloudTypes := []interface{}{}
+	for _, p := range plugins {
+		pluginSchema := sdutils.SchemaFor(p)
+		pluginSchema.Title = p.GetName()
+		cloud.AnyOf = append(cloud.AnyOf, pluginSchema)
+		cloudTypes = append(cloudTypes, p.GetName())
+	}
+	schema.Properties["cloud_options"] = cloud
+	schema.Properties["cloud_type"].Enum = cloudTypes
+	for _, f := range sdutils.LogFormats {
+		schema.Properties["log_format"].Enum = append(schema.Properties["log_format"].Enum, f)
+	}
+	return schema
+}
+
+// jsonMap returns the JSON encoding of v as a map.
+func jsonMap(v interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	data, err := json.Marshal(v)
+	if err == nil {
+		json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+func sortedKeys(m map[string]*sdutils.JSONSchema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// zeroValue is what encoding/json leaves out of a document for fields
+// marked omitempty.
+func zeroValue(schema *sdutils.JSONSchema) interface{} {
+	switch schema.Type {
+	case "string":
+		return ""
+	case "boolean":
+		return false
+	case "integer", "number":
+		return 0
+	}
+	return nil
+}
+
+func (cliContext *CliContext) configFile() string {
+	if cliContext.ConfigFile != "" {
+		return cliContext.ConfigFile
+	}
+	return filepath.Join(cliContext.ConfigDir, "default.json")
+}
+
+func (cliContext *CliContext) configSchemaCmd(c *kingpin.ParseContext) error {
+	schema := configSchema(sortedPlugins())
+	cliContext.SetResult(schema)
+	var buf bytes.Buffer
+	err := sdutils.WriteOutput(&buf, "json", schema)
+	if err != nil {
+		return err
+	}
+	cliContext.ConsoleLog(0, "%s", buf.String())
+	return nil
+}
+
+// configValidate checks default.json against the schema.  The cloud_options
+// are checked against the plugin of the cloud_type in the file.
+func (cliContext *CliContext) configValidate(c *kingpin.ParseContext) error {
+	configFile := cliContext.configFile()
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("The configuration file %s could not be read: %s", configFile, err)
+	}
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return fmt.Errorf("The configuration file %s is not valid JSON: %s", configFile, err)
+	}
+	schema := configSchema(sortedPlugins())
+	cloudType := builtinCliOptions("").CloudType
+	if m, ok := doc.(map[string]interface{}); ok {
+		if t, ok := m["cloud_type"].(string); ok {
+			cloudType = t
+		}
+	}
+	if p, ok := pluginsMap[cloudType]; ok {
+		schema.Properties["cloud_options"] = sdutils.SchemaFor(p)
+	}
+	problems := schema.Validate(doc, "")
+	cliContext.SetResult(problems)
+	if len(problems) == 0 {
+		cliContext.ConsoleLog(1, "The configuration file %s is valid.\n", configFile)
+		return nil
+	}
+	for _, p := range problems {
+		cliContext.ConsoleLog(0, "%s\n", p)
+	}
+	return fmt.Errorf("The configuration file %s has %d problems", configFile, len(problems))
+}
+
+// configShow prints default.json or, with --effective, every option with the
+// value in use and where it came from.  The flags given to this command are
+// the global ones.
+func (cliContext *CliContext) configShow(c *kingpin.ParseContext) error {
+	configFile := cliContext.configFile()
+	fileOptions := make(map[string]interface{})
+	if sdutils.PathExists(configFile) {
+		err := sdutils.LoadJSON(&fileOptions, configFile)
+		if err != nil {
+			return err
+		}
+	}
+	if !cliContext.ShowEffective {
+		cliContext.SetResult(fileOptions)
+		var buf bytes.Buffer
+		err := sdutils.WriteOutput(&buf, "json", fileOptions)
+		if err != nil {
+			return err
+		}
+		cliContext.ConsoleLog(0, "%s", buf.String())
+		return nil
+	}
+
+	flags := make(map[string]bool)
+	for _, e := range c.Elements {
+		if f, ok := e.Clause.(*kingpin.FlagClause); ok {
+			flags[strings.Replace(f.Model().Name, "-", "_", -1)] = true
+		}
+	}
+	source := sourceDefault
+	if flags["config_dir"] {
+		source = sourceFlag
+	} else if os.Getenv(configDirEnv) != "" {
+		source = sourceEnv
+	}
+	values := []configValue{{Option: "config_dir", Value: cliContext.ConfigDir, Source: source}}
+
+	schema := sdutils.SchemaFor(CliContext{})
+	effective := jsonMap(cliContext)
+	for _, name := range sortedKeys(schema.Properties) {
+		if name == "cloud_options" {
+			continue
+		}
+		source := sourceDefault
+		if flags[name] {
+			source = sourceFlag
+		} else if _, ok := fileOptions[name]; ok {
+			source = sourceFile
+		}
+		value, ok := effective[name]
+		if !ok {
+			value = zeroValue(schema.Properties[name])
+		}
+		values = append(values, configValue{Option: name, Value: value, Source: source})
+	}
+	if p, ok := pluginsMap[cliContext.CloudType]; ok {
+		fileCloud, _ := fileOptions["cloud_options"].(map[string]interface{})
+		pluginSchema := sdutils.SchemaFor(p)
+		effectiveCloud := jsonMap(p)
+		for _, name := range sortedKeys(pluginSchema.Properties) {
+			source := sourceDefault
+			if _, ok := fileCloud[name]; ok {
+				source = sourceFile
+			}
+			value, ok := effectiveCloud[name]
+			if !ok {
+				value = zeroValue(pluginSchema.Properties[name])
 			}
+			values = append(values, configValue{Option: fmt.Sprintf("cloud_options.%s", name), Value: value, Source: source})
 		}
 	}
-	// Setup defaults here
-	cliContext := CliContext{
+	cliContext.SetResult(values)
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "OPTION\tVALUE\tSOURCE")
+	for _, v := range values {
+		value, ok := v.Value.(string)
+		if !ok {
+			data, _ := json.Marshal(v.Value)
+			value = string(data)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", v.Option, dashIfEmpty(value), v.Source)
+	}
+	w.Flush()
+	cliContext.ConsoleLog(0, "%s", buf.String())
+	return nil
+}
+
+// defaultConfigDir is the configuration directory used when --config-dir is
+// not given.
+func defaultConfigDir() string {
+	confDir := os.Getenv(configDirEnv)
+	if confDir != "" {
+		return confDir
+	}
+	usr, err := user.Current()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get a current user home directory. Using the current directory. Error: %s\n", err)
+		return ".graviton"
+	}
+	return filepath.Join(usr.HomeDir, ".graviton")
+}
+
+// builtinCliOptions returns the options used when neither default.json nor
+// the command line sets them.
+func builtinCliOptions(confDir string) *CliContext {
+	return &CliContext{
 		DeploymentName:    "",
 		ConfigDir:         confDir,
 		LogLevel:          "INFO",
+		LogFormat:         "text",
+		LogMaxSize:        10,
 		CloudType:         "aws",
 		VolumeSize:        10,
 		RootVolumeSize:    16,
@@ -691,16 +1963,31 @@ func loadDefaultCliOptions(confDir string) *CliContext {
 		green:             color.New(color.FgGreen, color.Bold).SprintFunc(),
 		red:               color.New(color.FgRed, color.Bold).SprintFunc(),
 	}
+}
+
+func loadDefaultCliOptions(confDir string) *CliContext {
+	var err error
+
+	if confDir == "" {
+		confDir = defaultConfigDir()
+	}
+	cliContext := builtinCliOptions(confDir)
 	defaultFile := filepath.Join(confDir, "default.json")
 
-	if os.Getenv("STARDOG_GRAVITON_UNIT_TEST") == "" {
-		if sdutils.PathExists(defaultFile) {
-			err = sdutils.LoadJSON(&cliContext, defaultFile)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "There was an error loading the defaults file %s: %s\n", defaultFile, err)
-			}
+	if sdutils.PathExists(defaultFile) {
+		err = sdutils.LoadJSON(cliContext, defaultFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "There was an error loading the defaults file %s: %s\n", defaultFile, err)
+		}
+		// An unknown format would fail every command, including config validate
+		knownFormat := false
+		for _, f := range sdutils.LogFormats {
+			knownFormat = knownFormat || f == cliContext.LogFormat
+		}
+		if !knownFormat {
+			fmt.Fprintf(os.Stderr, "The log format %s in %s is not valid, using text\n", cliContext.LogFormat, defaultFile)
+			cliContext.LogFormat = "text"
 		}
-
 	}
 	p, ok := pluginsMap[cliContext.CloudType]
 	if ok && cliContext.CloudType != "" {
@@ -710,14 +1997,14 @@ func loadDefaultCliOptions(confDir string) *CliContext {
 		}
 	}
 
-	return &cliContext
+	return cliContext
 }
 
 func parseParameters(args []string) (*CliContext, error) {
 	// Setup defaults here
 	argConfDir := ""
 	for i, opt := range args {
-		if opt == "--config-dir" && i < len(args) - 1 {
+		if opt == "--config-dir" && i < len(args)-1 {
 			argConfDir = args[i+1]
 		} else if strings.HasPrefix(opt, "--config-dir=") {
 			argConfDir = strings.SplitN(opt, "=", 2)[1]
@@ -739,15 +2026,24 @@ func parseParameters(args []string) (*CliContext, error) {
 
 	cli.Flag("console-file", "Instead of sending console output to stdout send it here").StringVar(&cliContext.ConsoleFile)
 	cli.Flag("log-level", fmt.Sprintf("Log level [%s]", strings.Join(sdutils.LogLevelNames, " | "))).Default(cliContext.LogLevel).StringVar(&cliContext.LogLevel)
+	cli.Flag("log-format", fmt.Sprintf("Log file format [%s]", strings.Join(sdutils.LogFormats, " | "))).Default(cliContext.LogFormat).EnumVar(&cliContext.LogFormat, sdutils.LogFormats...)
+	cli.Flag("log-max-size", "The size in megabytes at which the log file is rotated.  0 disables the rotation.").Default(fmt.Sprintf("%d", cliContext.LogMaxSize)).IntVar(&cliContext.LogMaxSize)
 	cli.Flag("config-dir", "The path for the configuration information").Default(cliContext.ConfigDir).StringVar(&cliContext.ConfigDir)
 	cli.Flag("verbose", "How much output to send to the console").CounterVar(&cliContext.VerboseLevel)
 	cli.Flag("quiet", "Minimal console output").Default(fmt.Sprintf("%t", cliContext.Quiet)).BoolVar(&cliContext.Quiet)
+	cli.Flag("output", fmt.Sprintf("The format of the command output [%s]", strings.Join(sdutils.OutputFormats, " | "))).Default("text").EnumVar(&cliContext.OutputFormat, sdutils.OutputFormats...)
 	cli.Validate(cliContext.topValidate)
+	cli.PreAction(func(c *kingpin.ParseContext) error {
+		if c.SelectedCommand != nil {
+			cliContext.Command = c.SelectedCommand.FullCommand()
+		}
+		return nil
+	})
 
 	cmdOpts.LaunchCmd = cli.Command("launch", "Walk through a launch from scratch.")
 	cmdOpts.LaunchCmd.Flag("interactive", "Ask all questions even if there are default values.").Default(fmt.Sprintf("%t", cliContext.Interactive)).BoolVar(&cliContext.Interactive)
 	cmdOpts.LaunchCmd.Flag("force", "Do not ask questions.").Default(fmt.Sprintf("%t", cliContext.Force)).BoolVar(&cliContext.Force)
-	cmdOpts.LaunchCmd.Flag("type", "The type of cloud with which graviton will interact (only aws supported).").Default(cliContext.CloudType).StringVar(&cliContext.CloudType)
+	cmdOpts.LaunchCmd.Flag("type", "The type of cloud with which graviton will interact (aws or docker).").Default(cliContext.CloudType).StringVar(&cliContext.CloudType)
 	cmdOpts.LaunchCmd.Flag("name", "The name of the deployment.  It must be unique to this account.").StringVar(&cliContext.DeploymentName)
 	cmdOpts.LaunchCmd.Flag("sd-version", "The stardog version to associate with this deployment.").Default(cliContext.Version).StringVar(&cliContext.Version)
 	cmdOpts.LaunchCmd.Flag("private-key", "The path to the private key").Default(cliContext.PrivateKeyPath).StringVar(&cliContext.PrivateKeyPath)
@@ -761,6 +2057,7 @@ func parseParameters(args []string) (*CliContext, error) {
 	cmdOpts.LaunchCmd.Flag("stardog-properties", "A custom stardog properties file.").Default(cliContext.CustomSdProps).StringVar(&cliContext.CustomSdProps)
 	cmdOpts.LaunchCmd.Flag("custom-log4j", "A custom log4j file.").StringVar(&cliContext.CustomLog4J)
 	cmdOpts.LaunchCmd.Flag("no-wait", "Block until the stardog instance is healthy.").Default(fmt.Sprintf("%t", cliContext.NoWaitForHealthy)).BoolVar(&cliContext.NoWaitForHealthy)
+	cmdOpts.LaunchCmd.Flag("ttl", "How long the deployment should live, for example 8h.  The leaks command reports or stops expired deployments.").DurationVar(&cliContext.TTL)
 	cmdOpts.LaunchCmd.Flag("wait-timeout", "The number of seconds to block waiting for the stardog instance to become healthy.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
 	cmdOpts.LaunchCmd.Flag("connection-timeout", "The maximum number of seconds that a connection to Stardog can be idle.").Default(fmt.Sprintf("%d", cliContext.ConnectionTimeout)).IntVar(&cliContext.ConnectionTimeout)
 	cmdOpts.LaunchCmd.Flag("env", "Set an environment variable before running Stardog.  The format should be key=value.  This option can be used multiple times. Advanced feature.").StringsVar(&cliContext.EnvList)
@@ -771,14 +2068,20 @@ func parseParameters(args []string) (*CliContext, error) {
 	cmdOpts.LaunchCmd.Flag("memory-max", "The maximum amount of memory to give the JVM that runs Stardog nodes.").StringVar(&cliContext.MemoryMax)
 	cmdOpts.LaunchCmd.Flag("memory-start", "The starting amount of memory to give the JVM that runs Stardog nodes.").StringVar(&cliContext.MemoryStart)
 	cmdOpts.LaunchCmd.Flag("disable-security", "Run the Stardog servers without security.").Default(fmt.Sprintf("%t", cliContext.DisableSecurity)).BoolVar(&cliContext.DisableSecurity)
+	cmdOpts.LaunchCmd.Flag("credential-provider", fmt.Sprintf("Where the admin password of the deployment is kept (%s).", strings.Join(sdutils.CredentialProviders(), ", "))).Default(cliContext.CredentialProvider).StringVar(&cliContext.CredentialProvider)
+	cmdOpts.LaunchCmd.Flag("credential-key", "The name of the admin password within the credential provider.").Default(cliContext.CredentialKey).StringVar(&cliContext.CredentialKey)
+	cmdOpts.LaunchCmd.Flag("credential-option", "A credential provider setting such as region or helper.  The format should be key=value.").StringMapVar(&cliContext.CredentialOptions)
+	cmdOpts.LaunchCmd.Flag("tls-ca-bundle", "A PEM file of CA certificates to trust, in addition to the system ones, when verifying the https certificate of Stardog.").Default(cliContext.TLSCABundle).StringVar(&cliContext.TLSCABundle)
 	cmdOpts.LaunchCmd.Flag("custom-exec", "A custom script to run on Stardog nodes (experimental).").StringVar(&cliContext.CustomExec)
 	cmdOpts.LaunchCmd.Flag("custom-zk-exec", "A custom script to run on Zookeeper nodes (experimental).").StringVar(&cliContext.CustomZkExec)
+	cmdOpts.LaunchCmd.Flag("dry-run", "Show what would be added, changed or destroyed without doing it.").Default("false").BoolVar(&cliContext.DryRun)
 	cmdOpts.LaunchCmd.Validate(cliContext.envValidate)
 	cmdOpts.LaunchCmd.Action(cliContext.interactive)
 
 	cmdOpts.DestroyCmd = cli.Command("destroy", "Destroy everything associated with a deployment.")
 	cmdOpts.DestroyCmd.Arg("name", "The name of the deployment to destroy.").Required().StringVar(&cliContext.DeploymentName)
 	cmdOpts.DestroyCmd.Flag("force", "Do not verify with the destruction.").Default("false").BoolVar(&cliContext.Force)
+	cmdOpts.DestroyCmd.Flag("dry-run", "Show what would be added, changed or destroyed without doing it.").Default("false").BoolVar(&cliContext.DryRun)
 	cmdOpts.DestroyCmd.Action(cliContext.destroyFullDeployment)
 
 	cmdOpts.StatusCmd = cli.Command("status", "Check the status of a full deployment.")
@@ -787,9 +2090,36 @@ func parseParameters(args []string) (*CliContext, error) {
 	cmdOpts.StatusCmd.Flag("internal-health", "Do not verify with the destruction.").Default("false").BoolVar(&cliContext.InternalHealth)
 	cmdOpts.StatusCmd.Action(cliContext.fullStatus)
 
+	cmdOpts.ResumeCmd = cli.Command("resume", "Continue an interrupted launch from the last completed step.")
+	cmdOpts.ResumeCmd.Arg("deployment name", "The name of the deployment to resume.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.ResumeCmd.Flag("wait-timeout", "The number of seconds to block waiting for the stardog instance to become healthy.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
+	cmdOpts.ResumeCmd.Flag("json-file", "The path to the json output file.").StringVar(&cliContext.OutputFile)
+	cmdOpts.ResumeCmd.Action(cliContext.resume)
+
+	cmdOpts.ScaleCmd = cli.Command("scale", "Add or remove Stardog nodes on a running deployment.")
+	cmdOpts.ScaleCmd.Arg("deployment name", "The name of the deployment to scale.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.ScaleCmd.Flag("nodes", "The number of Stardog nodes the cluster should have.").Required().IntVar(&cliContext.ClusterSize)
+	cmdOpts.ScaleCmd.Flag("wait-timeout", "The number of seconds to block waiting for the cluster to reach its new size.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
+	cmdOpts.ScaleCmd.Action(cliContext.scale)
+
+	zkCmd := cli.Command("zk", "Manage the ZooKeeper ensemble of a running deployment.")
+	cmdOpts.ZkResizeCmd = zkCmd.Command("resize", "Change the number of ZooKeeper nodes one node at a time.")
+	cmdOpts.ZkResizeCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.ZkResizeCmd.Arg("count", "The number of ZooKeeper nodes.  This must be odd.").Required().IntVar(&cliContext.ZkClusterSize)
+	cmdOpts.ZkResizeCmd.Flag("wait-timeout", "The number of seconds to block waiting for the ZooKeeper quorum after each node.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
+	cmdOpts.ZkResizeCmd.Action(cliContext.zkResize)
+
+	cmdOpts.ZkReplaceCmd = zkCmd.Command("replace", "Replace a single ZooKeeper node.")
+	cmdOpts.ZkReplaceCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.ZkReplaceCmd.Arg("node", "The ZooKeeper id of the node to replace, starting at 1.").Required().IntVar(&cliContext.ZkNodeID)
+	cmdOpts.ZkReplaceCmd.Flag("wait-timeout", "The number of seconds to block waiting for the ZooKeeper quorum.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
+	cmdOpts.ZkReplaceCmd.Action(cliContext.zkReplace)
+
 	cmdOpts.StatusCmd = cli.Command("update-stardog", "Update and restart Stardog on all of the nodes")
 	cmdOpts.StatusCmd.Arg("deployment name", "The name of the deployment to use.").Required().StringVar(&cliContext.DeploymentName)
 	cmdOpts.StatusCmd.Arg("release", "The new Stardog release file to deploy.").Required().StringVar(&cliContext.SdReleaseFilePath)
+	cmdOpts.StatusCmd.Flag("rolling", "Update one node at a time, waiting for each node to rejoin the cluster before moving to the next.").BoolVar(&cliContext.RollingUpdate)
+	cmdOpts.StatusCmd.Flag("wait-timeout", "The number of seconds to block waiting for each node to rejoin the cluster.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
 	cmdOpts.StatusCmd.Action(cliContext.updateStardog)
 
 	cmdOpts.StatusCmd = cli.Command("logs", "Gather the logs of all the Stardog nodes.")
@@ -798,26 +2128,89 @@ func parseParameters(args []string) (*CliContext, error) {
 	cmdOpts.StatusCmd.Action(cliContext.gatherLogs)
 
 	cmdOpts.LeaksCmd = cli.Command("leaks", "Check aws services for possible resource leaks.")
+	cmdOpts.LeaksCmd.Flag("type", "The type of cloud with which graviton will interact (aws or docker).").Default(cliContext.CloudType).StringVar(&cliContext.CloudType)
 	cmdOpts.LeaksCmd.Flag("destroy", "Destroy any of the resources found.").Default("false").BoolVar(&cliContext.Destroy)
 	cmdOpts.LeaksCmd.Flag("force", "Destroy any of the resources found without first asking.").Default("false").BoolVar(&cliContext.Force)
 	cmdOpts.LeaksCmd.Flag("deployment-name", "Limit the search to a particular deployment name.").StringVar(&cliContext.DeploymentName)
+	cmdOpts.LeaksCmd.Flag("stop-expired", "Stop the instance of the deployments whose time to live has passed.").Default("false").BoolVar(&cliContext.StopExpired)
 	cmdOpts.LeaksCmd.Action(cliContext.leaks)
 
 	cmdOpts.SSHCmd = cli.Command("ssh", "ssh into the bastion node.")
 	cmdOpts.SSHCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
 	cmdOpts.SSHCmd.Action(cliContext.sshIn)
 
+	cmdOpts.PasswdCmd = cli.Command("passwd", "Change the password of a Stardog user.  The new password is prompted for or read from stdin.")
+	cmdOpts.PasswdCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.PasswdCmd.Flag("user", "The Stardog user whose password is changed.").Default("admin").StringVar(&cliContext.StardogUser)
+	cmdOpts.PasswdCmd.Action(cliContext.passwd)
+
+	cmdOpts.ClientCmd = cli.Command("client", "Run stardog-admin, or the stardog client, on the bastion node.  Put -- before the arguments of the client.")
+	cmdOpts.ClientCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.ClientCmd.Arg("args", "The arguments of the client.  Local files named in them are copied to the bastion node.").StringsVar(&cliContext.ClientArgs)
+	cmdOpts.ClientCmd.Flag("cli", "The client to run.").Default("stardog-admin").EnumVar(&cliContext.ClientCLI, "stardog-admin", "stardog")
+	cmdOpts.ClientCmd.Action(cliContext.client)
+
+	queryCmd := cli.Command("query", "Run a SPARQL query on a database of the deployment.")
+	queryCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	queryCmd.Arg("database", "The database to query.").Required().StringVar(&cliContext.Database)
+	queryCmd.Arg("sparql", "The query or the path to a file holding it.").Required().StringVar(&cliContext.Query)
+	queryCmd.Flag("format", "The format of the results.  Graph queries need turtle.").Default("csv").EnumVar(&cliContext.QueryFormat, "csv", "tsv", "json", "xml", "turtle")
+	queryCmd.Action(cliContext.query)
+
+	historyCmd := cli.Command("history", "Show the audit journal of a deployment.")
+	historyCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	historyCmd.Action(cliContext.history)
+
+	driftCmd := cli.Command("drift", "Compare the recorded state of a deployment with the resources that exist.")
+	driftCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	driftCmd.Action(cliContext.drift)
+
+	costCmd := cli.Command("cost", "Estimate what a deployment costs to run.")
+	costCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	costCmd.Action(cliContext.cost)
+
+	applyCmd := cli.Command("apply", "Create or update a deployment from a spec file.")
+	applyCmd.Flag("file", "The YAML or JSON spec of the deployment.").Short('f').Required().StringVar(&cliContext.SpecFile)
+	applyCmd.Flag("wait-timeout", "The number of seconds to block waiting for the stardog instance to become healthy.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
+	applyCmd.Flag("dry-run", "Show what would be added, changed or destroyed without doing it.").Default("false").BoolVar(&cliContext.DryRun)
+	applyCmd.Flag("release", "Path to the stardog release zip file, needed when the spec changes the Stardog version.").StringVar(&cliContext.SdReleaseFilePath)
+	applyCmd.Action(cliContext.apply)
+
+	exportCmd := cli.Command("export", "Write the spec of a deployment.")
+	exportCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	exportCmd.Flag("file", "The path to write the spec to instead of the console.").Short('f').StringVar(&cliContext.SpecFile)
+	exportCmd.Flag("format", "The format of the spec [yaml | json].").Default("yaml").EnumVar(&cliContext.SpecFormat, "yaml", "json")
+	exportCmd.Action(cliContext.export)
+
+	configCmd := cli.Command("config", "Check the default options in default.json.")
+	configSchemaCmd := configCmd.Command("schema", "Print the JSON Schema of default.json.")
+	configSchemaCmd.Action(cliContext.configSchemaCmd)
+	configValidateCmd := configCmd.Command("validate", "Check default.json for unknown options and values of the wrong type.")
+	configValidateCmd.Arg("file", "The file to check instead of default.json in the configuration directory.").StringVar(&cliContext.ConfigFile)
+	configValidateCmd.Action(cliContext.configValidate)
+	configShowCmd := configCmd.Command("show", "Print default.json.")
+	configShowCmd.Flag("effective", "Print every option with the value in use and where it came from.").Default("false").BoolVar(&cliContext.ShowEffective)
+	configShowCmd.Action(cliContext.configShow)
+
 	cmdOpts.AboutCmd = cli.Command("about", "Display information about this program.")
 	cmdOpts.AboutCmd.Action(cliContext.aboutCommand)
 
-	cmdOpts.BuildCmd = cli.Command("baseami", "Create a base ami.")
+	baseAmiCmd := cli.Command("baseami", "Manage the base images.")
+	cmdOpts.BuildCmd = baseAmiCmd.Command("build", "Create a base ami.").Default()
+	cmdOpts.BuildCmd.Flag("type", "The type of cloud with which graviton will interact (aws or docker).").Default(cliContext.CloudType).StringVar(&cliContext.CloudType)
 	cmdOpts.BuildCmd.Arg("release", "The stardog release file.").Required().StringVar(&cliContext.SdReleaseFilePath)
 	cmdOpts.BuildCmd.Arg("sd-version", "The stardog release version to will be baked into this file.").Required().StringVar(&cliContext.Version)
 	cmdOpts.BuildCmd.Action(cliContext.baseAmiAction)
 
+	cmdOpts.CopyImageCmd = baseAmiCmd.Command("copy", "Copy the base image to other regions.")
+	cmdOpts.CopyImageCmd.Flag("type", "The type of cloud with which graviton will interact (aws or docker).").Default(cliContext.CloudType).StringVar(&cliContext.CloudType)
+	cmdOpts.CopyImageCmd.Flag("to", "A region to copy the image to.  It can be given more than once.").Required().StringsVar(&cliContext.CopyRegions)
+	cmdOpts.CopyImageCmd.Arg("sd-version", "The stardog release version baked into the image.").Required().StringVar(&cliContext.Version)
+	cmdOpts.CopyImageCmd.Action(cliContext.copyImage)
+
 	deployCmd := cli.Command("deployment", "Manage and inspect deployments.")
 	cmdOpts.NewDeploymentCmd = deployCmd.Command("new", "Define a new deployment but do not create volumes or launch an instance.")
-	cmdOpts.NewDeploymentCmd.Flag("type", "The type of cloud with which graviton will interact (only aws supported).").Default("aws").StringVar(&cliContext.CloudType)
+	cmdOpts.NewDeploymentCmd.Flag("type", "The type of cloud with which graviton will interact (aws or docker).").Default("aws").StringVar(&cliContext.CloudType)
 	cmdOpts.NewDeploymentCmd.Arg("name", "The name of the deployment.  It must be unique to this account.").Required().StringVar(&cliContext.DeploymentName)
 	cmdOpts.NewDeploymentCmd.Arg("sd-version", "The stardog version to associate with this deployment.").Required().StringVar(&cliContext.Version)
 	cmdOpts.NewDeploymentCmd.Flag("private-key", "The path to the private key.").Default(cliContext.PrivateKeyPath).StringVar(&cliContext.PrivateKeyPath)
@@ -829,6 +2222,10 @@ func parseParameters(args []string) (*CliContext, error) {
 	cmdOpts.NewDeploymentCmd.Flag("memory-max", "The maximum amount of memory to give the JVM that runs Stardog nodes.").StringVar(&cliContext.MemoryMax)
 	cmdOpts.NewDeploymentCmd.Flag("memory-start", "The starting amount of memory to give the JVM that runs Stardog nodes.").StringVar(&cliContext.MemoryStart)
 	cmdOpts.NewDeploymentCmd.Flag("disable-security", "Run the Stardog servers without security.").Default(fmt.Sprintf("%t", cliContext.DisableSecurity)).BoolVar(&cliContext.DisableSecurity)
+	cmdOpts.NewDeploymentCmd.Flag("credential-provider", fmt.Sprintf("Where the admin password of the deployment is kept (%s).", strings.Join(sdutils.CredentialProviders(), ", "))).Default(cliContext.CredentialProvider).StringVar(&cliContext.CredentialProvider)
+	cmdOpts.NewDeploymentCmd.Flag("credential-key", "The name of the admin password within the credential provider.").Default(cliContext.CredentialKey).StringVar(&cliContext.CredentialKey)
+	cmdOpts.NewDeploymentCmd.Flag("credential-option", "A credential provider setting such as region or helper.  The format should be key=value.").StringMapVar(&cliContext.CredentialOptions)
+	cmdOpts.NewDeploymentCmd.Flag("tls-ca-bundle", "A PEM file of CA certificates to trust, in addition to the system ones, when verifying the https certificate of Stardog.").Default(cliContext.TLSCABundle).StringVar(&cliContext.TLSCABundle)
 	cmdOpts.NewDeploymentCmd.Action(cliContext.newDeployment)
 	cmdOpts.NewDeploymentCmd.Validate(cliContext.envValidate)
 
@@ -838,25 +2235,55 @@ func parseParameters(args []string) (*CliContext, error) {
 	cmdOpts.DestroyDeploymentCmd.Action(cliContext.destroyDeployment)
 
 	cmdOpts.ListDeploymentCmd = deployCmd.Command("list", "List the knwon deployments.")
+	cmdOpts.ListDeploymentCmd.Flag("all-regions", "List the deployments of every region, not only the selected one.").BoolVar(&cliContext.AllRegions)
+	cmdOpts.ListDeploymentCmd.Flag("check-health", "Check the health of every listed deployment.").BoolVar(&cliContext.CheckHealth)
 	cmdOpts.ListDeploymentCmd.Action(cliContext.deploymentList)
 
 	volumesCmd := cli.Command("volume", "Manage storage volumes.")
 	cmdOpts.NewVolumesCmd = volumesCmd.Command("new", "Create new backing storage.")
 	cmdOpts.NewVolumesCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
-	cmdOpts.NewVolumesCmd.Arg("license", "Path to your stardog license.").Required().StringVar(&cliContext.LicensePath)
-	cmdOpts.NewVolumesCmd.Arg("size", "The size of each storage volume in gigabytes.").Required().IntVar(&cliContext.VolumeSize)
-	cmdOpts.NewVolumesCmd.Arg("count", "The number storage volume.  This will be the size of the stardog cluster.").Required().IntVar(&cliContext.ClusterSize)
+	cmdOpts.NewVolumesCmd.Arg("license", "Path to your stardog license.").StringVar(&cliContext.LicensePath)
+	cmdOpts.NewVolumesCmd.Arg("size", "The size of each storage volume in gigabytes.").IntVar(&cliContext.VolumeSize)
+	cmdOpts.NewVolumesCmd.Arg("count", "The number storage volume.  This will be the size of the stardog cluster.").IntVar(&cliContext.ClusterSize)
+	cmdOpts.NewVolumesCmd.Flag("from-snapshot-set", "Create the volumes from a snapshot set instead of a license.  The set may come from another deployment.").StringVar(&cliContext.SnapshotSetID)
+	cmdOpts.NewVolumesCmd.Flag("dry-run", "Show what would be added, changed or destroyed without doing it.").Default("false").BoolVar(&cliContext.DryRun)
 	cmdOpts.NewVolumesCmd.Action(cliContext.newVolumes)
 
+	cmdOpts.SnapshotVolumesCmd = volumesCmd.Command("snapshot", "Snapshot every volume and record the snapshot set.")
+	cmdOpts.SnapshotVolumesCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.SnapshotVolumesCmd.Flag("tag", "A label to attach to the snapshots.").StringVar(&cliContext.SnapshotTag)
+	cmdOpts.SnapshotVolumesCmd.Action(cliContext.snapshotVolumes)
+
 	cmdOpts.DestroyVolumesCmd = volumesCmd.Command("destroy", "This will destroy the volumes permanently.")
 	cmdOpts.DestroyVolumesCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
 	cmdOpts.DestroyVolumesCmd.Flag("force", "Do not verify with the destruction.").Default("false").BoolVar(&cliContext.Force)
+	cmdOpts.DestroyVolumesCmd.Flag("dry-run", "Show what would be added, changed or destroyed without doing it.").Default("false").BoolVar(&cliContext.DryRun)
 	cmdOpts.DestroyVolumesCmd.Action(cliContext.destroyVolumes)
 
 	cmdOpts.StatusVolumesCmd = volumesCmd.Command("status", "Display information about the volumes.")
 	cmdOpts.StatusVolumesCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
 	cmdOpts.StatusVolumesCmd.Action(cliContext.statusVolumes)
 
+	backupCmd := cli.Command("backup", "Manage the backups of a deployment.")
+	cmdOpts.BackupScheduleCmd = backupCmd.Command("schedule", "Back up the deployment at a regular interval and prune old backups.")
+	cmdOpts.BackupScheduleCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.BackupScheduleCmd.Flag("every", "The time between backups, for example 6h.").Default("24h").DurationVar(&cliContext.BackupEvery)
+	cmdOpts.BackupScheduleCmd.Flag("keep", "The number of backups to keep.").Default("7").IntVar(&cliContext.BackupPolicy.Keep)
+	cmdOpts.BackupScheduleCmd.Flag("method", "snapshot to snapshot the volumes or db to run stardog-admin db backup.").Default(sdutils.BackupMethodSnapshot).EnumVar(&cliContext.BackupPolicy.Method, sdutils.BackupMethodSnapshot, sdutils.BackupMethodDatabase)
+	cmdOpts.BackupScheduleCmd.Flag("db", "A database to back up with the db method.  This option can be used multiple times.").StringsVar(&cliContext.BackupPolicy.Databases)
+	cmdOpts.BackupScheduleCmd.Flag("to", "Where the backups are shipped, either s3://bucket/prefix or a local directory.  The default is the backups directory of the deployment.").StringVar(&cliContext.BackupPolicy.Destination)
+	cmdOpts.BackupScheduleCmd.Flag("once", "Make a single backup and exit, for use with cron.").Default("false").BoolVar(&cliContext.BackupOnce)
+	cmdOpts.BackupScheduleCmd.Action(cliContext.backupSchedule)
+
+	cmdOpts.BackupListCmd = backupCmd.Command("list", "List the backups of a deployment.")
+	cmdOpts.BackupListCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.BackupListCmd.Action(cliContext.backupList)
+
+	cmdOpts.BackupRestoreCmd = backupCmd.Command("restore", "Restore a deployment from one of its backups.")
+	cmdOpts.BackupRestoreCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.BackupRestoreCmd.Arg("backup", "The id of the backup.").Required().StringVar(&cliContext.BackupID)
+	cmdOpts.BackupRestoreCmd.Action(cliContext.backupRestore)
+
 	instanceCmd := cli.Command("instance", "Manage the instance.")
 	cmdOpts.LaunchInstanceCmd = instanceCmd.Command("new", "Create new set of VMs running Stardog.")
 	cmdOpts.LaunchInstanceCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
@@ -866,17 +2293,34 @@ func parseParameters(args []string) (*CliContext, error) {
 	cmdOpts.LaunchInstanceCmd.Flag("wait-timeout", "The number of seconds to block waiting for the stardog instance to become healthy.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
 	cmdOpts.LaunchInstanceCmd.Flag("connection-timeout", "The maximum number of seconds that a connection to Stardog can be idle.").Default(fmt.Sprintf("%d", cliContext.ConnectionTimeout)).IntVar(&cliContext.ConnectionTimeout)
 	cmdOpts.LaunchInstanceCmd.Flag("cidr", "The network mask to which stardog access will be limited.").StringVar(&cliContext.HTTPMask)
+	cmdOpts.LaunchInstanceCmd.Flag("tls-ca-bundle", "A PEM file of CA certificates to trust, in addition to the system ones, when verifying the https certificate of Stardog.").Default(cliContext.TLSCABundle).StringVar(&cliContext.TLSCABundle)
+	cmdOpts.LaunchInstanceCmd.Flag("dry-run", "Show what would be added, changed or destroyed without doing it.").Default("false").BoolVar(&cliContext.DryRun)
 	cmdOpts.LaunchInstanceCmd.Action(cliContext.launchInstance)
 
 	cmdOpts.DestroyInstanceCmd = instanceCmd.Command("destroy", "Destroy the instance.")
 	cmdOpts.DestroyInstanceCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
 	cmdOpts.DestroyInstanceCmd.Flag("force", "Do not verify with the destruction.").Default("false").BoolVar(&cliContext.Force)
+	cmdOpts.DestroyInstanceCmd.Flag("dry-run", "Show what would be added, changed or destroyed without doing it.").Default("false").BoolVar(&cliContext.DryRun)
 	cmdOpts.DestroyInstanceCmd.Action(cliContext.destroyInstance)
 
 	cmdOpts.StatusInstanceCmd = instanceCmd.Command("status", "Get information about the instance.")
 	cmdOpts.StatusInstanceCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
 	cmdOpts.StatusInstanceCmd.Action(cliContext.statusInstance)
 
+	cmdOpts.StopInstanceCmd = instanceCmd.Command("stop", "Stop the Stardog and zookeeper nodes but keep the volumes.")
+	cmdOpts.StopInstanceCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.StopInstanceCmd.Action(cliContext.stopInstance)
+
+	cmdOpts.StartInstanceCmd = instanceCmd.Command("start", "Start the nodes of a stopped instance.")
+	cmdOpts.StartInstanceCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.StartInstanceCmd.Flag("wait-timeout", "The number of seconds to block waiting for the cluster to be healthy.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
+	cmdOpts.StartInstanceCmd.Action(cliContext.startInstance)
+
+	cmdOpts.ReimageCmd = instanceCmd.Command("reimage", "Move the Stardog nodes to a new base image one node at a time.")
+	cmdOpts.ReimageCmd.Arg("deployment", "The name of the deployment.").Required().StringVar(&cliContext.DeploymentName)
+	cmdOpts.ReimageCmd.Flag("wait-timeout", "The number of seconds to block waiting for each replaced node to rejoin the cluster.").Default(fmt.Sprintf("%d", cliContext.WaitMaxTimeSec)).IntVar(&cliContext.WaitMaxTimeSec)
+	cmdOpts.ReimageCmd.Action(cliContext.reimage)
+
 	// Add all the options for all the plugins
 	for _, p := range pluginsMap {
 		p.Register(&cmdOpts)
@@ -891,7 +2335,7 @@ func parseParameters(args []string) (*CliContext, error) {
 	return cliContext, nil
 }
 
-func loadDepWrapper(cliContext *CliContext, new bool) (sdutils.Deployment, error) {
+func loadDepWrapper(cliContext *CliContext, new bool) (*sdutils.BaseDeployment, sdutils.Deployment, error) {
 	baseD := sdutils.BaseDeployment{
 		Name:            cliContext.DeploymentName,
 		Version:         cliContext.Version,
@@ -901,5 +2345,6 @@ func loadDepWrapper(cliContext *CliContext, new bool) (sdutils.Deployment, error
 		CustomPropsFile: cliContext.CustomSdProps,
 		CustomLog4J:     cliContext.CustomLog4J,
 	}
-	return sdutils.LoadDeployment(cliContext, &baseD, new)
+	d, err := sdutils.LoadDeployment(cliContext, &baseD, new)
+	return &baseD, d, err
 }
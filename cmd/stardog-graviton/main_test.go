@@ -16,21 +16,26 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
-	"path/filepath"
-
-	"github.com/stardog-union/stardog-graviton/aws"
 	"github.com/stardog-union/stardog-graviton"
-	"errors"
+	"github.com/stardog-union/stardog-graviton/aws"
+	"github.com/stardog-union/stardog-graviton/docker"
+	"github.com/stardog-union/stardog-graviton/fake"
 )
 
 var (
@@ -63,6 +68,7 @@ var (
 }`
 	packerFile    = filepath.Join(os.TempDir(), "packer")
 	terraformFile = filepath.Join(os.TempDir(), "terraform")
+	fakeCloud     *fake.Cloud
 )
 
 func TestAbout(t *testing.T) {
@@ -151,12 +157,98 @@ func TestDeploymentList(t *testing.T) {
 }
 
 func TestStatusNoDeploy(t *testing.T) {
-	rc := realMain([]string{"--quiet", "status"})
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+
+	rc := realMain([]string{"--quiet", "--config-dir", confDir, "status"})
 	if rc == 0 {
 		t.Fatal("Should have failed")
 	}
 }
 
+func TestRegions(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	sshKeyFile := path.Join(confDir, "keyfile")
+	ioutil.WriteFile(sshKeyFile, []byte("xxx"), 0600)
+	consoleLog := path.Join(confDir, "output0")
+	depname1 := randDeployName()
+	depname2 := randDeployName()
+
+	awsKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	defer os.Setenv("AWS_ACCESS_KEY_ID", awsKeyID)
+	os.Setenv("AWS_ACCESS_KEY_ID", "gravitontest")
+	awsSecretKeyID := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	defer os.Setenv("AWS_SECRET_ACCESS_KEY", awsSecretKeyID)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "somevalue")
+
+	err := buildImage("ami-beefwest", confDir, "4.2", "/etc/group", "us-west-1")
+	if err != nil {
+		t.Fatalf("Failed to make the ami %s", err)
+	}
+	rc := realMain([]string{"--quiet", "--config-dir", confDir, "deployment", "new", "--region", "us-wset-1", "--private-key", sshKeyFile, "--aws-key-name", "keyname", depname1, "4.2"})
+	if rc == 0 {
+		t.Fatal("An unknown region should be refused")
+	}
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "deployment", "new", "--region", "eu-west-2", "--private-key", sshKeyFile, "--aws-key-name", "keyname", depname2, "4.2"})
+	if rc == 0 {
+		t.Fatal("There is no AMI in eu-west-2 yet")
+	}
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "baseami", "copy", "--to", "eu-west-3", "4.2"})
+	if rc == 0 {
+		t.Fatal("The copy should refuse an unknown region")
+	}
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "baseami", "copy", "--to", "eu-west-2", "4.2"})
+	if rc != 0 {
+		t.Fatal("baseami copy failed")
+	}
+
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "deployment", "new", "--private-key", sshKeyFile, "--aws-key-name", "keyname", depname1, "4.2"})
+	if rc != 0 {
+		t.Fatal("dep new should return 0")
+	}
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "deployment", "new", "--region", "eu-west-2", "--private-key", sshKeyFile, "--aws-key-name", "keyname", depname2, "4.2"})
+	if rc != 0 {
+		t.Fatal("dep new in eu-west-2 should return 0")
+	}
+
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "--console-file", consoleLog, "deployment", "list"})
+	if rc != 0 {
+		t.Fatal("deployment list failed")
+	}
+	output := readConsole(t, consoleLog)
+	if !strings.Contains(output, depname1) || strings.Contains(output, depname2) {
+		t.Fatalf("Only the deployments of us-west-1 should be listed %s", output)
+	}
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "--console-file", consoleLog, "deployment", "list", "--region", "eu-west-2"})
+	if rc != 0 {
+		t.Fatal("deployment list failed")
+	}
+	output = readConsole(t, consoleLog)
+	if strings.Contains(output, depname1) || !strings.Contains(output, depname2) {
+		t.Fatalf("Only the deployments of eu-west-2 should be listed %s", output)
+	}
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "--console-file", consoleLog, "deployment", "list", "--all-regions"})
+	if rc != 0 {
+		t.Fatal("deployment list failed")
+	}
+	output = readConsole(t, consoleLog)
+	if listedColumn(output, depname1, 1) != "us-west-1" || listedColumn(output, depname2, 1) != "eu-west-2" {
+		t.Fatalf("Every deployment should be listed with its region %s", output)
+	}
+}
+
+// listedColumn returns the given column of the deployment list row for name.
+func listedColumn(output string, name string, column int) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > column && fields[0] == name {
+			return fields[column]
+		}
+	}
+	return ""
+}
+
 func buildImage(amiName string, confDir string, version string, releasefile string, region string) error {
 	startPath := os.Getenv("PATH")
 	defer os.Setenv("PATH", startPath)
@@ -251,227 +343,1759 @@ func TestBuildImageTop(t *testing.T) {
 	}
 }
 
-func TestBasicDeploy(t *testing.T) {
-	awsKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
-	defer os.Setenv("AWS_ACCESS_KEY_ID", awsKeyID)
-	os.Setenv("AWS_ACCESS_KEY_ID", "gravitontest")
-	awsSecretKeyID := os.Getenv("AWS_SECRET_ACCESS_KEY")
-	defer os.Setenv("AWS_SECRET_ACCESS_KEY", awsSecretKeyID)
-	os.Setenv("AWS_SECRET_ACCESS_KEY", "somevalue")
+func readConsole(t *testing.T, consoleLog string) string {
+	b, err := ioutil.ReadFile(consoleLog)
+	if err != nil {
+		t.Fatal("the console log was not created")
+	}
+	return string(b)
+}
 
+func TestBasicDeploy(t *testing.T) {
 	confDir, _ := ioutil.TempDir("", "stardogtests")
 	defer os.RemoveAll(confDir)
-	sshKeyFile := path.Join(confDir, "keyfile")
-	fakeOut := "xxx"
-	ioutil.WriteFile(sshKeyFile, []byte(fakeOut), 0600)
 
-	region := "us-west-1"
-	err := buildImage("ami-deadbeef", confDir, "50.10", "/etc/group", region)
-	if err != nil {
-		t.Fatalf("Failed to make the ami %s", err)
+	rc := realMain([]string{"--config-dir", confDir, "baseami", "--type", "fake", "/etc/group", "50.10"})
+	if rc != 0 {
+		t.Fatal("baseami failed")
 	}
 
-	startPath := os.Getenv("PATH")
-	defer os.Setenv("PATH", startPath)
-	exeDir, _, _ := aws.MakeTestTerraform(0, goodoutput1, "")
-	defer os.RemoveAll(exeDir)
-	os.Setenv("PATH", strings.Join([]string{exeDir, os.Getenv("PATH")}, ":"))
-
-	consoleLog := path.Join(confDir, "output2")
-
 	depName := randDeployName()
-	rc := realMain([]string{"--config-dir", confDir, "launch", "--no-wait",
-		"--region", region, "--aws-key-name", "keyname", "--private-key", sshKeyFile,
-		"--sd-version", "50.10", "--license", "/etc/group", depName})
+	rc = realMain([]string{"--config-dir", confDir, "launch", "--type", "fake", "--cidr", "0.0.0.0/0",
+		"--wait-timeout", "10", "--sd-version", "50.10", "--license", "/etc/group", depName})
 	if rc != 0 {
 		t.Fatal("launch failed")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "status", depName})
+	res := fakeCloud.Get(depName)
+	if res == nil || !res.Instance || !res.Open || res.Mask != "0.0.0.0/0" {
+		t.Fatalf("The instance was not launched and opened %v", res)
+	}
+	if len(res.Volumes) != 3 || res.ZkSize != 3 {
+		t.Fatalf("The default sizes were not used %v", res)
+	}
+
+	consoleLog := path.Join(confDir, "output1")
+	rc = realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "status", depName})
 	if rc != 0 {
 		t.Fatal("status failed")
 	}
+	output := readConsole(t, consoleLog)
+	if !strings.Contains(output, "The instance is healthy") || !strings.Contains(output, "Using 3 stardog nodes") {
+		t.Fatalf("The status is wrong %s", output)
+	}
 	if !sdutils.PathExists(path.Join(confDir, "deployments", depName)) {
 		t.Fatal("The deployment directory should exist")
 	}
+
+	consoleLog = path.Join(confDir, "output2")
 	rc = realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "volume", "status", depName})
 	if rc != 0 {
 		t.Fatal("volume status failed")
 	}
-	b, err := ioutil.ReadFile(consoleLog)
-	if err != nil {
-		t.Fatal("the console log was not created")
-	}
-	vols := []string{"vol-46313ce8", "vol-a34ba11c", "vol-50313cfe"}
-	output1 := string(b)
-	for _, vol := range vols {
-		if !strings.Contains(output1, vol) {
+	output = readConsole(t, consoleLog)
+	for _, vol := range res.Volumes {
+		if !strings.Contains(output, vol) {
 			t.Fatalf("The volume %s should have been found", vol)
 		}
 	}
+
+	consoleLog = path.Join(confDir, "output3")
 	rc = realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "instance", "status", depName})
 	if rc != 0 {
 		t.Fatal("instance status failed")
 	}
-	b, err = ioutil.ReadFile(consoleLog)
-	if err != nil {
-		t.Fatal("the console log was not created")
-	}
-	instances := []string{"stardog.sometest.com", "bastion.sometest.com"}
-	output1 = string(b)
-	for _, inst := range instances {
-		if !strings.Contains(output1, inst) {
-			t.Fatalf("The instance %s should have been found", inst)
-		}
+	output = readConsole(t, consoleLog)
+	if !strings.Contains(output, fmt.Sprintf("bastion-%s.fake", depName)) {
+		t.Fatalf("The bastion should have been found %s", output)
 	}
 
 	rc = realMain([]string{"--config-dir", confDir, "destroy", "--force", depName})
 	if rc != 0 {
-		t.Fatal("status failed")
+		t.Fatal("destroy failed")
 	}
 	if sdutils.PathExists(path.Join(confDir, "deployments", depName)) {
 		t.Fatal("The deployment directory should not exist")
 	}
+	if fakeCloud.Get(depName) != nil {
+		t.Fatal("The cloud resources should have been destroyed")
+	}
 }
 
-func TestSteppedOutDeploy(t *testing.T) {
-	awsKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
-	defer os.Setenv("AWS_ACCESS_KEY_ID", awsKeyID)
-	os.Setenv("AWS_ACCESS_KEY_ID", "gravitontest")
-	awsSecretKeyID := os.Getenv("AWS_SECRET_ACCESS_KEY")
-	defer os.Setenv("AWS_SECRET_ACCESS_KEY", awsSecretKeyID)
-	os.Setenv("AWS_SECRET_ACCESS_KEY", "somevalue")
+func launchFake(t *testing.T, confDir string, depName string) {
+	rc := realMain([]string{"--config-dir", confDir, "deployment", "new", "--type", "fake", depName, "4.2"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "1", "2"})
+	if rc != 0 {
+		t.Fatal("volume new failed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "instance", "new", "--wait-timeout", "10", "--cidr", "10.0.0.0/8", depName, "1"})
+	if rc != 0 {
+		t.Fatal("instance new failed")
+	}
+}
 
+func TestStatusUnhealthy(t *testing.T) {
 	confDir, _ := ioutil.TempDir("", "stardogtests")
 	defer os.RemoveAll(confDir)
-	sshKeyFile := path.Join(confDir, "keyfile")
-	fakeOut := "xxx"
-	ioutil.WriteFile(sshKeyFile, []byte(fakeOut), 0600)
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
 
-	region := "us-west-1"
-	err := buildImage("ami-deadbeef", confDir, "4.2", "/etc/group", region)
-	if err != nil {
-		t.Fatalf("Failed to make the ami %s", err)
+	consoleLog := path.Join(confDir, "output1")
+	rc := realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "status", "--internal-health", depName})
+	if rc != 0 {
+		t.Fatal("status failed")
+	}
+	output := readConsole(t, consoleLog)
+	if !strings.Contains(output, "The instance is healthy") {
+		t.Fatalf("The instance should be healthy %s", output)
 	}
 
-	startPath := os.Getenv("PATH")
-	defer os.Setenv("PATH", startPath)
-	exeDir, _, _ := aws.MakeTestTerraform(0, goodoutput1, "")
-	defer os.RemoveAll(exeDir)
-	sshExeDir, _, _ := aws.MakeTestSSH(0)
-	defer os.RemoveAll(sshExeDir)
-	os.Setenv("PATH", strings.Join([]string{exeDir, os.Getenv("PATH")}, ":"))
+	fakeCloud.SetHealthy(depName, false)
+	consoleLog = path.Join(confDir, "output2")
+	rc = realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "status", depName})
+	if rc != 0 {
+		t.Fatal("status failed")
+	}
+	output = readConsole(t, consoleLog)
+	if !strings.Contains(output, "The instance is not healthy") {
+		t.Fatalf("The instance should not be healthy %s", output)
+	}
+}
 
+func TestUpdateStardogAndLogs(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
 	depName := randDeployName()
-	rc := realMain([]string{"--config-dir", confDir, "deployment", "new", "--private-key", sshKeyFile, "--aws-key-name", "keyname", "--region", region, depName, "4.2"})
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+
+	sockSave := os.Getenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", sockSave)
+	os.Unsetenv("SSH_AUTH_SOCK")
+	rc := realMain([]string{"--config-dir", confDir, "update-stardog", depName, "/etc/group"})
+	if rc == 0 {
+		t.Fatal("update-stardog needs an ssh agent")
+	}
+	os.Setenv("SSH_AUTH_SOCK", path.Join(confDir, "agent"))
+
+	rc = realMain([]string{"--config-dir", confDir, "update-stardog", depName, "/etc/group"})
 	if rc != 0 {
-		t.Fatal("depl new failed")
+		t.Fatal("update-stardog failed")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "1", "1"})
+	bastion := fmt.Sprintf("ubuntu@bastion-%s.fake", depName)
+	if !containsCommand(fakeCloud.SSHCommands(), bastion, fmt.Sprintf("/usr/local/bin/stardog-update %s 2 /tmp/group", depName)) {
+		t.Fatalf("The update was not run on the bastion %v", fakeCloud.SSHCommands())
+	}
+	if !containsCommand(fakeCloud.SCPCommands(), "/etc/group", fmt.Sprintf("bastion-%s.fake:/tmp", depName)) {
+		t.Fatalf("The release was not uploaded %v", fakeCloud.SCPCommands())
+	}
+
+	rc = realMain([]string{"--config-dir", confDir, "update-stardog", "--rolling", depName, "/etc/group"})
 	if rc != 0 {
-		t.Fatal("status failed")
+		t.Fatal("update-stardog --rolling failed")
 	}
-	if !sdutils.PathExists(path.Join(confDir, "deployments", depName)) {
-		t.Fatal("The deployment directory should exist")
+	if !containsCommand(fakeCloud.SSHCommands(), bastion, "/usr/local/bin/stardog-update-node 10.0.0.1 /tmp/group") ||
+		!containsCommand(fakeCloud.SSHCommands(), bastion, "/usr/local/bin/stardog-update-node 10.0.0.2 /tmp/group") {
+		t.Fatalf("Every node should have been updated %v", fakeCloud.SSHCommands())
 	}
-	os.Setenv("STARDOG_GRAVITON_HEALTHY", "false")
-	rc = realMain([]string{"--config-dir", confDir, "instance", "new", "--wait-timeout", "2", depName, "1"})
-	os.Unsetenv("STARDOG_GRAVITON_HEALTHY")
+
+	fakeCloud.FailSSH("stardog-update-node 10.0.0.1 ")
+	defer fakeCloud.ClearSSHFailures()
+	consoleLog := path.Join(confDir, "console.log")
+	before := len(fakeCloud.SSHCommands())
+	rc = realMain([]string{"--config-dir", confDir, "--console-file", consoleLog, "update-stardog", "--rolling", depName, "/etc/group"})
 	if rc == 0 {
-		t.Fatal("instance start should have failed with timeout")
+		t.Fatal("update-stardog --rolling should fail when a node fails")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "instance", "status", depName})
-	if rc != 0 {
-		t.Fatal("instance status failed")
+	after := fakeCloud.SSHCommands()[before:]
+	if !containsCommand(after, "/usr/local/bin/stardog-update-node --rollback 10.0.0.1") {
+		t.Fatalf("The failed node was not rolled back %v", after)
 	}
-	rc = realMain([]string{"--config-dir", confDir, "instance", "destroy", "--force", depName})
+	if containsCommand(after, "--rollback 10.0.0.1 /usr/local/stardog.") {
+		t.Fatalf("Binaries that were not swapped should not be restored %v", after)
+	}
+	if containsCommand(after, "stardog-update-node 10.0.0.2") {
+		t.Fatalf("The remaining nodes should not be touched %v", after)
+	}
+	output := readConsole(t, consoleLog)
+	if !strings.Contains(output, "The following nodes were not updated: 10.0.0.2:5821") {
+		t.Fatalf("The untouched nodes were not reported %s", output)
+	}
+
+	// A failure after the swap restores the release the update moved aside.
+	fakeCloud.SSHOutput("stardog-update-node 10.0.0.1 ", "stardog-update-node backup: /usr/local/stardog.20261018-120000")
+	defer fakeCloud.ClearSSHOutput()
+	before = len(fakeCloud.SSHCommands())
+	rc = realMain([]string{"--config-dir", confDir, "update-stardog", "--rolling", depName, "/etc/group"})
+	if rc == 0 {
+		t.Fatal("update-stardog --rolling should fail when a node fails")
+	}
+	after = fakeCloud.SSHCommands()[before:]
+	if !containsCommand(after, "/usr/local/bin/stardog-update-node --rollback 10.0.0.1 /usr/local/stardog.20261018-120000") {
+		t.Fatalf("The backup made by the update was not restored %v", after)
+	}
+	fakeCloud.ClearSSHFailures()
+	fakeCloud.ClearSSHOutput()
+
+	// Nothing is touched when the release does not reach the bastion node.
+	fakeCloud.FailSCP("/etc/group")
+	defer fakeCloud.ClearSCPFailures()
+	before = len(fakeCloud.SSHCommands())
+	resultLog := path.Join(confDir, "result.json")
+	rc = realMain([]string{"--output", "json", "--console-file", resultLog, "--config-dir", confDir, "update-stardog", "--rolling", depName, "/etc/group"})
+	if rc == 0 {
+		t.Fatal("update-stardog --rolling should fail when the upload fails")
+	}
+	if after = fakeCloud.SSHCommands()[before:]; containsCommand(after, "stardog-update-node") {
+		t.Fatalf("No node should be updated or rolled back %v", after)
+	}
+	if result := readResult(t, resultLog); result.Error == nil || !strings.Contains(result.Error.Message, "Failed to copy /etc/group to the bastion node") {
+		t.Fatalf("The failed upload was not reported %v", result)
+	}
+	fakeCloud.ClearSCPFailures()
+
+	logFile := path.Join(confDir, "logs.tar.gz")
+	rc = realMain([]string{"--config-dir", confDir, "logs", "--output-file", logFile, depName})
 	if rc != 0 {
-		t.Fatal("Should be able to destroy the instance")
+		t.Fatal("logs failed")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "volume", "destroy", "--force", depName})
+	if !containsCommand(fakeCloud.SSHCommands(), bastion, "/usr/local/bin/stardog-gather-logs") {
+		t.Fatalf("The logs were not gathered on the bastion %v", fakeCloud.SSHCommands())
+	}
+	if !sdutils.PathExists(logFile) {
+		t.Fatal("The logs were not downloaded")
+	}
+}
+
+func TestLeaks(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+
+	consoleLog := path.Join(confDir, "output1")
+	rc := realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "leaks", "--type", "fake", "--deployment-name", depName})
 	if rc != 0 {
-		t.Fatal("Should be able to destroy the volume")
+		t.Fatal("leaks failed")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "deployment", "destroy", "--force", depName})
+	output := readConsole(t, consoleLog)
+	if !strings.Contains(output, "Found 2 volumes") || !strings.Contains(output, "Found 1 instances") {
+		t.Fatalf("The leaks were not found %s", output)
+	}
+	if fakeCloud.Get(depName) == nil {
+		t.Fatal("Nothing should have been destroyed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "leaks", "--type", "fake", "--deployment-name", depName, "--destroy", "--force"})
 	if rc != 0 {
-		t.Fatal("Should be able to destroy the deployment")
+		t.Fatal("leaks failed")
 	}
-
-	if sdutils.PathExists(path.Join(confDir, "deployments", depName)) {
-		t.Fatal("The deployment directory should not exist")
+	if fakeCloud.Get(depName) != nil {
+		t.Fatal("The leaked resources should have been destroyed")
 	}
 }
 
-func TestDestroyNoExist(t *testing.T) {
+func TestResume(t *testing.T) {
 	confDir, _ := ioutil.TempDir("", "stardogtests")
 	defer os.RemoveAll(confDir)
-
 	depName := randDeployName()
-	rc := realMain([]string{"--config-dir", confDir, "deployment", "destroy", "--force", depName})
-	if rc == 0 {
-		t.Fatal("Should fail when deleting a non existing deployment")
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+
+	rc := realMain([]string{"--config-dir", confDir, "deployment", "new", "--type", "fake", depName, "4.2"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "volume", "destroy", "--force", depName})
+	rc = realMain([]string{"--config-dir", confDir, "resume", depName})
 	if rc == 0 {
-		t.Fatal("Should fail when deleting a non existing volume")
+		t.Fatal("resume should fail when no volume parameters were recorded")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "instance", "destroy", "--force", depName})
-	if rc == 0 {
-		t.Fatal("Should fail when deleting a non existing instance")
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "1", "2"})
+	if rc != 0 {
+		t.Fatal("volume new failed")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "instance", "status", depName})
-	if rc == 0 {
-		t.Fatal("Should fail when status a non existing instance")
+	rc = realMain([]string{"--config-dir", confDir, "instance", "new", "--no-wait", "--cidr", "10.0.0.0/8", depName, "1"})
+	if rc != 0 {
+		t.Fatal("instance new failed")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "volume", "status", depName})
-	if rc == 0 {
-		t.Fatal("Should fail when status a non existing instance")
+	if fakeCloud.Get(depName).Open {
+		t.Fatal("The instance should not be open yet")
 	}
 
-	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "/etc/group", "1", "1"})
-	if rc == 0 {
-		t.Fatal("Should fail when deleting a non existing volume")
-	}
-	rc = realMain([]string{"--config-dir", confDir, "instance", "new", depName, "1"})
-	if rc == 0 {
-		t.Fatal("Should fail when deleting a non existing instance")
+	consoleLog := path.Join(confDir, "output1")
+	rc = realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "status", depName})
+	if rc != 0 {
+		t.Fatal("status failed")
 	}
-	rc = realMain([]string{"--config-dir", confDir, "client", depName, "hostname"})
-	if rc == 0 {
-		t.Fatal("client command should have failed")
+	output := readConsole(t, consoleLog)
+	if !strings.Contains(output, sdutils.StateInstanceCreated) {
+		t.Fatalf("The step should be %s %s", sdutils.StateInstanceCreated, output)
 	}
-}
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-	os.Setenv("STARDOG_GRAVITON_UNIT_TEST", "on")
-	dir, err := ioutil.TempDir("", "stardogtest")
-	if err != nil {
-		panic("failed to make a temp dir")
+	rc = realMain([]string{"--config-dir", confDir, "resume", "--wait-timeout", "10", depName})
+	if rc != 0 {
+		t.Fatal("resume failed")
+	}
+	res := fakeCloud.Get(depName)
+	if !res.Open || res.Mask != "10.0.0.0/8" {
+		t.Fatalf("The instance was not opened with the recorded mask %v", res)
 	}
 
-	_, _, err = aws.MakeTestPacker(0, "amazon-ebs,artifact,0,string,AMIs were created:ami-deadbeef", dir)
-	if err != nil {
-		panic("failed to make fake packer")
+	jsonFile := path.Join(confDir, "status.json")
+	rc = realMain([]string{"--config-dir", confDir, "status", "--json-file", jsonFile, depName})
+	if rc != 0 {
+		t.Fatal("status failed")
 	}
-	_, _, err = aws.MakeTestTerraform(0, "terraform data", dir)
+	sd := sdutils.StardogDescription{}
+	err := sdutils.LoadJSON(&sd, jsonFile)
 	if err != nil {
-		panic("failed to make fake terraform")
+		t.Fatalf("Failed to load the status %s", err)
+	}
+	if sd.State != sdutils.StateHealthy {
+		t.Fatalf("The step should be %s not %s", sdutils.StateHealthy, sd.State)
 	}
-	// We need to trick the tests into thinking packer and terraform exists for stubs
-	os.Setenv("PATH", strings.Join([]string{dir, os.Getenv("PATH")}, ":"))
 }
 
-var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+func TestScale(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
 
-func randDeployName() string {
-	b := make([]rune, 10)
-	for i := range b {
-		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+	rc := realMain([]string{"--config-dir", confDir, "scale", "--nodes", "4", "--wait-timeout", "10", depName})
+	if rc != 0 {
+		t.Fatal("scale up failed")
 	}
-	return string(b)
-}
-
-func TestCleanup(t *testing.T) {
+	res := fakeCloud.Get(depName)
+	if len(res.Volumes) != 4 || res.Nodes != 4 {
+		t.Fatalf("The cluster should have 4 nodes %v", res)
+	}
+	rc = realMain([]string{"--config-dir", confDir, "scale", "--nodes", "2", depName})
+	if rc == 0 {
+		t.Fatal("scale should refuse to drop below the quorum")
+	}
+	if len(fakeCloud.Get(depName).Volumes) != 4 {
+		t.Fatal("The cluster should not have changed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "scale", "--nodes", "3", "--wait-timeout", "10", depName})
+	if rc != 0 {
+		t.Fatal("scale down failed")
+	}
+	res = fakeCloud.Get(depName)
+	if len(res.Volumes) != 3 || res.Nodes != 3 {
+		t.Fatalf("The cluster should have 3 nodes %v", res)
+	}
+}
+
+func TestReimage(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+
+	rc := realMain([]string{"--config-dir", confDir, "instance", "reimage", "--fake-image", "newimage", "--wait-timeout", "10", depName})
+	if rc != 0 {
+		t.Fatal("instance reimage failed")
+	}
+	res := fakeCloud.Get(depName)
+	if res.Image != "newimage" || len(res.SdReplaced) != 2 || res.SdReplaced[0] != 0 || res.SdReplaced[1] != 1 {
+		t.Fatalf("Every node should have been replaced in order %v", res)
+	}
+	if len(res.Away) != 0 {
+		t.Fatalf("Every node should have rejoined on its own address %v", res.Away)
+	}
+
+	fakeCloud.SetRejoin(depName, false)
+	defer fakeCloud.SetRejoin(depName, true)
+	rc = realMain([]string{"--config-dir", confDir, "instance", "reimage", "--wait-timeout", "2", depName})
+	if rc == 0 {
+		t.Fatal("instance reimage should fail when a node does not rejoin")
+	}
+	res = fakeCloud.Get(depName)
+	if len(res.SdReplaced) != 3 {
+		t.Fatalf("The remaining nodes should not be replaced %v", res)
+	}
+}
+
+func TestZookeeper(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+
+	rc := realMain([]string{"--config-dir", confDir, "zk", "resize", "--wait-timeout", "10", depName, "3"})
+	if rc != 0 {
+		t.Fatal("zk resize failed")
+	}
+	res := fakeCloud.Get(depName)
+	if res.ZkSize != 3 || len(res.ZkReplaced) != 3 {
+		t.Fatalf("The ensemble should have 3 nodes %v", res)
+	}
+	rc = realMain([]string{"--config-dir", confDir, "zk", "resize", "--wait-timeout", "10", depName, "5"})
+	if rc != 0 {
+		t.Fatal("zk resize failed")
+	}
+	before := len(fakeCloud.Get(depName).ZkReplaced)
+	rc = realMain([]string{"--config-dir", confDir, "zk", "resize", "--wait-timeout", "10", depName, "3"})
+	if rc != 0 {
+		t.Fatal("zk resize failed")
+	}
+	res = fakeCloud.Get(depName)
+	if fmt.Sprintf("%v", res.ZkReplaced[before:]) != "[0 1 2 3 4]" {
+		t.Fatalf("Shrinking should replace the kept nodes before removing the others %v", res.ZkReplaced[before:])
+	}
+	if len(res.SdReplaced) != 3*res.Nodes {
+		t.Fatalf("Every Stardog node should be replaced after each resize %v", res.SdReplaced)
+	}
+
+	// The replaced Stardog nodes rejoin on their old addresses, as docker
+	// containers do.
+	consoleLog := path.Join(confDir, "output")
+	clusterNodes := func() string {
+		rc := realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "status", depName})
+		if rc != 0 {
+			t.Fatal("status failed")
+		}
+		return fmt.Sprintf("%v", readResult(t, consoleLog).Result.(map[string]interface{})["stardog_nodes"])
+	}
+	nodesBefore := clusterNodes()
+	rc = realMain([]string{"--config-dir", confDir, "zk", "resize", "--wait-timeout", "10", depName, "5"})
+	if rc != 0 {
+		t.Fatal("zk resize should finish when the Stardog nodes keep their addresses")
+	}
+	if nodesAfter := clusterNodes(); nodesAfter != nodesBefore || !strings.Contains(nodesBefore, "10.0.0.1:5821") {
+		t.Fatalf("The Stardog nodes should keep their addresses %s %s", nodesBefore, nodesAfter)
+	}
+
+	fakeCloud.SetRejoin(depName, false)
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "zk", "resize", "--wait-timeout", "2", depName, "3"})
+	fakeCloud.SetRejoin(depName, true)
+	if rc == 0 {
+		t.Fatal("zk resize should fail when a Stardog node does not rejoin")
+	}
+	result := readResult(t, consoleLog)
+	if result.Error == nil || !strings.Contains(result.Error.Message, "instance reimage") || fakeCloud.Get(depName).ZkSize != 3 {
+		t.Fatalf("The failed Stardog replacement should be reported after the ensemble was resized %v", result.Error)
+	}
+	fakeCloud.ClearAway(depName)
+	rc = realMain([]string{"--config-dir", confDir, "zk", "resize", depName, "2"})
+	if rc == 0 {
+		t.Fatal("zk resize should refuse an even ensemble")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "zk", "replace", depName, "4"})
+	if rc == 0 {
+		t.Fatal("zk replace should refuse an unknown node")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "zk", "replace", "--wait-timeout", "10", depName, "2"})
+	if rc != 0 {
+		t.Fatal("zk replace failed")
+	}
+	res = fakeCloud.Get(depName)
+	if res.ZkReplaced[len(res.ZkReplaced)-1] != 1 {
+		t.Fatalf("The second node should have been replaced %v", res.ZkReplaced)
+	}
+	if !containsCommand(fakeCloud.SSHCommands(), "/zk/2") {
+		t.Fatal("The quorum was not checked from the bastion node")
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+
+	rc := realMain([]string{"--config-dir", confDir, "volume", "snapshot", "--tag", "nightly", depName})
+	if rc != 0 {
+		t.Fatal("volume snapshot failed")
+	}
+	files, err := ioutil.ReadDir(sdutils.SnapshotDir(confDir, depName))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("One snapshot set should have been recorded %v", err)
+	}
+	var set sdutils.SnapshotSet
+	err = sdutils.LoadJSON(&set, path.Join(sdutils.SnapshotDir(confDir, depName), files[0].Name()))
+	if err != nil {
+		t.Fatalf("The snapshot set could not be read %s", err)
+	}
+	if set.Tag != "nightly" || len(set.SnapshotIDs) != 2 || set.Type != "fake" {
+		t.Fatalf("The snapshot set is wrong %v", set)
+	}
+
+	cloneName := randDeployName()
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, cloneName, true, true)
+	rc = realMain([]string{"--config-dir", confDir, "deployment", "new", "--type", "fake", cloneName, "4.2"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", cloneName})
+	if rc == 0 {
+		t.Fatal("volume new needs a license or a snapshot set")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", "--from-snapshot-set", "nosuchset", cloneName})
+	if rc == 0 {
+		t.Fatal("volume new should fail with an unknown snapshot set")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", "--from-snapshot-set", set.ID, cloneName})
+	if rc != 0 {
+		t.Fatal("volume new from a snapshot set failed")
+	}
+	res := fakeCloud.Get(cloneName)
+	if res == nil || len(res.Volumes) != 2 {
+		t.Fatalf("The clone should have 2 volumes %v", res)
+	}
+	var baseD sdutils.BaseDeployment
+	err = sdutils.LoadJSON(&baseD, path.Join(sdutils.DeploymentDir(confDir, cloneName), "config.json"))
+	if err != nil {
+		t.Fatalf("The clone configuration could not be read %s", err)
+	}
+	if baseD.State != sdutils.StateVolumesCreated || baseD.Launch.SnapshotSetID != set.ID {
+		t.Fatalf("The clone should be at the volumes-created step from %s not %s %v", set.ID, baseD.State, baseD.Launch)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+
+	backupDir := path.Join(confDir, "shipped")
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			// Backups are named by the second in which they are taken.
+			time.Sleep(1100 * time.Millisecond)
+		}
+		rc := realMain([]string{"--config-dir", confDir, "backup", "schedule", "--every", "6h", "--keep", "1", "--to", backupDir, "--once", depName})
+		if rc != 0 {
+			t.Fatal("backup schedule failed")
+		}
+	}
+	baseD := sdutils.BaseDeployment{Directory: sdutils.DeploymentDir(confDir, depName)}
+	catalog, err := sdutils.LoadBackupCatalog(&baseD)
+	if err != nil {
+		t.Fatalf("The backup catalog could not be read %s", err)
+	}
+	if catalog.Policy == nil || catalog.Policy.Every != "6h0m0s" || catalog.Policy.Keep != 1 {
+		t.Fatalf("The policy was not recorded %v", catalog.Policy)
+	}
+	if len(catalog.Backups) != 1 {
+		t.Fatalf("Only one backup should be kept %v", catalog.Backups)
+	}
+	backupID := catalog.Backups[0].ID
+	shipped, _ := ioutil.ReadDir(backupDir)
+	if len(shipped) != 1 || shipped[0].Name() != backupID {
+		t.Fatalf("Only the latest backup should have been shipped %v", shipped)
+	}
+	snapCount := 0
+	for _, snap := range fakeCloud.Snapshots() {
+		if strings.Contains(snap, depName) {
+			snapCount++
+		}
+	}
+	if snapCount != 2 {
+		t.Fatalf("The snapshots of the pruned backup should have been deleted %v", fakeCloud.Snapshots())
+	}
+	sets, _ := ioutil.ReadDir(sdutils.SnapshotDir(confDir, depName))
+	if len(sets) != 1 {
+		t.Fatalf("The pruned snapshot set should have been removed %v", sets)
+	}
+
+	consoleLog := path.Join(confDir, "output1")
+	rc := realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "backup", "list", depName})
+	if rc != 0 {
+		t.Fatal("backup list failed")
+	}
+	if !strings.Contains(readConsole(t, consoleLog), backupID) {
+		t.Fatal("The backup was not listed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "backup", "restore", depName, backupID})
+	if rc == 0 {
+		t.Fatal("A snapshot backup cannot be restored over existing volumes")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "backup", "schedule", "--method", "db", "--db", "mydb", "--to", backupDir, "--once", depName})
+	if rc == 0 {
+		t.Fatal("Database backups cannot be shipped to a local directory")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "backup", "schedule", "--method", "db", "--db", "mydb", "--keep", "5", "--to", "s3://bucket/graviton?region=us-east-1", "--once", depName})
+	if rc != 0 {
+		t.Fatal("The database backup failed")
+	}
+	if !containsCommand(fakeCloud.SSHCommands(), "stardog-admin", "db backup --to s3:///bucket/graviton/"+depName, "mydb") {
+		t.Fatalf("stardog-admin db backup was not run %v", fakeCloud.SSHCommands())
+	}
+}
+
+func containsCommand(commands []string, parts ...string) bool {
+	for _, c := range commands {
+		found := true
+		for _, p := range parts {
+			if !strings.Contains(c, p) {
+				found = false
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSteppedOutDeploy(t *testing.T) {
+	awsKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	defer os.Setenv("AWS_ACCESS_KEY_ID", awsKeyID)
+	os.Setenv("AWS_ACCESS_KEY_ID", "gravitontest")
+	awsSecretKeyID := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	defer os.Setenv("AWS_SECRET_ACCESS_KEY", awsSecretKeyID)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "somevalue")
+
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	sshKeyFile := path.Join(confDir, "keyfile")
+	fakeOut := "xxx"
+	ioutil.WriteFile(sshKeyFile, []byte(fakeOut), 0600)
+
+	region := "us-west-1"
+	err := buildImage("ami-deadbeef", confDir, "4.2", "/etc/group", region)
+	if err != nil {
+		t.Fatalf("Failed to make the ami %s", err)
+	}
+
+	startPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", startPath)
+	exeDir, _, _ := aws.MakeTestTerraform(0, goodoutput1, "")
+	defer os.RemoveAll(exeDir)
+	os.Setenv("PATH", strings.Join([]string{exeDir, os.Getenv("PATH")}, ":"))
+
+	depName := randDeployName()
+	rc := realMain([]string{"--config-dir", confDir, "deployment", "new", "--private-key", sshKeyFile, "--aws-key-name", "keyname", "--region", region, depName, "4.2"})
+	if rc != 0 {
+		t.Fatal("depl new failed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "1", "1"})
+	if rc != 0 {
+		t.Fatal("status failed")
+	}
+	if !sdutils.PathExists(path.Join(confDir, "deployments", depName)) {
+		t.Fatal("The deployment directory should exist")
+	}
+	// The fake bastion does not know about this deployment so it is never healthy
+	rc = realMain([]string{"--config-dir", confDir, "instance", "new", "--wait-timeout", "2", depName, "1"})
+	if rc == 0 {
+		t.Fatal("instance start should have failed with timeout")
+	}
+	consoleLog := path.Join(confDir, "output1")
+	rc = realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "volume", "status", depName})
+	if rc != 0 {
+		t.Fatal("volume status failed")
+	}
+	output := readConsole(t, consoleLog)
+	for _, vol := range []string{"vol-46313ce8", "vol-a34ba11c", "vol-50313cfe"} {
+		if !strings.Contains(output, vol) {
+			t.Fatalf("The volume %s should have been found", vol)
+		}
+	}
+	consoleLog = path.Join(confDir, "output2")
+	rc = realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "instance", "status", depName})
+	if rc != 0 {
+		t.Fatal("instance status failed")
+	}
+	output = readConsole(t, consoleLog)
+	for _, inst := range []string{"stardog.sometest.com", "bastion.sometest.com"} {
+		if !strings.Contains(output, inst) {
+			t.Fatalf("The instance %s should have been found", inst)
+		}
+	}
+	rc = realMain([]string{"--config-dir", confDir, "instance", "destroy", "--force", depName})
+	if rc != 0 {
+		t.Fatal("Should be able to destroy the instance")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "volume", "destroy", "--force", depName})
+	if rc != 0 {
+		t.Fatal("Should be able to destroy the volume")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "deployment", "destroy", "--force", depName})
+	if rc != 0 {
+		t.Fatal("Should be able to destroy the deployment")
+	}
+
+	if sdutils.PathExists(path.Join(confDir, "deployments", depName)) {
+		t.Fatal("The deployment directory should not exist")
+	}
+}
+
+func TestDestroyNoExist(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+
+	depName := randDeployName()
+	rc := realMain([]string{"--config-dir", confDir, "deployment", "destroy", "--force", depName})
+	if rc == 0 {
+		t.Fatal("Should fail when deleting a non existing deployment")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "volume", "destroy", "--force", depName})
+	if rc == 0 {
+		t.Fatal("Should fail when deleting a non existing volume")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "instance", "destroy", "--force", depName})
+	if rc == 0 {
+		t.Fatal("Should fail when deleting a non existing instance")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "instance", "status", depName})
+	if rc == 0 {
+		t.Fatal("Should fail when status a non existing instance")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "volume", "status", depName})
+	if rc == 0 {
+		t.Fatal("Should fail when status a non existing instance")
+	}
+
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "/etc/group", "1", "1"})
+	if rc == 0 {
+		t.Fatal("Should fail when deleting a non existing volume")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "instance", "new", depName, "1"})
+	if rc == 0 {
+		t.Fatal("Should fail when deleting a non existing instance")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "client", depName, "hostname"})
+	if rc == 0 {
+		t.Fatal("client command should have failed")
+	}
+}
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+	dir, err := ioutil.TempDir("", "stardogtest")
+	if err != nil {
+		panic("failed to make a temp dir")
+	}
+
+	fakeCloud, err = fake.NewCloud(dir)
+	if err != nil {
+		panic("failed to make the fake cloud")
+	}
+	pluginFactories = append(pluginFactories, fakeCloud.NewPlugin)
+
+	_, _, err = aws.MakeTestPacker(0, "amazon-ebs,artifact,0,string,AMIs were created:ami-deadbeef", dir)
+	if err != nil {
+		panic("failed to make fake packer")
+	}
+	_, _, err = aws.MakeTestTerraform(0, "terraform data", dir)
+	if err != nil {
+		panic("failed to make fake terraform")
+	}
+	// We need to trick the tests into thinking packer, terraform and the
+	// bastion ssh and scp clients exist for stubs
+	os.Setenv("PATH", strings.Join([]string{dir, os.Getenv("PATH")}, ":"))
+}
+
+var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+
+func randDeployName() string {
+	b := make([]rune, 10)
+	for i := range b {
+		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+	}
+	return string(b)
+}
+
+func TestCleanup(t *testing.T) {
 	os.Remove(packerFile)
 	os.Remove(terraformFile)
 }
+
+func readResult(t *testing.T, consoleLog string) commandResult {
+	var result commandResult
+	b, err := ioutil.ReadFile(consoleLog)
+	if err != nil {
+		t.Fatal("the console log was not created")
+	}
+	err = json.Unmarshal(b, &result)
+	if err != nil {
+		t.Fatalf("The output is not a single json document %s: %s", err, string(b))
+	}
+	return result
+}
+
+func TestOutputFormats(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+
+	consoleLog := path.Join(confDir, "output")
+	rc := realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "baseami", "--type", "fake", "/etc/group", "4.2"})
+	if rc != 0 {
+		t.Fatal("baseami failed")
+	}
+	result := readResult(t, consoleLog)
+	image := result.Result.(map[string]interface{})
+	if !result.Success || result.Command != "baseami build" || image["image"] != "fake-4.2" {
+		t.Fatalf("The baseami result is wrong %v", result)
+	}
+
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "deployment", "list"})
+	if rc != 0 {
+		t.Fatal("deployment list failed")
+	}
+	result = readResult(t, consoleLog)
+	list := result.Result.([]interface{})
+	if len(list) != 1 || list[0].(map[string]interface{})["name"] != depName || list[0].(map[string]interface{})["type"] != "fake" {
+		t.Fatalf("The deployment list result is wrong %v", result)
+	}
+
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "volume", "status", depName})
+	if rc != 0 {
+		t.Fatal("volume status failed")
+	}
+	result = readResult(t, consoleLog)
+	if len(result.Result.(map[string]interface{})["VolumeIds"].([]interface{})) != 2 {
+		t.Fatalf("The volume status result is wrong %v", result)
+	}
+
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "instance", "status", depName})
+	if rc != 0 {
+		t.Fatal("instance status failed")
+	}
+	result = readResult(t, consoleLog)
+	if result.Result.(map[string]interface{})["stardog_url"] == nil {
+		t.Fatalf("The instance status result is wrong %v", result)
+	}
+
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "status", depName})
+	if rc != 0 {
+		t.Fatal("status failed")
+	}
+	result = readResult(t, consoleLog)
+	if len(result.Result.(map[string]interface{})["stardog_nodes"].([]interface{})) != 2 {
+		t.Fatalf("The status result is wrong %v", result)
+	}
+
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "leaks", "--type", "fake", "--deployment-name", depName})
+	if rc != 0 {
+		t.Fatal("leaks failed")
+	}
+	result = readResult(t, consoleLog)
+	if len(result.Result.(map[string]interface{})["instances"].([]interface{})) != 1 {
+		t.Fatalf("The leaks result is wrong %v", result)
+	}
+
+	rc = realMain([]string{"--output", "yaml", "--console-file", consoleLog, "--config-dir", confDir, "volume", "status", depName})
+	if rc != 0 {
+		t.Fatal("volume status failed")
+	}
+	output := readConsole(t, consoleLog)
+	if !strings.HasPrefix(output, "command: volume status\n") || !strings.Contains(output, "success: true\n") || strings.Contains(output, "Volumes:") {
+		t.Fatalf("The yaml output is wrong %s", output)
+	}
+
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "volume", "status", "nosuchdeployment"})
+	if rc == 0 {
+		t.Fatal("The status of a missing deployment should fail")
+	}
+	result = readResult(t, consoleLog)
+	if result.Success || result.Error == nil || result.Error.Message == "" || len(result.Error.LogFiles) != 2 {
+		t.Fatalf("The error result is wrong %v", result)
+	}
+}
+
+func TestDeploymentListDetails(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	emptyName := randDeployName()
+	rc := realMain([]string{"--config-dir", confDir, "deployment", "new", "--type", "fake", emptyName, "4.2"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
+	}
+
+	consoleLog := path.Join(confDir, "output")
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "--console-file", consoleLog, "deployment", "list"})
+	if rc != 0 {
+		t.Fatal("deployment list failed")
+	}
+	output := readConsole(t, consoleLog)
+	expected := []string{"-", "fake", "4.2", "fake-4.2"}
+	for i, e := range expected {
+		if listedColumn(output, depName, i+1) != e {
+			t.Fatalf("Column %d should be %s %s", i+1, e, output)
+		}
+	}
+	if listedColumn(output, depName, 6) != "yes" || listedColumn(output, depName, 7) != "yes" || listedColumn(output, depName, 8) != "2" || listedColumn(output, depName, 9) != "1" {
+		t.Fatalf("The resources of the deployment are wrong %s", output)
+	}
+	if listedColumn(output, emptyName, 6) != "no" || listedColumn(output, emptyName, 7) != "no" || listedColumn(output, emptyName, 8) != "-" {
+		t.Fatalf("The new deployment should have no resources %s", output)
+	}
+	if !strings.HasPrefix(listedColumn(output, depName, 10), fmt.Sprintf("%d-", time.Now().Year())) {
+		t.Fatalf("The creation time is missing %s", output)
+	}
+	if strings.Contains(output, "NAME") || listedColumn(output, depName, 12) != "" {
+		t.Fatalf("The header and health should not be shown %s", output)
+	}
+
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "--console-file", consoleLog, "deployment", "list", "--check-health"})
+	if rc != 0 {
+		t.Fatal("deployment list failed")
+	}
+	output = readConsole(t, consoleLog)
+	if listedColumn(output, depName, 12) != "healthy" || listedColumn(output, emptyName, 12) != "unhealthy" {
+		t.Fatalf("The health is wrong %s", output)
+	}
+
+	fakeCloud.SetHealthy(depName, false)
+	rc = realMain([]string{"--output", "json", "--config-dir", confDir, "--console-file", consoleLog, "deployment", "list", "--check-health"})
+	if rc != 0 {
+		t.Fatal("deployment list failed")
+	}
+	result := readResult(t, consoleLog)
+	for _, e := range result.Result.([]interface{}) {
+		entry := e.(map[string]interface{})
+		if entry["name"] == depName && (entry["healthy"] != false || entry["cluster_size"] != float64(2) || entry["created"] == nil) {
+			t.Fatalf("The json entry is wrong %v", entry)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	rc := realMain([]string{"--config-dir", confDir, "deployment", "new", "--type", "fake", "--env", "DB_PASSWORD=hunter2", "--env", "LEVEL=debug", depName, "4.2"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "1", "2"})
+	if rc != 0 {
+		t.Fatal("volume new failed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "instance", "new", "--wait-timeout", "10", "--cidr", "10.0.0.0/8", depName, "1"})
+	if rc != 0 {
+		t.Fatal("instance new failed")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "1", "2"})
+	if rc == 0 {
+		t.Fatal("The volumes already exist")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "status", depName})
+	if rc != 0 {
+		t.Fatal("status failed")
+	}
+
+	consoleLog := path.Join(confDir, "output")
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "history", depName})
+	if rc != 0 {
+		t.Fatal("history failed")
+	}
+	result := readResult(t, consoleLog)
+	entries := result.Result.([]interface{})
+	if len(entries) != 4 {
+		t.Fatalf("There should be 4 entries, status is not recorded %v", entries)
+	}
+	expected := []struct {
+		command string
+		outcome string
+		change  string
+	}{
+		{"deployment new", "success", "deployment created"},
+		{"volume new", "success", "volumes created"},
+		{"instance new", "success", "instance created"},
+		{"volume new", "failure", ""},
+	}
+	for i, e := range expected {
+		entry := entries[i].(map[string]interface{})
+		if entry["command"] != e.command || entry["outcome"] != e.outcome || entry["user"] == "" || entry["start"] == nil {
+			t.Fatalf("The entry %d is wrong %v", i, entry)
+		}
+		b, _ := json.Marshal(entry["resources"])
+		if e.change != "" && !strings.Contains(string(b), e.change) {
+			t.Fatalf("The entry %d should record %s %v", i, e.change, entry)
+		}
+	}
+	args, _ := json.Marshal(entries[0].(map[string]interface{})["args"])
+	if strings.Contains(string(args), "hunter2") || !strings.Contains(string(args), "DB_PASSWORD=*****") || !strings.Contains(string(args), "LEVEL=debug") {
+		t.Fatalf("The secret was not redacted %s", string(args))
+	}
+
+	rc = realMain([]string{"--config-dir", confDir, "destroy", "--force", depName})
+	if rc != 0 {
+		t.Fatal("destroy failed")
+	}
+	rc = realMain([]string{"--quiet", "--console-file", consoleLog, "--config-dir", confDir, "history", depName})
+	if rc != 0 {
+		t.Fatal("The history should outlive the deployment")
+	}
+	output := readConsole(t, consoleLog)
+	if !strings.Contains(output, "instance deleted") || !strings.Contains(output, "deployment deleted") {
+		t.Fatalf("The destroy was not recorded %s", output)
+	}
+}
+
+func TestJSONLogFormat(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	rc := realMain([]string{"--log-format", "json", "--log-level", "DEBUG", "--config-dir", confDir, "deployment", "new", "--type", "fake", depName, "4.2"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
+	}
+	data, err := ioutil.ReadFile(path.Join(confDir, "deployments", depName, "logs", "graviton.log"))
+	if err != nil {
+		t.Fatalf("The log file was not written %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for _, l := range lines {
+		entry := make(map[string]string)
+		err = json.Unmarshal([]byte(l), &entry)
+		if err != nil {
+			t.Fatalf("The log line is not json %s: %s", err, l)
+		}
+		if entry["command"] != "deployment new" || entry["deployment"] != depName || entry["level"] == "" {
+			t.Fatalf("The log line is missing its fields %s", l)
+		}
+	}
+
+	rc = realMain([]string{"--log-format", "xml", "--config-dir", confDir, "deployment", "list"})
+	if rc == 0 {
+		t.Fatal("xml is not a log format")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	consoleLog := path.Join(confDir, "output")
+	planned := func(args ...string) map[string]interface{} {
+		args = append([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir}, args...)
+		rc := realMain(args)
+		result := readResult(t, consoleLog)
+		if rc != 0 {
+			t.Fatalf("The dry run %v failed %v", args, result.Error)
+		}
+		return result.Result.(map[string]interface{})
+	}
+	count := func(plan map[string]interface{}, action string, resourceType string) float64 {
+		counts, ok := plan[action].(map[string]interface{})
+		if !ok {
+			return 0
+		}
+		n, _ := counts[resourceType].(float64)
+		return n
+	}
+
+	plan := planned("launch", "--type", "fake", "--dry-run", "--cidr", "0.0.0.0/0", "--sd-version", "4.2", "--license", "/etc/group", depName)
+	if count(plan, "add", "fake_volume") != 3 || count(plan, "add", "fake_instance") != 1 || count(plan, "add", "fake_zookeeper_node") != 3 {
+		t.Fatalf("The launch plan of a new deployment is wrong %v", plan)
+	}
+	if sdutils.PathExists(path.Join(sdutils.DeploymentDir(confDir, depName), "config.json")) {
+		t.Fatal("The dry run created the deployment")
+	}
+	if fakeCloud.Get(depName) != nil {
+		t.Fatal("The dry run created resources")
+	}
+	rc := realMain([]string{"--config-dir", confDir, "deployment", "new", "--type", "fake", depName, "4.2"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+
+	plan = planned("launch", "--type", "fake", "--dry-run", "--cidr", "0.0.0.0/0", "--sd-version", "4.2", "--license", "/etc/group", depName)
+	if count(plan, "add", "fake_volume") != 3 || count(plan, "add", "fake_instance") != 1 || count(plan, "add", "fake_zookeeper_node") != 3 {
+		t.Fatalf("The launch plan is wrong %v", plan)
+	}
+	plan = planned("volume", "new", "--dry-run", depName, "/etc/group", "1", "2")
+	if count(plan, "add", "fake_volume") != 2 || plan["destroy"] != nil {
+		t.Fatalf("The volume plan is wrong %v", plan)
+	}
+	res := fakeCloud.Get(depName)
+	if res != nil && (len(res.Volumes) > 0 || res.Instance) {
+		t.Fatalf("The dry runs created resources %v", res)
+	}
+
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "1", "2"})
+	if rc != 0 {
+		t.Fatal("volume new failed")
+	}
+	plan = planned("instance", "new", "--dry-run", depName, "1")
+	if count(plan, "add", "fake_stardog_node") != 2 || count(plan, "add", "fake_zookeeper_node") != 1 {
+		t.Fatalf("The instance plan is wrong %v", plan)
+	}
+	plan = planned("destroy", "--dry-run", depName)
+	if count(plan, "destroy", "fake_volume") != 2 || plan["add"] != nil {
+		t.Fatalf("The destroy plan is wrong %v", plan)
+	}
+	plan = planned("volume", "destroy", "--dry-run", depName)
+	if count(plan, "destroy", "fake_volume") != 2 {
+		t.Fatalf("The volume destroy plan is wrong %v", plan)
+	}
+	res = fakeCloud.Get(depName)
+	if res == nil || len(res.Volumes) != 2 || res.Instance {
+		t.Fatalf("The dry runs changed the resources %v", res)
+	}
+
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "history", depName})
+	if rc != 0 {
+		t.Fatal("history failed")
+	}
+	entries := readResult(t, consoleLog).Result.([]interface{})
+	if len(entries) != 2 {
+		t.Fatalf("Dry runs should not be in the history %v", entries)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	consoleLog := path.Join(confDir, "output")
+	drifted := func() (int, []interface{}) {
+		rc := realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "drift", depName})
+		items, _ := readResult(t, consoleLog).Result.([]interface{})
+		return rc, items
+	}
+
+	rc := realMain([]string{"--config-dir", confDir, "deployment", "new", "--type", "fake", depName, "4.2"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "1", "2"})
+	if rc != 0 {
+		t.Fatal("volume new failed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "instance", "new", depName, "1"})
+	if rc != 0 {
+		t.Fatal("instance new failed")
+	}
+	rc, items := drifted()
+	if rc != 0 || len(items) != 0 {
+		t.Fatalf("A new deployment should not drift %d %v", rc, items)
+	}
+
+	fakeCloud.SetNodes(depName, 1)
+	rc, items = drifted()
+	if rc == 0 || len(items) != 1 {
+		t.Fatalf("The stopped node should be drift %d %v", rc, items)
+	}
+	item := items[0].(map[string]interface{})
+	if item["kind"] != sdutils.DriftModified || item["resource"] != "fake_stardog_node" {
+		t.Fatalf("The drift is wrong %v", item)
+	}
+
+	fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	rc, items = drifted()
+	if rc == 0 || len(items) != 2 {
+		t.Fatalf("The volumes and the instance should be missing %d %v", rc, items)
+	}
+	for _, i := range items {
+		if i.(map[string]interface{})["kind"] != sdutils.DriftMissing {
+			t.Fatalf("The drift is wrong %v", items)
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	consoleLog := path.Join(confDir, "output")
+	estimate := func() map[string]interface{} {
+		rc := realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "cost", depName})
+		result := readResult(t, consoleLog)
+		if rc != 0 {
+			t.Fatalf("cost failed %v", result.Error)
+		}
+		return result.Result.(map[string]interface{})
+	}
+	count := func(e map[string]interface{}, resource string) float64 {
+		for _, i := range e["items"].([]interface{}) {
+			item := i.(map[string]interface{})
+			if item["resource"] == resource {
+				return item["count"].(float64)
+			}
+		}
+		return 0
+	}
+
+	rc := realMain([]string{"--config-dir", confDir, "deployment", "new", "--type", "fake", depName, "4.2"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	e := estimate()
+	if count(e, "stardog node") != 3 || count(e, "zookeeper node") != 3 || e["hourly"].(float64) <= 0 {
+		t.Fatalf("The defaults should be priced %v", e)
+	}
+
+	rc = realMain([]string{"--config-dir", confDir, "volume", "new", depName, "/etc/group", "1", "5"})
+	if rc != 0 {
+		t.Fatal("volume new failed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "instance", "new", depName, "1"})
+	if rc != 0 {
+		t.Fatal("instance new failed")
+	}
+	e = estimate()
+	if count(e, "stardog node") != 5 || count(e, "zookeeper node") != 1 {
+		t.Fatalf("The deployment should be priced as it is %v", e)
+	}
+}
+
+func TestStopStart(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+
+	rc := realMain([]string{"--config-dir", confDir, "baseami", "--type", "fake", "/etc/group", "50.10"})
+	if rc != 0 {
+		t.Fatal("baseami failed")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "launch", "--type", "fake", "--cidr", "0.0.0.0/0", "--ttl", "1ms",
+		"--wait-timeout", "10", "--sd-version", "50.10", "--license", "/etc/group", depName})
+	if rc != 0 {
+		t.Fatal("launch failed")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	baseD, err := sdutils.ReadBaseDeployment(&sdutils.TestContext{ConfigDir: confDir}, depName)
+	if err != nil || baseD.Expires == nil {
+		t.Fatalf("The expiry was not recorded %v %s", baseD, err)
+	}
+
+	rc = realMain([]string{"--config-dir", confDir, "leaks", "--type", "fake", "--deployment-name", depName})
+	if rc != 0 {
+		t.Fatal("leaks failed")
+	}
+	if res := fakeCloud.Get(depName); res.Stopped {
+		t.Fatal("leaks should only report the expired deployment")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "leaks", "--type", "fake", "--deployment-name", depName, "--stop-expired"})
+	if rc != 0 {
+		t.Fatal("leaks --stop-expired failed")
+	}
+	res := fakeCloud.Get(depName)
+	if !res.Stopped || res.Nodes != 0 || len(res.Volumes) != 3 {
+		t.Fatalf("The expired deployment was not stopped %v", res)
+	}
+	rc = realMain([]string{"--config-dir", confDir, "drift", depName})
+	if rc != 0 {
+		t.Fatal("A stopped deployment has not drifted")
+	}
+
+	rc = realMain([]string{"--config-dir", confDir, "instance", "start", "--wait-timeout", "10", depName})
+	if rc != 0 {
+		t.Fatal("instance start failed")
+	}
+	res = fakeCloud.Get(depName)
+	if res.Stopped || res.Nodes != 3 {
+		t.Fatalf("The instance was not started %v", res)
+	}
+	baseD, err = sdutils.ReadBaseDeployment(&sdutils.TestContext{ConfigDir: confDir}, depName)
+	if err != nil || baseD.Stopped != nil {
+		t.Fatalf("The start was not recorded %v %s", baseD, err)
+	}
+
+	rc = realMain([]string{"--config-dir", confDir, "instance", "stop", depName})
+	if rc != 0 {
+		t.Fatal("instance stop failed")
+	}
+	if res = fakeCloud.Get(depName); !res.Stopped {
+		t.Fatal("The instance was not stopped")
+	}
+}
+
+func TestApplyExport(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	consoleLog := path.Join(confDir, "output")
+
+	rc := realMain([]string{"--config-dir", confDir, "baseami", "--type", "fake", "/etc/group", "50.10"})
+	if rc != 0 {
+		t.Fatal("baseami failed")
+	}
+	specFile := path.Join(confDir, "cluster.yaml")
+	spec := fmt.Sprintf(`spec_version: 1
+name: %s
+type: fake
+stardog_version: "50.10"
+license: /etc/group
+cluster_size: 3
+zookeeper_size: 3
+http_mask: 0.0.0.0/0
+memory: 3g
+variables:
+  stardog_home_volume_type: gp2
+`, depName)
+	err := ioutil.WriteFile(specFile, []byte(spec), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write the spec %s", err)
+	}
+	rc = realMain([]string{"--config-dir", confDir, "apply", "-f", specFile, "--wait-timeout", "10"})
+	if rc != 0 {
+		t.Fatal("apply should launch the deployment")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	res := fakeCloud.Get(depName)
+	if res == nil || len(res.Volumes) != 3 || !res.Healthy {
+		t.Fatalf("The deployment was not launched %v", res)
+	}
+
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "apply", "-f", specFile})
+	result := readResult(t, consoleLog)
+	if rc != 0 {
+		t.Fatalf("applying the same spec again failed %v", result.Error)
+	}
+	if changes, ok := result.Result.([]interface{}); !ok || len(changes) != 0 {
+		t.Fatalf("Nothing should change %v", result.Result)
+	}
+
+	exported := path.Join(confDir, "exported.json")
+	rc = realMain([]string{"--config-dir", confDir, "export", "--format", "json", "-f", exported, depName})
+	if rc != 0 {
+		t.Fatal("export failed")
+	}
+	exportedSpec, err := sdutils.ReadSpec(exported)
+	if err != nil {
+		t.Fatalf("The exported spec should be valid %s", err)
+	}
+	if exportedSpec.ClusterSize != 3 || exportedSpec.License != "/etc/group" || exportedSpec.Variables["stardog_home_volume_type"] != "gp2" {
+		t.Fatalf("The exported spec is wrong %v", exportedSpec)
+	}
+	if !strings.Contains(strings.Join(exportedSpec.Environment, " "), "-Xmx3g") {
+		t.Fatalf("The memory should be part of the environment %v", exportedSpec.Environment)
+	}
+
+	exportedSpec.ClusterSize = 4
+	data, _ := json.Marshal(exportedSpec)
+	ioutil.WriteFile(exported, data, 0600)
+	rc = realMain([]string{"--config-dir", confDir, "apply", "-f", exported, "--dry-run"})
+	if rc != 0 || len(fakeCloud.Get(depName).Volumes) != 3 {
+		t.Fatal("A dry run should not scale the cluster")
+	}
+	rc = realMain([]string{"--config-dir", confDir, "apply", "-f", exported, "--wait-timeout", "10"})
+	if rc != 0 {
+		t.Fatal("apply should scale the cluster")
+	}
+	if res = fakeCloud.Get(depName); len(res.Volumes) != 4 || res.Nodes != 4 {
+		t.Fatalf("The cluster should have 4 nodes %v", res)
+	}
+
+	sockSave := os.Getenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", sockSave)
+	os.Setenv("SSH_AUTH_SOCK", path.Join(confDir, "agent"))
+	exportedSpec.Version = "50.11"
+	data, _ = json.Marshal(exportedSpec)
+	ioutil.WriteFile(exported, data, 0600)
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "apply", "-f", exported})
+	result = readResult(t, consoleLog)
+	if rc == 0 || !strings.Contains(result.Error.Message, "--release") {
+		t.Fatalf("A new version needs the release %v", result.Error)
+	}
+	rc = realMain([]string{"--config-dir", confDir, "apply", "-f", exported, "--release", "/etc/group", "--wait-timeout", "10"})
+	if rc != 0 {
+		t.Fatal("apply should update the version")
+	}
+	if !containsCommand(fakeCloud.SSHCommands(), fmt.Sprintf("bastion-%s.fake", depName), "/usr/local/bin/stardog-update-node 10.0.0.4 /tmp/group") {
+		t.Fatalf("The nodes were not updated one at a time %v", fakeCloud.SSHCommands())
+	}
+	rc = realMain([]string{"--config-dir", confDir, "export", "--format", "json", "-f", exported, depName})
+	if rc != 0 {
+		t.Fatal("export failed")
+	}
+	exportedSpec, err = sdutils.ReadSpec(exported)
+	if err != nil || exportedSpec.Version != "50.11" {
+		t.Fatalf("The new version was not recorded %v %s", exportedSpec, err)
+	}
+
+	exportedSpec.Environment = append(exportedSpec.Environment, "STARDOG_TEST=yes")
+	data, _ = json.Marshal(exportedSpec)
+	ioutil.WriteFile(exported, data, 0600)
+	rc = realMain([]string{"--config-dir", confDir, "apply", "-f", exported, "--wait-timeout", "10"})
+	if rc != 0 {
+		t.Fatal("apply should replace the nodes with the new environment")
+	}
+	if res = fakeCloud.Get(depName); len(res.SdReplaced) != 4 {
+		t.Fatalf("Every node should have been replaced %v", res.SdReplaced)
+	}
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "apply", "-f", exported})
+	result = readResult(t, consoleLog)
+	if rc != 0 {
+		t.Fatalf("applying the same spec again failed %v", result.Error)
+	}
+	if changes, ok := result.Result.([]interface{}); !ok || len(changes) != 0 {
+		t.Fatalf("The new environment was not recorded %v", result.Result)
+	}
+
+	exportedSpec.VolumeSize = 20
+	data, _ = json.Marshal(exportedSpec)
+	ioutil.WriteFile(exported, data, 0600)
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "apply", "-f", exported})
+	result = readResult(t, consoleLog)
+	if rc == 0 || !strings.Contains(result.Error.Message, "volume_size") {
+		t.Fatalf("The volume size cannot be changed in place %v", result.Error)
+	}
+}
+
+func TestConfigValidateAndShow(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	consoleLog := path.Join(confDir, "output")
+	defaultFile := path.Join(confDir, "default.json")
+
+	bad := `{"volum_size": 5, "cluster_size": "3", "log_format": "xml", "cloud_type": "aws",
+		"cloud_options": {"region": "us-west-2", "sd_instance": "m4.large"}}`
+	ioutil.WriteFile(defaultFile, []byte(bad), 0600)
+	rc := realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "config", "validate"})
+	if rc == 0 {
+		t.Fatal("The configuration should not be valid")
+	}
+	result := readResult(t, consoleLog)
+	problems := fmt.Sprint(result.Result)
+	for _, p := range []string{
+		"cloud_options.sd_instance is not a known option",
+		"cluster_size must be an integer not a string",
+		"log_format must be one of text, json",
+		"volum_size is not a known option",
+	} {
+		if !strings.Contains(problems, p) {
+			t.Fatalf("The problem %s was not reported %s", p, problems)
+		}
+	}
+
+	good := `{"volume_size": 5, "cloud_type": "aws", "cloud_options": {"region": "us-west-2"}}`
+	ioutil.WriteFile(defaultFile, []byte(good), 0600)
+	rc = realMain([]string{"--config-dir", confDir, "config", "validate"})
+	if rc != 0 {
+		t.Fatal("The configuration should be valid")
+	}
+
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "--log-level", "DEBUG", "config", "show", "--effective"})
+	result = readResult(t, consoleLog)
+	if rc != 0 {
+		t.Fatalf("config show failed %v", result.Error)
+	}
+	sources := make(map[string]string)
+	values := make(map[string]interface{})
+	for _, v := range result.Result.([]interface{}) {
+		m := v.(map[string]interface{})
+		sources[m["option"].(string)] = m["source"].(string)
+		values[m["option"].(string)] = m["value"]
+	}
+	expected := map[string]string{
+		"config_dir":           "flag",
+		"log_level":            "flag",
+		"volume_size":          "default.json",
+		"cluster_size":         "default",
+		"quiet":                "default",
+		"cloud_options.region": "default.json",
+		"cloud_options.ami_id": "default",
+	}
+	for option, source := range expected {
+		if sources[option] != source {
+			t.Fatalf("The source of %s should be %s %v", option, source, sources)
+		}
+	}
+	if values["volume_size"] != float64(5) || values["cloud_options.region"] != "us-west-2" || values["quiet"] != false {
+		t.Fatalf("The effective values are wrong %v", values)
+	}
+}
+
+func TestConfigSchemaFile(t *testing.T) {
+	var buf bytes.Buffer
+	err := sdutils.WriteOutput(&buf, "json", configSchema([]sdutils.Plugin{aws.GetPlugin(), docker.GetPlugin()}))
+	if err != nil {
+		t.Fatalf("Failed to write the schema %s", err)
+	}
+	published, err := ioutil.ReadFile(filepath.Join("..", "..", "default.schema.json"))
+	if err != nil {
+		t.Fatalf("Failed to read the published schema %s", err)
+	}
+	if buf.String() != string(published) {
+		t.Fatal("default.schema.json is out of date, regenerate it with the config schema command")
+	}
+}
+
+func TestPasswd(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+
+	rc := realMain([]string{"--config-dir", confDir, "baseami", "--type", "fake", "/etc/group", "50.10"})
+	if rc != 0 {
+		t.Fatal("baseami failed")
+	}
+	os.Setenv("STARDOG_ADMIN_PASSWORD", "launchpw")
+	defer os.Unsetenv("STARDOG_ADMIN_PASSWORD")
+	rc = realMain([]string{"--config-dir", confDir, "launch", "--type", "fake", "--cidr", "0.0.0.0/0",
+		"--wait-timeout", "10", "--sd-version", "50.10", "--license", "/etc/group", depName})
+	if rc != 0 {
+		t.Fatal("launch failed")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	if res := fakeCloud.Get(depName); res.Password != "launchpw" {
+		t.Fatalf("The launch should have set the admin password %s", res.Password)
+	}
+
+	stdinFile := path.Join(confDir, "stdin")
+	ioutil.WriteFile(stdinFile, []byte("secretpw\n"), 0600)
+	stdin, err := os.Open(stdinFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	rc = realMain([]string{"--config-dir", confDir, "passwd", depName})
+	os.Stdin = oldStdin
+	stdin.Close()
+	if rc != 0 {
+		t.Fatal("passwd failed")
+	}
+	if res := fakeCloud.Get(depName); res.Password != "secretpw" {
+		t.Fatalf("The admin password was not changed %s", res.Password)
+	}
+	for _, line := range fakeCloud.SSHCommands() {
+		if strings.Contains(line, "launchpw") || strings.Contains(line, "secretpw") {
+			t.Fatalf("A password was passed to ssh: %s", line)
+		}
+	}
+
+	os.Stdin, _ = os.Open(stdinFile)
+	rc = realMain([]string{"--config-dir", confDir, "passwd", "--user", "nobody", depName})
+	os.Stdin.Close()
+	os.Stdin = oldStdin
+	if rc == 0 {
+		t.Fatal("passwd should fail with the old admin password")
+	}
+	os.Setenv("STARDOG_ADMIN_PASSWORD", "secretpw")
+	rc = realMain([]string{"--config-dir", confDir, "status", depName})
+	if rc != 0 {
+		t.Fatal("status should work with the new admin password")
+	}
+}
+
+func TestCredentialProviderFile(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+
+	rc := realMain([]string{"--config-dir", confDir, "baseami", "--type", "fake", "/etc/group", "50.10"})
+	if rc != 0 {
+		t.Fatal("baseami failed")
+	}
+	os.Setenv("STARDOG_ADMIN_PASSWORD", "storedpw")
+	rc = realMain([]string{"--config-dir", confDir, "launch", "--type", "fake", "--cidr", "0.0.0.0/0",
+		"--credential-provider", "file", "--wait-timeout", "10", "--sd-version", "50.10", "--license", "/etc/group", depName})
+	os.Unsetenv("STARDOG_ADMIN_PASSWORD")
+	if rc != 0 {
+		t.Fatal("launch failed")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	if res := fakeCloud.Get(depName); res.Password != "storedpw" {
+		t.Fatalf("The launch should have set the admin password %s", res.Password)
+	}
+	baseD, err := sdutils.ReadBaseDeployment(&sdutils.TestContext{ConfigDir: confDir}, depName)
+	if err != nil || baseD.Credentials == nil || baseD.Credentials.Provider != "file" {
+		t.Fatalf("The credential provider was not recorded %v %s", baseD, err)
+	}
+
+	consoleLog := path.Join(confDir, "output")
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "status", depName})
+	if rc != 0 {
+		t.Fatal("status should authenticate with the stored password")
+	}
+	result := readResult(t, consoleLog)
+	nodes, ok := result.Result.(map[string]interface{})["stardog_nodes"].([]interface{})
+	if !ok || len(nodes) != 3 {
+		t.Fatalf("The cluster nodes should be listed %v", result)
+	}
+
+	rc = realMain([]string{"--config-dir", confDir, "launch", "--type", "fake", "--credential-provider", "vault", "other" + depName})
+	if rc == 0 {
+		t.Fatal("An unknown credential provider should fail")
+	}
+}
+
+func TestCredentialProviderNewPassword(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+
+	rc := realMain([]string{"--config-dir", confDir, "baseami", "--type", "fake", "/etc/group", "50.10"})
+	if rc != 0 {
+		t.Fatal("baseami failed")
+	}
+
+	// Without STARDOG_ADMIN_PASSWORD the user is asked for the password.
+	stdinPath := path.Join(confDir, "stdin")
+	ioutil.WriteFile(stdinPath, []byte("typedpw\n"), 0600)
+	stdin, err := os.Open(stdinPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedStdin := os.Stdin
+	os.Stdin = stdin
+	rc = realMain([]string{"--config-dir", confDir, "launch", "--type", "fake", "--cidr", "0.0.0.0/0",
+		"--credential-provider", "file", "--wait-timeout", "10", "--sd-version", "50.10", "--license", "/etc/group", depName})
+	os.Stdin = savedStdin
+	stdin.Close()
+	if rc != 0 {
+		t.Fatal("launch failed")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+	if res := fakeCloud.Get(depName); res.Password != "typedpw" {
+		t.Fatalf("The launch should have set the typed password %s", res.Password)
+	}
+
+	// Without a user to ask a random password is generated and stored.
+	otherName := "other" + depName
+	rc = realMain([]string{"--config-dir", confDir, "launch", "--type", "fake", "--cidr", "0.0.0.0/0", "--force",
+		"--credential-provider", "file", "--wait-timeout", "10", "--sd-version", "50.10", "--license", "/etc/group", otherName})
+	if rc != 0 {
+		t.Fatal("launch failed")
+	}
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, otherName, true, true)
+	res := fakeCloud.Get(otherName)
+	if res.Password == "" || res.Password == "admin" {
+		t.Fatalf("The launch should not keep the default password %s", res.Password)
+	}
+	context := &sdutils.TestContext{ConfigDir: confDir}
+	baseD, err := sdutils.ReadBaseDeployment(context, otherName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pw := sdutils.AdminPassword(context, baseD); pw != res.Password {
+		t.Fatalf("The generated password was not stored %s %s", pw, res.Password)
+	}
+}
+
+func TestTLSCABundle(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	caPath := path.Join(confDir, "ca.pem")
+	ioutil.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	rc := realMain([]string{"--quiet", "--config-dir", confDir, "deployment", "new", "--type", "fake", "--tls-ca-bundle", "/etc/group", "bad" + depName, "50.10"})
+	if rc == 0 {
+		t.Fatal("A CA bundle without certificates should fail")
+	}
+	rc = realMain([]string{"--quiet", "--config-dir", confDir, "deployment", "new", "--type", "fake", "--tls-ca-bundle", caPath, depName, "50.10"})
+	if rc != 0 {
+		t.Fatal("deployment new failed")
+	}
+	baseD, err := sdutils.ReadBaseDeployment(&sdutils.TestContext{ConfigDir: confDir}, depName)
+	if err != nil || baseD.TLSCABundle != caPath {
+		t.Fatalf("The CA bundle was not recorded %v %s", baseD, err)
+	}
+}
+
+func TestClientAndQuery(t *testing.T) {
+	confDir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(confDir)
+	depName := randDeployName()
+	launchFake(t, confDir, depName)
+	defer fakeCloud.NewPlugin().FindLeaks(&sdutils.TestContext{}, depName, true, true)
+
+	dataFile := path.Join(confDir, "data.ttl")
+	ioutil.WriteFile(dataFile, []byte("<a> <b> <c> ."), 0644)
+	rc := realMain([]string{"--config-dir", confDir, "client", depName, "--", "db", "create", "-n", "my db", "--options=it's", dataFile})
+	if rc != 0 {
+		t.Fatal("client failed")
+	}
+	var clientCmd string
+	for _, line := range fakeCloud.SSHCommands() {
+		if strings.Contains(line, "stardog-admin") && strings.Contains(line, depName) {
+			clientCmd = line
+		}
+	}
+	if !strings.Contains(clientCmd, "sudo /usr/local/stardog/bin/stardog-admin --server http://") ||
+		!strings.Contains(clientCmd, `db create -n 'my db' '--options=it'\''s' /tmp/graviton-client-`) ||
+		!strings.HasSuffix(clientCmd, "-data.ttl") {
+		t.Fatalf("The client arguments were not quoted or the file was not replaced: %s", clientCmd)
+	}
+	if strings.Contains(clientCmd, " -t ") {
+		t.Fatalf("The client should not get a terminal: %s", clientCmd)
+	}
+
+	logFile := path.Join(sdutils.DeploymentDir(confDir, depName), "logs", "graviton.log")
+	rc = realMain([]string{"--config-dir", confDir, "--log-level", "DEBUG", "client", depName, "--", "user", "passwd", "-N", "n3wsecret", "admin"})
+	if rc != 0 {
+		t.Fatal("client failed")
+	}
+	entries, err := sdutils.LoadAuditJournal(&sdutils.TestContext{ConfigDir: confDir}, depName)
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("The client should be audited %v %s", entries, err)
+	}
+	if args := strings.Join(entries[len(entries)-1].Args, " "); strings.Contains(args, "n3wsecret") {
+		t.Fatalf("The password was written to the audit journal %s", args)
+	}
+	logData, _ := ioutil.ReadFile(logFile)
+	if strings.Contains(string(logData), "n3wsecret") || !strings.Contains(string(logData), "Running stardog-admin on the bastion node") {
+		t.Fatalf("Only the name of the client should be logged %s", logData)
+	}
+	uploaded := false
+	for _, line := range fakeCloud.SCPCommands() {
+		if strings.Contains(line, dataFile) && strings.Contains(line, "/tmp/graviton-client-") {
+			uploaded = true
+		}
+	}
+	if !uploaded {
+		t.Fatalf("The data file was not copied to the bastion node %v", fakeCloud.SCPCommands())
+	}
+
+	fakeCloud.FailSSHWithCode("stardog-admin --server", 3)
+	defer fakeCloud.ClearSSHFailures()
+	rc = realMain([]string{"--config-dir", confDir, "client", depName, "--", "db", "list"})
+	if rc != 3 {
+		t.Fatalf("The exit code of the client should be passed on, not %d", rc)
+	}
+
+	consoleLog := path.Join(confDir, "client.json")
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "client", depName, "--", "db", "list"})
+	result := readResult(t, consoleLog)
+	if rc == 0 || !strings.Contains(result.Error.Message, "--output json") {
+		t.Fatalf("The client output cannot be structured %v", result.Error)
+	}
+
+	consoleLog = path.Join(confDir, "query")
+	rc = realMain([]string{"--console-file", consoleLog, "--config-dir", confDir, "query", depName, "mydb", "SELECT * { ?s ?p ?o }"})
+	if rc != 0 {
+		t.Fatal("query failed")
+	}
+	output := readConsole(t, consoleLog)
+	if !strings.Contains(output, "db\r\nmydb\r\n") {
+		t.Fatalf("The csv results were not written %s", output)
+	}
+	queryFile := path.Join(confDir, "q.rq")
+	ioutil.WriteFile(queryFile, []byte("SELECT * { ?s ?p ?o }"), 0644)
+	consoleLog = path.Join(confDir, "query.json")
+	rc = realMain([]string{"--output", "json", "--console-file", consoleLog, "--config-dir", confDir, "query", "--format", "json", depName, "other", queryFile})
+	if rc != 0 {
+		t.Fatal("query --format json failed")
+	}
+	result = readResult(t, consoleLog)
+	bindings := result.Result.(map[string]interface{})["results"].(map[string]interface{})["bindings"].([]interface{})
+	if len(bindings) != 1 {
+		t.Fatalf("The json results were not returned %v", result)
+	}
+	rc = realMain([]string{"--config-dir", confDir, "query", "--format", "turtle", depName, "mydb", "SELECT * { ?s ?p ?o }"})
+	if rc == 0 {
+		t.Fatal("An unsupported format should fail")
+	}
+}
@@ -0,0 +1,111 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+const (
+	// HoursPerMonth is the number of hours that cloud providers bill for a
+	// month.
+	HoursPerMonth = 730
+)
+
+// CostItem is the price of count resources of the same kind.  Detail
+// describes the size or type that the price depends on.
+type CostItem struct {
+	Resource string  `json:"resource"`
+	Detail   string  `json:"detail,omitempty"`
+	Count    int     `json:"count"`
+	Hourly   float64 `json:"hourly"`
+	Monthly  float64 `json:"monthly"`
+}
+
+// CostEstimate is what a deployment is expected to cost while it runs.  It
+// only covers the resources that graviton creates and leaves out data
+// transfer and the like.
+type CostEstimate struct {
+	Region   string     `json:"region,omitempty"`
+	Currency string     `json:"currency,omitempty"`
+	Items    []CostItem `json:"items"`
+	Hourly   float64    `json:"hourly"`
+	Monthly  float64    `json:"monthly"`
+}
+
+// NewCostEstimate returns a CostEstimate with nothing in it.
+func NewCostEstimate(region string, currency string) *CostEstimate {
+	return &CostEstimate{Region: region, Currency: currency, Items: []CostItem{}}
+}
+
+// AddHourly adds count resources that are billed by the hour.
+func (e *CostEstimate) AddHourly(resource string, detail string, count int, hourly float64) {
+	e.add(resource, detail, count, hourly*float64(count))
+}
+
+// AddMonthly adds count resources that are billed by the month, for example
+// storage.
+func (e *CostEstimate) AddMonthly(resource string, detail string, count int, monthly float64) {
+	e.add(resource, detail, count, monthly*float64(count)/HoursPerMonth)
+}
+
+func (e *CostEstimate) add(resource string, detail string, count int, hourly float64) {
+	if count < 1 {
+		return
+	}
+	e.Items = append(e.Items, CostItem{
+		Resource: resource,
+		Detail:   detail,
+		Count:    count,
+		Hourly:   hourly,
+		Monthly:  hourly * HoursPerMonth,
+	})
+	e.Hourly += hourly
+	e.Monthly += hourly * HoursPerMonth
+}
+
+// DeploymentCost estimates the cost of the deployment.  The volumes and
+// instance that exist are estimated as they are.  For the rest the
+// parameters recorded by an earlier launch are used and then the given
+// defaults.
+func DeploymentCost(baseD *BaseDeployment, dep Deployment, defaults LaunchParameters) (*CostEstimate, error) {
+	p := defaults
+	if lp := baseD.Launch; lp != nil {
+		if lp.VolumeSize > 0 {
+			p.VolumeSize = lp.VolumeSize
+		}
+		if lp.ClusterSize > 0 {
+			p.ClusterSize = lp.ClusterSize
+		}
+		if lp.RootVolumeSize > 0 {
+			p.RootVolumeSize = lp.RootVolumeSize
+		}
+		if lp.ZkSize > 0 {
+			p.ZkSize = lp.ZkSize
+		}
+	}
+	if dep.VolumeExists() {
+		size, err := dep.ClusterSize()
+		if err != nil {
+			return nil, err
+		}
+		p.ClusterSize = size
+	}
+	if dep.InstanceExists() {
+		size, err := dep.ZookeeperSize()
+		if err != nil {
+			return nil, err
+		}
+		p.ZkSize = size
+	}
+	return dep.EstimateCost(p.VolumeSize, p.ClusterSize, p.RootVolumeSize, p.ZkSize)
+}
@@ -0,0 +1,59 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"testing"
+)
+
+func TestCostEstimate(t *testing.T) {
+	e := NewCostEstimate("us-west-1", "USD")
+	e.AddHourly("stardog node", "m4.large", 3, 0.1)
+	e.AddMonthly("storage", "io1 100 GB", 3, 73)
+	e.AddHourly("nothing", "", 0, 10)
+	if len(e.Items) != 2 {
+		t.Fatalf("Empty items should be left out %v", e.Items)
+	}
+	if e.Items[1].Hourly < 0.2999 || e.Items[1].Hourly > 0.3001 {
+		t.Fatalf("The monthly price was not converted %v", e.Items[1])
+	}
+	if e.Hourly < 0.5999 || e.Hourly > 0.6001 || e.Monthly < 437.99 || e.Monthly > 438.01 {
+		t.Fatalf("The totals are wrong %f %f", e.Hourly, e.Monthly)
+	}
+}
+
+func TestDeploymentCost(t *testing.T) {
+	dep := tpDeployment{}
+	baseD := BaseDeployment{Name: "cost"}
+	defaults := LaunchParameters{VolumeSize: 10, ClusterSize: 3, ZkSize: 3}
+	e, err := DeploymentCost(&baseD, &dep, defaults)
+	if err != nil {
+		t.Fatalf("Failed to estimate %s", err)
+	}
+	if e.Items[0].Count != 3 || e.Items[1].Count != 3 || e.Items[2].Detail != "10 GB" {
+		t.Fatalf("The defaults were not used %v", e.Items)
+	}
+
+	baseD.Launch = &LaunchParameters{VolumeSize: 20, ClusterSize: 5}
+	dep.TstVolumeExists = true
+	e, err = DeploymentCost(&baseD, &dep, defaults)
+	if err != nil {
+		t.Fatalf("Failed to estimate %s", err)
+	}
+	if e.Items[0].Count != 1 || e.Items[1].Count != 3 || e.Items[2].Detail != "20 GB" {
+		t.Fatalf("The recorded sizes were not used %v", e.Items)
+	}
+}
@@ -0,0 +1,371 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// The credential providers that are always available.  Cloud plugins add
+// their own with AddCredentialProvider.
+const (
+	CredentialProviderEnv     = "env"
+	CredentialProviderFile    = "file"
+	CredentialProviderKeyring = "keyring"
+)
+
+const (
+	adminPasswordEnv     = "STARDOG_ADMIN_PASSWORD"
+	defaultAdminPassword = "admin"
+	credentialsKeyEnv    = "GRAVITON_CREDENTIALS_KEY"
+	keyringService       = "graviton"
+)
+
+var (
+	credentialProviderMap = make(map[string]CredentialProviderFactory)
+)
+
+// CredentialRef records where the admin password of a deployment is kept.
+// It is stored in config.json in place of the password.  Key names the
+// password within the provider and Options holds provider specific settings
+// such as the region of a cloud secret store.
+type CredentialRef struct {
+	Provider string            `json:"provider"`
+	Key      string            `json:"key,omitempty"`
+	Options  map[string]string `json:"options,omitempty"`
+}
+
+// CredentialProvider reads and stores the admin password of a deployment.
+type CredentialProvider interface {
+	// GetPassword returns the stored password or an empty string when
+	// nothing is stored.
+	GetPassword() (string, error)
+	// SetPassword stores a new password.
+	SetPassword(password string) error
+}
+
+// CredentialProviderFactory makes the provider for a deployment.
+type CredentialProviderFactory func(context AppContext, baseD *BaseDeployment, ref *CredentialRef) (CredentialProvider, error)
+
+// AddCredentialProvider associates a name with a credential provider.
+func AddCredentialProvider(name string, factory CredentialProviderFactory) {
+	credentialProviderMap[name] = factory
+}
+
+// CredentialProviders returns the names of every credential provider.
+func CredentialProviders() []string {
+	names := make([]string, 0, len(credentialProviderMap))
+	for name := range credentialProviderMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetCredentialProvider returns the provider selected by the deployment.
+// Deployments that do not select one use the environment.
+func GetCredentialProvider(context AppContext, baseD *BaseDeployment) (CredentialProvider, error) {
+	ref := baseD.Credentials
+	if ref == nil {
+		ref = &CredentialRef{Provider: CredentialProviderEnv}
+	}
+	factory, ok := credentialProviderMap[ref.Provider]
+	if !ok {
+		return nil, fmt.Errorf("The credential provider %s is not supported, use one of %s", ref.Provider, strings.Join(CredentialProviders(), ", "))
+	}
+	return factory(context, baseD, ref)
+}
+
+// AdminPassword returns the password graviton uses to talk to Stardog as
+// the admin user.  When the provider has nothing stored, or cannot be read,
+// the Stardog default is used.
+func AdminPassword(context AppContext, baseD *BaseDeployment) string {
+	provider, err := GetCredentialProvider(context, baseD)
+	if err == nil {
+		var pw string
+		pw, err = provider.GetPassword()
+		if err == nil && pw != "" {
+			return pw
+		}
+	}
+	if err != nil {
+		context.Logf(WARN, "Failed to read the admin password of %s, using the default: %s", baseD.Name, err)
+	}
+	return defaultAdminPassword
+}
+
+// RecordAdminPassword stores a new admin password with the provider of the
+// deployment and records the provider in its config.json.
+func RecordAdminPassword(context AppContext, baseD *BaseDeployment, password string) error {
+	provider, err := GetCredentialProvider(context, baseD)
+	if err != nil {
+		return err
+	}
+	err = provider.SetPassword(password)
+	if err != nil {
+		return fmt.Errorf("Failed to store the admin password of %s: %s", baseD.Name, err)
+	}
+	if baseD.Credentials == nil {
+		return nil
+	}
+	confPath := path.Join(baseD.Directory, "config.json")
+	data, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return err
+	}
+	conf := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return err
+	}
+	conf["credentials"], err = json.Marshal(baseD.Credentials)
+	if err != nil {
+		return err
+	}
+	return WriteJSON(conf, confPath)
+}
+
+// newAdminPassword picks the admin password of a new deployment whose
+// provider stores it.  The user is asked for one when graviton is
+// interactive, otherwise a random password is generated.
+func newAdminPassword(context AppContext, baseD *BaseDeployment) (string, error) {
+	if context.GetInteractive() {
+		return ReadNewPassword("Enter the new admin password for Stardog")
+	}
+	data := make([]byte, 18)
+	_, err := io.ReadFull(rand.Reader, data)
+	if err != nil {
+		return "", err
+	}
+	context.ConsoleLog(1, "A random admin password was generated and stored with the %s credential provider.\n", baseD.Credentials.Provider)
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// envCredentialProvider reads the password from an environment variable,
+// STARDOG_ADMIN_PASSWORD unless the key names another.  A new password can
+// only be set for the running process.
+type envCredentialProvider struct {
+	context AppContext
+	name    string
+}
+
+func newEnvCredentialProvider(context AppContext, baseD *BaseDeployment, ref *CredentialRef) (CredentialProvider, error) {
+	name := ref.Key
+	if name == "" {
+		name = adminPasswordEnv
+	}
+	return &envCredentialProvider{context: context, name: name}, nil
+}
+
+func (p *envCredentialProvider) GetPassword() (string, error) {
+	return os.Getenv(p.name), nil
+}
+
+func (p *envCredentialProvider) SetPassword(password string) error {
+	if os.Getenv(p.name) != password {
+		p.context.ConsoleLog(1, "Set %s to the new password so that graviton can keep managing the deployment.\n", p.name)
+	}
+	return os.Setenv(p.name, password)
+}
+
+// fileCredentialProvider keeps the password encrypted with AES-GCM in a file
+// in the deployment directory.  The encryption key is derived from
+// GRAVITON_CREDENTIALS_KEY when it is set, otherwise a random key is kept in
+// credentials.key in the configuration directory.
+type fileCredentialProvider struct {
+	filePath string
+	keyPath  string
+}
+
+func newFileCredentialProvider(context AppContext, baseD *BaseDeployment, ref *CredentialRef) (CredentialProvider, error) {
+	filePath := ref.Key
+	if filePath == "" {
+		filePath = "admin-password.enc"
+	}
+	if !filepath.IsAbs(filePath) {
+		filePath = path.Join(baseD.Directory, filePath)
+	}
+	return &fileCredentialProvider{
+		filePath: filePath,
+		keyPath:  path.Join(context.GetConfigDir(), "credentials.key"),
+	}, nil
+}
+
+func (p *fileCredentialProvider) cipher(create bool) (cipher.AEAD, error) {
+	var key []byte
+	if passphrase := os.Getenv(credentialsKeyEnv); passphrase != "" {
+		sum := sha256.Sum256([]byte(passphrase))
+		key = sum[:]
+	} else {
+		data, err := ioutil.ReadFile(p.keyPath)
+		if os.IsNotExist(err) && create {
+			data = make([]byte, 32)
+			_, err = io.ReadFull(rand.Reader, data)
+			if err == nil {
+				err = ioutil.WriteFile(p.keyPath, data, 0600)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(data) != 32 {
+			return nil, fmt.Errorf("The key in %s is not valid", p.keyPath)
+		}
+		key = data
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (p *fileCredentialProvider) GetPassword() (string, error) {
+	data, err := ioutil.ReadFile(p.filePath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := p.cipher(false)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("The credential file %s is not valid", p.filePath)
+	}
+	pw, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("The credential file %s could not be decrypted", p.filePath)
+	}
+	return string(pw), nil
+}
+
+func (p *fileCredentialProvider) SetPassword(password string) error {
+	gcm, err := p.cipher(true)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(password), nil)
+	return ioutil.WriteFile(p.filePath, []byte(base64.StdEncoding.EncodeToString(sealed)), 0600)
+}
+
+// keyringCredentialProvider keeps the password in the keyring of the OS
+// through a command helper.  A helper given in the options is called as
+// "helper get key", printing the password, and "helper store key", reading
+// it from stdin.  Otherwise secret-tool is used on Linux and security on
+// macOS.  The password is never passed as an argument.
+type keyringCredentialProvider struct {
+	key    string
+	helper string
+}
+
+func newKeyringCredentialProvider(context AppContext, baseD *BaseDeployment, ref *CredentialRef) (CredentialProvider, error) {
+	key := ref.Key
+	if key == "" {
+		key = baseD.Name
+	}
+	helper := ref.Options["helper"]
+	if helper == "" && runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return nil, fmt.Errorf("There is no keyring helper for %s, set the helper option", runtime.GOOS)
+	}
+	return &keyringCredentialProvider{key: key, helper: helper}, nil
+}
+
+func (p *keyringCredentialProvider) run(stdin string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("The keyring helper %s failed: %s %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+func (p *keyringCredentialProvider) GetPassword() (string, error) {
+	switch {
+	case p.helper != "":
+		return p.run("", p.helper, "get", p.key)
+	case runtime.GOOS == "darwin":
+		return p.run("", "security", "find-generic-password", "-s", keyringService, "-a", p.key, "-w")
+	}
+	return p.run("", "secret-tool", "lookup", "service", keyringService, "account", p.key)
+}
+
+func (p *keyringCredentialProvider) SetPassword(password string) error {
+	var err error
+	switch {
+	case p.helper != "":
+		_, err = p.run(password, p.helper, "store", p.key)
+	case runtime.GOOS == "darwin":
+		quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		line := fmt.Sprintf("add-generic-password -U -s %s -a \"%s\" -w \"%s\"\n", keyringService, quote.Replace(p.key), quote.Replace(password))
+		_, err = p.run(line, "security", "-i")
+	default:
+		_, err = p.run(password, "secret-tool", "store", "--label", fmt.Sprintf("%s %s", keyringService, p.key), "service", keyringService, "account", p.key)
+	}
+	return err
+}
+
+// ParseCredentialRef makes a reference from the command line options.  An
+// empty provider selects none.
+func ParseCredentialRef(provider string, key string, options map[string]string) (*CredentialRef, error) {
+	if provider == "" {
+		if key != "" || len(options) > 0 {
+			return nil, errors.New("A credential key or option needs a credential provider")
+		}
+		return nil, nil
+	}
+	if _, ok := credentialProviderMap[provider]; !ok {
+		return nil, fmt.Errorf("The credential provider %s is not supported, use one of %s", provider, strings.Join(CredentialProviders(), ", "))
+	}
+	return &CredentialRef{Provider: provider, Key: key, Options: options}, nil
+}
+
+func init() {
+	AddCredentialProvider(CredentialProviderEnv, newEnvCredentialProvider)
+	AddCredentialProvider(CredentialProviderFile, newFileCredentialProvider)
+	AddCredentialProvider(CredentialProviderKeyring, newKeyringCredentialProvider)
+}
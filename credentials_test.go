@@ -0,0 +1,152 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func newCredentialsDeployment(t *testing.T, ref *CredentialRef) (*TestContext, *BaseDeployment) {
+	dir, err := ioutil.TempDir("", "stardogtests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseD := &BaseDeployment{Name: "credtest", Directory: DeploymentDir(dir, "credtest"), Credentials: ref}
+	os.MkdirAll(baseD.Directory, 0755)
+	err = WriteJSON(baseD, path.Join(baseD.Directory, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &TestContext{ConfigDir: dir}, baseD
+}
+
+func TestEnvCredentialProvider(t *testing.T) {
+	context, baseD := newCredentialsDeployment(t, nil)
+	defer os.RemoveAll(context.ConfigDir)
+	os.Unsetenv("STARDOG_ADMIN_PASSWORD")
+	defer os.Unsetenv("STARDOG_ADMIN_PASSWORD")
+
+	if pw := AdminPassword(context, baseD); pw != "admin" {
+		t.Fatalf("The default password should be used %s", pw)
+	}
+	os.Setenv("STARDOG_ADMIN_PASSWORD", "envpw")
+	if pw := AdminPassword(context, baseD); pw != "envpw" {
+		t.Fatalf("The password should come from the environment %s", pw)
+	}
+
+	baseD.Credentials = &CredentialRef{Provider: CredentialProviderEnv, Key: "GRAVITON_TEST_PW"}
+	defer os.Unsetenv("GRAVITON_TEST_PW")
+	err := RecordAdminPassword(context, baseD, "otherpw")
+	if err != nil || os.Getenv("GRAVITON_TEST_PW") != "otherpw" || AdminPassword(context, baseD) != "otherpw" {
+		t.Fatalf("The password should be set in the named variable %s", err)
+	}
+}
+
+func TestFileCredentialProvider(t *testing.T) {
+	context, baseD := newCredentialsDeployment(t, &CredentialRef{Provider: CredentialProviderFile})
+	defer os.RemoveAll(context.ConfigDir)
+	os.Unsetenv("GRAVITON_CREDENTIALS_KEY")
+
+	if pw := AdminPassword(context, baseD); pw != "admin" {
+		t.Fatalf("Nothing is stored yet %s", pw)
+	}
+	err := RecordAdminPassword(context, baseD, "filepw")
+	if err != nil {
+		t.Fatalf("Failed to store the password %s", err)
+	}
+	data, err := ioutil.ReadFile(path.Join(baseD.Directory, "admin-password.enc"))
+	if err != nil || strings.Contains(string(data), "filepw") {
+		t.Fatalf("The password should be stored encrypted %s %s", string(data), err)
+	}
+	if pw := AdminPassword(context, baseD); pw != "filepw" {
+		t.Fatalf("The stored password was not read %s", pw)
+	}
+
+	stored, err := ReadBaseDeployment(context, baseD.Name)
+	if err != nil || stored.Credentials == nil || stored.Credentials.Provider != CredentialProviderFile {
+		t.Fatalf("The provider should be recorded in config.json %v %s", stored, err)
+	}
+
+	os.Setenv("GRAVITON_CREDENTIALS_KEY", "a passphrase")
+	defer os.Unsetenv("GRAVITON_CREDENTIALS_KEY")
+	provider, _ := GetCredentialProvider(context, baseD)
+	_, err = provider.GetPassword()
+	if err == nil {
+		t.Fatal("A different key should not decrypt the password")
+	}
+	err = provider.SetPassword("passphrasepw")
+	if err != nil {
+		t.Fatalf("Failed to store the password %s", err)
+	}
+	pw, err := provider.GetPassword()
+	if err != nil || pw != "passphrasepw" {
+		t.Fatalf("The password should be read with the passphrase %s %s", pw, err)
+	}
+}
+
+func TestKeyringCredentialProvider(t *testing.T) {
+	context, baseD := newCredentialsDeployment(t, nil)
+	defer os.RemoveAll(context.ConfigDir)
+
+	store := path.Join(context.ConfigDir, "keyring")
+	helper := path.Join(context.ConfigDir, "helper")
+	script := `#!/usr/bin/env bash
+case "$1" in
+	get) cat "` + store + `.$2" 2>/dev/null ;;
+	store) cat > "` + store + `.$2" ;;
+	*) exit 1 ;;
+esac
+`
+	err := ioutil.WriteFile(helper, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseD.Credentials = &CredentialRef{Provider: CredentialProviderKeyring, Options: map[string]string{"helper": helper}}
+	err = RecordAdminPassword(context, baseD, "keyringpw")
+	if err != nil {
+		t.Fatalf("Failed to store the password %s", err)
+	}
+	data, err := ioutil.ReadFile(store + ".credtest")
+	if err != nil || string(data) != "keyringpw" {
+		t.Fatalf("The helper should have been given the password on stdin %s %s", string(data), err)
+	}
+	if pw := AdminPassword(context, baseD); pw != "keyringpw" {
+		t.Fatalf("The helper should have returned the password %s", pw)
+	}
+}
+
+func TestParseCredentialRef(t *testing.T) {
+	ref, err := ParseCredentialRef("", "", nil)
+	if err != nil || ref != nil {
+		t.Fatalf("No provider should select none %v %s", ref, err)
+	}
+	_, err = ParseCredentialRef("", "key", nil)
+	if err == nil {
+		t.Fatal("A key without a provider should fail")
+	}
+	_, err = ParseCredentialRef("vault", "", nil)
+	if err == nil || !strings.Contains(err.Error(), "keyring") {
+		t.Fatalf("An unknown provider should list the known ones %s", err)
+	}
+	ref, err = ParseCredentialRef("file", "pw.enc", nil)
+	if err != nil || ref.Provider != "file" || ref.Key != "pw.enc" {
+		t.Fatalf("The reference was not made %v %s", ref, err)
+	}
+}
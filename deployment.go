@@ -20,12 +20,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
-	"net/http"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"errors"
 )
@@ -58,9 +59,137 @@ func DeploymentDir(confDir string, deploymentName string) string {
 // is associated with a deployment.
 func DeleteDeployment(context AppContext, name string) {
 	deploymentDir := DeploymentDir(context.GetConfigDir(), name)
+	err := archiveAuditJournal(context, name)
+	if err != nil {
+		context.Logf(WARN, "Failed to archive the audit journal of %s: %s", name, err)
+	}
 	os.RemoveAll(deploymentDir)
 }
 
+// ListDeployments reads the config.json file of every deployment in the
+// configuration directory.  Directories without a readable config.json are
+// skipped.
+func ListDeployments(context AppContext) ([]*BaseDeployment, error) {
+	files, err := ioutil.ReadDir(DeploymentDir(context.GetConfigDir(), ""))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*BaseDeployment{}, nil
+		}
+		return nil, err
+	}
+	deployments := []*BaseDeployment{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		baseD, err := ReadBaseDeployment(context, f.Name())
+		if err != nil {
+			context.Logf(WARN, "Skipping the deployment %s: %s", f.Name(), err)
+			continue
+		}
+		deployments = append(deployments, baseD)
+	}
+	return deployments, nil
+}
+
+// ReadBaseDeployment reads the config.json file of the named deployment
+// without loading its plugin.
+func ReadBaseDeployment(context AppContext, name string) (*BaseDeployment, error) {
+	var baseD BaseDeployment
+	err := LoadJSON(&baseD, path.Join(DeploymentDir(context.GetConfigDir(), name), "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	baseD.Name = name
+	baseD.Directory = DeploymentDir(context.GetConfigDir(), name)
+	return &baseD, nil
+}
+
+// DeploymentSummary is the description of a single deployment shown by the
+// deployment list command.  Healthy is only set when the health was checked.
+type DeploymentSummary struct {
+	Name           string     `json:"name"`
+	Type           string     `json:"type,omitempty"`
+	Region         string     `json:"region,omitempty"`
+	Version        string     `json:"version,omitempty"`
+	Image          string     `json:"image,omitempty"`
+	State          string     `json:"state,omitempty"`
+	VolumesExist   bool       `json:"volumes"`
+	InstanceExists bool       `json:"instance"`
+	ClusterSize    int        `json:"cluster_size,omitempty"`
+	ZkSize         int        `json:"zookeeper_size,omitempty"`
+	Created        *time.Time `json:"created,omitempty"`
+	Expires        *time.Time `json:"expires,omitempty"`
+	Stopped        *time.Time `json:"stopped,omitempty"`
+	Healthy        *bool      `json:"healthy,omitempty"`
+	dep            Deployment
+	baseD          *BaseDeployment
+}
+
+// SummarizeDeployment loads the deployment and inspects which of its
+// resources exist.  A deployment that cannot be loaded is still summarized
+// from its config.json.
+func SummarizeDeployment(context AppContext, baseD *BaseDeployment) *DeploymentSummary {
+	summary := DeploymentSummary{
+		Name:    baseD.Name,
+		Type:    baseD.Type,
+		Version: baseD.Version,
+		State:   CurrentState(baseD),
+		Created: baseD.Created,
+		Expires: baseD.Expires,
+		Stopped: baseD.Stopped,
+		baseD:   baseD,
+	}
+	p, err := GetPlugin(baseD.Type)
+	if err != nil {
+		context.Logf(WARN, "Cannot inspect the deployment %s: %s", baseD.Name, err)
+		return &summary
+	}
+	summary.Region = p.DeploymentRegion(baseD)
+	summary.Image = p.DeploymentImage(baseD)
+
+	dep, err := LoadDeployment(context, baseD, false)
+	if err != nil {
+		context.Logf(WARN, "Failed to load the deployment %s: %s", baseD.Name, err)
+		return &summary
+	}
+	summary.dep = dep
+	summary.VolumesExist = dep.VolumeExists()
+	if summary.VolumesExist {
+		size, err := dep.ClusterSize()
+		if err == nil {
+			summary.ClusterSize = size
+		}
+	}
+	summary.InstanceExists = dep.InstanceExists()
+	if summary.InstanceExists {
+		size, err := dep.ZookeeperSize()
+		if err == nil {
+			summary.ZkSize = size
+		}
+	}
+	return &summary
+}
+
+// CheckDeploymentsHealth fetches the health of all of the summarized
+// deployments concurrently.  Deployments without an instance are unhealthy.
+func CheckDeploymentsHealth(context AppContext, summaries []*DeploymentSummary) {
+	var wg sync.WaitGroup
+	for _, summary := range summaries {
+		healthy := false
+		summary.Healthy = &healthy
+		if summary.dep == nil || !summary.InstanceExists {
+			continue
+		}
+		wg.Add(1)
+		go func(s *DeploymentSummary) {
+			defer wg.Done()
+			*s.Healthy = IsHealthy(context, s.baseD, s.dep, false)
+		}(summary)
+	}
+	wg.Wait()
+}
+
 // LoadDeployment inflates a Deployment object from the information stored in the
 // configuration directory.
 func LoadDeployment(context AppContext, baseD *BaseDeployment, new bool) (Deployment, error) {
@@ -84,6 +213,12 @@ func LoadDeployment(context AppContext, baseD *BaseDeployment, new bool) (Deploy
 			return nil, err
 		}
 		context.Logf(DEBUG, "Loading the default %s from %s", baseD, confPath)
+		SetVariables(baseD.Variables)
+		// The stored type wins over the command line default
+		plugin, err = GetPlugin(baseD.Type)
+		if err != nil {
+			return nil, err
+		}
 		return plugin.DeploymentLoader(context, baseD, new)
 	}
 	os.MkdirAll(baseD.Directory, 0755)
@@ -95,14 +230,43 @@ func LoadDeployment(context AppContext, baseD *BaseDeployment, new bool) (Deploy
 		return nil, fmt.Errorf("The path to the custom zk script %s does not exist", baseD.CustomZkScript)
 	}
 
+	SetVariables(baseD.Variables)
+	baseD.State = StateDefined
+	now := time.Now()
+	baseD.Created = &now
 	d, err := plugin.DeploymentLoader(context, baseD, new)
 	return d, err
 }
 
+// PlanNewDeployment plans the definition of a deployment that does not exist
+// yet without recording it or creating anything in the cloud.  The plugin
+// works in a scratch directory that replaces baseD.Directory and that the
+// caller removes once it is done with the deployment.
+func PlanNewDeployment(context AppContext, baseD *BaseDeployment) (Deployment, *PlanSummary, error) {
+	plugin, err := GetPlugin(baseD.Type)
+	if err != nil {
+		return nil, nil, err
+	}
+	if baseD.CustomScript != "" && !PathExists(baseD.CustomScript) {
+		return nil, nil, fmt.Errorf("The path to the custom script %s does not exist", baseD.CustomScript)
+	}
+	if baseD.CustomZkScript != "" && !PathExists(baseD.CustomZkScript) {
+		return nil, nil, fmt.Errorf("The path to the custom zk script %s does not exist", baseD.CustomZkScript)
+	}
+	baseD.Directory, err = ioutil.TempDir("", "graviton-plan")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	SetVariables(baseD.Variables)
+	baseD.State = StateDefined
+	return plugin.PlanDeployment(context, baseD)
+}
+
 func runClient(context AppContext, sd *StardogDescription, baseD *BaseDeployment, d Deployment, cmdArray []string) error {
 	baseSSH, err := getSSHCommand(context, baseD, sd)
 	if err != nil {
-		return nil
+		return err
 	}
 	chpwCmd := append(baseSSH,
 		"sudo",
@@ -120,7 +284,256 @@ func runClient(context AppContext, sd *StardogDescription, baseD *BaseDeployment
 	return err
 }
 
+// internalStardogClient returns a client for the internal URL of the
+// deployment and a function that must be called when it is no longer used.
+// The internal load balancer is used directly when it can be reached,
+// otherwise the requests go through an ssh tunnel to the bastion node.
+func internalStardogClient(context AppContext, baseD *BaseDeployment, sd *StardogDescription, adminPw string) (StardogClient, func(), error) {
+	if sd.StardogInternalURL == "" {
+		return nil, nil, fmt.Errorf("The deployment %s does not have an internal Stardog URL", baseD.Name)
+	}
+	client := NewStardogClient(sd.StardogInternalURL, "admin", adminPw, context, stardogClientOptions(baseD))
+	if sd.SSHHost == "" {
+		return client, func() {}, nil
+	}
+	probe := NewStardogClient(sd.StardogInternalURL, "admin", adminPw, context, &StardogClientOptions{Timeout: 5 * time.Second, CABundle: baseD.TLSCABundle})
+	if _, err := probe.Healthy(); err == nil {
+		return client, func() {}, nil
+	}
+	context.Logf(DEBUG, "The internal URL %s cannot be reached, using an ssh tunnel", sd.StardogInternalURL)
+	tunnelURL, closeTunnel, err := openSSHTunnel(context, baseD, sd, sd.StardogInternalURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewStardogClient(tunnelURL, "admin", adminPw, context, stardogClientOptions(baseD)), closeTunnel, nil
+}
+
+// openSSHTunnel forwards a free local port through the bastion node to the
+// host of remoteURL.  It returns the local URL and a function that closes
+// the tunnel.
+func openSSHTunnel(context AppContext, baseD *BaseDeployment, sd *StardogDescription, remoteURL string) (string, func(), error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return "", nil, err
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	localAddr := l.Addr().String()
+	l.Close()
+	sshBase, err := getSSHCommand(context, baseD, sd)
+	if err != nil {
+		return "", nil, err
+	}
+	_, localPort, _ := net.SplitHostPort(localAddr)
+	target := sshBase[len(sshBase)-1]
+	sshCmd := append([]string{}, sshBase[:len(sshBase)-1]...)
+	sshCmd = append(sshCmd, "-N", "-o", "ExitOnForwardFailure=yes", "-L", fmt.Sprintf("%s:%s", localPort, u.Host), target)
+	cmd := exec.Cmd{
+		Path: sshCmd[0],
+		Args: sshCmd,
+	}
+	context.Logf(DEBUG, "Opening an ssh tunnel: %s", strings.Join(sshCmd, " "))
+	err = cmd.Start()
+	if err != nil {
+		return "", nil, err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	closeTunnel := func() {
+		cmd.Process.Kill()
+		<-exited
+	}
+	for i := 0; i < 60; i++ {
+		select {
+		case err = <-exited:
+			return "", nil, fmt.Errorf("The ssh tunnel to %s closed: %v", sd.SSHHost, err)
+		default:
+		}
+		conn, err := net.DialTimeout("tcp", localAddr, time.Second)
+		if err == nil {
+			conn.Close()
+			return fmt.Sprintf("%s://%s", u.Scheme, localAddr), closeTunnel, nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	closeTunnel()
+	return "", nil, fmt.Errorf("Timed out opening an ssh tunnel to %s", sd.SSHHost)
+}
+
+// changePassword sets the password of a Stardog user with the HTTP user API.
+func changePassword(context AppContext, baseD *BaseDeployment, sd *StardogDescription, adminPw string, user string, newPw string) error {
+	client, release, err := internalStardogClient(context, baseD, sd, adminPw)
+	if err != nil {
+		return err
+	}
+	defer release()
+	err = client.ChangePassword(user, newPw)
+	if err != nil {
+		return fmt.Errorf("Failed to change the password of %s: %s", user, err)
+	}
+	return nil
+}
+
+// ChangeUserPassword sets the password of a Stardog user through the internal
+// load balancer of the deployment.  The password is sent in the body of the
+// request so it never appears on a command line or in the logs.  A new admin
+// password is recorded with the credential provider of the deployment.
+func ChangeUserPassword(context AppContext, baseD *BaseDeployment, dep Deployment, user string, newPw string) error {
+	sd, err := dep.FullStatus()
+	if err != nil {
+		return err
+	}
+	err = changePassword(context, baseD, sd, AdminPassword(context, baseD), user, newPw)
+	if err != nil || user != "admin" {
+		return err
+	}
+	return RecordAdminPassword(context, baseD, newPw)
+}
+
+// QueryDeployment runs a SPARQL query against a database of the deployment
+// through its internal load balancer and returns the results in the accept
+// format.
+func QueryDeployment(context AppContext, baseD *BaseDeployment, dep Deployment, db string, query string, accept string) ([]byte, error) {
+	sd, err := dep.FullStatus()
+	if err != nil {
+		return nil, err
+	}
+	client, release, err := internalStardogClient(context, baseD, sd, AdminPassword(context, baseD))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return client.Query(db, "", query, accept)
+}
+
+// RemoteExitError is returned when a command run on the bastion node exits
+// with a non zero code.
+type RemoteExitError struct {
+	Command string
+	Code    int
+}
+
+func (e *RemoteExitError) Error() string {
+	return fmt.Sprintf("%s exited with %d", e.Command, e.Code)
+}
+
+// shellQuote quotes s for the shell on the bastion node.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,+%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// localFileArg returns the local file named by a client argument, either
+// the whole argument or the value of an --option=value, and the part of the
+// argument that comes before it.
+func localFileArg(arg string) (string, string, bool) {
+	prefix, value := "", arg
+	if strings.HasPrefix(arg, "-") {
+		ndx := strings.Index(arg, "=")
+		if ndx < 0 {
+			return "", "", false
+		}
+		prefix, value = arg[:ndx+1], arg[ndx+1:]
+	}
+	info, err := os.Stat(value)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", "", false
+	}
+	return prefix, value, true
+}
+
+// RunStardogClient runs a Stardog command line client, stardog-admin or
+// stardog, on the bastion node.  stardog-admin is pointed at the internal URL
+// of the deployment.  Arguments that name local files, for example data to
+// load, are copied to the bastion node first.  The output of the client is
+// streamed and when it fails a *RemoteExitError holds its exit code.
+func RunStardogClient(context AppContext, baseD *BaseDeployment, d Deployment, cli string, args []string) error {
+	sd, err := d.FullStatus()
+	if err != nil {
+		return err
+	}
+	sshBase, err := getSSHCommand(context, baseD, sd)
+	if err != nil {
+		return err
+	}
+	// The client is not given a terminal so that stdout and stderr stay apart.
+	sshNoTTY := []string{}
+	for _, a := range sshBase {
+		if a != "-t" {
+			sshNoTTY = append(sshNoTTY, a)
+		}
+	}
+	// The arguments of the client may hold passwords so only the name of
+	// the program is logged.
+	runRemote := func(name string, remote []string, stream bool) error {
+		quoted := make([]string, len(remote))
+		for i, r := range remote {
+			quoted[i] = shellQuote(r)
+		}
+		sshCmd := append(append([]string{}, sshNoTTY...), strings.Join(quoted, " "))
+		cmd := exec.Cmd{
+			Path: sshCmd[0],
+			Args: sshCmd,
+		}
+		if stream {
+			cmd.Stdin = os.Stdin
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+		}
+		context.Logf(DEBUG, "Running %s on the bastion node", name)
+		return cmd.Run()
+	}
+
+	remoteDir := fmt.Sprintf("/tmp/graviton-client-%d", rand.Int())
+	remoteArgs := make([]string, len(args))
+	uploaded := false
+	for i, arg := range args {
+		remoteArgs[i] = arg
+		prefix, localPath, ok := localFileArg(arg)
+		if !ok {
+			continue
+		}
+		if !uploaded {
+			err = runRemote("mkdir", []string{"mkdir", "-p", remoteDir}, false)
+			if err != nil {
+				return fmt.Errorf("Failed to make %s on the bastion node: %s", remoteDir, err)
+			}
+			defer runRemote("rm", []string{"rm", "-rf", remoteDir}, false)
+			uploaded = true
+		}
+		remotePath := path.Join(remoteDir, fmt.Sprintf("%d-%s", i, path.Base(localPath)))
+		context.ConsoleLog(2, "Copying %s to the bastion node\n", localPath)
+		err = runSCPCommand(context, baseD, sd, localPath, remotePath, true)
+		if err != nil {
+			return fmt.Errorf("Failed to copy %s to the bastion node: %s", localPath, err)
+		}
+		remoteArgs[i] = prefix + remotePath
+	}
+
+	remote := []string{"sudo", path.Join("/usr/local/stardog/bin", cli)}
+	if cli == "stardog-admin" {
+		remote = append(remote, "--server", sd.StardogInternalURL)
+	}
+	remote = append(remote, remoteArgs...)
+	err = runRemote(cli, remote, true)
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return &RemoteExitError{Command: cli, Code: exitErr.ExitCode()}
+	}
+	return err
+}
+
 func getSSHCommand(context AppContext, baseD *BaseDeployment, sd *StardogDescription) ([]string, error) {
+	if sd.SSHHost == "" {
+		return nil, fmt.Errorf("The deployment %s does not have an ssh host", baseD.Name)
+	}
 	context.Logf(DEBUG, "sshing to %s to run the stardog client\n", sd.SSHHost)
 
 	sshPath, err := exec.LookPath("ssh")
@@ -190,7 +603,7 @@ func RunSSH(context AppContext, baseD *BaseDeployment, d Deployment) error {
 
 	baseSSH, err := getSSHCommand(context, baseD, sd)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	cmd := exec.Cmd{
@@ -212,25 +625,24 @@ func RunSSH(context AppContext, baseD *BaseDeployment, d Deployment) error {
 
 // IsHealthy checks the deployment to see if the Stardog service is healthy.  if
 // internal is set to true it will test by sshing into the bastion node first.
+// Deployments without a bastion node check the internal URL directly.
 func IsHealthy(context AppContext, baseD *BaseDeployment, d Deployment, internal bool) bool {
 	sd, err := d.FullStatus()
 	if err != nil {
 		context.Logf(WARN, "Status failure %s", err)
 		return false
 	}
-	if os.Getenv("STARDOG_GRAVITON_UNIT_TEST") != "" {
-		h := os.Getenv("STARDOG_GRAVITON_HEALTHY")
-		if h != "" {
-			b, err := strconv.ParseBool(h)
-			if err != nil {
-				return false
-			}
-			return b
-		}
-		return true
+	baseURL := sd.StardogURL
+	if internal {
+		baseURL = sd.StardogInternalURL
 	}
+	return checkURL(context, baseD, sd, fmt.Sprintf("%s/admin/healthcheck", baseURL), internal)
+}
 
-	if internal {
+// checkURL returns true if a GET on the url answers 200.  If internal is true
+// and the deployment has a bastion node the request is made from there.
+func checkURL(context AppContext, baseD *BaseDeployment, sd *StardogDescription, url string, internal bool) bool {
+	if internal && sd.SSHHost != "" {
 		context.Logf(DEBUG, "Checking health via ssh.")
 		sshBase, err := getSSHCommand(context, baseD, sd)
 		if err != nil {
@@ -242,7 +654,7 @@ func IsHealthy(context AppContext, baseD *BaseDeployment, d Deployment, internal
 			"/usr/bin/curl",
 			"-s", "-o", "/dev/null",
 			"-w", "%{http_code}",
-			fmt.Sprintf("%s/admin/healthcheck", sd.StardogInternalURL),
+			url,
 		}...)
 
 		cmd := exec.Cmd{
@@ -258,14 +670,19 @@ func IsHealthy(context AppContext, baseD *BaseDeployment, d Deployment, internal
 		}
 		return string(b) == "200"
 	}
-	url := fmt.Sprintf("%s/admin/healthcheck", sd.StardogURL)
 	context.Logf(DEBUG, "Checking health at %s.", url)
 
-	response, err := http.Get(url)
+	client, err := NewHTTPClient(baseD.TLSCABundle, 30*time.Second)
+	if err != nil {
+		context.Logf(WARN, "Cannot check the health of %s: %s", url, err)
+		return false
+	}
+	response, err := client.Get(url)
 	if err != nil {
 		context.Logf(DEBUG, "Error getting the health check %s", err)
 		return false
 	}
+	response.Body.Close()
 	return response.StatusCode == 200
 }
 
@@ -296,22 +713,19 @@ func WaitForHealth(context AppContext, baseD *BaseDeployment, d Deployment, wait
 	return nil
 }
 
-func WaitForNClusterNodes(context AppContext, size int, sdURL string, pw string, waitTimeout int) error {
+// WaitForNClusterNodes blocks until /admin/cluster reports exactly size nodes.
+// When opts is nil DefaultStardogClientOptions are used.
+func WaitForNClusterNodes(context AppContext, size int, sdURL string, pw string, waitTimeout int, opts *StardogClientOptions) error {
 	var err error
 	pollInterval := 2
-	itCnt := waitTimeout / pollInterval
+	deadline := time.Now().Add(time.Duration(waitTimeout) * time.Second)
 
-	client := stardogClientImpl{
-		sdURL:    sdURL,
-		logger:   context,
-		username: "admin",
-		password: pw,
-	}
+	client := NewStardogClient(sdURL, "admin", pw, context, pollingOptions(opts))
 	spinner := NewSpinner(context, 2, "Waiting for the node to be healthy internally")
 	nodes := &[]string{}
-	for i := 0; len(*nodes) < size; i++ {
+	for len(*nodes) != size {
 		context.ConsoleLog(2, "%d nodes waiting for %d\n", len(*nodes), size)
-		if i >= itCnt {
+		if time.Now().After(deadline) {
 			return errors.New("Timed out waiting for all the cluster nodes")
 		}
 		spinner.EchoNext()
@@ -336,19 +750,35 @@ func linePrinter(cliContext AppContext, line string) *ScanResult {
 // CreateInstance wraps up the deployment.CreateInstance method and blocks until
 // the deployment is considered healthy.  It will then change the password by
 // SSHing into the bastion node.  Once that is complete it will open up the
-// the firewall.
+// the firewall.  Each completed step is recorded in the deployment lifecycle.
 func CreateInstance(context AppContext, baseD *BaseDeployment, dep Deployment, volumeSize int, zkSize int, waitMaxTimeSec int, timeoutSec int, mask string, bastionVolSnapshotId string, noWait bool) error {
+	lp := launchParameters(baseD)
+	lp.RootVolumeSize = volumeSize
+	lp.ZkSize = zkSize
+	lp.IdleTimeout = timeoutSec
+	lp.HTTPMask = mask
+	lp.BastionVolSnapshotID = bastionVolSnapshotId
 	err := dep.CreateInstance(volumeSize, zkSize, timeoutSec, bastionVolSnapshotId)
 	if err != nil {
 		return err
 	}
+	err = SetDeploymentState(context, baseD, StateInstanceCreated)
+	if err != nil {
+		return err
+	}
 	if noWait {
 		context.ConsoleLog(1, "Not waiting...\n")
 		return nil
 	}
+	return finishInstance(context, baseD, dep, waitMaxTimeSec)
+}
 
+// finishInstance takes a created instance through the remaining lifecycle
+// steps, skipping the ones that were already recorded as complete.
+func finishInstance(context AppContext, baseD *BaseDeployment, dep Deployment, waitMaxTimeSec int) error {
+	lp := launchParameters(baseD)
 	context.ConsoleLog(1, "Waiting for stardog to come up...\n")
-	err = WaitForHealth(context, baseD, dep, waitMaxTimeSec, true)
+	err := WaitForHealth(context, baseD, dep, waitMaxTimeSec, true)
 	if err != nil {
 		return err
 	}
@@ -356,26 +786,246 @@ func CreateInstance(context AppContext, baseD *BaseDeployment, dep Deployment, v
 	if err != nil {
 		return err
 	}
-	pw := "admin"
-	newPw := os.Getenv("STARDOG_ADMIN_PASSWORD")
-	if newPw != "" {
-		context.ConsoleLog(1, "Changing the default password...\n")
-		err = runClient(context, sd, baseD, dep, []string{"user", "passwd", "-u", "admin", "-N", newPw, "-p", "admin"})
+	newPw := os.Getenv(adminPasswordEnv)
+	if !StateReached(baseD, StatePasswordSet) {
+		if newPw == "" && baseD.Credentials != nil && baseD.Credentials.Provider != CredentialProviderEnv {
+			// A stored password is expected, so the default is not kept.
+			newPw, err = newAdminPassword(context, baseD)
+			if err != nil {
+				return err
+			}
+		}
+		if newPw != "" {
+			context.ConsoleLog(1, "Changing the default password...\n")
+			err = changePassword(context, baseD, sd, defaultAdminPassword, "admin", newPw)
+			if err != nil {
+				return err
+			}
+			err = RecordAdminPassword(context, baseD, newPw)
+			if err != nil {
+				return err
+			}
+		}
+		err = SetDeploymentState(context, baseD, StatePasswordSet)
+		if err != nil {
+			return err
+		}
+	}
+	if !StateReached(baseD, StateOpened) {
+		err = dep.OpenInstance(lp.RootVolumeSize, lp.ZkSize, lp.HTTPMask, lp.IdleTimeout)
 		if err != nil {
 			return err
 		}
-		pw = newPw
+		err = SetDeploymentState(context, baseD, StateOpened)
+		if err != nil {
+			return err
+		}
+	}
+	clusterSize, err := dep.ClusterSize()
+	if err != nil {
+		return err
 	}
-	err = dep.OpenInstance(volumeSize, zkSize, mask, timeoutSec)
+	err = WaitForNClusterNodes(context, clusterSize, sd.StardogURL, AdminPassword(context, baseD), waitMaxTimeSec, stardogClientOptions(baseD))
 	if err != nil {
 		return err
 	}
+	return SetDeploymentState(context, baseD, StateHealthy)
+}
+
+// QuorumSize returns the smallest number of nodes that is a majority of a
+// cluster of the given size.
+func QuorumSize(clusterSize int) int {
+	return clusterSize/2 + 1
+}
+
+// ScaleDeployment changes the number of Stardog nodes in a deployment.  It
+// refuses to remove more nodes than a quorum of the current cluster can
+// tolerate and blocks until the cluster reports exactly the new size.
+func ScaleDeployment(context AppContext, baseD *BaseDeployment, dep Deployment, nodes int, waitMaxTimeSec int) error {
+	current, err := dep.ClusterSize()
+	if err != nil {
+		return err
+	}
+	if nodes == current {
+		context.ConsoleLog(1, "The cluster already has %d nodes.\n", nodes)
+		return nil
+	}
+	quorum := QuorumSize(current)
+	if nodes < quorum {
+		return fmt.Errorf("Scaling from %d to %d nodes would drop below the quorum of %d nodes", current, nodes, quorum)
+	}
+	context.ConsoleLog(1, "Scaling the cluster from %d to %d nodes...\n", current, nodes)
+	err = dep.ResizeCluster(nodes)
+	if err != nil {
+		return err
+	}
+	launchParameters(baseD).ClusterSize = nodes
+	err = SetDeploymentState(context, baseD, CurrentState(baseD))
+	if err != nil {
+		return err
+	}
+	if !dep.InstanceExists() {
+		return nil
+	}
+	sd, err := dep.FullStatus()
+	if err != nil {
+		return err
+	}
+	return WaitForNClusterNodes(context, nodes, sd.StardogURL, AdminPassword(context, baseD), waitMaxTimeSec, stardogClientOptions(baseD))
+}
+
+// ReimageDeployment moves the Stardog nodes to the base image selected by the
+// plugin.  The nodes are replaced one at a time and each one must rejoin the
+// cluster before the next one is replaced.  The replaced nodes reattach the
+// same data volumes.
+func ReimageDeployment(context AppContext, baseD *BaseDeployment, dep Deployment, waitMaxTimeSec int) error {
+	if !dep.InstanceExists() {
+		return errors.New("There is no instance to reimage")
+	}
 	clusterSize, err := dep.ClusterSize()
 	if err != nil {
 		return err
 	}
-	err = WaitForNClusterNodes(context, clusterSize, sd.StardogURL, pw, waitMaxTimeSec)
-	return err
+	err = dep.UpdateImage()
+	if err != nil {
+		return err
+	}
+	return replaceStardogNodes(context, baseD, dep, clusterSize, waitMaxTimeSec)
+}
+
+// ReconfigureDeployment records the environment, the custom files and the
+// security setting of baseD and then reimages the deployment so that every
+// Stardog node is replaced, one at a time, with the new configuration.
+func ReconfigureDeployment(context AppContext, baseD *BaseDeployment, waitMaxTimeSec int) error {
+	if baseD.CustomScript != "" && !PathExists(baseD.CustomScript) {
+		return fmt.Errorf("The path to the custom script %s does not exist", baseD.CustomScript)
+	}
+	if baseD.CustomZkScript != "" && !PathExists(baseD.CustomZkScript) {
+		return fmt.Errorf("The path to the custom zk script %s does not exist", baseD.CustomZkScript)
+	}
+	err := SetDeploymentSettings(baseD)
+	if err != nil {
+		return err
+	}
+	dep, err := LoadDeployment(context, baseD, false)
+	if err != nil {
+		return err
+	}
+	context.ConsoleLog(1, "Replacing the Stardog nodes so that they use the new configuration...\n")
+	return ReimageDeployment(context, baseD, dep, waitMaxTimeSec)
+}
+
+// ReopenInstance opens the instance again with a new network mask and idle
+// timeout.  An empty mask or a timeout of 0 keeps the current value.
+func ReopenInstance(context AppContext, baseD *BaseDeployment, dep Deployment, mask string, idleTimeout int) error {
+	lp := launchParameters(baseD)
+	if mask != "" {
+		lp.HTTPMask = mask
+	}
+	if idleTimeout > 0 {
+		lp.IdleTimeout = idleTimeout
+	}
+	zkSize, err := dep.ZookeeperSize()
+	if err != nil {
+		return err
+	}
+	err = dep.OpenInstance(lp.RootVolumeSize, zkSize, lp.HTTPMask, lp.IdleTimeout)
+	if err != nil {
+		return err
+	}
+	return SetDeploymentState(context, baseD, CurrentState(baseD))
+}
+
+// replaceStardogNodes recreates the Stardog nodes one at a time from the
+// current launch configuration, waiting for each one to rejoin the cluster
+// before moving to the next.
+func replaceStardogNodes(context AppContext, baseD *BaseDeployment, dep Deployment, clusterSize int, waitMaxTimeSec int) error {
+	sd, err := dep.FullStatus()
+	if err != nil {
+		return err
+	}
+	err = WaitForNClusterNodes(context, clusterSize, sd.StardogURL, AdminPassword(context, baseD), waitMaxTimeSec, stardogClientOptions(baseD))
+	if err != nil {
+		return err
+	}
+	poller := NewStardogClient(sd.StardogURL, "admin", AdminPassword(context, baseD), context, pollingOptions(stardogClientOptions(baseD)))
+	nodes, err := poller.GetClusterInfo()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < clusterSize; i++ {
+		context.ConsoleLog(1, "Replacing Stardog node %d of %d...\n", i+1, clusterSize)
+		err = dep.ReplaceStardogNode(i)
+		if err != nil {
+			return err
+		}
+		nodes, err = waitForNodeReplacement(context, baseD, sd, poller, *nodes, waitMaxTimeSec)
+		if err != nil {
+			if i+1 < clusterSize {
+				context.ConsoleLog(0, "Stardog nodes %d to %d were not replaced.\n", i+2, clusterSize)
+			}
+			return fmt.Errorf("Stardog node %d did not rejoin the cluster: %s", i+1, err)
+		}
+	}
+	context.ConsoleLog(1, "Successfully replaced all %d Stardog nodes.\n", clusterSize)
+	return nil
+}
+
+// waitForNodeReplacement blocks until one of the addresses in before has
+// left /admin/cluster and a node has joined in its place, either on a new
+// address or, as a recreated container does, on the same one.  Counting the
+// nodes is not enough because the old node may still be listed when the
+// replacement starts.  The node that joined must answer its own health check
+// when there is a bastion node to check it from, otherwise its membership is
+// enough.  The new membership is returned so that it can be the baseline of
+// the next replacement.
+func waitForNodeReplacement(context AppContext, baseD *BaseDeployment, sd *StardogDescription, client StardogClient, before []string, waitTimeout int) (*[]string, error) {
+	pollInterval := 2
+	deadline := time.Now().Add(time.Duration(waitTimeout) * time.Second)
+	spin := NewSpinner(context, 1, "Waiting for the replacement node to join the cluster")
+	departed := ""
+	for {
+		nodes, err := client.GetClusterInfo()
+		if err != nil {
+			context.Logf(WARN, "Cluster info failed: %s", err)
+		} else {
+			if departed == "" {
+				for _, n := range before {
+					if !containsString(*nodes, n) {
+						departed = n
+						context.Logf(INFO, "The Stardog node %s left the cluster", n)
+						break
+					}
+				}
+			}
+			joined := ""
+			if departed != "" && len(*nodes) == len(before) {
+				if containsString(*nodes, departed) {
+					joined = departed
+				} else {
+					for _, n := range *nodes {
+						if !containsString(before, n) {
+							joined = n
+							break
+						}
+					}
+				}
+			}
+			if joined != "" && (sd.SSHHost == "" || checkURL(context, baseD, sd, fmt.Sprintf("http://%s/admin/healthcheck", joined), true)) {
+				spin.Close()
+				context.Logf(INFO, "The Stardog node %s replaced %s", joined, departed)
+				return nodes, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if departed == "" {
+				return nil, errors.New("Timed out waiting for the old node to leave the cluster")
+			}
+			return nil, fmt.Errorf("Timed out waiting for a node to replace %s", departed)
+		}
+		spin.EchoNext()
+		time.Sleep(time.Duration(pollInterval) * time.Second)
+	}
 }
 
 // Upload a new Stardog release zip to the nodes and restart Stardog
@@ -429,6 +1079,150 @@ func UpdateStardog(context AppContext, baseD *BaseDeployment, dep Deployment, sd
 	return nil
 }
 
+// UpdateStardogRolling upgrades the Stardog nodes one at a time so that the
+// cluster keeps serving requests.  After each node is restarted it must rejoin
+// the cluster and pass its health check before the next node is touched.  If
+// a node fails it is rolled back to its previous binaries and the remaining
+// nodes are left on the old release.
+func UpdateStardogRolling(context AppContext, baseD *BaseDeployment, dep Deployment, sdReleaseFile string, waitMaxTimeSec int) error {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return errors.New("ssh-agent needs to be setup to update Stardog binaries")
+	}
+	sd, err := dep.FullStatus()
+	if err != nil {
+		return err
+	}
+	sshBase, err := getSSHCommand(context, baseD, sd)
+	if err != nil {
+		return err
+	}
+	clusterSize, err := dep.ClusterSize()
+	if err != nil {
+		return err
+	}
+	client := NewStardogClient(sd.StardogURL, "admin", AdminPassword(context, baseD), context, stardogClientOptions(baseD))
+	nodes, err := client.GetClusterInfo()
+	if err != nil {
+		return err
+	}
+	if len(*nodes) != clusterSize {
+		return fmt.Errorf("Only %d of the %d Stardog nodes are in the cluster, a rolling update needs a complete cluster", len(*nodes), clusterSize)
+	}
+
+	remoteDir := "/tmp"
+	err = runSCPCommand(context, baseD, sd, sdReleaseFile, remoteDir, true)
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s to the bastion node: %s", sdReleaseFile, err)
+	}
+	remoteFile := strings.Join([]string{remoteDir, path.Base(sdReleaseFile)}, "/")
+
+	poller := NewStardogClient(sd.StardogURL, "admin", AdminPassword(context, baseD), context, pollingOptions(stardogClientOptions(baseD)))
+	for i, node := range *nodes {
+		context.ConsoleLog(1, "Updating Stardog node %s (%d of %d)...\n", node, i+1, len(*nodes))
+		ip := strings.Split(node, ":")[0]
+		output, err := runNodeUpdate(context, sshBase, ip, remoteFile)
+		if err == nil {
+			err = waitForNodeToRejoin(context, baseD, sd, poller, node, waitMaxTimeSec)
+		}
+		if err != nil {
+			context.ConsoleLog(0, "%s\n", context.FailString(fmt.Sprintf("Failed to update the Stardog node %s", node)))
+			context.ConsoleLog(1, "Rolling back the Stardog node %s...\n", node)
+			rbArgs := []string{"--rollback", ip}
+			if backup := nodeUpdateBackup(output); backup != "" {
+				rbArgs = append(rbArgs, backup)
+			} else {
+				context.ConsoleLog(1, "The binaries of %s were not replaced, it is only restarted.\n", node)
+			}
+			_, rbErr := runNodeUpdate(context, sshBase, rbArgs...)
+			if rbErr != nil {
+				context.Logf(ERROR, "Failed to roll back %s: %s", node, rbErr)
+				context.ConsoleLog(0, "The Stardog node %s could not be rolled back.\n", node)
+			} else if waitForNodeToRejoin(context, baseD, sd, poller, node, waitMaxTimeSec) != nil {
+				context.ConsoleLog(0, "The Stardog node %s was rolled back but did not rejoin the cluster.\n", node)
+			} else {
+				context.ConsoleLog(1, "The Stardog node %s was rolled back.\n", node)
+			}
+			if i+1 < len(*nodes) {
+				context.ConsoleLog(0, "The following nodes were not updated: %s\n", strings.Join((*nodes)[i+1:], ", "))
+			}
+			return err
+		}
+		context.ConsoleLog(1, "%s\n", context.SuccessString(fmt.Sprintf("The Stardog node %s was updated", node)))
+	}
+	context.ConsoleLog(1, "Successfully updated all %d Stardog nodes.\n", len(*nodes))
+	return nil
+}
+
+// nodeUpdateBackupMarker starts the line that the single node update script
+// prints right before it swaps the binaries.  The rest of the line is the
+// directory holding the previous release.
+const nodeUpdateBackupMarker = "stardog-update-node backup:"
+
+// nodeUpdateBackup returns the backup directory reported in the output of
+// the single node update script, or an empty string when the script failed
+// before swapping the binaries.
+func nodeUpdateBackup(output string) string {
+	backup := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, nodeUpdateBackupMarker) {
+			backup = strings.TrimSpace(strings.TrimPrefix(line, nodeUpdateBackupMarker))
+		}
+	}
+	return backup
+}
+
+// runNodeUpdate calls the single node update script on the bastion node and
+// returns what it printed, also when it fails.
+func runNodeUpdate(context AppContext, sshBase []string, args ...string) (string, error) {
+	sshCmd := append(append([]string{}, sshBase...), "/usr/local/bin/stardog-update-node")
+	sshCmd = append(sshCmd, args...)
+	cmd := exec.Cmd{
+		Path: sshCmd[0],
+		Args: sshCmd,
+	}
+	context.Logf(DEBUG, "Running the node update command: %s", strings.Join(sshCmd, " "))
+	o, err := cmd.Output()
+	if err != nil {
+		context.Logf(ERROR, "The node update command failed: %s", string(o))
+		return string(o), fmt.Errorf("The node update command failed: %s", err)
+	}
+	return string(o), nil
+}
+
+// waitForNodeToRejoin blocks until node is listed by /admin/cluster and
+// answers its own health check.  The client should be made with
+// pollingOptions so that the deadline holds.
+func waitForNodeToRejoin(context AppContext, baseD *BaseDeployment, sd *StardogDescription, client StardogClient, node string, waitTimeout int) error {
+	pollInterval := 2
+	deadline := time.Now().Add(time.Duration(waitTimeout) * time.Second)
+	healthURL := fmt.Sprintf("http://%s/admin/healthcheck", node)
+	spin := NewSpinner(context, 1, fmt.Sprintf("Waiting for %s to rejoin the cluster", node))
+	for {
+		nodes, err := client.GetClusterInfo()
+		if err != nil {
+			context.Logf(WARN, "Cluster info failed: %s", err)
+		} else if containsString(*nodes, node) && checkURL(context, baseD, sd, healthURL, true) {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for %s to rejoin the cluster", node)
+		}
+		spin.EchoNext()
+		time.Sleep(time.Duration(pollInterval) * time.Second)
+	}
+	spin.Close()
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
 // GatherLogs sshes into the bastion node and collects logs from the stardog nodes
 func GatherLogs(context AppContext, baseD *BaseDeployment, dep Deployment, outfile string) error {
 	if os.Getenv("SSH_AUTH_SOCK") == "" {
@@ -485,31 +1279,21 @@ func FullStatus(context AppContext, baseD *BaseDeployment, dep Deployment, inter
 		return err
 	}
 
+	sd.State = CurrentState(baseD)
+	context.ConsoleLog(1, "The deployment is at the step: %s\n", context.HighlightString(sd.State))
 	sd.Healthy = IsHealthy(context, baseD, dep, internal)
 	if sd.Healthy {
 		context.ConsoleLog(1, "%s\n", context.SuccessString("The instance is healthy"))
 	} else {
 		context.ConsoleLog(1, "%s\n", context.FailString("The instance is not healthy"))
 	}
-	if os.Getenv("STARDOG_GRAVITON_UNIT_TEST") != "" {
-		return nil
-	}
-
 	context.ConsoleLog(1, "Stardog is available here: %s\n", context.HighlightString(sd.StardogURL))
 	context.ConsoleLog(1, "Stardog is internally available here: %s\n", context.HighlightString(sd.StardogInternalURL))
-	context.ConsoleLog(1, "ssh is available here: %s\n", sd.SSHHost)
-
-	pw := os.Getenv("STARDOG_ADMIN_PASSWORD")
-	if pw == "" {
-		pw = "admin"
+	if sd.SSHHost != "" {
+		context.ConsoleLog(1, "ssh is available here: %s\n", sd.SSHHost)
 	}
 
-	client := stardogClientImpl{
-		sdURL:    sd.StardogURL,
-		logger:   context,
-		username: "admin",
-		password: pw,
-	}
+	client := NewStardogClient(sd.StardogURL, "admin", AdminPassword(context, baseD), context, stardogClientOptions(baseD))
 	nodes, err := client.GetClusterInfo()
 	if err != nil {
 		return err
@@ -519,6 +1303,7 @@ func FullStatus(context AppContext, baseD *BaseDeployment, dep Deployment, inter
 		context.ConsoleLog(1, "\t%s\n", n)
 	}
 	sd.StardogNodes = *nodes
+	context.SetResult(sd)
 
 	if outfile != "" {
 		err = WriteJSON(sd, outfile)
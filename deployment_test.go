@@ -16,10 +16,15 @@
 package sdutils
 
 import (
+	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetNoPluging(t *testing.T) {
@@ -166,3 +171,136 @@ func TestLoadExistingDeploymentGoodLoad(t *testing.T) {
 	}
 	DeleteDeployment(&app, baseD.Name)
 }
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"db":                "db",
+		"--server=http://x": "--server=http://x",
+		"my db":             "'my db'",
+		"it's":              `'it'\''s'`,
+		"":                  "''",
+		"$HOME":             "'$HOME'",
+	}
+	for in, expected := range cases {
+		if out := shellQuote(in); out != expected {
+			t.Fatalf("%s was quoted as %s not %s", in, out, expected)
+		}
+	}
+}
+
+func TestLocalFileArg(t *testing.T) {
+	f, err := ioutil.TempFile("", "stardogtests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	prefix, file, ok := localFileArg(f.Name())
+	if !ok || prefix != "" || file != f.Name() {
+		t.Fatalf("The file argument was not found %s %s", prefix, file)
+	}
+	prefix, file, ok = localFileArg("--data=" + f.Name())
+	if !ok || prefix != "--data=" || file != f.Name() {
+		t.Fatalf("The file option was not found %s %s", prefix, file)
+	}
+	for _, arg := range []string{"db", "-n", os.TempDir(), "--data", "-x=/no/such/file"} {
+		if _, _, ok := localFileArg(arg); ok {
+			t.Fatalf("%s is not a local file", arg)
+		}
+	}
+}
+
+func TestWaitForNClusterNodesDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	err := WaitForNClusterNodes(&TestContext{}, 3, server.URL, "admin", 1, nil)
+	if err == nil {
+		t.Fatal("Waiting on a cluster that never answers should time out")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("A 1 second wait took %s", elapsed)
+	}
+}
+
+func TestPollingOptions(t *testing.T) {
+	opts := DefaultStardogClientOptions()
+	opts.Timeout = time.Minute
+	polling := pollingOptions(opts)
+	if polling.Retries != 0 || polling.Timeout > 10*time.Second {
+		t.Fatalf("Polling options should not retry or wait long: %+v", polling)
+	}
+	if opts.Retries == 0 || opts.Timeout != time.Minute {
+		t.Fatal("The original options were changed")
+	}
+	if pollingOptions(nil).Retries != 0 {
+		t.Fatal("The defaults should not retry when polling")
+	}
+}
+
+func TestWaitForNodeReplacement(t *testing.T) {
+	var server *httptest.Server
+	polls := 0
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin/healthcheck" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// The old node is still listed at first, then it leaves and the
+		// replacement joins.
+		nodes := []string{"10.0.0.1:5821", "10.0.0.2:5821"}
+		if polls == 1 {
+			nodes = []string{"10.0.0.2:5821"}
+		} else if polls > 1 {
+			nodes = []string{"10.0.0.2:5821", strings.TrimPrefix(server.URL, "http://")}
+		}
+		polls++
+		data, _ := json.Marshal(map[string]interface{}{"nodes": nodes})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	context := &TestContext{}
+	client := NewStardogClient(server.URL, "admin", "admin", context, pollingOptions(nil))
+	before := []string{"10.0.0.1:5821", "10.0.0.2:5821"}
+	nodes, err := waitForNodeReplacement(context, &BaseDeployment{}, &StardogDescription{}, client, before, 20)
+	if err != nil {
+		t.Fatalf("The replacement should be seen %s", err)
+	}
+	if polls < 3 || containsString(*nodes, "10.0.0.1:5821") || len(*nodes) != 2 {
+		t.Fatalf("The wait ended before the node was replaced %v after %d polls", *nodes, polls)
+	}
+}
+
+func TestWaitForNodeReplacementSameAddress(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A recreated container leaves the cluster and rejoins on the
+		// address it had.
+		nodes := []string{"sd0:5821", "sd1:5821"}
+		if polls == 1 {
+			nodes = []string{"sd1:5821"}
+		}
+		polls++
+		data, _ := json.Marshal(map[string]interface{}{"nodes": nodes})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	context := &TestContext{}
+	client := NewStardogClient(server.URL, "admin", "admin", context, pollingOptions(nil))
+	before := []string{"sd0:5821", "sd1:5821"}
+	nodes, err := waitForNodeReplacement(context, &BaseDeployment{}, &StardogDescription{}, client, before, 20)
+	if err != nil {
+		t.Fatalf("A node that rejoins on its address should count as replaced %s", err)
+	}
+	if polls < 3 || !containsString(*nodes, "sd0:5821") || len(*nodes) != 2 {
+		t.Fatalf("The wait ended before the node rejoined %v after %d polls", *nodes, polls)
+	}
+}
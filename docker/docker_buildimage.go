@@ -0,0 +1,81 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+var (
+	dockerfile = `FROM openjdk:8-jre-slim
+RUN apt-get update && apt-get install -y --no-install-recommends unzip && rm -rf /var/lib/apt/lists/*
+COPY stardog.zip /tmp/stardog.zip
+RUN unzip -q /tmp/stardog.zip -d /opt && mv /opt/stardog-* /opt/stardog && rm /tmp/stardog.zip
+ENV STARDOG_HOME=%s
+VOLUME %s
+EXPOSE %d
+ENTRYPOINT ["/opt/stardog/bin/stardog-admin", "server", "start", "--foreground", "--port", "%d"]
+`
+)
+
+func (p *dockerPlugin) HaveImage(c sdutils.AppContext) bool {
+	_, err := dockerOutput(c, "image", "inspect", "--format", "{{.Id}}", fmt.Sprintf("%s:%s", p.Image, c.GetVersion()))
+	return err == nil
+}
+
+func (p *dockerPlugin) BuildImage(context sdutils.AppContext, sdReleaseFilePath string, version string) error {
+	context.Logf(sdutils.DEBUG, "Build docker image\n")
+
+	if !sdutils.PathExists(sdReleaseFilePath) {
+		return fmt.Errorf("The release file %s does not exist", sdReleaseFilePath)
+	}
+	dir, err := ioutil.TempDir("", "graviton-docker")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	err = sdutils.CopyFile(sdReleaseFilePath, path.Join(dir, "stardog.zip"))
+	if err != nil {
+		return err
+	}
+	data := fmt.Sprintf(dockerfile, stardogHome, stardogHome, stardogPort, stardogPort)
+	err = ioutil.WriteFile(path.Join(dir, "Dockerfile"), []byte(data), 0644)
+	if err != nil {
+		return err
+	}
+
+	image := fmt.Sprintf("%s:%s", p.Image, version)
+	spin := sdutils.NewSpinner(context, 1, fmt.Sprintf("Building the docker image %s", image))
+	err = runDocker(context, spin, "build", "-t", image, dir)
+	if err != nil {
+		return err
+	}
+	context.SetResult(&sdutils.ImageDescription{Version: version, Image: image})
+	context.ConsoleLog(1, "Built the docker image %s\n", image)
+	return nil
+}
+
+// CopyImage is not supported because docker images are not tied to a region.
+func (p *dockerPlugin) CopyImage(context sdutils.AppContext, regions []string) error {
+	return errors.New("The docker plugin does not copy images between regions")
+}
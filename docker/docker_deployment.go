@@ -0,0 +1,603 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+const (
+	// deploymentLabel is attached to every docker object graviton creates so
+	// that they can be found again by FindLeaks.
+	deploymentLabel = "graviton.deployment"
+	// snapshotLabel marks volume copies made by SnapshotVolumeSet.  They
+	// do not carry the deployment label so that they outlive it.
+	snapshotLabel = "graviton.snapshot"
+)
+
+type dockerDeploymentDescription struct {
+	Image           string `json:"image,omitempty"`
+	ZkImage         string `json:"zk_image,omitempty"`
+	Port            int    `json:"port,omitempty"`
+	Version         string `json:"-"`
+	Name            string `json:"-"`
+	deployDir       string
+	customPropFile  string
+	customLog4J     string
+	environment     []string
+	disableSecurity bool
+	ctx             sdutils.AppContext
+	plugin          *dockerPlugin
+}
+
+func newDockerDeploymentDescription(c sdutils.AppContext, baseD *sdutils.BaseDeployment, p *dockerPlugin) (*dockerDeploymentDescription, error) {
+	if baseD.CustomScript != "" || baseD.CustomZkScript != "" {
+		return nil, errors.New("Custom scripts are not supported by the docker plugin")
+	}
+	if p.Port < 1 || p.Port > 65535 {
+		return nil, fmt.Errorf("The port %d is not valid", p.Port)
+	}
+	deployDir := sdutils.DeploymentDir(c.GetConfigDir(), baseD.Name)
+	dd := dockerDeploymentDescription{
+		Image:   p.Image,
+		ZkImage: p.ZkImage,
+		Port:    p.Port,
+		Version: baseD.Version,
+		Name:    baseD.Name,
+		ctx:     c,
+		plugin:  p,
+	}
+	dd.setBase(baseD, deployDir)
+	return &dd, nil
+}
+
+func (dd *dockerDeploymentDescription) setBase(baseD *sdutils.BaseDeployment, deployDir string) {
+	dd.deployDir = deployDir
+	dd.customPropFile = baseD.CustomPropsFile
+	dd.customLog4J = baseD.CustomLog4J
+	dd.environment = baseD.Environment
+	dd.disableSecurity = baseD.DisableSecurity
+}
+
+func (dd *dockerDeploymentDescription) dockerDir() string {
+	return path.Join(dd.deployDir, "docker")
+}
+
+func (dd *dockerDeploymentDescription) DestroyDeployment() error {
+	return nil
+}
+
+func (dd *dockerDeploymentDescription) CreateVolumeSet(licensePath string, sizeOfEachVolume int, clusterSize int) error {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	return vm.CreateSet(licensePath, sizeOfEachVolume, clusterSize)
+}
+
+func (dd *dockerDeploymentDescription) PlanVolumeSet(licensePath string, sizeOfEachVolume int, clusterSize int) (*sdutils.PlanSummary, error) {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	return vm.PlanSet(licensePath, clusterSize)
+}
+
+func (dd *dockerDeploymentDescription) DeleteVolumeSet() error {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	if !vm.VolumeExists() {
+		return fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	return vm.DeleteSet()
+}
+
+func (dd *dockerDeploymentDescription) PlanDeleteVolumeSet() (*sdutils.PlanSummary, error) {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	if !vm.VolumeExists() {
+		return nil, fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	return vm.PlanDeleteSet()
+}
+
+func (dd *dockerDeploymentDescription) ClusterSize() (int, error) {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	if !vm.VolumeExists() {
+		return -1, fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	vols, err := LoadDockerVolumes(dd.ctx, vm.VolumeDir)
+	if err != nil {
+		return -1, err
+	}
+	return vols.ClusterSize, nil
+}
+
+// ResizeCluster grows the volumes before starting new nodes and stops nodes
+// before removing their volumes.
+func (dd *dockerDeploymentDescription) ResizeCluster(clusterSize int) error {
+	current, err := dd.ClusterSize()
+	if err != nil {
+		return err
+	}
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	if clusterSize > current {
+		err = vm.Resize(clusterSize)
+		if err != nil || !di.InstanceExists() {
+			return err
+		}
+		return di.Resize(clusterSize)
+	}
+	if di.InstanceExists() {
+		err = di.Resize(clusterSize)
+		if err != nil {
+			return err
+		}
+	}
+	return vm.Resize(clusterSize)
+}
+
+func (dd *dockerDeploymentDescription) SnapshotVolumeSet(tag string) ([]string, error) {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	if !vm.VolumeExists() {
+		return nil, fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	return vm.Snapshot(tag)
+}
+
+func (dd *dockerDeploymentDescription) CreateVolumeSetFromSnapshots(snapshotIDs []string, sizeOfEachVolume int) error {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	return vm.CreateSetFromSnapshots(snapshotIDs, sizeOfEachVolume)
+}
+
+func (dd *dockerDeploymentDescription) DeleteVolumeSnapshots(snapshotIDs []string) error {
+	for _, id := range snapshotIDs {
+		err := runDocker(dd.ctx, nil, "volume", "rm", id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dd *dockerDeploymentDescription) StatusVolumeSet() error {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	if !vm.VolumeExists() {
+		return fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	return vm.Status()
+}
+
+func (dd *dockerDeploymentDescription) VolumeExists() bool {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	return vm.VolumeExists()
+}
+
+func (dd *dockerDeploymentDescription) CreateInstance(volumeSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) error {
+	if bastionVolSnapshotId != "" {
+		dd.ctx.ConsoleLog(1, "The docker plugin has no bastion node, ignoring the bastion volume snapshot.\n")
+	}
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return di.CreateInstance(zookeeperSize, idleTimeout)
+}
+
+func (dd *dockerDeploymentDescription) PlanInstance(clusterSize int, volumeSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) (*sdutils.PlanSummary, error) {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return nil, err
+	}
+	return di.PlanInstance(clusterSize, zookeeperSize)
+}
+
+func (dd *dockerDeploymentDescription) OpenInstance(volumeSize int, zookeeperSize int, mask string, idleTimeout int) error {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return di.OpenInstance(mask, idleTimeout)
+}
+
+func (dd *dockerDeploymentDescription) DeleteInstance() error {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return di.DeleteInstance()
+}
+
+func (dd *dockerDeploymentDescription) PlanDeleteInstance() (*sdutils.PlanSummary, error) {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return nil, err
+	}
+	return di.PlanDelete()
+}
+
+func (dd *dockerDeploymentDescription) StatusInstance() error {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return di.Status()
+}
+
+func (dd *dockerDeploymentDescription) StopInstance() error {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return di.Stop()
+}
+
+func (dd *dockerDeploymentDescription) StartInstance() error {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return di.Start()
+}
+
+func (dd *dockerDeploymentDescription) InstanceExists() bool {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return false
+	}
+	return di.InstanceExists()
+}
+
+func (dd *dockerDeploymentDescription) ZookeeperSize() (int, error) {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return -1, err
+	}
+	err = di.load()
+	if err != nil {
+		return -1, err
+	}
+	return di.ZkSize, nil
+}
+
+func (dd *dockerDeploymentDescription) ReplaceZookeeperNode(zookeeperSize int, ndx int) error {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return di.ReplaceZookeeperNode(zookeeperSize, ndx)
+}
+
+// UpdateImage points the Stardog nodes at the image given with
+// --docker-image, or at the image of the deployment's version which may have
+// been rebuilt.  Running containers keep the old image until they are
+// replaced.
+func (dd *dockerDeploymentDescription) UpdateImage() error {
+	image := ""
+	if dd.plugin != nil {
+		image = dd.plugin.ReimageImage
+	}
+	if image == "" {
+		image = dd.Image
+	}
+	if !strings.Contains(image, ":") {
+		image = fmt.Sprintf("%s:%s", image, dd.Version)
+	}
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return di.UpdateImage(image)
+}
+
+func (dd *dockerDeploymentDescription) ReplaceStardogNode(ndx int) error {
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return err
+	}
+	return di.ReplaceStardogNode(ndx)
+}
+
+func (dd *dockerDeploymentDescription) FullStatus() (*sdutils.StardogDescription, error) {
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	volumeStatus, err := vm.getStatusInformation()
+	if err != nil {
+		dd.ctx.ConsoleLog(1, "No volume information found %s\n", err)
+	}
+
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return nil, err
+	}
+	instS, err := di.getStatusInformation()
+	if err != nil {
+		dd.ctx.ConsoleLog(1, "No instance information found.\n")
+	}
+
+	// There is no bastion node so the internal URL is the same front end
+	// that is published on the docker host.
+	sdURL := fmt.Sprintf("http://%s:%d", dockerHost(), dd.Port)
+	sD := sdutils.StardogDescription{
+		StardogURL:          sdURL,
+		StardogInternalURL:  sdURL,
+		VolumeDescription:   volumeStatus,
+		InstanceDescription: instS,
+		TimeStamp:           time.Now(),
+	}
+	return &sD, nil
+}
+
+// compareNames reports the recorded names that are not found and the found
+// names that were not recorded.
+func compareNames(source string, resourceType string, recorded []string, found []string) []sdutils.DriftItem {
+	items := []sdutils.DriftItem{}
+	foundSet := make(map[string]bool)
+	for _, n := range found {
+		foundSet[n] = true
+	}
+	recordedSet := make(map[string]bool)
+	for _, n := range recorded {
+		recordedSet[n] = true
+		if !foundSet[n] {
+			items = append(items, sdutils.DriftItem{Kind: sdutils.DriftMissing, Source: source, Resource: fmt.Sprintf("%s %s", resourceType, n)})
+		}
+	}
+	for _, n := range found {
+		if !recordedSet[n] {
+			items = append(items, sdutils.DriftItem{Kind: sdutils.DriftExtra, Source: source, Resource: fmt.Sprintf("%s %s", resourceType, n),
+				Detail: "labeled for the deployment but not recorded"})
+		}
+	}
+	return items
+}
+
+// EstimateCost returns an empty estimate because the containers run on the
+// local docker host.
+func (dd *dockerDeploymentDescription) EstimateCost(sizeOfEachVolume int, clusterSize int, rootVolumeSize int, zookeeperSize int) (*sdutils.CostEstimate, error) {
+	return sdutils.NewCostEstimate("local", ""), nil
+}
+
+// Drift compares the volumes, containers and network recorded for the
+// deployment with the ones that carry its label.  A recorded container that
+// is not running has been modified unless the instance was stopped.
+func (dd *dockerDeploymentDescription) Drift() ([]sdutils.DriftItem, error) {
+	filter := labelFilter(dd.Name)
+	containerLines, err := dockerOutput(dd.ctx, "ps", "-a", "--filter", filter, "--format", "{{.Names}} {{.State}}")
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := dockerOutput(dd.ctx, "volume", "ls", "--filter", filter, "--format", "{{.Name}}")
+	if err != nil {
+		return nil, err
+	}
+	networks, err := dockerOutput(dd.ctx, "network", "ls", "--filter", filter, "--format", "{{.Name}}")
+	if err != nil {
+		return nil, err
+	}
+	containers := []string{}
+	states := make(map[string]string)
+	for _, l := range containerLines {
+		fields := strings.Fields(l)
+		if len(fields) == 0 {
+			continue
+		}
+		containers = append(containers, fields[0])
+		if len(fields) > 1 {
+			states[fields[0]] = fields[1]
+		}
+	}
+
+	recordedVolumes := []string{}
+	vm := NewDockerVolumeManager(dd.ctx, dd)
+	if vm.VolumeExists() {
+		vols, err := LoadDockerVolumes(dd.ctx, vm.VolumeDir)
+		if err != nil {
+			return nil, err
+		}
+		recordedVolumes = vols.VolumeNames
+	}
+	recordedContainers := []string{}
+	recordedNetworks := []string{}
+	stopped := false
+	di, err := NewDockerInstance(dd.ctx, dd)
+	if err != nil {
+		return nil, err
+	}
+	if di.InstanceExists() {
+		err = di.load()
+		if err != nil {
+			return nil, err
+		}
+		recordedContainers = append([]string{di.FrontEnd}, di.StardogNodes...)
+		recordedContainers = append(recordedContainers, di.ZkNodes...)
+		recordedNetworks = []string{di.Network}
+		stopped = di.Stopped
+	}
+
+	items := compareNames("volumes", "volume", recordedVolumes, volumes)
+	items = append(items, compareNames("instance", "container", recordedContainers, containers)...)
+	items = append(items, compareNames("instance", "network", recordedNetworks, networks)...)
+	for _, n := range recordedContainers {
+		if state, ok := states[n]; ok && state != "running" && !stopped {
+			items = append(items, sdutils.DriftItem{Kind: sdutils.DriftModified, Source: "instance", Resource: fmt.Sprintf("container %s", n),
+				Detail: fmt.Sprintf("the container is %s", state)})
+		}
+	}
+	return items, nil
+}
+
+type dockerPlugin struct {
+	Image        string `json:"image,omitempty"`
+	ZkImage      string `json:"zk_image,omitempty"`
+	Port         int    `json:"port,omitempty"`
+	ReimageImage string `json:"-"`
+}
+
+// GetPlugin returns the plugin interface that this module represents.
+func GetPlugin() sdutils.Plugin {
+	return &dockerPlugin{
+		Image:   "graviton-stardog",
+		ZkImage: "zookeeper:3.4",
+		Port:    5821,
+	}
+}
+
+func (p *dockerPlugin) LoadDefaults(defaultCliOpts interface{}) error {
+	// parse out from the interface any config file defaults
+	b, err := json.Marshal(defaultCliOpts)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *dockerPlugin) Register(cmdOpts *sdutils.CommandOpts) error {
+	cmdOpts.BuildCmd.Flag("docker-image", "The name of the docker image to build for stardog nodes.").Default(p.Image).StringVar(&p.Image)
+
+	cmdOpts.LaunchCmd.Flag("docker-image", "The docker image to use for stardog nodes.  The stardog version is used as the tag.").Default(p.Image).StringVar(&p.Image)
+	cmdOpts.LaunchCmd.Flag("zk-image", "The docker image to use for zookeeper nodes.").Default(p.ZkImage).StringVar(&p.ZkImage)
+	cmdOpts.LaunchCmd.Flag("docker-port", "The port on the docker host where stardog will be published.").Default(fmt.Sprintf("%d", p.Port)).IntVar(&p.Port)
+
+	cmdOpts.NewDeploymentCmd.Flag("docker-image", "The docker image to use for stardog nodes.  The stardog version is used as the tag.").Default(p.Image).StringVar(&p.Image)
+	cmdOpts.NewDeploymentCmd.Flag("zk-image", "The docker image to use for zookeeper nodes.").Default(p.ZkImage).StringVar(&p.ZkImage)
+	cmdOpts.NewDeploymentCmd.Flag("docker-port", "The port on the docker host where stardog will be published.").Default(fmt.Sprintf("%d", p.Port)).IntVar(&p.Port)
+
+	cmdOpts.ReimageCmd.Flag("docker-image", "The docker image to move the stardog nodes to.  The stardog version is used as the tag if none is given.").StringVar(&p.ReimageImage)
+
+	return nil
+}
+
+func (p *dockerPlugin) DeploymentLoader(context sdutils.AppContext, baseD *sdutils.BaseDeployment, new bool) (sdutils.Deployment, error) {
+	_, err := GetDockerPath(context)
+	if err != nil {
+		return nil, err
+	}
+
+	if new {
+		dd, err := newDockerDeploymentDescription(context, baseD, p)
+		if err != nil {
+			return nil, err
+		}
+		baseD.CloudOpts = dd
+		data, err := json.Marshal(baseD)
+		if err != nil {
+			return nil, err
+		}
+		confPath := path.Join(dd.deployDir, "config.json")
+		err = ioutil.WriteFile(confPath, data, 0600)
+		if err != nil {
+			return nil, err
+		}
+		return dd, nil
+	}
+	data, err := json.Marshal(baseD.CloudOpts)
+	if err != nil {
+		return nil, err
+	}
+	var dd dockerDeploymentDescription
+	err = json.Unmarshal(data, &dd)
+	if err != nil {
+		return nil, err
+	}
+	dd.Name = baseD.Name
+	dd.Version = baseD.Version
+	dd.ctx = context
+	dd.plugin = p
+	dd.setBase(baseD, sdutils.DeploymentDir(context.GetConfigDir(), baseD.Name))
+
+	return &dd, nil
+}
+
+// PlanDeployment plans a new deployment.  Nothing is created when a docker
+// deployment is defined, so the plan is empty.
+func (p *dockerPlugin) PlanDeployment(context sdutils.AppContext, baseD *sdutils.BaseDeployment) (sdutils.Deployment, *sdutils.PlanSummary, error) {
+	_, err := GetDockerPath(context)
+	if err != nil {
+		return nil, nil, err
+	}
+	dd, err := newDockerDeploymentDescription(context, baseD, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	dd.setBase(baseD, baseD.Directory)
+	return dd, sdutils.NewPlanSummary(), nil
+}
+
+func (p *dockerPlugin) GetName() string {
+	return "docker"
+}
+
+// GetRegion returns an empty string because docker deployments all live on
+// the local docker host.
+func (p *dockerPlugin) GetRegion() string {
+	return ""
+}
+
+func (p *dockerPlugin) DeploymentRegion(baseD *sdutils.BaseDeployment) string {
+	return ""
+}
+
+func (p *dockerPlugin) DeploymentImage(baseD *sdutils.BaseDeployment) string {
+	data, err := json.Marshal(baseD.CloudOpts)
+	if err != nil {
+		return ""
+	}
+	var dd dockerDeploymentDescription
+	err = json.Unmarshal(data, &dd)
+	if err != nil || dd.Image == "" {
+		return ""
+	}
+	if !strings.Contains(dd.Image, ":") {
+		return fmt.Sprintf("%s:%s", dd.Image, baseD.Version)
+	}
+	return dd.Image
+}
+
+func (p *dockerPlugin) DeploymentOptions(baseD *sdutils.BaseDeployment) map[string]interface{} {
+	data, err := json.Marshal(baseD.CloudOpts)
+	if err != nil {
+		return nil
+	}
+	var dd dockerDeploymentDescription
+	err = json.Unmarshal(data, &dd)
+	if err != nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"image":    dd.Image,
+		"zk_image": dd.ZkImage,
+		"port":     dd.Port,
+	}
+}
+
+// GetDockerPath returns the path to the docker client found in the users
+// path.
+func GetDockerPath(context sdutils.AppContext) (string, error) {
+	dockerPath, err := exec.LookPath("docker")
+	if err != nil {
+		return "", fmt.Errorf("The docker client could not be found: %s", err)
+	}
+	return dockerPath, nil
+}
@@ -0,0 +1,200 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+var (
+	fakeDockerOutput = "testdep-sdhome0\ntestdep-sdhome1\ntestdep-sd0\ntestdep-sd1\ntestdep-zk0\ntestdep-net\n"
+)
+
+func makeTestDeployment(t *testing.T, dir string, plugin *dockerPlugin) (*sdutils.TestContext, *dockerDeploymentDescription) {
+	app := sdutils.TestContext{
+		ConfigDir: dir,
+		Version:   "4.2",
+	}
+	baseD := sdutils.BaseDeployment{
+		Type:      plugin.GetName(),
+		Name:      "testdep",
+		Directory: sdutils.DeploymentDir(dir, "testdep"),
+		Version:   "4.2",
+	}
+	os.MkdirAll(baseD.Directory, 0755)
+	d, err := plugin.DeploymentLoader(&app, &baseD, true)
+	if err != nil {
+		t.Fatalf("Failed to make the deployment %s", err)
+	}
+	return &app, d.(*dockerDeploymentDescription)
+}
+
+func setFakeDocker(t *testing.T, dir string, rc int) (string, func()) {
+	exeDir, _, err := MakeTestDocker(rc, fakeDockerOutput, dir)
+	if err != nil {
+		t.Fatalf("Failed to make the fake docker %s", err)
+	}
+	pathSave := os.Getenv("PATH")
+	os.Setenv("PATH", fmt.Sprintf("%s:%s", exeDir, pathSave))
+	return path.Join(exeDir, "params"), func() { os.Setenv("PATH", pathSave) }
+}
+
+func readParams(t *testing.T, paramsFile string) string {
+	data, err := ioutil.ReadFile(paramsFile)
+	if err != nil {
+		t.Fatalf("docker was not called %s", err)
+	}
+	return string(data)
+}
+
+func TestDeploymentLoadDefaults(t *testing.T) {
+	plugin := GetPlugin().(*dockerPlugin)
+	i := make(map[string]interface{})
+	i["image"] = "myimage"
+	i["zk_image"] = "myzk"
+	i["port"] = 5822
+
+	err := plugin.LoadDefaults(&i)
+	if err != nil {
+		t.Fatalf("Failed to load defaults %s", err)
+	}
+	if plugin.Image != "myimage" {
+		t.Fatal("image not set right")
+	}
+	if plugin.ZkImage != "myzk" {
+		t.Fatal("zk_image not set right")
+	}
+	if plugin.Port != 5822 {
+		t.Fatal("port not set right")
+	}
+}
+
+func TestDeploymentLoadNew(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	_, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+
+	plugin := GetPlugin().(*dockerPlugin)
+	plugin.Port = 6000
+	sdutils.AddCloudType(plugin)
+	app, dd := makeTestDeployment(t, dir, plugin)
+	if dd.Port != 6000 {
+		t.Fatal("The port was not set")
+	}
+	if dd.dockerDir() != path.Join(sdutils.DeploymentDir(dir, "testdep"), "docker") {
+		t.Fatalf("The docker directory is wrong %s", dd.dockerDir())
+	}
+
+	baseD := sdutils.BaseDeployment{
+		Type:      plugin.GetName(),
+		Name:      "testdep",
+		Directory: sdutils.DeploymentDir(dir, "testdep"),
+	}
+	d, err := sdutils.LoadDeployment(app, &baseD, false)
+	if err != nil {
+		t.Fatalf("Failed to load the deployment %s", err)
+	}
+	dd2 := d.(*dockerDeploymentDescription)
+	if dd2.Port != 6000 || dd2.Image != plugin.Image || dd2.Version != "4.2" {
+		t.Fatalf("The deployment was not loaded properly %v", dd2)
+	}
+}
+
+func TestDeploymentBadOptions(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	app := sdutils.TestContext{
+		ConfigDir: dir,
+		Version:   "4.2",
+	}
+	plugin := GetPlugin().(*dockerPlugin)
+	baseD := sdutils.BaseDeployment{
+		Type:         plugin.GetName(),
+		Name:         "testdep",
+		Version:      "4.2",
+		CustomScript: "/some/script",
+	}
+	_, err := newDockerDeploymentDescription(&app, &baseD, plugin)
+	if err == nil {
+		t.Fatal("Custom scripts should not be allowed")
+	}
+	baseD.CustomScript = ""
+	plugin.Port = 0
+	_, err = newDockerDeploymentDescription(&app, &baseD, plugin)
+	if err == nil {
+		t.Fatal("A bad port should not be allowed")
+	}
+}
+
+func TestFindLeaks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	paramsFile, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+	app := sdutils.TestContext{
+		ConfigDir: dir,
+		Version:   "4.2",
+	}
+
+	plugin := GetPlugin()
+	err := plugin.FindLeaks(&app, "testdep", false, false)
+	if err != nil {
+		t.Fatalf("Failed to look for leaks %s", err)
+	}
+	params := readParams(t, paramsFile)
+	if strings.Contains(params, " rm ") {
+		t.Fatal("Nothing should have been removed")
+	}
+	if !strings.Contains(params, "label=graviton.deployment=testdep") {
+		t.Fatalf("The deployment label was not used %s", params)
+	}
+
+	err = plugin.FindLeaks(&app, "testdep", true, true)
+	if err != nil {
+		t.Fatalf("Failed to destroy leaks %s", err)
+	}
+	params = readParams(t, paramsFile)
+	if !strings.Contains(params, "rm -f -v testdep-sd0") {
+		t.Fatalf("The container was not removed %s", params)
+	}
+	if !strings.Contains(params, "volume rm testdep-sdhome0") {
+		t.Fatalf("The volume was not removed %s", params)
+	}
+}
+
+func TestCompareNames(t *testing.T) {
+	items := compareNames("volumes", "volume", []string{"testdep-sdhome0", "testdep-sdhome2"}, []string{"testdep-sdhome0", "testdep-sdhome1"})
+	if len(items) != 2 {
+		t.Fatalf("There should be one missing and one extra volume %v", items)
+	}
+	if items[0].Kind != sdutils.DriftMissing || items[0].Resource != "volume testdep-sdhome2" {
+		t.Fatalf("The missing volume is wrong %v", items[0])
+	}
+	if items[1].Kind != sdutils.DriftExtra || items[1].Resource != "volume testdep-sdhome1" {
+		t.Fatalf("The extra volume is wrong %v", items[1])
+	}
+	if len(compareNames("volumes", "volume", []string{"a"}, []string{"a"})) != 0 {
+		t.Fatal("The same names are not drift")
+	}
+}
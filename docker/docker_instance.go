@@ -0,0 +1,665 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+const (
+	frontEndImage = "nginx:stable-alpine"
+	stardogPort   = 5821
+)
+
+var (
+	nginxConfTemplate = `events {}
+http {
+    upstream stardog {
+%s    }
+    server {
+        listen %d;
+        client_max_body_size 0;
+        proxy_read_timeout %ds;
+        proxy_send_timeout %ds;
+        location / {
+            proxy_pass http://stardog;
+        }
+    }
+}
+`
+)
+
+// DockerInstance represents the set of containers running a Stardog cluster
+// on a docker engine.
+type DockerInstance struct {
+	DeploymentName  string             `json:"deployment_name,omitempty"`
+	Image           string             `json:"image,omitempty"`
+	ZkImage         string             `json:"zk_image,omitempty"`
+	ZkSize          int                `json:"zookeeper_size,omitempty"`
+	SdSize          int                `json:"stardog_size,omitempty"`
+	Port            int                `json:"port,omitempty"`
+	BindAddress     string             `json:"bind_address,omitempty"`
+	IdleTimeout     int                `json:"idle_timeout,omitempty"`
+	Environment     []string           `json:"environment,omitempty"`
+	StartOpts       []string           `json:"stardog_start_opts,omitempty"`
+	Network         string             `json:"network,omitempty"`
+	ZkNodes         []string           `json:"zookeeper_nodes,omitempty"`
+	StardogNodes    []string           `json:"stardog_nodes,omitempty"`
+	FrontEnd        string             `json:"front_end,omitempty"`
+	Stopped         bool               `json:"stopped,omitempty"`
+	WorkDir         string             `json:"-"`
+	Ctx             sdutils.AppContext `json:"-"`
+	customPropsData string
+	customLog4J     string
+}
+
+// InstanceStatusDescription describes details about a running Stardog instance.
+// The containers that are currently running are listed.
+type InstanceStatusDescription struct {
+	ZkNodesContact []string
+	StardogNodes   []string
+}
+
+// NewDockerInstance instanciates a DockerInstance object which will be used to
+// start or inspect the Stardog containers.
+func NewDockerInstance(ctx sdutils.AppContext, dd *dockerDeploymentDescription) (*DockerInstance, error) {
+	customData := ""
+	if dd.customPropFile != "" {
+		data, err := ioutil.ReadFile(dd.customPropFile)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid custom properties file: %s", err)
+		}
+		customData = string(data)
+	}
+	customLog4J := ""
+	if dd.customLog4J != "" {
+		p, err := filepath.Abs(dd.customLog4J)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid custom log4j file: %s", err)
+		}
+		customLog4J = p
+	}
+
+	instance := DockerInstance{
+		DeploymentName:  dd.Name,
+		Image:           fmt.Sprintf("%s:%s", dd.Image, dd.Version),
+		ZkImage:         dd.ZkImage,
+		Port:            dd.Port,
+		Network:         fmt.Sprintf("%s-net", dd.Name),
+		FrontEnd:        fmt.Sprintf("%s-sdlb", dd.Name),
+		WorkDir:         dd.dockerDir(),
+		Ctx:             ctx,
+		customPropsData: customData,
+		customLog4J:     customLog4J,
+	}
+	for _, env := range dd.environment {
+		instance.Environment = append(instance.Environment, unquoteEnv(env))
+	}
+	if dd.disableSecurity {
+		instance.StartOpts = []string{"--disable-security"}
+	}
+	return &instance, nil
+}
+
+// unquoteEnv strips the shell quoting that graviton adds to environment
+// values because docker passes them through verbatim.
+func unquoteEnv(env string) string {
+	kv := strings.SplitN(env, "=", 2)
+	if len(kv) != 2 {
+		return env
+	}
+	v := kv[1]
+	if len(v) > 1 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		v = v[1 : len(v)-1]
+	}
+	return fmt.Sprintf("%s=%s", kv[0], v)
+}
+
+// bindAddress maps the CIDR used by the other plugins onto a docker host
+// interface.  Docker cannot filter by source address so anything other than
+// a fully open mask is only published on the loopback interface.
+func bindAddress(mask string) string {
+	if mask == "0.0.0.0/0" {
+		return "0.0.0.0"
+	}
+	return "127.0.0.1"
+}
+
+// dockerHost returns the address at which published ports can be reached.
+func dockerHost() string {
+	u, err := url.Parse(os.Getenv("DOCKER_HOST"))
+	if err == nil && u.Scheme == "tcp" && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "127.0.0.1"
+}
+
+func (di *DockerInstance) confPath() string {
+	return path.Join(di.WorkDir, "instance.json")
+}
+
+func (di *DockerInstance) load() error {
+	if !di.InstanceExists() {
+		return errors.New("There is no configured instance")
+	}
+	ctx := di.Ctx
+	workDir := di.WorkDir
+	customPropsData := di.customPropsData
+	customLog4J := di.customLog4J
+	err := sdutils.LoadJSON(di, di.confPath())
+	if err != nil {
+		return err
+	}
+	di.Ctx = ctx
+	di.WorkDir = workDir
+	di.customPropsData = customPropsData
+	di.customLog4J = customLog4J
+	return nil
+}
+
+func (di *DockerInstance) zkServers() string {
+	servers := make([]string, len(di.ZkNodes))
+	for i, n := range di.ZkNodes {
+		servers[i] = fmt.Sprintf("%s:2181", n)
+	}
+	return strings.Join(servers, ",")
+}
+
+func (di *DockerInstance) writeStardogProperties(ndx int) (string, error) {
+	props := fmt.Sprintf("pack.enabled=true\npack.node.address=%s\npack.zookeeper.address=%s\n%s\n",
+		di.StardogNodes[ndx], di.zkServers(), di.customPropsData)
+	propsPath := path.Join(di.WorkDir, fmt.Sprintf("stardog%d.properties", ndx))
+	err := ioutil.WriteFile(propsPath, []byte(props), 0644)
+	if err != nil {
+		return "", err
+	}
+	return propsPath, nil
+}
+
+func (di *DockerInstance) writeFrontEndConf() (string, error) {
+	var upstream bytes.Buffer
+	for _, n := range di.StardogNodes {
+		upstream.WriteString(fmt.Sprintf("        server %s:%d;\n", n, stardogPort))
+	}
+	conf := fmt.Sprintf(nginxConfTemplate, upstream.String(), stardogPort, di.IdleTimeout, di.IdleTimeout)
+	confPath := path.Join(di.WorkDir, "nginx.conf")
+	err := ioutil.WriteFile(confPath, []byte(conf), 0644)
+	if err != nil {
+		return "", err
+	}
+	return confPath, nil
+}
+
+func (di *DockerInstance) removeContainer(name string) {
+	err := runDocker(di.Ctx, nil, "rm", "-f", name)
+	if err != nil {
+		di.Ctx.Logf(sdutils.DEBUG, "The container %s was not removed: %s", name, err)
+	}
+}
+
+func (di *DockerInstance) runContainer(spin *sdutils.Spinner, name string, opts []string, image string, args ...string) error {
+	di.removeContainer(name)
+	cmdArray := []string{"run", "-d",
+		"--name", name,
+		"--hostname", name,
+		"--network", di.Network,
+		"--label", labelArg(di.DeploymentName),
+	}
+	cmdArray = append(cmdArray, opts...)
+	cmdArray = append(cmdArray, image)
+	cmdArray = append(cmdArray, args...)
+	return runDocker(di.Ctx, spin, cmdArray...)
+}
+
+func (di *DockerInstance) ensureNetwork() error {
+	names, err := dockerOutput(di.Ctx, "network", "ls", "--filter", fmt.Sprintf("name=^%s$", di.Network), "--format", "{{.Name}}")
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return nil
+	}
+	return runDocker(di.Ctx, nil, "network", "create", "--label", labelArg(di.DeploymentName), di.Network)
+}
+
+func (di *DockerInstance) startFrontEnd(spin *sdutils.Spinner) error {
+	confPath, err := di.writeFrontEndConf()
+	if err != nil {
+		return err
+	}
+	opts := []string{
+		"-p", fmt.Sprintf("%s:%d:%d", di.BindAddress, di.Port, stardogPort),
+		"-v", fmt.Sprintf("%s:/etc/nginx/nginx.conf:ro", confPath),
+	}
+	return di.runContainer(spin, di.FrontEnd, opts, frontEndImage)
+}
+
+// CreateInstance will start the zookeeper and Stardog containers and a front
+// end that is only published on the loopback interface.
+func (di *DockerInstance) CreateInstance(zookeeperSize int, idleTimeout int) error {
+	vols, err := LoadDockerVolumes(di.Ctx, di.WorkDir)
+	if err != nil {
+		return fmt.Errorf("No volume information exists for %s", di.DeploymentName)
+	}
+	if zookeeperSize < 1 {
+		return errors.New("At least one zookeeper node is required")
+	}
+	di.SdSize = vols.ClusterSize
+	di.ZkSize = zookeeperSize
+	di.IdleTimeout = idleTimeout
+	di.BindAddress = bindAddress("")
+	di.ZkNodes = make([]string, zookeeperSize, zookeeperSize)
+	for i := range di.ZkNodes {
+		di.ZkNodes[i] = fmt.Sprintf("%s-zk%d", di.DeploymentName, i)
+	}
+	di.StardogNodes = make([]string, di.SdSize, di.SdSize)
+	for i := range di.StardogNodes {
+		di.StardogNodes[i] = fmt.Sprintf("%s-sd%d", di.DeploymentName, i)
+	}
+
+	if di.InstanceExists() {
+		di.Ctx.ConsoleLog(1, "The instance already exists.\n")
+		di.Ctx.Logf(sdutils.INFO, "The instance already exists.")
+	}
+	err = sdutils.WriteJSON(di, di.confPath())
+	if err != nil {
+		return err
+	}
+	err = di.ensureNetwork()
+	if err != nil {
+		return err
+	}
+
+	spin := sdutils.NewSpinner(di.Ctx, 1, "Creating the instance containers...")
+	for i := range di.ZkNodes {
+		err = di.startZookeeperNode(spin, i)
+		if err != nil {
+			di.Ctx.ConsoleLog(1, "Failed to create the instance.\n")
+			return err
+		}
+	}
+	for i := range di.StardogNodes {
+		err = di.startStardogNode(spin, i, vols)
+		if err != nil {
+			di.Ctx.ConsoleLog(1, "Failed to create the instance.\n")
+			return err
+		}
+	}
+	err = di.startFrontEnd(spin)
+	if err != nil {
+		di.Ctx.ConsoleLog(1, "Failed to create the instance.\n")
+		return err
+	}
+	di.Ctx.ConsoleLog(1, "Successfully created the instance.\n")
+	return nil
+}
+
+// PlanInstance reports the containers that CreateInstance would start.  The
+// containers of an existing instance are replaced.
+func (di *DockerInstance) PlanInstance(clusterSize int, zookeeperSize int) (*sdutils.PlanSummary, error) {
+	if zookeeperSize < 1 {
+		return nil, errors.New("At least one zookeeper node is required")
+	}
+	plan := sdutils.NewPlanSummary()
+	if di.InstanceExists() {
+		err := di.load()
+		if err != nil {
+			return nil, err
+		}
+		plan.Record(sdutils.PlanDestroy, "docker_container", len(di.ZkNodes)+len(di.StardogNodes)+1)
+	} else {
+		plan.Record(sdutils.PlanAdd, "docker_network", 1)
+	}
+	plan.Record(sdutils.PlanAdd, "docker_container", zookeeperSize+clusterSize+1)
+	return plan, nil
+}
+
+func (di *DockerInstance) startZookeeperNode(spin *sdutils.Spinner, ndx int) error {
+	zkServers := make([]string, len(di.ZkNodes))
+	for i, n := range di.ZkNodes {
+		zkServers[i] = fmt.Sprintf("server.%d=%s:2888:3888", i+1, n)
+	}
+	opts := []string{
+		"-e", fmt.Sprintf("ZOO_MY_ID=%d", ndx+1),
+		"-e", fmt.Sprintf("ZOO_SERVERS=%s", strings.Join(zkServers, " ")),
+	}
+	return di.runContainer(spin, di.ZkNodes[ndx], opts, di.ZkImage)
+}
+
+func (di *DockerInstance) startStardogNode(spin *sdutils.Spinner, ndx int, vols *DockerVolumes) error {
+	propsPath, err := di.writeStardogProperties(ndx)
+	if err != nil {
+		return err
+	}
+	opts := []string{
+		"-v", fmt.Sprintf("%s:%s", vols.VolumeNames[ndx], stardogHome),
+		"-v", fmt.Sprintf("%s:%s:ro", propsPath, path.Join(stardogHome, "stardog.properties")),
+		"-e", fmt.Sprintf("STARDOG_HOME=%s", stardogHome),
+	}
+	if di.customLog4J != "" {
+		opts = append(opts, "-v", fmt.Sprintf("%s:%s:ro", di.customLog4J, path.Join(stardogHome, "log4j2.xml")))
+	}
+	for _, env := range di.Environment {
+		opts = append(opts, "-e", env)
+	}
+	return di.runContainer(spin, di.StardogNodes[ndx], opts, di.Image, di.StartOpts...)
+}
+
+// Resize starts or removes Stardog containers so that clusterSize of them run
+// and points the front end at the new set of nodes.  A volume must already
+// exist for every node.
+func (di *DockerInstance) Resize(clusterSize int) error {
+	err := di.load()
+	if err != nil {
+		return err
+	}
+	vols, err := LoadDockerVolumes(di.Ctx, di.WorkDir)
+	if err != nil {
+		return fmt.Errorf("No volume information exists for %s", di.DeploymentName)
+	}
+	if clusterSize > len(vols.VolumeNames) {
+		return fmt.Errorf("Only %d volumes exist for %d nodes", len(vols.VolumeNames), clusterSize)
+	}
+	spin := sdutils.NewSpinner(di.Ctx, 1, "Resizing the instance containers...")
+	for len(di.StardogNodes) > clusterSize {
+		di.removeContainer(di.StardogNodes[len(di.StardogNodes)-1])
+		di.StardogNodes = di.StardogNodes[:len(di.StardogNodes)-1]
+	}
+	for i := len(di.StardogNodes); i < clusterSize; i++ {
+		di.StardogNodes = append(di.StardogNodes, fmt.Sprintf("%s-sd%d", di.DeploymentName, i))
+		err = di.startStardogNode(spin, i, vols)
+		if err != nil {
+			di.Ctx.ConsoleLog(1, "Failed to resize the instance.\n")
+			return err
+		}
+	}
+	di.SdSize = clusterSize
+	err = sdutils.WriteJSON(di, di.confPath())
+	if err != nil {
+		return err
+	}
+	err = di.startFrontEnd(spin)
+	if err != nil {
+		di.Ctx.ConsoleLog(1, "Failed to resize the instance.\n")
+		return err
+	}
+	di.Ctx.ConsoleLog(1, "Successfully resized the instance.\n")
+	return nil
+}
+
+// UpdateImage records the image that Stardog containers are started from
+// along with the environment and the start options of the deployment.
+func (di *DockerInstance) UpdateImage(image string) error {
+	environment := di.Environment
+	startOpts := di.StartOpts
+	err := di.load()
+	if err != nil {
+		return err
+	}
+	di.Environment = environment
+	di.StartOpts = startOpts
+	if di.Image == image {
+		di.Ctx.ConsoleLog(1, "The deployment already uses the image %s.\n", image)
+	} else {
+		di.Ctx.ConsoleLog(1, "Moving the deployment from the image %s to %s.\n", di.Image, image)
+	}
+	di.Image = image
+	return sdutils.WriteJSON(di, di.confPath())
+}
+
+// ReplaceStardogNode recreates the Stardog container at index ndx from the
+// current image.  The container is attached to the same data volume.
+func (di *DockerInstance) ReplaceStardogNode(ndx int) error {
+	err := di.load()
+	if err != nil {
+		return err
+	}
+	if ndx < 0 || ndx >= len(di.StardogNodes) {
+		return fmt.Errorf("There is no Stardog node %d", ndx)
+	}
+	vols, err := LoadDockerVolumes(di.Ctx, di.WorkDir)
+	if err != nil {
+		return fmt.Errorf("No volume information exists for %s", di.DeploymentName)
+	}
+	spin := sdutils.NewSpinner(di.Ctx, 1, "Replacing the stardog container...")
+	di.removeContainer(di.StardogNodes[ndx])
+	err = di.startStardogNode(spin, ndx, vols)
+	if err != nil {
+		return err
+	}
+	di.Ctx.ConsoleLog(1, "Successfully replaced stardog node %d.\n", ndx)
+	return nil
+}
+
+// ReplaceZookeeperNode recreates the zookeeper container at index ndx for an
+// ensemble of zookeeperSize nodes.  If ndx is outside of the new ensemble the
+// container is removed.  The Stardog properties files are rewritten with the
+// new connection string and are picked up when the Stardog nodes restart.
+func (di *DockerInstance) ReplaceZookeeperNode(zookeeperSize int, ndx int) error {
+	err := di.load()
+	if err != nil {
+		return err
+	}
+	if zookeeperSize < 1 {
+		return errors.New("At least one zookeeper node is required")
+	}
+	spin := sdutils.NewSpinner(di.Ctx, 1, "Replacing the zookeeper container...")
+	if ndx >= zookeeperSize {
+		di.removeContainer(fmt.Sprintf("%s-zk%d", di.DeploymentName, ndx))
+	}
+	if len(di.ZkNodes) > zookeeperSize {
+		di.ZkNodes = di.ZkNodes[:zookeeperSize]
+	}
+	for i := len(di.ZkNodes); i < zookeeperSize; i++ {
+		di.ZkNodes = append(di.ZkNodes, fmt.Sprintf("%s-zk%d", di.DeploymentName, i))
+	}
+	di.ZkSize = zookeeperSize
+	if ndx < zookeeperSize {
+		err = di.startZookeeperNode(spin, ndx)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range di.StardogNodes {
+		_, err = di.writeStardogProperties(i)
+		if err != nil {
+			return err
+		}
+	}
+	err = sdutils.WriteJSON(di, di.confPath())
+	if err != nil {
+		return err
+	}
+	di.Ctx.ConsoleLog(1, "Successfully replaced zookeeper node %d.\n", ndx)
+	return nil
+}
+
+// OpenInstance will republish the front end so that it can be reached from
+// outside of the docker host if the mask allows it.
+func (di *DockerInstance) OpenInstance(mask string, idleTimeout int) error {
+	err := di.load()
+	if err != nil {
+		return err
+	}
+	di.BindAddress = bindAddress(mask)
+	if di.BindAddress == "127.0.0.1" && mask != "" {
+		di.Ctx.Logf(sdutils.INFO, "docker cannot limit access to %s, publishing on the loopback interface only", mask)
+	}
+	di.IdleTimeout = idleTimeout
+	err = sdutils.WriteJSON(di, di.confPath())
+	if err != nil {
+		return err
+	}
+	spin := sdutils.NewSpinner(di.Ctx, 1, "Opening the front end...")
+	err = di.startFrontEnd(spin)
+	if err != nil {
+		di.Ctx.ConsoleLog(1, "Failed to open up the instance.\n")
+		return err
+	}
+	di.Ctx.ConsoleLog(1, "Successfully opened up the instance.\n")
+	return nil
+}
+
+// Stop stops the front end, the Stardog and the zookeeper containers in that
+// order.  The containers and the volumes are kept.
+func (di *DockerInstance) Stop() error {
+	err := di.load()
+	if err != nil {
+		return err
+	}
+	names := append([]string{di.FrontEnd}, di.StardogNodes...)
+	names = append(names, di.ZkNodes...)
+	spin := sdutils.NewSpinner(di.Ctx, 1, "Stopping the instance containers")
+	err = runDocker(di.Ctx, spin, append([]string{"stop"}, names...)...)
+	if err != nil {
+		di.Ctx.ConsoleLog(1, "Failed to stop the instance.\n")
+		return err
+	}
+	di.Stopped = true
+	err = sdutils.WriteJSON(di, di.confPath())
+	if err != nil {
+		return err
+	}
+	di.Ctx.ConsoleLog(1, "Successfully stopped the instance.\n")
+	return nil
+}
+
+// Start starts the containers stopped by Stop, zookeeper first.
+func (di *DockerInstance) Start() error {
+	err := di.load()
+	if err != nil {
+		return err
+	}
+	names := append([]string{}, di.ZkNodes...)
+	names = append(names, di.StardogNodes...)
+	names = append(names, di.FrontEnd)
+	spin := sdutils.NewSpinner(di.Ctx, 1, "Starting the instance containers")
+	err = runDocker(di.Ctx, spin, append([]string{"start"}, names...)...)
+	if err != nil {
+		di.Ctx.ConsoleLog(1, "Failed to start the instance.\n")
+		return err
+	}
+	di.Stopped = false
+	err = sdutils.WriteJSON(di, di.confPath())
+	if err != nil {
+		return err
+	}
+	di.Ctx.ConsoleLog(1, "Successfully started the instance.\n")
+	return nil
+}
+
+// DeleteInstance will remove all of the containers and the network.  The
+// volumes are left in place.
+func (di *DockerInstance) DeleteInstance() error {
+	err := di.load()
+	if err != nil {
+		return err
+	}
+	names := append([]string{di.FrontEnd}, di.StardogNodes...)
+	names = append(names, di.ZkNodes...)
+	spin := sdutils.NewSpinner(di.Ctx, 1, "Deleting the instance containers")
+	for _, n := range names {
+		err = runDocker(di.Ctx, spin, "rm", "-f", n)
+		if err != nil {
+			di.Ctx.Logf(sdutils.WARN, "Failed to remove the container %s: %s", n, err)
+		}
+	}
+	err = runDocker(di.Ctx, spin, "network", "rm", di.Network)
+	if err != nil {
+		return err
+	}
+	os.Remove(di.confPath())
+	di.Ctx.ConsoleLog(1, "Successfully destroyed the instance.\n")
+	return nil
+}
+
+// PlanDelete reports the containers and the network that DeleteInstance
+// would remove.
+func (di *DockerInstance) PlanDelete() (*sdutils.PlanSummary, error) {
+	err := di.load()
+	if err != nil {
+		return nil, err
+	}
+	plan := sdutils.NewPlanSummary()
+	plan.Record(sdutils.PlanDestroy, "docker_container", len(di.ZkNodes)+len(di.StardogNodes)+1)
+	plan.Record(sdutils.PlanDestroy, "docker_network", 1)
+	return plan, nil
+}
+
+// InstanceExists will return a bool if the associated DockerInstance has
+// already been created.
+func (di *DockerInstance) InstanceExists() bool {
+	return sdutils.PathExists(di.confPath())
+}
+
+func (di *DockerInstance) getStatusInformation() (*InstanceStatusDescription, error) {
+	err := di.load()
+	if err != nil {
+		return nil, err
+	}
+	running, err := dockerOutput(di.Ctx, "ps", "--filter", labelFilter(di.DeploymentName), "--filter", "status=running", "--format", "{{.Names}}")
+	if err != nil {
+		return nil, err
+	}
+	runningMap := make(map[string]bool)
+	for _, n := range running {
+		runningMap[n] = true
+	}
+	s := InstanceStatusDescription{}
+	for _, n := range di.ZkNodes {
+		if runningMap[n] {
+			s.ZkNodesContact = append(s.ZkNodesContact, fmt.Sprintf("%s:2181", n))
+		}
+	}
+	for _, n := range di.StardogNodes {
+		if runningMap[n] {
+			s.StardogNodes = append(s.StardogNodes, n)
+		}
+	}
+	return &s, nil
+}
+
+// Status will print the status of the containers.
+func (di *DockerInstance) Status() error {
+	s, err := di.getStatusInformation()
+	if err != nil {
+		return err
+	}
+	di.Ctx.SetResult(&sdutils.StardogDescription{
+		StardogURL:          fmt.Sprintf("http://%s:%d", dockerHost(), di.Port),
+		InstanceDescription: s,
+	})
+	di.Ctx.ConsoleLog(1, "Stardog: %s\n", fmt.Sprintf("http://%s:%d", dockerHost(), di.Port))
+	di.Ctx.ConsoleLog(1, "Running stardog containers: %d of %d\n", len(s.StardogNodes), len(di.StardogNodes))
+	for _, n := range s.StardogNodes {
+		di.Ctx.ConsoleLog(1, "\t%s\n", n)
+	}
+	di.Ctx.ConsoleLog(1, "Running zookeeper containers: %d of %d\n", len(s.ZkNodesContact), len(di.ZkNodes))
+	for _, n := range s.ZkNodesContact {
+		di.Ctx.ConsoleLog(1, "\t%s\n", n)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestUnquoteEnv(t *testing.T) {
+	tests := map[string]string{
+		`A="a b"`: "A=a b",
+		`B='x'`:   "B=x",
+		`C=plain`: "C=plain",
+		`D="`:     `D="`,
+		`E`:       "E",
+	}
+	for in, out := range tests {
+		if unquoteEnv(in) != out {
+			t.Fatalf("%s became %s not %s", in, unquoteEnv(in), out)
+		}
+	}
+}
+
+func TestBindAddress(t *testing.T) {
+	if bindAddress("0.0.0.0/0") != "0.0.0.0" {
+		t.Fatal("An open mask should bind all interfaces")
+	}
+	if bindAddress("10.0.0.0/8") != "127.0.0.1" {
+		t.Fatal("A restricted mask should bind the loopback interface")
+	}
+}
+
+func TestInstanceNoVolumes(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	_, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+
+	_, dd := makeTestDeployment(t, dir, GetPlugin().(*dockerPlugin))
+	if dd.InstanceExists() {
+		t.Fatal("The instance should not exist")
+	}
+	err := dd.CreateInstance(0, 1, 60, "")
+	if err == nil {
+		t.Fatal("The instance cannot be created without volumes")
+	}
+	err = dd.StatusInstance()
+	if err == nil {
+		t.Fatal("Status should fail without an instance")
+	}
+	err = dd.DeleteInstance()
+	if err == nil {
+		t.Fatal("Delete should fail without an instance")
+	}
+}
+
+func TestInstanceLifecycle(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	paramsFile, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+
+	licensePath := path.Join(dir, "license")
+	ioutil.WriteFile(licensePath, []byte("license"), 0600)
+
+	_, dd := makeTestDeployment(t, dir, GetPlugin().(*dockerPlugin))
+	dd.environment = []string{`JAVA_OPTS="-Xmx1g"`}
+	err := dd.CreateVolumeSet(licensePath, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to create the volumes %s", err)
+	}
+	err = dd.CreateInstance(0, 1, 60, "")
+	if err != nil {
+		t.Fatalf("Failed to create the instance %s", err)
+	}
+	if !dd.InstanceExists() {
+		t.Fatal("The instance should exist")
+	}
+	params := readParams(t, paramsFile)
+	for _, expected := range []string{
+		"--name testdep-zk0",
+		"ZOO_SERVERS=server.1=testdep-zk0:2888:3888",
+		"--name testdep-sd1",
+		"-v testdep-sdhome1:/var/opt/stardog",
+		"-e JAVA_OPTS=-Xmx1g",
+		"-p 127.0.0.1:5821:5821",
+	} {
+		if !strings.Contains(params, expected) {
+			t.Fatalf("Expected %s in %s", expected, params)
+		}
+	}
+	props, err := ioutil.ReadFile(path.Join(dd.dockerDir(), "stardog1.properties"))
+	if err != nil {
+		t.Fatalf("The properties were not written %s", err)
+	}
+	if !strings.Contains(string(props), "pack.node.address=testdep-sd1") ||
+		!strings.Contains(string(props), "pack.zookeeper.address=testdep-zk0:2181") {
+		t.Fatalf("The properties are wrong %s", string(props))
+	}
+	conf, err := ioutil.ReadFile(path.Join(dd.dockerDir(), "nginx.conf"))
+	if err != nil {
+		t.Fatalf("The front end configuration was not written %s", err)
+	}
+	if !strings.Contains(string(conf), "server testdep-sd0:5821;") || !strings.Contains(string(conf), "proxy_read_timeout 60s;") {
+		t.Fatalf("The front end configuration is wrong %s", string(conf))
+	}
+
+	err = dd.OpenInstance(0, 1, "0.0.0.0/0", 120)
+	if err != nil {
+		t.Fatalf("Failed to open the instance %s", err)
+	}
+	params = readParams(t, paramsFile)
+	if !strings.Contains(params, "-p 0.0.0.0:5821:5821") {
+		t.Fatalf("The front end was not opened %s", params)
+	}
+
+	sd, err := dd.FullStatus()
+	if err != nil {
+		t.Fatalf("Failed to get the status %s", err)
+	}
+	if sd.StardogURL != "http://127.0.0.1:5821" || sd.SSHHost != "" {
+		t.Fatalf("The status is wrong %v", sd)
+	}
+	instS := sd.InstanceDescription.(*InstanceStatusDescription)
+	if len(instS.StardogNodes) != 2 || len(instS.ZkNodesContact) != 1 {
+		t.Fatalf("The running containers are wrong %v", instS)
+	}
+	err = dd.StatusInstance()
+	if err != nil {
+		t.Fatalf("Status failed %s", err)
+	}
+
+	err = dd.StopInstance()
+	if err != nil {
+		t.Fatalf("Failed to stop the instance %s", err)
+	}
+	params = readParams(t, paramsFile)
+	if !strings.Contains(params, "stop testdep-sdlb testdep-sd0 testdep-sd1 testdep-zk0") {
+		t.Fatalf("The containers were not stopped in order %s", params)
+	}
+	err = dd.StartInstance()
+	if err != nil {
+		t.Fatalf("Failed to start the instance %s", err)
+	}
+	params = readParams(t, paramsFile)
+	if !strings.Contains(params, "start testdep-zk0 testdep-sd0 testdep-sd1 testdep-sdlb") {
+		t.Fatalf("The containers were not started in order %s", params)
+	}
+	if !dd.InstanceExists() {
+		t.Fatal("Stopping must keep the instance")
+	}
+
+	err = dd.DeleteInstance()
+	if err != nil {
+		t.Fatalf("Failed to delete the instance %s", err)
+	}
+	if dd.InstanceExists() {
+		t.Fatal("The instance should not exist")
+	}
+	params = readParams(t, paramsFile)
+	if !strings.Contains(params, "network rm testdep-net") {
+		t.Fatalf("The network was not removed %s", params)
+	}
+}
+
+func TestInstanceReplaceZookeeper(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	paramsFile, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+
+	licensePath := path.Join(dir, "license")
+	ioutil.WriteFile(licensePath, []byte("license"), 0600)
+
+	_, dd := makeTestDeployment(t, dir, GetPlugin().(*dockerPlugin))
+	err := dd.CreateVolumeSet(licensePath, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to create the volumes %s", err)
+	}
+	err = dd.CreateInstance(0, 1, 60, "")
+	if err != nil {
+		t.Fatalf("Failed to create the instance %s", err)
+	}
+	for ndx := 1; ndx < 3; ndx++ {
+		err = dd.ReplaceZookeeperNode(3, ndx)
+		if err != nil {
+			t.Fatalf("Failed to add zookeeper node %d %s", ndx, err)
+		}
+	}
+	zkSize, err := dd.ZookeeperSize()
+	if err != nil || zkSize != 3 {
+		t.Fatalf("The zookeeper size should be 3 not %d %v", zkSize, err)
+	}
+	params := readParams(t, paramsFile)
+	if !strings.Contains(params, "--name testdep-zk2") ||
+		!strings.Contains(params, "ZOO_SERVERS=server.1=testdep-zk0:2888:3888 server.2=testdep-zk1:2888:3888 server.3=testdep-zk2:2888:3888") {
+		t.Fatalf("The new zookeeper node was not started %s", params)
+	}
+	props, err := ioutil.ReadFile(path.Join(dd.dockerDir(), "stardog0.properties"))
+	if err != nil {
+		t.Fatalf("The properties were not written %s", err)
+	}
+	if !strings.Contains(string(props), "pack.zookeeper.address=testdep-zk0:2181,testdep-zk1:2181,testdep-zk2:2181") {
+		t.Fatalf("The properties were not updated %s", string(props))
+	}
+
+	err = dd.ReplaceZookeeperNode(1, 2)
+	if err != nil {
+		t.Fatalf("Failed to remove zookeeper node 2 %s", err)
+	}
+	params = readParams(t, paramsFile)
+	if !strings.Contains(params, "rm -f testdep-zk2") {
+		t.Fatalf("The zookeeper node was not removed %s", params)
+	}
+	zkSize, _ = dd.ZookeeperSize()
+	if zkSize != 1 {
+		t.Fatalf("The zookeeper size should be 1 not %d", zkSize)
+	}
+}
+
+func TestInstanceReimage(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	paramsFile, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+
+	licensePath := path.Join(dir, "license")
+	ioutil.WriteFile(licensePath, []byte("license"), 0600)
+
+	plugin := GetPlugin().(*dockerPlugin)
+	_, dd := makeTestDeployment(t, dir, plugin)
+	err := dd.CreateVolumeSet(licensePath, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to create the volumes %s", err)
+	}
+	err = dd.CreateInstance(0, 1, 60, "")
+	if err != nil {
+		t.Fatalf("Failed to create the instance %s", err)
+	}
+	plugin.ReimageImage = "newstardog"
+	err = dd.UpdateImage()
+	if err != nil {
+		t.Fatalf("Failed to update the image %s", err)
+	}
+	err = dd.ReplaceStardogNode(1)
+	if err != nil {
+		t.Fatalf("Failed to replace the node %s", err)
+	}
+	params := readParams(t, paramsFile)
+	if !strings.Contains(params, "rm -f testdep-sd1") ||
+		!strings.Contains(params, "-v testdep-sdhome1:/var/opt/stardog") ||
+		!strings.Contains(params, "newstardog:4.2") {
+		t.Fatalf("The node was not restarted from the new image %s", params)
+	}
+	err = dd.ReplaceStardogNode(2)
+	if err == nil {
+		t.Fatal("There is no third node to replace")
+	}
+}
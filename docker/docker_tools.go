@@ -0,0 +1,148 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+// runDocker calls out to the docker client with the given arguments and
+// logs its output.
+func runDocker(c sdutils.AppContext, spin *sdutils.Spinner, args ...string) error {
+	dockerPath, err := GetDockerPath(c)
+	if err != nil {
+		return err
+	}
+	cmdArray := append([]string{dockerPath}, args...)
+	cmd := exec.Cmd{
+		Path: cmdArray[0],
+		Args: cmdArray,
+	}
+	c.Logf(sdutils.DEBUG, "Running %s", strings.Join(cmdArray, " "))
+	_, err = sdutils.RunCommand(c, cmd, nil, spin)
+	return err
+}
+
+// dockerOutput calls out to the docker client and returns the non-empty
+// lines that it wrote to stdout.
+func dockerOutput(c sdutils.AppContext, args ...string) ([]string, error) {
+	dockerPath, err := GetDockerPath(c)
+	if err != nil {
+		return nil, err
+	}
+	cmdArray := append([]string{dockerPath}, args...)
+	cmd := exec.Cmd{
+		Path: cmdArray[0],
+		Args: cmdArray,
+	}
+	c.Logf(sdutils.DEBUG, "Running %s", strings.Join(cmdArray, " "))
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{}
+	for _, l := range strings.Split(string(data), "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+func labelFilter(deploymentName string) string {
+	if deploymentName == "" {
+		return fmt.Sprintf("label=%s", deploymentLabel)
+	}
+	return fmt.Sprintf("label=%s=%s", deploymentLabel, deploymentName)
+}
+
+func labelArg(deploymentName string) string {
+	return fmt.Sprintf("%s=%s", deploymentLabel, deploymentName)
+}
+
+func (p *dockerPlugin) FindLeaks(c sdutils.AppContext, deploymentName string, destroy bool, force bool) error {
+	c.ConsoleLog(1, "Looking for docker resources\n")
+
+	filter := labelFilter(deploymentName)
+	containers, err := dockerOutput(c, "ps", "-a", "--filter", filter, "--format", "{{.Names}}")
+	if err != nil {
+		return err
+	}
+	volumes, err := dockerOutput(c, "volume", "ls", "--filter", filter, "--format", "{{.Name}}")
+	if err != nil {
+		return err
+	}
+	networks, err := dockerOutput(c, "network", "ls", "--filter", filter, "--format", "{{.Name}}")
+	if err != nil {
+		return err
+	}
+
+	c.SetResult(map[string][]string{
+		"containers": containers,
+		"volumes":    volumes,
+		"networks":   networks,
+	})
+	c.ConsoleLog(1, "Found %d containers\n", len(containers))
+	for _, n := range containers {
+		c.ConsoleLog(1, "\t%s\n", n)
+	}
+	c.ConsoleLog(1, "Found %d volumes\n", len(volumes))
+	for _, n := range volumes {
+		c.ConsoleLog(1, "\t%s\n", n)
+	}
+	c.ConsoleLog(1, "Found %d networks\n", len(networks))
+	for _, n := range networks {
+		c.ConsoleLog(1, "\t%s\n", n)
+	}
+
+	if !destroy {
+		return nil
+	}
+	if !force {
+		if !sdutils.AskUserYesOrNo("Would you like to destroy these resources?") {
+			return nil
+		}
+	}
+	// Containers have to go first because they hold references to the
+	// volumes and networks.
+	for _, n := range containers {
+		err = runDocker(c, nil, "rm", "-f", "-v", n)
+		if err != nil {
+			c.Logf(sdutils.WARN, "Failed to delete the container %s, %s", n, err)
+			c.ConsoleLog(1, "Failed to delete the container %s, %s\n", n, err)
+		}
+	}
+	for _, n := range volumes {
+		err = runDocker(c, nil, "volume", "rm", n)
+		if err != nil {
+			c.Logf(sdutils.WARN, "Failed to delete the volume %s, %s", n, err)
+			c.ConsoleLog(1, "Failed to delete the volume %s, %s\n", n, err)
+		}
+	}
+	for _, n := range networks {
+		err = runDocker(c, nil, "network", "rm", n)
+		if err != nil {
+			c.Logf(sdutils.WARN, "Failed to delete the network %s, %s", n, err)
+			c.ConsoleLog(1, "Failed to delete the network %s, %s\n", n, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+const (
+	stardogHome = "/var/opt/stardog"
+)
+
+// VolumeStatusDescription is an opaque way to pass docker specific information
+// to the calling code.
+type VolumeStatusDescription struct {
+	VolumeNames []string
+}
+
+// DockerVolumes describes the named docker volumes used to store STARDOG_HOME.
+type DockerVolumes struct {
+	DeploymentName   string   `json:"deployment_name,omitempty"`
+	SizeOfEachVolume int      `json:"volume_size,omitempty"`
+	ClusterSize      int      `json:"cluster_size,omitempty"`
+	LicensePath      string   `json:"stardog_license,omitempty"`
+	Image            string   `json:"image,omitempty"`
+	VolumeNames      []string `json:"volumes,omitempty"`
+	VolumeDir        string   `json:"-"`
+	appContext       sdutils.AppContext
+}
+
+// NewDockerVolumeManager returns a DockerVolumes structure that will be used
+// by graviton to manage the volumes.
+func NewDockerVolumeManager(ac sdutils.AppContext, dd *dockerDeploymentDescription) *DockerVolumes {
+	return &DockerVolumes{
+		DeploymentName: dd.Name,
+		Image:          fmt.Sprintf("%s:%s", dd.Image, dd.Version),
+		VolumeDir:      dd.dockerDir(),
+		appContext:     ac,
+	}
+}
+
+// LoadDockerVolumes will inflate a DockerVolumes structure from the
+// information stored in the deployment directory.
+func LoadDockerVolumes(ac sdutils.AppContext, volDir string) (*DockerVolumes, error) {
+	var vols DockerVolumes
+	confFile := path.Join(volDir, "volumes.json")
+	err := sdutils.LoadJSON(&vols, confFile)
+	if err != nil {
+		return nil, err
+	}
+	vols.VolumeDir = volDir
+	vols.appContext = ac
+	return &vols, nil
+}
+
+func volumeName(deploymentName string, ndx int) string {
+	return fmt.Sprintf("%s-sdhome%d", deploymentName, ndx)
+}
+
+// VolumeExists returns true or false based on whether or not the volumes
+// already exist.
+func (v *DockerVolumes) VolumeExists() bool {
+	confFile := path.Join(v.VolumeDir, "volumes.json")
+	return sdutils.PathExists(confFile)
+}
+
+// CreateSet creates one named docker volume per Stardog node and places the
+// license in each of them.  Docker local volumes cannot be limited in size so
+// sizeOfEachVolume is only recorded.
+func (v *DockerVolumes) CreateSet(licensePath string, sizeOfEachVolume int, clusterSize int) error {
+	if clusterSize < 1 {
+		return errors.New("At least one volume is required")
+	}
+	licensePath, err := filepath.Abs(licensePath)
+	if err != nil {
+		return err
+	}
+	if !sdutils.PathExists(licensePath) {
+		return fmt.Errorf("The license file %s does not exist", licensePath)
+	}
+	v.appContext.ConsoleLog(2, "Creating a docker volume set in directory %s\n", v.VolumeDir)
+	err = os.MkdirAll(v.VolumeDir, 0755)
+	if err != nil {
+		return err
+	}
+	v.ClusterSize = clusterSize
+	v.SizeOfEachVolume = sizeOfEachVolume
+	v.LicensePath = licensePath
+	v.VolumeNames = make([]string, clusterSize, clusterSize)
+	for i := 0; i < clusterSize; i++ {
+		v.VolumeNames[i] = volumeName(v.DeploymentName, i)
+	}
+
+	confFile := path.Join(v.VolumeDir, "volumes.json")
+	if sdutils.PathExists(confFile) {
+		v.appContext.ConsoleLog(1, "Volumes have already been created for the %s deployment, creating them again.", v.DeploymentName)
+		v.appContext.Logf(sdutils.WARN, "Volumes have already been created for the %s deployment, creating them again.", v.DeploymentName)
+	}
+	err = sdutils.WriteJSON(v, confFile)
+	if err != nil {
+		return err
+	}
+
+	spin := sdutils.NewSpinner(v.appContext, 1, "Calling out to docker to create the volumes")
+	for _, name := range v.VolumeNames {
+		err = v.createVolume(spin, name)
+		if err != nil {
+			return err
+		}
+	}
+	v.appContext.ConsoleLog(1, "Successfully created the volumes.\n")
+	return nil
+}
+
+// PlanSet reports the volumes that CreateSet would create.  Volumes that
+// already exist are kept and only get the license written to them again.
+func (v *DockerVolumes) PlanSet(licensePath string, clusterSize int) (*sdutils.PlanSummary, error) {
+	if clusterSize < 1 {
+		return nil, errors.New("At least one volume is required")
+	}
+	if !sdutils.PathExists(licensePath) {
+		return nil, fmt.Errorf("The license file %s does not exist", licensePath)
+	}
+	existing := 0
+	if v.VolumeExists() {
+		vols, err := LoadDockerVolumes(v.appContext, v.VolumeDir)
+		if err != nil {
+			return nil, err
+		}
+		existing = len(vols.VolumeNames)
+		if existing > clusterSize {
+			existing = clusterSize
+		}
+	}
+	plan := sdutils.NewPlanSummary()
+	plan.Record(sdutils.PlanChange, "docker_volume", existing)
+	plan.Record(sdutils.PlanAdd, "docker_volume", clusterSize-existing)
+	return plan, nil
+}
+
+func (v *DockerVolumes) createVolume(spin *sdutils.Spinner, name string) error {
+	err := runDocker(v.appContext, spin, "volume", "create", "--label", labelArg(v.DeploymentName), name)
+	if err != nil {
+		return err
+	}
+	if v.LicensePath == "" && len(v.VolumeNames) > 0 {
+		// Volumes restored from snapshots carry the license of the
+		// original deployment.
+		return runDocker(v.appContext, spin, "run", "--rm",
+			"-v", fmt.Sprintf("%s:/from:ro", v.VolumeNames[0]),
+			"-v", fmt.Sprintf("%s:%s", name, stardogHome),
+			"--entrypoint", "cp",
+			v.Image,
+			"/from/stardog-license-key.bin", path.Join(stardogHome, "stardog-license-key.bin"))
+	}
+	return runDocker(v.appContext, spin, "run", "--rm",
+		"-v", fmt.Sprintf("%s:%s", name, stardogHome),
+		"-v", fmt.Sprintf("%s:/tmp/stardog-license-key.bin:ro", v.LicensePath),
+		"--entrypoint", "cp",
+		v.Image,
+		"/tmp/stardog-license-key.bin", path.Join(stardogHome, "stardog-license-key.bin"))
+}
+
+// copyVolume copies the contents of the volume src into the volume dst.
+func (v *DockerVolumes) copyVolume(spin *sdutils.Spinner, src string, dst string) error {
+	return runDocker(v.appContext, spin, "run", "--rm",
+		"-v", fmt.Sprintf("%s:/from:ro", src),
+		"-v", fmt.Sprintf("%s:/to", dst),
+		"--entrypoint", "cp",
+		v.Image,
+		"-a", "/from/.", "/to/")
+}
+
+// Snapshot copies every volume into a new docker volume and returns their
+// names in the order of the Stardog nodes.
+func (v *DockerVolumes) Snapshot(tag string) ([]string, error) {
+	vols, err := LoadDockerVolumes(v.appContext, v.VolumeDir)
+	if err != nil {
+		return nil, err
+	}
+	stamp := time.Now().UTC().Format("20060102t150405")
+	spin := sdutils.NewSpinner(v.appContext, 1, "Calling out to docker to snapshot the volumes")
+	snapshots := make([]string, len(vols.VolumeNames))
+	for i, name := range vols.VolumeNames {
+		snapshots[i] = fmt.Sprintf("%s-snap%s", name, stamp)
+		args := []string{"volume", "create", "--label", fmt.Sprintf("%s=%s", snapshotLabel, v.DeploymentName)}
+		if tag != "" {
+			args = append(args, "--label", fmt.Sprintf("%s.tag=%s", snapshotLabel, tag))
+		}
+		args = append(args, snapshots[i])
+		err = runDocker(v.appContext, spin, args...)
+		if err != nil {
+			return nil, err
+		}
+		err = v.copyVolume(spin, name, snapshots[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	v.appContext.ConsoleLog(1, "Successfully snapshotted the volumes.\n")
+	return snapshots, nil
+}
+
+// CreateSetFromSnapshots creates one volume per snapshot and copies the
+// snapshot into it.  The license comes with the data.
+func (v *DockerVolumes) CreateSetFromSnapshots(snapshotIDs []string, sizeOfEachVolume int) error {
+	if len(snapshotIDs) < 1 {
+		return errors.New("At least one volume is required")
+	}
+	err := os.MkdirAll(v.VolumeDir, 0755)
+	if err != nil {
+		return err
+	}
+	v.ClusterSize = len(snapshotIDs)
+	v.SizeOfEachVolume = sizeOfEachVolume
+	v.VolumeNames = make([]string, len(snapshotIDs), len(snapshotIDs))
+	for i := range snapshotIDs {
+		v.VolumeNames[i] = volumeName(v.DeploymentName, i)
+	}
+	err = sdutils.WriteJSON(v, path.Join(v.VolumeDir, "volumes.json"))
+	if err != nil {
+		return err
+	}
+
+	spin := sdutils.NewSpinner(v.appContext, 1, "Calling out to docker to restore the volumes")
+	for i, name := range v.VolumeNames {
+		err = runDocker(v.appContext, spin, "volume", "create", "--label", labelArg(v.DeploymentName), name)
+		if err != nil {
+			return err
+		}
+		err = v.copyVolume(spin, snapshotIDs[i], name)
+		if err != nil {
+			return err
+		}
+	}
+	v.appContext.ConsoleLog(1, "Successfully created the volumes.\n")
+	return nil
+}
+
+// Resize creates or removes volumes so that there is one for each of
+// clusterSize Stardog nodes.  The volumes of the remaining nodes are left
+// untouched.
+func (v *DockerVolumes) Resize(clusterSize int) error {
+	if clusterSize < 1 {
+		return errors.New("At least one volume is required")
+	}
+	vols, err := LoadDockerVolumes(v.appContext, v.VolumeDir)
+	if err != nil {
+		return err
+	}
+	v.SizeOfEachVolume = vols.SizeOfEachVolume
+	v.LicensePath = vols.LicensePath
+	v.VolumeNames = vols.VolumeNames
+	spin := sdutils.NewSpinner(v.appContext, 1, "Calling out to docker to resize the volumes")
+	for i := len(v.VolumeNames); i < clusterSize; i++ {
+		name := volumeName(v.DeploymentName, i)
+		err = v.createVolume(spin, name)
+		if err != nil {
+			return err
+		}
+		v.VolumeNames = append(v.VolumeNames, name)
+	}
+	for len(v.VolumeNames) > clusterSize {
+		name := v.VolumeNames[len(v.VolumeNames)-1]
+		err = runDocker(v.appContext, spin, "volume", "rm", name)
+		if err != nil {
+			return err
+		}
+		v.VolumeNames = v.VolumeNames[:len(v.VolumeNames)-1]
+	}
+	v.ClusterSize = clusterSize
+	err = sdutils.WriteJSON(v, path.Join(v.VolumeDir, "volumes.json"))
+	if err != nil {
+		return err
+	}
+	v.appContext.ConsoleLog(1, "Successfully resized the volumes.\n")
+	return nil
+}
+
+// DeleteSet will delete the docker volumes.
+func (v *DockerVolumes) DeleteSet() error {
+	confFile := path.Join(v.VolumeDir, "volumes.json")
+	vols, err := LoadDockerVolumes(v.appContext, v.VolumeDir)
+	if err != nil {
+		return err
+	}
+	spin := sdutils.NewSpinner(v.appContext, 1, "Calling out to docker to delete the volumes")
+	for _, name := range vols.VolumeNames {
+		err = runDocker(v.appContext, spin, "volume", "rm", name)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.Remove(confFile)
+	if err != nil {
+		return err
+	}
+	v.appContext.ConsoleLog(1, "Successfully destroyed the volumes.\n")
+	return nil
+}
+
+// PlanDeleteSet reports the volumes that DeleteSet would remove.
+func (v *DockerVolumes) PlanDeleteSet() (*sdutils.PlanSummary, error) {
+	vols, err := LoadDockerVolumes(v.appContext, v.VolumeDir)
+	if err != nil {
+		return nil, err
+	}
+	plan := sdutils.NewPlanSummary()
+	plan.Record(sdutils.PlanDestroy, "docker_volume", len(vols.VolumeNames))
+	return plan, nil
+}
+
+func (v *DockerVolumes) getStatusInformation() (*VolumeStatusDescription, error) {
+	vols, err := LoadDockerVolumes(v.appContext, v.VolumeDir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := dockerOutput(v.appContext, "volume", "ls", "--filter", labelFilter(v.DeploymentName), "--format", "{{.Name}}")
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, n := range names {
+		found[n] = true
+	}
+	for _, n := range vols.VolumeNames {
+		if !found[n] {
+			return nil, fmt.Errorf("The volume %s is missing from docker", n)
+		}
+	}
+	return &VolumeStatusDescription{VolumeNames: vols.VolumeNames}, nil
+}
+
+// Status will print out status information about the docker volumes.
+func (v *DockerVolumes) Status() error {
+	vD, err := v.getStatusInformation()
+	if err != nil {
+		return err
+	}
+	v.appContext.SetResult(vD)
+	v.appContext.ConsoleLog(1, "Volumes:\n")
+	for _, x := range vD.VolumeNames {
+		v.appContext.ConsoleLog(1, "%s\n", x)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestVolumesNotThere(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	_, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+
+	app, dd := makeTestDeployment(t, dir, GetPlugin().(*dockerPlugin))
+	vm := NewDockerVolumeManager(app, dd)
+	if vm.VolumeExists() {
+		t.Fatal("The volume shouldn't exist yet")
+	}
+	err := vm.Status()
+	if err == nil {
+		t.Fatal("The volume shouldn't exist yet, status should fail")
+	}
+	err = vm.DeleteSet()
+	if err == nil {
+		t.Fatal("The delete should have failed")
+	}
+	err = vm.CreateSet("/no/such/license", 1, 2)
+	if err == nil {
+		t.Fatal("The create should have failed")
+	}
+	err = vm.CreateSet(path.Join(dir, "license"), 1, 0)
+	if err == nil {
+		t.Fatal("The create should have failed with no volumes")
+	}
+}
+
+func TestVolumesCreateStatusDelete(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	paramsFile, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+
+	licensePath := path.Join(dir, "license")
+	ioutil.WriteFile(licensePath, []byte("license"), 0600)
+
+	app, dd := makeTestDeployment(t, dir, GetPlugin().(*dockerPlugin))
+	err := dd.CreateVolumeSet(licensePath, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to create the volumes %s", err)
+	}
+	if !dd.VolumeExists() {
+		t.Fatal("The volumes should exist")
+	}
+	params := readParams(t, paramsFile)
+	if !strings.Contains(params, "volume create --label graviton.deployment=testdep testdep-sdhome1") {
+		t.Fatalf("The volume was not created %s", params)
+	}
+	if !strings.Contains(params, "graviton-stardog:4.2") {
+		t.Fatalf("The license was not copied with the stardog image %s", params)
+	}
+	sz, err := dd.ClusterSize()
+	if err != nil || sz != 2 {
+		t.Fatalf("The cluster size is wrong %d %s", sz, err)
+	}
+	vols, err := LoadDockerVolumes(app, dd.dockerDir())
+	if err != nil {
+		t.Fatalf("Failed to load the volumes %s", err)
+	}
+	if vols.SizeOfEachVolume != 10 || len(vols.VolumeNames) != 2 {
+		t.Fatalf("The volume information is wrong %v", vols)
+	}
+	err = dd.StatusVolumeSet()
+	if err != nil {
+		t.Fatalf("Status failed %s", err)
+	}
+	err = dd.DeleteVolumeSet()
+	if err != nil {
+		t.Fatalf("Failed to delete the volumes %s", err)
+	}
+	if dd.VolumeExists() {
+		t.Fatal("The volumes should not exist")
+	}
+	params = readParams(t, paramsFile)
+	if !strings.Contains(params, "volume rm testdep-sdhome0") {
+		t.Fatalf("The volume was not removed %s", params)
+	}
+}
+
+func TestVolumesResize(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	paramsFile, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+
+	licensePath := path.Join(dir, "license")
+	ioutil.WriteFile(licensePath, []byte("license"), 0600)
+
+	app, dd := makeTestDeployment(t, dir, GetPlugin().(*dockerPlugin))
+	err := dd.CreateVolumeSet(licensePath, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to create the volumes %s", err)
+	}
+	err = dd.CreateInstance(0, 1, 60, "")
+	if err != nil {
+		t.Fatalf("Failed to create the instance %s", err)
+	}
+
+	err = dd.ResizeCluster(3)
+	if err != nil {
+		t.Fatalf("Failed to grow the cluster %s", err)
+	}
+	params := readParams(t, paramsFile)
+	for _, expected := range []string{
+		"volume create --label graviton.deployment=testdep testdep-sdhome2",
+		"--name testdep-sd2",
+		"-v testdep-sdhome2:/var/opt/stardog",
+	} {
+		if !strings.Contains(params, expected) {
+			t.Fatalf("Expected %s in %s", expected, params)
+		}
+	}
+	conf, err := ioutil.ReadFile(path.Join(dd.dockerDir(), "nginx.conf"))
+	if err != nil || !strings.Contains(string(conf), "server testdep-sd2:5821;") {
+		t.Fatalf("The front end does not know the new node %s", string(conf))
+	}
+
+	err = dd.ResizeCluster(1)
+	if err != nil {
+		t.Fatalf("Failed to shrink the cluster %s", err)
+	}
+	params = readParams(t, paramsFile)
+	if !strings.Contains(params, "rm -f testdep-sd2") || !strings.Contains(params, "volume rm testdep-sdhome1") {
+		t.Fatalf("The nodes were not removed %s", params)
+	}
+	vols, err := LoadDockerVolumes(app, dd.dockerDir())
+	if err != nil {
+		t.Fatalf("Failed to load the volumes %s", err)
+	}
+	if vols.ClusterSize != 1 || len(vols.VolumeNames) != 1 {
+		t.Fatalf("The volume information is wrong %v", vols)
+	}
+	conf, _ = ioutil.ReadFile(path.Join(dd.dockerDir(), "nginx.conf"))
+	if strings.Contains(string(conf), "testdep-sd1") {
+		t.Fatalf("The front end still uses a removed node %s", string(conf))
+	}
+}
+
+func TestVolumesSnapshotRestore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	paramsFile, cleanup := setFakeDocker(t, dir, 0)
+	defer cleanup()
+
+	licensePath := path.Join(dir, "license")
+	ioutil.WriteFile(licensePath, []byte("license"), 0600)
+
+	app, dd := makeTestDeployment(t, dir, GetPlugin().(*dockerPlugin))
+	vm := NewDockerVolumeManager(app, dd)
+	err := vm.CreateSet(licensePath, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to create the volumes %s", err)
+	}
+	snapshots, err := dd.SnapshotVolumeSet("nightly")
+	if err != nil {
+		t.Fatalf("Failed to snapshot the volumes %s", err)
+	}
+	if len(snapshots) != 2 || !strings.HasPrefix(snapshots[1], "testdep-sdhome1-snap") {
+		t.Fatalf("The snapshots are wrong %v", snapshots)
+	}
+	params := readParams(t, paramsFile)
+	for _, expected := range []string{
+		"--label graviton.snapshot=testdep --label graviton.snapshot.tag=nightly " + snapshots[0],
+		"-v testdep-sdhome0:/from:ro -v " + snapshots[0] + ":/to",
+	} {
+		if !strings.Contains(params, expected) {
+			t.Fatalf("Expected %s in %s", expected, params)
+		}
+	}
+
+	err = vm.DeleteSet()
+	if err != nil {
+		t.Fatalf("Failed to delete the volumes %s", err)
+	}
+	err = dd.CreateVolumeSetFromSnapshots(snapshots, 10)
+	if err != nil {
+		t.Fatalf("Failed to restore the volumes %s", err)
+	}
+	params = readParams(t, paramsFile)
+	if !strings.Contains(params, "-v "+snapshots[1]+":/from:ro -v testdep-sdhome1:/to") {
+		t.Fatalf("The volume was not restored %s", params)
+	}
+	vols, err := LoadDockerVolumes(app, dd.dockerDir())
+	if err != nil || len(vols.VolumeNames) != 2 || vols.LicensePath != "" {
+		t.Fatalf("The restored volumes are wrong %v %v", vols, err)
+	}
+}
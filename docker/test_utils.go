@@ -0,0 +1,54 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+)
+
+// MakeTestDocker writes a fake docker client into dir (or a new temporary
+// directory) that records every invocation in the file params and prints
+// output.
+func MakeTestDocker(rc int, output string, dir string) (string, string, error) {
+	var err error
+	exedir := dir
+	if dir == "" {
+		exedir, err = ioutil.TempDir("/tmp", "stardogtest")
+		if err != nil {
+			return "", "", err
+		}
+	}
+	paramsFile := path.Join(exedir, "params")
+	dataFile := path.Join(exedir, "datafileDocker")
+	err = ioutil.WriteFile(dataFile, []byte(output), 0644)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to write the file %s", err)
+	}
+
+	fakeDocker := `#!/usr/bin/env bash
+	echo ${@} >> %s
+	cat %s
+	exit %d`
+	fakeDocker = fmt.Sprintf(fakeDocker, paramsFile, dataFile, rc)
+	dockerFile := path.Join(exedir, "docker")
+	err = ioutil.WriteFile(dockerFile, []byte(fakeDocker), 0755)
+	if err != nil {
+		return "", "", err
+	}
+	return exedir, dockerFile, nil
+}
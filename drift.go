@@ -0,0 +1,87 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"fmt"
+)
+
+const (
+	// DriftMissing is a resource that graviton recorded but that no longer
+	// exists.
+	DriftMissing = "missing"
+	// DriftExtra is a resource that belongs to the deployment but that
+	// graviton does not know about.
+	DriftExtra = "extra"
+	// DriftModified is a resource that exists but no longer matches what
+	// graviton recorded.
+	DriftModified = "modified"
+)
+
+// DriftItem is a single difference between the recorded state of a
+// deployment and what actually exists.  Source names the part of the
+// deployment where it was found, for example volumes or instance.
+type DriftItem struct {
+	Kind     string `json:"kind"`
+	Source   string `json:"source,omitempty"`
+	Resource string `json:"resource"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// DriftFromPlan turns the results of TerraformPlanScanner for a workspace
+// that was already applied into drift.  Resources that terraform would
+// create are missing, the ones it would destroy are no longer part of the
+// configuration and the rest were modified.
+func DriftFromPlan(source string, results []ScanResult) []DriftItem {
+	items := []DriftItem{}
+	for _, r := range results {
+		item := DriftItem{Source: source, Resource: r.Value}
+		switch r.Key {
+		case PlanAdd:
+			item.Kind = DriftMissing
+		case PlanDestroy:
+			item.Kind = DriftExtra
+			item.Detail = "not in the configuration"
+		case PlanReplace:
+			item.Kind = DriftModified
+			item.Detail = "must be replaced"
+		default:
+			item.Kind = DriftModified
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// DetectDrift compares the lifecycle step recorded for the deployment with
+// the volumes and instance that the plugin can see and adds the drift that
+// the plugin itself finds.
+func DetectDrift(context AppContext, baseD *BaseDeployment, dep Deployment) ([]DriftItem, error) {
+	items := []DriftItem{}
+	if StateReached(baseD, StateVolumesCreated) && !dep.VolumeExists() {
+		items = append(items, DriftItem{Kind: DriftMissing, Source: "deployment", Resource: "volumes",
+			Detail: fmt.Sprintf("the deployment is at the step %s", baseD.State)})
+	}
+	if StateReached(baseD, StateInstanceCreated) && !dep.InstanceExists() {
+		items = append(items, DriftItem{Kind: DriftMissing, Source: "deployment", Resource: "instance",
+			Detail: fmt.Sprintf("the deployment is at the step %s", baseD.State)})
+	}
+	pluginItems, err := dep.Drift()
+	if err != nil {
+		return nil, err
+	}
+	return append(items, pluginItems...), nil
+}
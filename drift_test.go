@@ -0,0 +1,64 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"testing"
+)
+
+func TestDriftFromPlan(t *testing.T) {
+	results := []ScanResult{
+		{Key: PlanAdd, Value: "aws_autoscaling_group.stardog.1"},
+		{Key: PlanDestroy, Value: "aws_instance.builder"},
+		{Key: PlanChange, Value: "aws_security_group.stardog"},
+		{Key: PlanReplace, Value: "aws_elb.stardog"},
+	}
+	items := DriftFromPlan("instance", results)
+	kinds := []string{DriftMissing, DriftExtra, DriftModified, DriftModified}
+	if len(items) != len(kinds) {
+		t.Fatalf("There should be an item per resource %v", items)
+	}
+	for i, k := range kinds {
+		if items[i].Kind != k || items[i].Source != "instance" || items[i].Resource != results[i].Value {
+			t.Fatalf("The item %d is wrong %v", i, items[i])
+		}
+	}
+	if len(DriftFromPlan("volumes", nil)) != 0 {
+		t.Fatal("No changes is no drift")
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	dep := tpDeployment{TstVolumeExists: true, TstInstanceExists: true}
+	baseD := BaseDeployment{Name: "drift", State: StateHealthy}
+	items, err := DetectDrift(&TestContext{}, &baseD, &dep)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("There should be no drift %v %s", items, err)
+	}
+
+	dep.TstInstanceExists = false
+	items, err = DetectDrift(&TestContext{}, &baseD, &dep)
+	if err != nil || len(items) != 1 || items[0].Resource != "instance" || items[0].Kind != DriftMissing {
+		t.Fatalf("The instance should be missing %v %s", items, err)
+	}
+
+	dep.TstVolumeExists = false
+	baseD.State = StateVolumesCreated
+	items, err = DetectDrift(&TestContext{}, &baseD, &dep)
+	if err != nil || len(items) != 1 || items[0].Resource != "volumes" {
+		t.Fatalf("Only the volumes should be missing %v %s", items, err)
+	}
+}
@@ -0,0 +1,491 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// The fake ssh client plays the part of the bastion node.  Every call is
+	// recorded and health checks are answered from a file that the Cloud
+	// keeps up to date.  Calls that match a line of the fail file exit with
+	// an error, 1 unless the line starts with exit=code.  Calls that match
+	// the pattern of a line of the output file print the text after the tab.
+	fakeSSH = `#!/usr/bin/env bash
+echo "$@" >> %s
+if [ -f "%s" ]; then
+	while IFS=$'\t' read -r p out; do
+		case "$*" in *"$p"*) echo "$out" ;; esac
+	done < "%s"
+fi
+if [ -f "%s" ]; then
+	while read -r p; do
+		code=1
+		case "$p" in exit=*) code="${p%%%% *}"; code="${code#exit=}"; p="${p#* }" ;; esac
+		case "$*" in *"$p"*) exit $code ;; esac
+	done < "%s"
+fi
+host=""
+for a in "$@"; do
+	case "$a" in
+		ubuntu@*) host="${a#ubuntu@}" ;;
+		/usr/bin/curl) cat "%s/$host.health"; exit 0 ;;
+	esac
+done
+exit 0
+`
+	// The fake scp client records every call and creates the local file on
+	// downloads.  Calls that match a line of the fail file exit with 1.
+	fakeSCP = `#!/usr/bin/env bash
+echo "$@" >> %s
+if [ -f "%s" ]; then
+	while read -r p; do
+		case "$*" in *"$p"*) exit 1 ;; esac
+	done < "%s"
+fi
+last="${@: -1}"
+case "$last" in
+	*:*) ;;
+	*) touch "$last" ;;
+esac
+exit 0
+`
+)
+
+// Resources describes what the fake cloud holds for a single deployment.
+type Resources struct {
+	Volumes     []string
+	VolumeSize  int
+	Instance    bool
+	Open        bool
+	Mask        string
+	ZkSize      int
+	ZkReplaced  []int
+	Image       string
+	SdReplaced  []int
+	Away        map[int]int
+	NoRejoin    bool
+	IdleTimeout int
+	Healthy     bool
+	Nodes       int
+	Stopped     bool
+	Password    string
+	server      *httptest.Server
+}
+
+// Cloud is an in process model of the resources a cloud provider would hold
+// for graviton deployments.  Every plugin made from the same Cloud shares its
+// state so that it survives between commands.
+type Cloud struct {
+	mutex     sync.Mutex
+	dir       string
+	resources map[string]*Resources
+	images    map[string]bool
+	snapshots map[string]string
+}
+
+// NewCloud creates an empty Cloud.  The fake ssh and scp clients used to model
+// the bastion node are written into dir, which should be added to the PATH.
+func NewCloud(dir string) (*Cloud, error) {
+	c := &Cloud{
+		dir:       dir,
+		resources: make(map[string]*Resources),
+		images:    make(map[string]bool),
+		snapshots: make(map[string]string),
+	}
+	err := ioutil.WriteFile(path.Join(dir, "ssh"), []byte(fmt.Sprintf(fakeSSH, c.sshLog(), c.sshOutputFile(), c.sshOutputFile(), c.sshFailFile(), c.sshFailFile(), dir)), 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(path.Join(dir, "scp"), []byte(fmt.Sprintf(fakeSCP, c.scpLog(), c.scpFailFile(), c.scpFailFile())), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// BinDir returns the directory holding the fake ssh and scp clients.
+func (c *Cloud) BinDir() string {
+	return c.dir
+}
+
+func (c *Cloud) sshLog() string {
+	return path.Join(c.dir, "ssh.log")
+}
+
+func (c *Cloud) sshFailFile() string {
+	return path.Join(c.dir, "ssh.fail")
+}
+
+func (c *Cloud) scpFailFile() string {
+	return path.Join(c.dir, "scp.fail")
+}
+
+func (c *Cloud) sshOutputFile() string {
+	return path.Join(c.dir, "ssh.out")
+}
+
+func (c *Cloud) scpLog() string {
+	return path.Join(c.dir, "scp.log")
+}
+
+func readLines(filePath string) []string {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	lines := []string{}
+	for _, l := range strings.Split(string(data), "\n") {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// SSHCommands returns the arguments of every ssh call made to a bastion node.
+func (c *Cloud) SSHCommands() []string {
+	return readLines(c.sshLog())
+}
+
+// SCPCommands returns the arguments of every scp call made to a bastion node.
+func (c *Cloud) SCPCommands() []string {
+	return readLines(c.scpLog())
+}
+
+// Get returns a copy of the resources held for the deployment or nil if there
+// are none.
+func (c *Cloud) Get(name string) *Resources {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[name]
+	if !ok {
+		return nil
+	}
+	cp := *r
+	cp.Volumes = append([]string{}, r.Volumes...)
+	cp.ZkReplaced = append([]int{}, r.ZkReplaced...)
+	cp.SdReplaced = append([]int{}, r.SdReplaced...)
+	cp.Away = map[int]int{}
+	for i, n := range r.Away {
+		cp.Away[i] = n
+	}
+	return &cp
+}
+
+// Deployments returns the sorted names of the deployments that hold resources.
+func (c *Cloud) Deployments() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	names := []string{}
+	for n := range c.resources {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetHealthy changes the answer of the Stardog health check for a deployment.
+func (c *Cloud) SetHealthy(name string, healthy bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[name]
+	if !ok {
+		return
+	}
+	r.Healthy = healthy
+	c.writeHealth(name, r)
+}
+
+// SetNodes changes the number of nodes reported by /admin/cluster.
+func (c *Cloud) SetNodes(name string, nodes int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[name]
+	if !ok {
+		return
+	}
+	r.Nodes = nodes
+}
+
+// SetRejoin controls whether a replaced Stardog node joins the cluster again.
+// When rejoin is false a replaced node never comes back to /admin/cluster.
+func (c *Cloud) SetRejoin(name string, rejoin bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[name]
+	if !ok {
+		return
+	}
+	r.NoRejoin = !rejoin
+}
+
+// ClearAway brings back every Stardog node that left the cluster.
+func (c *Cloud) ClearAway(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[name]
+	if !ok {
+		return
+	}
+	r.Away = nil
+}
+
+// Snapshots returns the sorted ids of every volume snapshot in the cloud.
+// Snapshots are kept when the deployment that made them is destroyed.
+func (c *Cloud) Snapshots() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ids := []string{}
+	for id := range c.snapshots {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// FailSSH makes every later ssh call whose arguments contain pattern fail.
+func (c *Cloud) FailSSH(pattern string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := os.OpenFile(c.sshFailFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, pattern)
+}
+
+// FailSSHWithCode makes every later ssh call whose arguments contain pattern
+// exit with code.
+func (c *Cloud) FailSSHWithCode(pattern string, code int) {
+	c.FailSSH(fmt.Sprintf("exit=%d %s", code, pattern))
+}
+
+// ClearSSHFailures makes every ssh call succeed again.
+func (c *Cloud) ClearSSHFailures() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	os.Remove(c.sshFailFile())
+}
+
+// FailSCP makes every later scp call whose arguments contain pattern fail.
+func (c *Cloud) FailSCP(pattern string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := os.OpenFile(c.scpFailFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, pattern)
+}
+
+// ClearSCPFailures makes every scp call succeed again.
+func (c *Cloud) ClearSCPFailures() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	os.Remove(c.scpFailFile())
+}
+
+// SSHOutput makes every later ssh call whose arguments contain pattern print
+// text, whether or not the call fails.
+func (c *Cloud) SSHOutput(pattern string, text string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := os.OpenFile(c.sshOutputFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s\t%s\n", pattern, text)
+}
+
+// ClearSSHOutput stops the ssh calls from printing the text set with
+// SSHOutput.
+func (c *Cloud) ClearSSHOutput() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	os.Remove(c.sshOutputFile())
+}
+
+// AddImage marks an image as available for a Stardog version.
+func (c *Cloud) AddImage(version string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.images[version] = true
+}
+
+// Close stops all of the fake Stardog endpoints.
+func (c *Cloud) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, r := range c.resources {
+		if r.server != nil {
+			r.server.Close()
+			r.server = nil
+		}
+	}
+}
+
+func bastionHost(name string) string {
+	return fmt.Sprintf("bastion-%s.fake", name)
+}
+
+func (c *Cloud) writeHealth(name string, r *Resources) {
+	code := "503"
+	if r.Healthy {
+		code = "200"
+	}
+	ioutil.WriteFile(path.Join(c.dir, fmt.Sprintf("%s.health", bastionHost(name))), []byte(code), 0644)
+}
+
+func (c *Cloud) get(name string) *Resources {
+	r, ok := c.resources[name]
+	if !ok {
+		r = &Resources{}
+		c.resources[name] = r
+	}
+	return r
+}
+
+func (c *Cloud) release(name string) {
+	r, ok := c.resources[name]
+	if !ok {
+		return
+	}
+	if len(r.Volumes) == 0 && !r.Instance {
+		delete(c.resources, name)
+		os.Remove(path.Join(c.dir, fmt.Sprintf("%s.health", bastionHost(name))))
+	}
+}
+
+func (c *Cloud) stardogHandler(name string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/healthcheck", func(w http.ResponseWriter, req *http.Request) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		r, ok := c.resources[name]
+		if !ok || !r.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/admin/cluster", func(w http.ResponseWriter, req *http.Request) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		r, ok := c.resources[name]
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		u, p, ok := req.BasicAuth()
+		if !ok || u != "admin" || p != r.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// A node that is away is left out, it counts down one answer at
+		// a time unless it never comes back.
+		nodes := []string{}
+		for i := 0; i < r.Nodes; i++ {
+			if n, ok := r.Away[i]; ok {
+				if n == 0 {
+					delete(r.Away, i)
+				} else {
+					if n > 0 {
+						r.Away[i] = n - 1
+					}
+					continue
+				}
+			}
+			nodes = append(nodes, fmt.Sprintf("10.0.0.%d:5821", i+1))
+		}
+		data, _ := json.Marshal(map[string]interface{}{"nodes": nodes})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+	// Every database answers queries with a single row naming it.
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		r, ok := c.resources[name]
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		u, p, ok := req.BasicAuth()
+		if !ok || u != "admin" || p != r.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		if req.Method != "POST" || len(parts) != 2 || parts[1] != "query" || req.FormValue("query") == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch req.Header.Get("Accept") {
+		case "text/csv":
+			fmt.Fprintf(w, "db\r\n%s\r\n", parts[0])
+		case "application/sparql-results+json":
+			fmt.Fprintf(w, `{"head": {"vars": ["db"]}, "results": {"bindings": [{"db": {"type": "literal", "value": %q}}]}}`, parts[0])
+		default:
+			w.WriteHeader(http.StatusNotAcceptable)
+		}
+	})
+	// Only the admin user exists and its password can be changed.
+	mux.HandleFunc("/admin/users/", func(w http.ResponseWriter, req *http.Request) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		r, ok := c.resources[name]
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		u, p, ok := req.BasicAuth()
+		if !ok || u != "admin" || p != r.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Method != "PUT" || !strings.HasSuffix(req.URL.Path, "/pwd") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.URL.Path != "/admin/users/admin/pwd" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "The user does not exist")
+			return
+		}
+		var body map[string]string
+		err := json.NewDecoder(req.Body).Decode(&body)
+		if err != nil || body["password"] == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Password = body["password"]
+	})
+	return mux
+}
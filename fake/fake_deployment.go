@@ -0,0 +1,624 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path"
+	"time"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+// VolumeStatusDescription is an opaque way to pass fake volume information
+// to the calling code.
+type VolumeStatusDescription struct {
+	VolumeIds []string
+}
+
+// InstanceStatusDescription describes details about a running fake instance.
+type InstanceStatusDescription struct {
+	ZkSize int
+	Open   bool
+}
+
+type fakeDeploymentDescription struct {
+	Name      string `json:"-"`
+	Version   string `json:"-"`
+	deployDir string
+	ctx       sdutils.AppContext
+	cloud     *Cloud
+	plugin    *fakePlugin
+}
+
+func (dd *fakeDeploymentDescription) DestroyDeployment() error {
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) CreateVolumeSet(licensePath string, sizeOfEachVolume int, clusterSize int) error {
+	if !sdutils.PathExists(licensePath) {
+		return fmt.Errorf("The license file %s does not exist", licensePath)
+	}
+	if clusterSize < 1 {
+		return errors.New("At least one volume is required")
+	}
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r := c.get(dd.Name)
+	if r.Instance {
+		return errors.New("The volumes cannot be changed while an instance is running")
+	}
+	r.VolumeSize = sizeOfEachVolume
+	r.Volumes = make([]string, clusterSize)
+	for i := range r.Volumes {
+		r.Volumes[i] = fmt.Sprintf("vol-%s-%d", dd.Name, i)
+	}
+	dd.ctx.ConsoleLog(1, "Successfully created the volumes.\n")
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) PlanVolumeSet(licensePath string, sizeOfEachVolume int, clusterSize int) (*sdutils.PlanSummary, error) {
+	if !sdutils.PathExists(licensePath) {
+		return nil, fmt.Errorf("The license file %s does not exist", licensePath)
+	}
+	if clusterSize < 1 {
+		return nil, errors.New("At least one volume is required")
+	}
+	plan := sdutils.NewPlanSummary()
+	r := dd.cloud.Get(dd.Name)
+	current := 0
+	if r != nil {
+		current = len(r.Volumes)
+	}
+	plan.Record(sdutils.PlanDestroy, "fake_volume", current)
+	plan.Record(sdutils.PlanAdd, "fake_volume", clusterSize)
+	return plan, nil
+}
+
+func (dd *fakeDeploymentDescription) DeleteVolumeSet() error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || len(r.Volumes) == 0 {
+		return fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	if r.Instance {
+		return errors.New("The volumes are in use by an instance")
+	}
+	r.Volumes = nil
+	c.release(dd.Name)
+	dd.ctx.ConsoleLog(1, "Successfully destroyed the volumes.\n")
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) PlanDeleteVolumeSet() (*sdutils.PlanSummary, error) {
+	r := dd.cloud.Get(dd.Name)
+	if r == nil || len(r.Volumes) == 0 {
+		return nil, fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	plan := sdutils.NewPlanSummary()
+	plan.Record(sdutils.PlanDestroy, "fake_volume", len(r.Volumes))
+	return plan, nil
+}
+
+func (dd *fakeDeploymentDescription) StatusVolumeSet() error {
+	r := dd.cloud.Get(dd.Name)
+	if r == nil || len(r.Volumes) == 0 {
+		return fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	dd.ctx.SetResult(&VolumeStatusDescription{VolumeIds: append([]string{}, r.Volumes...)})
+	dd.ctx.ConsoleLog(1, "Volumes:\n")
+	for _, v := range r.Volumes {
+		dd.ctx.ConsoleLog(1, "%s\n", v)
+	}
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) VolumeExists() bool {
+	r := dd.cloud.Get(dd.Name)
+	return r != nil && len(r.Volumes) > 0
+}
+
+func (dd *fakeDeploymentDescription) ClusterSize() (int, error) {
+	r := dd.cloud.Get(dd.Name)
+	if r == nil || len(r.Volumes) == 0 {
+		return -1, fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	return len(r.Volumes), nil
+}
+
+func (dd *fakeDeploymentDescription) ResizeCluster(clusterSize int) error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || len(r.Volumes) == 0 {
+		return fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	if clusterSize < 1 {
+		return errors.New("At least one volume is required")
+	}
+	vols := make([]string, clusterSize)
+	for i := range vols {
+		vols[i] = fmt.Sprintf("vol-%s-%d", dd.Name, i)
+	}
+	r.Volumes = vols
+	if r.Instance {
+		r.Nodes = clusterSize
+	}
+	dd.ctx.ConsoleLog(1, "Successfully resized the cluster.\n")
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) SnapshotVolumeSet(tag string) ([]string, error) {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || len(r.Volumes) == 0 {
+		return nil, fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	ids := make([]string, len(r.Volumes))
+	for i, v := range r.Volumes {
+		ids[i] = fmt.Sprintf("snap-%s-%d", v, len(c.snapshots))
+		c.snapshots[ids[i]] = tag
+	}
+	dd.ctx.ConsoleLog(1, "Successfully snapshotted the volumes.\n")
+	return ids, nil
+}
+
+func (dd *fakeDeploymentDescription) CreateVolumeSetFromSnapshots(snapshotIDs []string, sizeOfEachVolume int) error {
+	if len(snapshotIDs) < 1 {
+		return errors.New("At least one volume is required")
+	}
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, id := range snapshotIDs {
+		if _, ok := c.snapshots[id]; !ok {
+			return fmt.Errorf("The snapshot %s does not exist", id)
+		}
+	}
+	r := c.get(dd.Name)
+	if r.Instance {
+		return errors.New("The volumes cannot be changed while an instance is running")
+	}
+	r.VolumeSize = sizeOfEachVolume
+	r.Volumes = make([]string, len(snapshotIDs))
+	for i := range r.Volumes {
+		r.Volumes[i] = fmt.Sprintf("vol-%s-%d", dd.Name, i)
+	}
+	dd.ctx.ConsoleLog(1, "Successfully created the volumes.\n")
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) DeleteVolumeSnapshots(snapshotIDs []string) error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, id := range snapshotIDs {
+		if _, ok := c.snapshots[id]; !ok {
+			return fmt.Errorf("The snapshot %s does not exist", id)
+		}
+		delete(c.snapshots, id)
+	}
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) CreateInstance(volumeSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || len(r.Volumes) == 0 {
+		return fmt.Errorf("No volume information exists for %s", dd.Name)
+	}
+	if zookeeperSize < 1 {
+		return errors.New("At least one zookeeper node is required")
+	}
+	r.Instance = true
+	r.ZkSize = zookeeperSize
+	r.IdleTimeout = idleTimeout
+	r.Healthy = true
+	r.Nodes = len(r.Volumes)
+	if r.Password == "" {
+		r.Password = "admin"
+	}
+	if r.server == nil {
+		r.server = httptest.NewServer(c.stardogHandler(dd.Name))
+	}
+	c.writeHealth(dd.Name, r)
+	dd.ctx.ConsoleLog(1, "Successfully created the instance.\n")
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) StopInstance() error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || !r.Instance {
+		return errors.New("There is no configured instance")
+	}
+	r.Stopped = true
+	r.Nodes = 0
+	r.Healthy = false
+	c.writeHealth(dd.Name, r)
+	dd.ctx.ConsoleLog(1, "Successfully stopped the instance.\n")
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) StartInstance() error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || !r.Instance {
+		return errors.New("There is no configured instance")
+	}
+	r.Stopped = false
+	r.Nodes = len(r.Volumes)
+	r.Healthy = true
+	c.writeHealth(dd.Name, r)
+	dd.ctx.ConsoleLog(1, "Successfully started the instance.\n")
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) PlanInstance(clusterSize int, volumeSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) (*sdutils.PlanSummary, error) {
+	if zookeeperSize < 1 {
+		return nil, errors.New("At least one zookeeper node is required")
+	}
+	plan := sdutils.NewPlanSummary()
+	r := dd.cloud.Get(dd.Name)
+	if r != nil && r.Instance {
+		plan.Record(sdutils.PlanChange, "fake_instance", 1)
+		return plan, nil
+	}
+	plan.Record(sdutils.PlanAdd, "fake_instance", 1)
+	plan.Record(sdutils.PlanAdd, "fake_stardog_node", clusterSize)
+	plan.Record(sdutils.PlanAdd, "fake_zookeeper_node", zookeeperSize)
+	return plan, nil
+}
+
+func (dd *fakeDeploymentDescription) OpenInstance(volumeSize int, zookeeperSize int, mask string, idleTimeout int) error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || !r.Instance {
+		return errors.New("There is no configured instance")
+	}
+	r.Open = true
+	r.Mask = mask
+	r.IdleTimeout = idleTimeout
+	dd.ctx.ConsoleLog(1, "Successfully opened up the instance.\n")
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) DeleteInstance() error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || !r.Instance {
+		return errors.New("There is no configured instance")
+	}
+	if r.server != nil {
+		r.server.Close()
+		r.server = nil
+	}
+	r.Instance = false
+	r.Open = false
+	r.Healthy = false
+	c.writeHealth(dd.Name, r)
+	c.release(dd.Name)
+	dd.ctx.ConsoleLog(1, "Successfully destroyed the instance.\n")
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) PlanDeleteInstance() (*sdutils.PlanSummary, error) {
+	r := dd.cloud.Get(dd.Name)
+	if r == nil || !r.Instance {
+		return nil, errors.New("There is no configured instance")
+	}
+	plan := sdutils.NewPlanSummary()
+	plan.Record(sdutils.PlanDestroy, "fake_instance", 1)
+	plan.Record(sdutils.PlanDestroy, "fake_stardog_node", r.Nodes)
+	plan.Record(sdutils.PlanDestroy, "fake_zookeeper_node", r.ZkSize)
+	return plan, nil
+}
+
+func (dd *fakeDeploymentDescription) StatusInstance() error {
+	sd, err := dd.FullStatus()
+	if err != nil {
+		return err
+	}
+	if sd.InstanceDescription == nil {
+		return errors.New("There is no configured instance")
+	}
+	dd.ctx.SetResult(sd)
+	dd.ctx.ConsoleLog(1, "Stardog: %s\n", sd.StardogURL)
+	dd.ctx.ConsoleLog(1, "SSH: %s\n", sd.SSHHost)
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) InstanceExists() bool {
+	r := dd.cloud.Get(dd.Name)
+	return r != nil && r.Instance
+}
+
+func (dd *fakeDeploymentDescription) ZookeeperSize() (int, error) {
+	r := dd.cloud.Get(dd.Name)
+	if r == nil || !r.Instance {
+		return -1, errors.New("There is no configured instance")
+	}
+	return r.ZkSize, nil
+}
+
+func (dd *fakeDeploymentDescription) ReplaceZookeeperNode(zookeeperSize int, ndx int) error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || !r.Instance {
+		return errors.New("There is no configured instance")
+	}
+	if zookeeperSize < 1 {
+		return errors.New("At least one zookeeper node is required")
+	}
+	r.ZkSize = zookeeperSize
+	r.ZkReplaced = append(r.ZkReplaced, ndx)
+	dd.ctx.ConsoleLog(1, "Successfully replaced zookeeper node %d.\n", ndx)
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) UpdateImage() error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || !r.Instance {
+		return errors.New("There is no configured instance")
+	}
+	r.Image = fmt.Sprintf("fake-%s", dd.Version)
+	if dd.plugin != nil && dd.plugin.ReimageImage != "" {
+		r.Image = dd.plugin.ReimageImage
+	}
+	dd.ctx.ConsoleLog(1, "Successfully moved to the image %s.\n", r.Image)
+	return nil
+}
+
+func (dd *fakeDeploymentDescription) ReplaceStardogNode(ndx int) error {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.resources[dd.Name]
+	if !ok || !r.Instance {
+		return errors.New("There is no configured instance")
+	}
+	if ndx < 0 || ndx >= len(r.Volumes) {
+		return fmt.Errorf("There is no Stardog node %d", ndx)
+	}
+	r.SdReplaced = append(r.SdReplaced, ndx)
+	// As with a recreated docker container the node keeps its address.  It
+	// leaves the cluster for one answer of /admin/cluster and then rejoins.
+	if r.Away == nil {
+		r.Away = map[int]int{}
+	}
+	r.Away[ndx] = 1
+	if r.NoRejoin {
+		r.Away[ndx] = -1
+	}
+	return nil
+}
+
+// Drift reports a running instance with fewer Stardog nodes than volumes,
+// which is how the fake cloud models nodes that were removed by hand.
+func (dd *fakeDeploymentDescription) Drift() ([]sdutils.DriftItem, error) {
+	items := []sdutils.DriftItem{}
+	r := dd.cloud.Get(dd.Name)
+	if r != nil && r.Instance && !r.Stopped && r.Nodes != len(r.Volumes) {
+		items = append(items, sdutils.DriftItem{
+			Kind:     sdutils.DriftModified,
+			Source:   "instance",
+			Resource: "fake_stardog_node",
+			Detail:   fmt.Sprintf("%d of %d nodes are running", r.Nodes, len(r.Volumes)),
+		})
+	}
+	return items, nil
+}
+
+// EstimateCost prices the fake resources with made up prices.
+func (dd *fakeDeploymentDescription) EstimateCost(sizeOfEachVolume int, clusterSize int, rootVolumeSize int, zookeeperSize int) (*sdutils.CostEstimate, error) {
+	e := sdutils.NewCostEstimate("fake", "USD")
+	e.AddHourly("stardog node", "fake_stardog_node", clusterSize, 0.1)
+	e.AddHourly("zookeeper node", "fake_zookeeper_node", zookeeperSize, 0.05)
+	e.AddMonthly("stardog home storage", fmt.Sprintf("%d GB", sizeOfEachVolume), clusterSize, 0.1*float64(sizeOfEachVolume))
+	return e, nil
+}
+
+func (dd *fakeDeploymentDescription) FullStatus() (*sdutils.StardogDescription, error) {
+	c := dd.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	sD := sdutils.StardogDescription{
+		TimeStamp: time.Now(),
+	}
+	r, ok := c.resources[dd.Name]
+	if !ok {
+		return &sD, nil
+	}
+	if len(r.Volumes) > 0 {
+		sD.VolumeDescription = &VolumeStatusDescription{VolumeIds: append([]string{}, r.Volumes...)}
+	}
+	if r.Instance && r.server != nil {
+		sD.SSHHost = bastionHost(dd.Name)
+		sD.StardogURL = r.server.URL
+		sD.StardogInternalURL = r.server.URL
+		sD.InstanceDescription = &InstanceStatusDescription{ZkSize: r.ZkSize, Open: r.Open}
+		for i := 0; i < r.ZkSize; i++ {
+			sD.ZookeeperHealthURLs = append(sD.ZookeeperHealthURLs, fmt.Sprintf("%s/zk/%d", r.server.URL, i))
+		}
+	}
+	return &sD, nil
+}
+
+type fakePlugin struct {
+	cloud        *Cloud
+	ReimageImage string `json:"-"`
+}
+
+// NewPlugin returns a plugin that manages deployments in this Cloud.
+func (c *Cloud) NewPlugin() sdutils.Plugin {
+	return &fakePlugin{cloud: c}
+}
+
+func (p *fakePlugin) Register(cmdOpts *sdutils.CommandOpts) error {
+	cmdOpts.ReimageCmd.Flag("fake-image", "The image to move the Stardog nodes to.").StringVar(&p.ReimageImage)
+	return nil
+}
+
+func (p *fakePlugin) LoadDefaults(defaultCliOpts interface{}) error {
+	return nil
+}
+
+func (p *fakePlugin) GetRegion() string {
+	return ""
+}
+
+func (p *fakePlugin) DeploymentRegion(baseD *sdutils.BaseDeployment) string {
+	return ""
+}
+
+func (p *fakePlugin) DeploymentImage(baseD *sdutils.BaseDeployment) string {
+	r := p.cloud.Get(baseD.Name)
+	if r != nil && r.Image != "" {
+		return r.Image
+	}
+	return fmt.Sprintf("fake-%s", baseD.Version)
+}
+
+func (p *fakePlugin) DeploymentOptions(baseD *sdutils.BaseDeployment) map[string]interface{} {
+	return nil
+}
+
+func (p *fakePlugin) CopyImage(context sdutils.AppContext, regions []string) error {
+	return errors.New("The fake plugin does not copy images between regions")
+}
+
+func (p *fakePlugin) GetName() string {
+	return "fake"
+}
+
+func (p *fakePlugin) HaveImage(c sdutils.AppContext) bool {
+	p.cloud.mutex.Lock()
+	defer p.cloud.mutex.Unlock()
+	return p.cloud.images[c.GetVersion()]
+}
+
+func (p *fakePlugin) BuildImage(context sdutils.AppContext, sdReleaseFilePath string, version string) error {
+	if !sdutils.PathExists(sdReleaseFilePath) {
+		return fmt.Errorf("The release file %s does not exist", sdReleaseFilePath)
+	}
+	p.cloud.AddImage(version)
+	context.SetResult(&sdutils.ImageDescription{Version: version, Image: "fake-" + version})
+	context.ConsoleLog(1, "Image Successfully built: fake-%s\n", version)
+	return nil
+}
+
+func (p *fakePlugin) FindLeaks(context sdutils.AppContext, deploymentName string, destroy bool, force bool) error {
+	names := []string{}
+	for _, n := range p.cloud.Deployments() {
+		if deploymentName == "" || deploymentName == n {
+			names = append(names, n)
+		}
+	}
+	volumes := []string{}
+	instances := []string{}
+	for _, n := range names {
+		r := p.cloud.Get(n)
+		volumes = append(volumes, r.Volumes...)
+		if r.Instance {
+			instances = append(instances, n)
+		}
+	}
+	context.SetResult(map[string][]string{"volumes": volumes, "instances": instances})
+	context.ConsoleLog(1, "Found %d volumes\n", len(volumes))
+	context.ConsoleLog(1, "Found %d instances\n", len(instances))
+	if !destroy || len(names) == 0 {
+		return nil
+	}
+	if !force {
+		if !sdutils.AskUserYesOrNo("Would you like to destroy these resources?") {
+			return nil
+		}
+	}
+	c := p.cloud
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, n := range names {
+		r := c.resources[n]
+		if r.server != nil {
+			r.server.Close()
+		}
+		delete(c.resources, n)
+	}
+	return nil
+}
+
+// PlanDeployment defines nothing in the fake cloud, so the plan is empty.
+func (p *fakePlugin) PlanDeployment(context sdutils.AppContext, baseD *sdutils.BaseDeployment) (sdutils.Deployment, *sdutils.PlanSummary, error) {
+	dd := fakeDeploymentDescription{
+		Name:      baseD.Name,
+		Version:   baseD.Version,
+		deployDir: baseD.Directory,
+		ctx:       context,
+		cloud:     p.cloud,
+		plugin:    p,
+	}
+	return &dd, sdutils.NewPlanSummary(), nil
+}
+
+func (p *fakePlugin) DeploymentLoader(context sdutils.AppContext, baseD *sdutils.BaseDeployment, new bool) (sdutils.Deployment, error) {
+	dd := fakeDeploymentDescription{
+		Name:      baseD.Name,
+		Version:   baseD.Version,
+		deployDir: sdutils.DeploymentDir(context.GetConfigDir(), baseD.Name),
+		ctx:       context,
+		cloud:     p.cloud,
+		plugin:    p,
+	}
+	if new {
+		baseD.CloudOpts = &dd
+		data, err := json.Marshal(baseD)
+		if err != nil {
+			return nil, err
+		}
+		confPath := path.Join(dd.deployDir, "config.json")
+		err = ioutil.WriteFile(confPath, data, 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &dd, nil
+}
@@ -0,0 +1,142 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stardog-union/stardog-graviton"
+)
+
+func TestFakeLifecycle(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	cloud, err := NewCloud(dir)
+	if err != nil {
+		t.Fatalf("Failed to make the cloud %s", err)
+	}
+	defer cloud.Close()
+	pathSave := os.Getenv("PATH")
+	defer os.Setenv("PATH", pathSave)
+	os.Setenv("PATH", fmt.Sprintf("%s:%s", cloud.BinDir(), pathSave))
+
+	app := sdutils.TestContext{
+		ConfigDir: dir,
+		Version:   "4.2",
+	}
+	plugin := cloud.NewPlugin()
+	sdutils.AddCloudType(plugin)
+	baseD := sdutils.BaseDeployment{
+		Type:      plugin.GetName(),
+		Name:      "testdep",
+		Directory: sdutils.DeploymentDir(dir, "testdep"),
+		Version:   "4.2",
+	}
+	dep, err := sdutils.LoadDeployment(&app, &baseD, true)
+	if err != nil {
+		t.Fatalf("Failed to make the deployment %s", err)
+	}
+	if !sdutils.PathExists(path.Join(baseD.Directory, "config.json")) {
+		t.Fatal("The deployment was not written")
+	}
+	err = dep.CreateInstance(16, 1, 60, "")
+	if err == nil {
+		t.Fatal("An instance needs volumes")
+	}
+	err = dep.CreateVolumeSet("/etc/group", 10, 3)
+	if err != nil {
+		t.Fatalf("Failed to create the volumes %s", err)
+	}
+	err = dep.CreateInstance(16, 1, 60, "")
+	if err != nil {
+		t.Fatalf("Failed to create the instance %s", err)
+	}
+	if !sdutils.IsHealthy(&app, &baseD, dep, false) {
+		t.Fatal("The instance should be healthy")
+	}
+	if !sdutils.IsHealthy(&app, &baseD, dep, true) {
+		t.Fatal("The instance should be healthy through the bastion")
+	}
+	if len(cloud.SSHCommands()) != 1 {
+		t.Fatalf("The bastion should have been used once %v", cloud.SSHCommands())
+	}
+	cloud.SetHealthy("testdep", false)
+	if sdutils.IsHealthy(&app, &baseD, dep, false) {
+		t.Fatal("The instance should not be healthy")
+	}
+	if sdutils.IsHealthy(&app, &baseD, dep, true) {
+		t.Fatal("The instance should not be healthy through the bastion")
+	}
+	cloud.SetHealthy("testdep", true)
+	sd, err := dep.FullStatus()
+	if err != nil {
+		t.Fatalf("Failed to get the status %s", err)
+	}
+	err = sdutils.WaitForNClusterNodes(&app, 3, sd.StardogURL, "admin", 4, nil)
+	if err != nil {
+		t.Fatalf("The cluster should have 3 nodes %s", err)
+	}
+
+	err = dep.DeleteVolumeSet()
+	if err == nil {
+		t.Fatal("The volumes are in use")
+	}
+	err = dep.DeleteInstance()
+	if err != nil {
+		t.Fatalf("Failed to delete the instance %s", err)
+	}
+	err = dep.DeleteVolumeSet()
+	if err != nil {
+		t.Fatalf("Failed to delete the volumes %s", err)
+	}
+	if len(cloud.Deployments()) != 0 {
+		t.Fatalf("Nothing should be left in the cloud %v", cloud.Deployments())
+	}
+}
+
+func TestFakeLeaks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtest")
+	defer os.RemoveAll(dir)
+	cloud, err := NewCloud(dir)
+	if err != nil {
+		t.Fatalf("Failed to make the cloud %s", err)
+	}
+	defer cloud.Close()
+	app := sdutils.TestContext{
+		ConfigDir: dir,
+		Version:   "4.2",
+	}
+	plugin := cloud.NewPlugin()
+	for _, n := range []string{"dep1", "dep2"} {
+		baseD := sdutils.BaseDeployment{Type: "fake", Name: n, Version: "4.2"}
+		dep, _ := plugin.DeploymentLoader(&app, &baseD, false)
+		err = dep.CreateVolumeSet("/etc/group", 10, 1)
+		if err != nil {
+			t.Fatalf("Failed to create the volumes %s", err)
+		}
+	}
+	err = plugin.FindLeaks(&app, "dep1", true, true)
+	if err != nil {
+		t.Fatalf("Failed to destroy leaks %s", err)
+	}
+	if cloud.Get("dep1") != nil || cloud.Get("dep2") == nil {
+		t.Fatal("Only dep1 should have been destroyed")
+	}
+}
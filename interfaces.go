@@ -26,28 +26,57 @@ import (
 type ConsoleEffect func(a ...interface{}) string
 
 // BaseDeployment hold information about the deployments and is serialized
-// to JSON.  CloudOpts is defined by the specific plugin in use.
+// to JSON.  CloudOpts is defined by the specific plugin in use.  Expires is
+// set when the deployment was launched with a time to live and Stopped when
+// its instance was stopped.  Variables are terraform variables that are set
+// in the environment whenever the deployment is loaded.
 type BaseDeployment struct {
-	Type            string      `json:"type,omitempty"`
-	Name            string      `json:"name,omitempty"`
-	Directory       string      `json:"directory,omitempty"`
-	Version         string      `json:"version,omitempty"`
-	PrivateKey      string      `json:"private_key,omitempty"`
-	CustomPropsFile string      `json:"custom_props,omitempty"`
-	CustomLog4J     string      `json:"custom_log4j,omitempty"`
-	IdleTimeout     int         `json:"idle_timeout,omitempty"`
-	Environment     []string    `json:"environment,omitempty"`
-	DisableSecurity bool        `json:"disable_security,omitempty"`
-	CloudOpts       interface{} `json:"cloud_opts,omitempty"`
-	CustomScript    string      `json:"custom_script,omitempty"`
-	CustomZkScript  string      `json:"custom_zk_script,omitempty"`
+	Type            string            `json:"type,omitempty"`
+	Name            string            `json:"name,omitempty"`
+	Directory       string            `json:"directory,omitempty"`
+	Version         string            `json:"version,omitempty"`
+	PrivateKey      string            `json:"private_key,omitempty"`
+	CustomPropsFile string            `json:"custom_props,omitempty"`
+	CustomLog4J     string            `json:"custom_log4j,omitempty"`
+	IdleTimeout     int               `json:"idle_timeout,omitempty"`
+	Environment     []string          `json:"environment,omitempty"`
+	DisableSecurity bool              `json:"disable_security,omitempty"`
+	CloudOpts       interface{}       `json:"cloud_opts,omitempty"`
+	CustomScript    string            `json:"custom_script,omitempty"`
+	CustomZkScript  string            `json:"custom_zk_script,omitempty"`
+	State           string            `json:"state,omitempty"`
+	Launch          *LaunchParameters `json:"launch,omitempty"`
+	Created         *time.Time        `json:"created,omitempty"`
+	Expires         *time.Time        `json:"expires,omitempty"`
+	Stopped         *time.Time        `json:"stopped,omitempty"`
+	Variables       map[string]string `json:"variables,omitempty"`
+	Credentials     *CredentialRef    `json:"credentials,omitempty"`
+	TLSCABundle     string            `json:"tls_ca_bundle,omitempty"`
+}
+
+// LaunchParameters records the values used to create the volumes and the
+// instance so that an interrupted launch can be resumed.
+type LaunchParameters struct {
+	LicensePath          string `json:"license,omitempty"`
+	VolumeSize           int    `json:"volume_size,omitempty"`
+	ClusterSize          int    `json:"cluster_size,omitempty"`
+	RootVolumeSize       int    `json:"root_volume_size,omitempty"`
+	ZkSize               int    `json:"zookeeper_size,omitempty"`
+	IdleTimeout          int    `json:"idle_timeout,omitempty"`
+	HTTPMask             string `json:"http_mask,omitempty"`
+	BastionVolSnapshotID string `json:"bastion_volume_snapshot_id,omitempty"`
+	SnapshotSetID        string `json:"snapshot_set,omitempty"`
 }
 
 // AppContext provides and abstraction to logging, console interaction and
-// basic configuration information
+// basic configuration information.  SetResult records the structured result
+// of the running command for the machine readable output formats.  LogWith
+// is Logf with structured fields attached to the line.
 type AppContext interface {
 	ConsoleLog(level int, format string, v ...interface{})
+	SetResult(result interface{})
 	Logf(level int, format string, v ...interface{})
+	LogWith(level int, fields LogFields, format string, v ...interface{})
 	GetConfigDir() string
 	GetVersion() string
 	GetInteractive() bool
@@ -62,28 +91,79 @@ type StardogDescription struct {
 	StardogURL          string      `json:"stardog_url,omitempty"`
 	StardogInternalURL  string      `json:"stardog_internal_url,omitempty"`
 	StardogNodes        []string    `json:"stardog_nodes,omitempty"`
+	ZookeeperHealthURLs []string    `json:"zookeeper_health_urls,omitempty"`
 	SSHHost             string      `json:"ssh_host,omitempty"`
 	Healthy             bool        `json:"healthy,omitempty"`
+	State               string      `json:"state,omitempty"`
 	TimeStamp           time.Time   `json:"timestamp,omitempty"`
 	VolumeDescription   interface{} `json:"volume,omitempty"`
 	InstanceDescription interface{} `json:"instance,omitempty"`
 }
 
+// ImageDescription identifies a base image made by baseami.  It is the
+// structured result of the build and copy commands.
+type ImageDescription struct {
+	Version string `json:"version,omitempty"`
+	Region  string `json:"region,omitempty"`
+	Image   string `json:"image,omitempty"`
+}
+
 // Deployment is an interface to a plugin that is managing the actual Stardog services.
 type Deployment interface {
 	CreateVolumeSet(licensePath string, sizeOfEachVolume int, clusterSize int) error
+	// PlanVolumeSet reports what CreateVolumeSet would create without
+	// changing anything.
+	PlanVolumeSet(licensePath string, sizeOfEachVolume int, clusterSize int) (*PlanSummary, error)
 	DeleteVolumeSet() error
+	// PlanDeleteVolumeSet reports what DeleteVolumeSet would delete.
+	PlanDeleteVolumeSet() (*PlanSummary, error)
 	StatusVolumeSet() error
 	VolumeExists() bool
 	ClusterSize() (int, error)
+	// ResizeCluster adds or removes volumes and Stardog nodes so that
+	// clusterSize of them exist.
+	ResizeCluster(clusterSize int) error
+	// SnapshotVolumeSet snapshots every volume and returns the ids of the
+	// snapshots, one for each volume.
+	SnapshotVolumeSet(tag string) ([]string, error)
+	// CreateVolumeSetFromSnapshots creates one volume from each snapshot.
+	CreateVolumeSetFromSnapshots(snapshotIDs []string, sizeOfEachVolume int) error
+	// DeleteVolumeSnapshots deletes snapshots made by SnapshotVolumeSet.
+	DeleteVolumeSnapshots(snapshotIDs []string) error
 
 	CreateInstance(volumeSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) error
+	// PlanInstance reports what CreateInstance would create.  It is given
+	// the cluster size because the volumes may not exist yet.
+	PlanInstance(clusterSize int, volumeSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) (*PlanSummary, error)
 	OpenInstance(volumeSize int, zookeeperSize int, mask string, idleTimeout int) error
 	DeleteInstance() error
+	// PlanDeleteInstance reports what DeleteInstance would delete.
+	PlanDeleteInstance() (*PlanSummary, error)
 	StatusInstance() error
 	InstanceExists() bool
+	// StopInstance stops the Stardog and zookeeper nodes but keeps the
+	// volumes and everything needed for StartInstance.
+	StopInstance() error
+	// StartInstance brings back the nodes stopped by StopInstance.
+	StartInstance() error
+	// ZookeeperSize returns the number of nodes in the zookeeper ensemble.
+	ZookeeperSize() (int, error)
+	// ReplaceZookeeperNode recreates the zookeeper node at index ndx for an
+	// ensemble of zookeeperSize nodes, or removes it when ndx is outside of
+	// the ensemble.
+	ReplaceZookeeperNode(zookeeperSize int, ndx int) error
+	// UpdateImage records the image that replaced Stardog nodes start from.
+	UpdateImage() error
+	// ReplaceStardogNode recreates the Stardog node at index ndx on the same
+	// data volume.
+	ReplaceStardogNode(ndx int) error
 
 	FullStatus() (*StardogDescription, error)
+	// Drift compares what the plugin recorded with what exists in the cloud.
+	Drift() ([]DriftItem, error)
+	// EstimateCost prices the deployment with the given sizes.  The parts
+	// that already exist are priced as they are.
+	EstimateCost(sizeOfEachVolume int, clusterSize int, rootVolumeSize int, zookeeperSize int) (*CostEstimate, error)
 
 	DestroyDeployment() error
 }
@@ -102,24 +182,47 @@ type CommandOpts struct {
 	PasswdCmd            *kingpin.CmdClause
 	AboutCmd             *kingpin.CmdClause
 	BuildCmd             *kingpin.CmdClause
+	CopyImageCmd         *kingpin.CmdClause
 	NewDeploymentCmd     *kingpin.CmdClause
 	DestroyDeploymentCmd *kingpin.CmdClause
 	ListDeploymentCmd    *kingpin.CmdClause
 	NewVolumesCmd        *kingpin.CmdClause
 	DestroyVolumesCmd    *kingpin.CmdClause
 	StatusVolumesCmd     *kingpin.CmdClause
+	SnapshotVolumesCmd   *kingpin.CmdClause
+	BackupScheduleCmd    *kingpin.CmdClause
+	BackupListCmd        *kingpin.CmdClause
+	BackupRestoreCmd     *kingpin.CmdClause
 	LaunchInstanceCmd    *kingpin.CmdClause
 	DestroyInstanceCmd   *kingpin.CmdClause
 	StatusInstanceCmd    *kingpin.CmdClause
+	StopInstanceCmd      *kingpin.CmdClause
+	StartInstanceCmd     *kingpin.CmdClause
+	ResumeCmd            *kingpin.CmdClause
+	ScaleCmd             *kingpin.CmdClause
+	ZkResizeCmd          *kingpin.CmdClause
+	ZkReplaceCmd         *kingpin.CmdClause
+	ReimageCmd           *kingpin.CmdClause
 }
 
-// Plugin defines the interface for adding drivers to the system
+// Plugin defines the interface for adding drivers to the system.
+// DeploymentOptions returns the options of a deployment with the names that
+// LoadDefaults accepts.  PlanDeployment is the dry run of DeploymentLoader
+// for a new deployment.  The deployment it returns is only held in memory,
+// it works in baseD.Directory and the plan lists what defining it would
+// create.
 type Plugin interface {
 	Register(cmdOpts *CommandOpts) error
 	DeploymentLoader(context AppContext, baseD *BaseDeployment, new bool) (Deployment, error)
+	PlanDeployment(context AppContext, baseD *BaseDeployment) (Deployment, *PlanSummary, error)
 	LoadDefaults(defaultCliOpts interface{}) error
 	BuildImage(context AppContext, sdReleaseFilePath string, version string) error
 	GetName() string
 	FindLeaks(context AppContext, deploymentName string, destroy bool, force bool) error
 	HaveImage(context AppContext) bool
+	CopyImage(context AppContext, regions []string) error
+	GetRegion() string
+	DeploymentRegion(baseD *BaseDeployment) string
+	DeploymentImage(baseD *BaseDeployment) string
+	DeploymentOptions(baseD *BaseDeployment) map[string]interface{}
 }
@@ -0,0 +1,322 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"time"
+)
+
+// The steps that a deployment goes through on its way to a healthy Stardog
+// cluster.  They are recorded in config.json in this order.
+const (
+	StateDefined         = "defined"
+	StateVolumesCreated  = "volumes-created"
+	StateInstanceCreated = "instance-created"
+	StatePasswordSet     = "password-set"
+	StateOpened          = "opened"
+	StateHealthy         = "healthy"
+)
+
+var (
+	lifecycleStates = []string{
+		StateDefined,
+		StateVolumesCreated,
+		StateInstanceCreated,
+		StatePasswordSet,
+		StateOpened,
+		StateHealthy,
+	}
+)
+
+// StateIndex returns the position of the state in the lifecycle.  Deployments
+// created before the state was recorded are treated as defined.
+func StateIndex(state string) int {
+	for i, s := range lifecycleStates {
+		if s == state {
+			return i
+		}
+	}
+	return 0
+}
+
+// StateReached returns true if the deployment has completed the given step.
+func StateReached(baseD *BaseDeployment, state string) bool {
+	return StateIndex(baseD.State) >= StateIndex(state)
+}
+
+// SetDeploymentState records the lifecycle step, the launch parameters, the
+// expiry and whether the instance is stopped in the config.json file of the
+// deployment.  The rest of the file, which is
+// owned by the plugin, is left untouched.
+func SetDeploymentState(context AppContext, baseD *BaseDeployment, state string) error {
+	confPath := path.Join(baseD.Directory, "config.json")
+	data, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return err
+	}
+	conf := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return err
+	}
+	stateData, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	conf["state"] = stateData
+	if baseD.Launch != nil {
+		launchData, err := json.Marshal(baseD.Launch)
+		if err != nil {
+			return err
+		}
+		conf["launch"] = launchData
+	}
+	for key, t := range map[string]*time.Time{"expires": baseD.Expires, "stopped": baseD.Stopped} {
+		if t == nil {
+			delete(conf, key)
+			continue
+		}
+		timeData, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		conf[key] = timeData
+	}
+	err = WriteJSON(conf, confPath)
+	if err != nil {
+		return err
+	}
+	context.LogWith(INFO, LogFields{"phase": state}, "The deployment %s moved from %s to %s", baseD.Name, baseD.State, state)
+	baseD.State = state
+	return nil
+}
+
+// SetDeploymentSettings records the Stardog version, the environment, the
+// custom files and whether security is disabled in the config.json file of
+// the deployment.  As with SetDeploymentState the rest of the file is left
+// untouched.
+func SetDeploymentSettings(baseD *BaseDeployment) error {
+	confPath := path.Join(baseD.Directory, "config.json")
+	data, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return err
+	}
+	conf := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return err
+	}
+	settings := map[string]interface{}{
+		"version":          baseD.Version,
+		"environment":      baseD.Environment,
+		"custom_props":     baseD.CustomPropsFile,
+		"custom_log4j":     baseD.CustomLog4J,
+		"custom_script":    baseD.CustomScript,
+		"custom_zk_script": baseD.CustomZkScript,
+		"disable_security": baseD.DisableSecurity,
+	}
+	for key, value := range settings {
+		valueData, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		switch string(valueData) {
+		case `""`, "null", "false":
+			// The fields are omitted when empty as they are when the
+			// deployment is made.
+			delete(conf, key)
+		default:
+			conf[key] = valueData
+		}
+	}
+	return WriteJSON(conf, confPath)
+}
+
+func launchParameters(baseD *BaseDeployment) *LaunchParameters {
+	if baseD.Launch == nil {
+		baseD.Launch = &LaunchParameters{}
+	}
+	return baseD.Launch
+}
+
+// CreateVolumes wraps up the deployment.CreateVolumeSet method and records
+// the step in the deployment lifecycle.
+func CreateVolumes(context AppContext, baseD *BaseDeployment, dep Deployment, licensePath string, sizeOfEachVolume int, clusterSize int) error {
+	lp := launchParameters(baseD)
+	lp.SnapshotSetID = ""
+	lp.LicensePath = licensePath
+	lp.VolumeSize = sizeOfEachVolume
+	lp.ClusterSize = clusterSize
+	err := dep.CreateVolumeSet(licensePath, sizeOfEachVolume, clusterSize)
+	if err != nil {
+		return err
+	}
+	return SetDeploymentState(context, baseD, StateVolumesCreated)
+}
+
+// DeleteVolumes wraps up the deployment.DeleteVolumeSet method and moves the
+// deployment back to the defined step.
+func DeleteVolumes(context AppContext, baseD *BaseDeployment, dep Deployment) error {
+	err := dep.DeleteVolumeSet()
+	if err != nil {
+		return err
+	}
+	return SetDeploymentState(context, baseD, StateDefined)
+}
+
+// DeleteInstance wraps up the deployment.DeleteInstance method and moves the
+// deployment back to the volumes-created step.
+func DeleteInstance(context AppContext, baseD *BaseDeployment, dep Deployment) error {
+	err := dep.DeleteInstance()
+	if err != nil {
+		return err
+	}
+	state := StateDefined
+	if dep.VolumeExists() {
+		state = StateVolumesCreated
+	}
+	return SetDeploymentState(context, baseD, state)
+}
+
+// ResumeDeployment continues an interrupted launch from the last step that was
+// recorded as complete.
+func ResumeDeployment(context AppContext, baseD *BaseDeployment, dep Deployment, waitMaxTimeSec int) error {
+	context.ConsoleLog(1, "The deployment %s is at the step %s\n", baseD.Name, context.HighlightString(CurrentState(baseD)))
+	if StateReached(baseD, StateHealthy) {
+		context.ConsoleLog(1, "There is nothing left to do.\n")
+		return nil
+	}
+	lp := baseD.Launch
+	if !StateReached(baseD, StateVolumesCreated) && lp != nil && lp.SnapshotSetID != "" {
+		context.ConsoleLog(1, "Creating the volumes from the snapshot set %s...\n", lp.SnapshotSetID)
+		err := CreateVolumesFromSnapshots(context, baseD, dep, lp.SnapshotSetID)
+		if err != nil {
+			return err
+		}
+	}
+	if !StateReached(baseD, StateVolumesCreated) {
+		if lp == nil || lp.LicensePath == "" || lp.ClusterSize < 1 {
+			return errors.New("The volume parameters were never recorded for this deployment, please use the volume new command")
+		}
+		context.ConsoleLog(1, "Creating the volumes...\n")
+		err := CreateVolumes(context, baseD, dep, lp.LicensePath, lp.VolumeSize, lp.ClusterSize)
+		if err != nil {
+			return err
+		}
+	}
+	lp = baseD.Launch
+	if lp == nil || lp.ZkSize < 1 {
+		return errors.New("The instance parameters were never recorded for this deployment, please use the instance new command")
+	}
+	if !StateReached(baseD, StateInstanceCreated) {
+		context.ConsoleLog(1, "Creating the instance...\n")
+		err := dep.CreateInstance(lp.RootVolumeSize, lp.ZkSize, lp.IdleTimeout, lp.BastionVolSnapshotID)
+		if err != nil {
+			return err
+		}
+		err = SetDeploymentState(context, baseD, StateInstanceCreated)
+		if err != nil {
+			return err
+		}
+	}
+	return finishInstance(context, baseD, dep, waitMaxTimeSec)
+}
+
+// CurrentState returns the recorded lifecycle step of the deployment.
+func CurrentState(baseD *BaseDeployment) string {
+	if baseD.State == "" {
+		return StateDefined
+	}
+	return baseD.State
+}
+
+// StopDeployment stops the instance of the deployment and records when it was
+// stopped.  The volumes are kept so that StartDeployment can bring the same
+// cluster back.
+func StopDeployment(context AppContext, baseD *BaseDeployment, dep Deployment) error {
+	if !dep.InstanceExists() {
+		return fmt.Errorf("The deployment %s has no instance to stop", baseD.Name)
+	}
+	if baseD.Stopped != nil {
+		context.ConsoleLog(1, "The instance of %s was already stopped at %s.\n", baseD.Name, baseD.Stopped.Local().Format(time.RFC1123))
+		return nil
+	}
+	err := dep.StopInstance()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	baseD.Stopped = &now
+	return SetDeploymentState(context, baseD, CurrentState(baseD))
+}
+
+// StartDeployment starts the instance of a stopped deployment and blocks
+// until all of its Stardog nodes are back in the cluster.
+func StartDeployment(context AppContext, baseD *BaseDeployment, dep Deployment, waitMaxTimeSec int) error {
+	if !dep.InstanceExists() {
+		return fmt.Errorf("The deployment %s has no instance to start", baseD.Name)
+	}
+	err := dep.StartInstance()
+	if err != nil {
+		return err
+	}
+	baseD.Stopped = nil
+	err = SetDeploymentState(context, baseD, CurrentState(baseD))
+	if err != nil {
+		return err
+	}
+	context.ConsoleLog(1, "Waiting for stardog to come up...\n")
+	err = WaitForHealth(context, baseD, dep, waitMaxTimeSec, true)
+	if err != nil {
+		return err
+	}
+	sd, err := dep.FullStatus()
+	if err != nil {
+		return err
+	}
+	clusterSize, err := dep.ClusterSize()
+	if err != nil {
+		return err
+	}
+	return WaitForNClusterNodes(context, clusterSize, sd.StardogURL, AdminPassword(context, baseD), waitMaxTimeSec, stardogClientOptions(baseD))
+}
+
+// Expired returns true when the deployment was launched with a time to live
+// that has passed by now.
+func Expired(baseD *BaseDeployment, now time.Time) bool {
+	return baseD.Expires != nil && now.After(*baseD.Expires)
+}
+
+// ExpiredDeployments lists the deployments whose time to live has passed and
+// whose instance was not stopped.
+func ExpiredDeployments(context AppContext, now time.Time) ([]*BaseDeployment, error) {
+	deployments, err := ListDeployments(context)
+	if err != nil {
+		return nil, err
+	}
+	expired := []*BaseDeployment{}
+	for _, baseD := range deployments {
+		if Expired(baseD, now) && baseD.Stopped == nil {
+			expired = append(expired, baseD)
+		}
+	}
+	return expired, nil
+}
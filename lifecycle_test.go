@@ -0,0 +1,136 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestStateReached(t *testing.T) {
+	baseD := BaseDeployment{}
+	if CurrentState(&baseD) != StateDefined {
+		t.Fatal("An old deployment should be defined")
+	}
+	if StateReached(&baseD, StateVolumesCreated) {
+		t.Fatal("The volumes should not be created")
+	}
+	baseD.State = StatePasswordSet
+	if !StateReached(&baseD, StateInstanceCreated) || !StateReached(&baseD, StatePasswordSet) {
+		t.Fatal("The earlier steps should be reached")
+	}
+	if StateReached(&baseD, StateOpened) {
+		t.Fatal("The instance should not be opened")
+	}
+}
+
+func TestSetDeploymentState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardogtest")
+	if err != nil {
+		t.Fatal("Temp dir failed")
+	}
+	defer os.RemoveAll(dir)
+
+	app := TestContext{
+		ConfigDir: dir,
+		Version:   "test1",
+	}
+	baseD := BaseDeployment{
+		Type:      "notreal",
+		Name:      "notreal",
+		Directory: dir,
+	}
+	confPath := path.Join(dir, "config.json")
+	err = ioutil.WriteFile(confPath, []byte(`{"name": "notreal", "type": "notreal", "cloud_opts": {"region": "here"}}`), 0600)
+	if err != nil {
+		t.Fatal("Failed to write the config")
+	}
+	launchParameters(&baseD).ZkSize = 3
+	err = SetDeploymentState(&app, &baseD, StateInstanceCreated)
+	if err != nil {
+		t.Fatalf("Failed to set the state %s", err)
+	}
+	if baseD.State != StateInstanceCreated {
+		t.Fatal("The state was not updated")
+	}
+
+	conf := make(map[string]interface{})
+	err = LoadJSON(&conf, confPath)
+	if err != nil {
+		t.Fatalf("Failed to load the config %s", err)
+	}
+	if conf["state"] != StateInstanceCreated {
+		t.Fatalf("The state was not written %v", conf)
+	}
+	if _, ok := conf["cloud_opts"]; !ok {
+		t.Fatalf("The plugin options were lost %v", conf)
+	}
+
+	loaded := BaseDeployment{}
+	err = LoadJSON(&loaded, confPath)
+	if err != nil {
+		t.Fatalf("Failed to load the deployment %s", err)
+	}
+	if loaded.State != StateInstanceCreated || loaded.Launch == nil || loaded.Launch.ZkSize != 3 {
+		t.Fatalf("The deployment did not round trip %v", loaded)
+	}
+}
+
+func TestStopDeploymentAndExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardogtest")
+	if err != nil {
+		t.Fatal("Temp dir failed")
+	}
+	defer os.RemoveAll(dir)
+	app := TestContext{ConfigDir: dir}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	for name, expires := range map[string]*time.Time{"old": &past, "new": &future, "forever": nil} {
+		baseD := BaseDeployment{Name: name, Type: "notreal", Directory: DeploymentDir(dir, name), Expires: expires}
+		os.MkdirAll(baseD.Directory, 0755)
+		err = WriteJSON(&baseD, path.Join(baseD.Directory, "config.json"))
+		if err != nil {
+			t.Fatalf("Failed to write the config %s", err)
+		}
+	}
+	expired, err := ExpiredDeployments(&app, time.Now())
+	if err != nil || len(expired) != 1 || expired[0].Name != "old" {
+		t.Fatalf("Only old should be expired %v %s", expired, err)
+	}
+
+	dep := tpDeployment{}
+	err = StopDeployment(&app, expired[0], &dep)
+	if err == nil {
+		t.Fatal("There is no instance to stop")
+	}
+	dep.TstInstanceExists = true
+	err = StopDeployment(&app, expired[0], &dep)
+	if err != nil {
+		t.Fatalf("Failed to stop %s", err)
+	}
+	loaded, err := ReadBaseDeployment(&app, "old")
+	if err != nil || loaded.Stopped == nil || loaded.Expires == nil {
+		t.Fatalf("The stop was not recorded %v %s", loaded, err)
+	}
+	expired, err = ExpiredDeployments(&app, time.Now())
+	if err != nil || len(expired) != 0 {
+		t.Fatalf("A stopped deployment is not reported again %v %s", expired, err)
+	}
+}
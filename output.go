@@ -0,0 +1,61 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// OutputFormats lists the document formats that a command result can be
+// written in.  text is the normal human readable console output.
+var OutputFormats = []string{"text", "json", "yaml"}
+
+// WriteOutput encodes doc in the given format and writes it to w.  The YAML
+// form is made from the JSON encoding so that both formats use the same
+// field names.
+func WriteOutput(w io.Writer, format string, doc interface{}) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+	case "yaml":
+		var generic interface{}
+		err = yaml.Unmarshal(data, &generic)
+		if err != nil {
+			return err
+		}
+		data, err = yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("The output format %s is not supported", format)
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+	if data[len(data)-1] != '\n' {
+		_, err = w.Write([]byte("\n"))
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteOutput(t *testing.T) {
+	sd := StardogDescription{StardogURL: "http://host:5821", StardogNodes: []string{"a:5821", "b:5821"}}
+
+	var buf bytes.Buffer
+	err := WriteOutput(&buf, "json", &sd)
+	if err != nil {
+		t.Fatalf("Failed to write json %s", err)
+	}
+	var back StardogDescription
+	err = json.Unmarshal(buf.Bytes(), &back)
+	if err != nil {
+		t.Fatalf("The json output did not parse %s", err)
+	}
+	if back.StardogURL != sd.StardogURL || len(back.StardogNodes) != 2 {
+		t.Fatalf("The json output is wrong %s", buf.String())
+	}
+
+	buf.Reset()
+	err = WriteOutput(&buf, "yaml", &sd)
+	if err != nil {
+		t.Fatalf("Failed to write yaml %s", err)
+	}
+	if !strings.Contains(buf.String(), "stardog_url: http://host:5821\n") || !strings.Contains(buf.String(), "- a:5821\n") {
+		t.Fatalf("The yaml output should use the json field names %s", buf.String())
+	}
+
+	if WriteOutput(&buf, "xml", &sd) == nil {
+		t.Fatal("xml is not a supported format")
+	}
+}
@@ -0,0 +1,187 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// PlanAdd is the action of a resource that would be created.
+	PlanAdd = "add"
+	// PlanChange is the action of a resource that would be updated in place.
+	PlanChange = "change"
+	// PlanDestroy is the action of a resource that would be destroyed.
+	PlanDestroy = "destroy"
+	// PlanReplace is the action of a resource that would be destroyed and
+	// created again.  It is only found in the results of
+	// TerraformPlanScanner.
+	PlanReplace = "replace"
+)
+
+// PlanSummary counts the resources that a command would add, change or
+// destroy by resource type.  It is the result of a dry run.
+type PlanSummary struct {
+	Add     map[string]int `json:"add,omitempty"`
+	Change  map[string]int `json:"change,omitempty"`
+	Destroy map[string]int `json:"destroy,omitempty"`
+}
+
+// NewPlanSummary returns a PlanSummary with nothing planned.
+func NewPlanSummary() *PlanSummary {
+	return &PlanSummary{
+		Add:     make(map[string]int),
+		Change:  make(map[string]int),
+		Destroy: make(map[string]int),
+	}
+}
+
+// Record adds count resources of resourceType to the given action.
+func (p *PlanSummary) Record(action string, resourceType string, count int) {
+	if count < 1 {
+		return
+	}
+	switch action {
+	case PlanAdd:
+		p.Add[resourceType] += count
+	case PlanChange:
+		p.Change[resourceType] += count
+	case PlanDestroy:
+		p.Destroy[resourceType] += count
+	}
+}
+
+// Merge adds every resource planned in other to p.
+func (p *PlanSummary) Merge(other *PlanSummary) {
+	if other == nil {
+		return
+	}
+	for t, n := range other.Add {
+		p.Record(PlanAdd, t, n)
+	}
+	for t, n := range other.Change {
+		p.Record(PlanChange, t, n)
+	}
+	for t, n := range other.Destroy {
+		p.Record(PlanDestroy, t, n)
+	}
+}
+
+// Empty is true when nothing would be touched.
+func (p *PlanSummary) Empty() bool {
+	return len(p.Add) == 0 && len(p.Change) == 0 && len(p.Destroy) == 0
+}
+
+func planTotal(counts map[string]int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+// ShowPlan prints the plan grouped by action and records it as the result of
+// the command.
+func ShowPlan(context AppContext, plan *PlanSummary) {
+	context.SetResult(plan)
+	if plan.Empty() {
+		context.ConsoleLog(1, "Dry run: no resources would be changed.\n")
+		return
+	}
+	context.ConsoleLog(1, "Dry run: %d to add, %d to change, %d to destroy.\n",
+		planTotal(plan.Add), planTotal(plan.Change), planTotal(plan.Destroy))
+	actions := []struct {
+		name   string
+		counts map[string]int
+	}{
+		{PlanAdd, plan.Add},
+		{PlanChange, plan.Change},
+		{PlanDestroy, plan.Destroy},
+	}
+	for _, a := range actions {
+		types := make([]string, 0, len(a.counts))
+		for t := range a.counts {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			context.ConsoleLog(1, "  %-8s %3d %s\n", a.name, a.counts[t], t)
+		}
+	}
+}
+
+// The resource lines of terraform plan -no-color start with the action
+// symbol followed by the resource address, for example
+// "  + aws_instance.bastion" or "-/+ aws_elb.stardog (new resource required)".
+var planLineRegex = regexp.MustCompile(`^\s*(\+|-|~|-/\+|\+/-|<=)\s+([A-Za-z0-9_.\[\]-]+)`)
+
+// TerraformPlanScanner is a LineScanner for the output of terraform plan
+// -no-color.  The Key of the result is the action and the Value is the
+// address of the resource.  Data sources that are only read are ignored.
+func TerraformPlanScanner(cliContext AppContext, line string) *ScanResult {
+	m := planLineRegex.FindStringSubmatch(line)
+	if m == nil || PlanResourceType(m[2]) == "" {
+		return nil
+	}
+	switch m[1] {
+	case "+":
+		return &ScanResult{Key: PlanAdd, Value: m[2]}
+	case "-":
+		return &ScanResult{Key: PlanDestroy, Value: m[2]}
+	case "~":
+		return &ScanResult{Key: PlanChange, Value: m[2]}
+	case "-/+", "+/-":
+		return &ScanResult{Key: PlanReplace, Value: m[2]}
+	}
+	return nil
+}
+
+// NewTerraformPlanSummary counts the results of TerraformPlanScanner by
+// resource type.  A resource that must be replaced is counted as both
+// destroyed and added.
+func NewTerraformPlanSummary(results *[]ScanResult) *PlanSummary {
+	plan := NewPlanSummary()
+	if results == nil {
+		return plan
+	}
+	for _, r := range *results {
+		resourceType := PlanResourceType(r.Value)
+		if r.Key == PlanReplace {
+			plan.Record(PlanDestroy, resourceType, 1)
+			plan.Record(PlanAdd, resourceType, 1)
+			continue
+		}
+		plan.Record(r.Key, resourceType, 1)
+	}
+	return plan
+}
+
+// PlanResourceType returns the type of a terraform resource address, for
+// example aws_instance for module.x.aws_instance.bastion[0].  An empty
+// string is returned for data sources and for anything that is not an
+// address.
+func PlanResourceType(address string) string {
+	parts := strings.Split(address, ".")
+	for len(parts) >= 2 && parts[0] == "module" {
+		parts = parts[2:]
+	}
+	if len(parts) < 2 || parts[0] == "data" {
+		return ""
+	}
+	return parts[0]
+}
@@ -0,0 +1,106 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"strings"
+	"testing"
+)
+
+const terraformPlanOutput = `Refreshing Terraform state in-memory prior to plan...
+
+data.aws_availability_zones.available: Refreshing state...
+aws_ebs_volume.stardog_data.0: Refreshing state... (ID: vol-0a1b)
+
+------------------------------------------------------------------------
+
+An execution plan has been generated and is shown below.
+Resource actions are indicated with the following symbols:
+  + create
+  ~ update in-place
+  - destroy
+-/+ destroy and then create replacement
+ <= read (data resources)
+
+Terraform will perform the following actions:
+
+ <= data.template_file.userdata
+      id:                        <computed>
+
+  + aws_ebs_volume.stardog_data[1]
+      id:                        <computed>
+      size:                      "10"
+
+  + aws_ebs_volume.stardog_data[2]
+      id:                        <computed>
+
+  ~ aws_security_group.stardog
+      ingress.#:                 "1" => "2"
+
+-/+ aws_elb.stardog (new resource required)
+      id:                        "sd-elb" => <computed> (forces new resource)
+
+  - module.zk.aws_instance.zookeeper[2]
+
+
+Plan: 3 to add, 1 to change, 2 to destroy.
+`
+
+func TestTerraformPlanScanner(t *testing.T) {
+	var results []ScanResult
+	for _, line := range strings.Split(terraformPlanOutput, "\n") {
+		r := TerraformPlanScanner(&TestContext{}, line)
+		if r != nil {
+			results = append(results, *r)
+		}
+	}
+	if len(results) != 5 {
+		t.Fatalf("There should be 5 resource lines %v", results)
+	}
+	plan := NewTerraformPlanSummary(&results)
+	if plan.Add["aws_ebs_volume"] != 2 || plan.Add["aws_elb"] != 1 || len(plan.Add) != 2 {
+		t.Fatalf("The added resources are wrong %v", plan.Add)
+	}
+	if plan.Change["aws_security_group"] != 1 || len(plan.Change) != 1 {
+		t.Fatalf("The changed resources are wrong %v", plan.Change)
+	}
+	if plan.Destroy["aws_elb"] != 1 || plan.Destroy["aws_instance"] != 1 || len(plan.Destroy) != 2 {
+		t.Fatalf("The destroyed resources are wrong %v", plan.Destroy)
+	}
+}
+
+func TestPlanSummary(t *testing.T) {
+	plan := NewPlanSummary()
+	if !plan.Empty() {
+		t.Fatal("A new plan should be empty")
+	}
+	plan.Record(PlanAdd, "fake_volume", 0)
+	if !plan.Empty() {
+		t.Fatal("Nothing was planned")
+	}
+	other := NewPlanSummary()
+	other.Record(PlanAdd, "fake_volume", 2)
+	other.Record(PlanDestroy, "fake_instance", 1)
+	plan.Record(PlanAdd, "fake_volume", 1)
+	plan.Merge(other)
+	plan.Merge(nil)
+	if plan.Add["fake_volume"] != 3 || plan.Destroy["fake_instance"] != 1 || plan.Empty() {
+		t.Fatalf("The merge is wrong %v", plan)
+	}
+	if PlanResourceType("data.aws_ami.base") != "" || PlanResourceType("create") != "" || PlanResourceType("module.a.module.b.aws_elb.x") != "aws_elb" {
+		t.Fatal("The resource types are wrong")
+	}
+}
@@ -0,0 +1,211 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaDraft is the JSON Schema version of the schemas made by SchemaFor.
+const SchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema is the part of JSON Schema that is needed to describe the
+// configuration files.  AdditionalProperties is either false or the
+// *JSONSchema of the values of a map.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaFor describes the JSON encoding of v.  The fields of structs are
+// named by their json tags and fields that are not encoded are left out.
+// Structs do not allow other properties.
+func SchemaFor(v interface{}) *JSONSchema {
+	return schemaForType(reflect.TypeOf(v))
+}
+
+func schemaForType(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema), AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			s.Properties[name] = schemaForType(f.Type)
+		}
+		return s
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaForType(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaForType(t.Elem())}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	}
+	return &JSONSchema{}
+}
+
+func jsonTypeName(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case float64:
+		if t == math.Trunc(t) {
+			return "an integer"
+		}
+		return "a number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Validate checks a document decoded by encoding/json against the schema
+// and returns a description of every problem found.  where names the
+// document in the descriptions.
+func (s *JSONSchema) Validate(doc interface{}, where string) []string {
+	if len(s.AnyOf) > 0 {
+		for _, option := range s.AnyOf {
+			if len(option.Validate(doc, where)) == 0 {
+				return nil
+			}
+		}
+		return []string{fmt.Sprintf("%s does not match any of the allowed forms", where)}
+	}
+	if len(s.Enum) > 0 {
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(doc) {
+				return nil
+			}
+		}
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			allowed[i] = fmt.Sprint(e)
+		}
+		return []string{fmt.Sprintf("%s must be one of %s", where, strings.Join(allowed, ", "))}
+	}
+
+	name := where
+	if name == "" {
+		name = "The document"
+	}
+	wrongType := []string{fmt.Sprintf("%s must be %s not %s", name, schemaTypeName(s.Type), jsonTypeName(doc))}
+	switch s.Type {
+	case "object":
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return wrongType
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		problems := []string{}
+		for _, k := range keys {
+			key := k
+			if where != "" {
+				key = fmt.Sprintf("%s.%s", where, k)
+			}
+			if p, ok := s.Properties[k]; ok {
+				problems = append(problems, p.Validate(m[k], key)...)
+			} else if additional, ok := s.AdditionalProperties.(*JSONSchema); ok {
+				problems = append(problems, additional.Validate(m[k], key)...)
+			} else {
+				problems = append(problems, fmt.Sprintf("%s is not a known option", key))
+			}
+		}
+		return problems
+	case "array":
+		a, ok := doc.([]interface{})
+		if !ok {
+			return wrongType
+		}
+		problems := []string{}
+		for i, e := range a {
+			if s.Items != nil {
+				problems = append(problems, s.Items.Validate(e, fmt.Sprintf("%s[%d]", where, i))...)
+			}
+		}
+		return problems
+	case "string":
+		if _, ok := doc.(string); !ok {
+			return wrongType
+		}
+	case "boolean":
+		if _, ok := doc.(bool); !ok {
+			return wrongType
+		}
+	case "integer":
+		if n, ok := doc.(float64); !ok || n != math.Trunc(n) {
+			return wrongType
+		}
+	case "number":
+		if _, ok := doc.(float64); !ok {
+			return wrongType
+		}
+	}
+	return nil
+}
+
+func schemaTypeName(t string) string {
+	switch t {
+	case "object", "array", "integer":
+		return "an " + t
+	}
+	return "a " + t
+}
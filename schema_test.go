@@ -0,0 +1,75 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaTestOptions struct {
+	Name    string            `json:"name,omitempty"`
+	Count   int               `json:"count"`
+	Enabled bool              `json:"enabled"`
+	Tags    []string          `json:"tags"`
+	Vars    map[string]string `json:"vars"`
+	When    *time.Time        `json:"when"`
+	Skipped string            `json:"-"`
+	hidden  string
+}
+
+func TestSchemaFor(t *testing.T) {
+	s := SchemaFor(&schemaTestOptions{})
+	if s.Type != "object" || s.AdditionalProperties != false || len(s.Properties) != 6 {
+		t.Fatalf("The struct schema is wrong %v", s)
+	}
+	if s.Properties["count"].Type != "integer" || s.Properties["tags"].Items.Type != "string" || s.Properties["when"].Format != "date-time" {
+		t.Fatalf("The field schemas are wrong %v", s.Properties)
+	}
+	if _, ok := s.Properties["Skipped"]; ok {
+		t.Fatal("Fields that are not encoded should be left out")
+	}
+
+	var doc interface{}
+	json.Unmarshal([]byte(`{"name": "a", "count": 2, "tags": ["x"], "vars": {"k": "v"}}`), &doc)
+	problems := s.Validate(doc, "")
+	if len(problems) != 0 {
+		t.Fatalf("The document should be valid %v", problems)
+	}
+	json.Unmarshal([]byte(`{"nmae": "a", "count": 2.5, "enabled": "yes", "tags": [1], "vars": {"k": 1}}`), &doc)
+	problems = s.Validate(doc, "")
+	expected := []string{
+		"count must be an integer not a number",
+		"enabled must be a boolean not a string",
+		"nmae is not a known option",
+		"tags[0] must be a string not an integer",
+		"vars.k must be a string not an integer",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("The problems are wrong %v", problems)
+	}
+
+	choice := &JSONSchema{AnyOf: []*JSONSchema{{Type: "string"}, {Type: "integer"}}}
+	if len(choice.Validate(float64(3), "x")) != 0 || len(choice.Validate(true, "x")) != 1 {
+		t.Fatal("anyOf was not checked")
+	}
+	enum := &JSONSchema{Type: "string", Enum: []interface{}{"text", "json"}}
+	if len(enum.Validate("json", "x")) != 0 || len(enum.Validate("xml", "x")) != 1 {
+		t.Fatal("enum was not checked")
+	}
+}
@@ -1,72 +1,248 @@
-package sdutils
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
 
+package sdutils
 
 import (
-	"io"
-	"fmt"
-	"net/http"
-	"io/ioutil"
 	"bytes"
 	"encoding/json"
-	"time"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// StardogClient talks to the HTTP API of a Stardog server or cluster, for
+// example through the load balancer of a deployment.  The txID of Query and
+// Update is the transaction returned by BeginTransaction or empty to run
+// outside of a transaction.
+type StardogClient interface {
+	GetClusterInfo() (*[]string, error)
+	ServerStatus() (map[string]interface{}, error)
+	Healthy() (bool, error)
+
+	ListDatabases() ([]string, error)
+	CreateDatabase(name string, options map[string]interface{}) error
+	DropDatabase(name string) error
+	OnlineDatabase(name string) error
+	OfflineDatabase(name string) error
+
+	ListUsers() ([]string, error)
+	CreateUser(name string, password string, superuser bool) error
+	DeleteUser(name string) error
+	ChangePassword(name string, password string) error
+	ListRoles() ([]string, error)
+	CreateRole(name string) error
+	DeleteRole(name string) error
+	AssignRole(user string, role string) error
+	UnassignRole(user string, role string) error
+
+	Query(db string, txID string, query string, accept string) ([]byte, error)
+	Update(db string, txID string, update string) error
+	BeginTransaction(db string) (string, error)
+	CommitTransaction(db string, txID string) error
+	RollbackTransaction(db string, txID string) error
+}
+
+// StardogClientOptions controls how a StardogClient makes requests.  Timeout
+// limits each request.  Requests that are answered with 503 Service
+// Unavailable are tried again up to Retries times, RetryWait apart.  The
+// requests that can safely be repeated are also tried again when they could
+// not be sent at all.  The certificates of https servers are verified
+// against the system roots and the PEM certificates in the CABundle file.
+type StardogClientOptions struct {
+	Timeout   time.Duration
+	Retries   int
+	RetryWait time.Duration
+	CABundle  string
+}
+
+// StardogRequestError is returned when Stardog answers with an unexpected
+// status code.
+type StardogRequestError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+func (e *StardogRequestError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("Stardog answered %s to %s with %d: %s", e.Method, e.URL, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("Stardog answered %s to %s with %d", e.Method, e.URL, e.StatusCode)
+}
+
+// DefaultStardogClientOptions returns the options used when none are given.
+// A cluster that is still starting answers 503 for a while.
+func DefaultStardogClientOptions() *StardogClientOptions {
+	return &StardogClientOptions{
+		Timeout:   30 * time.Second,
+		Retries:   10,
+		RetryWait: 2 * time.Second,
+	}
+}
+
+// pollingOptions returns a copy of opts, or of the defaults when opts is nil,
+// for a client that polls in a loop with its own deadline.  Requests are not
+// tried again and are cut short so that a single poll cannot outlast the
+// deadline by much.
+func pollingOptions(opts *StardogClientOptions) *StardogClientOptions {
+	if opts == nil {
+		opts = DefaultStardogClientOptions()
+	}
+	polling := *opts
+	polling.Retries = 0
+	if polling.Timeout <= 0 || polling.Timeout > 10*time.Second {
+		polling.Timeout = 10 * time.Second
+	}
+	return &polling
+}
+
 type stardogClientImpl struct {
 	sdURL    string
 	password string
 	username string
 	logger   SdVaLogger
+	opts     StardogClientOptions
+	client   *http.Client
+	err      error
 }
 
+// NewStardogClient returns a StardogClient for the server at sdURL.  When
+// opts is nil DefaultStardogClientOptions are used.  If the CA bundle cannot
+// be loaded every request fails with the reason.
+func NewStardogClient(sdURL string, username string, password string, logger SdVaLogger, opts *StardogClientOptions) StardogClient {
+	if opts == nil {
+		opts = DefaultStardogClientOptions()
+	}
+	client, err := NewHTTPClient(opts.CABundle, opts.Timeout)
+	return &stardogClientImpl{
+		sdURL:    strings.TrimRight(sdURL, "/"),
+		username: username,
+		password: password,
+		logger:   logger,
+		opts:     *opts,
+		client:   client,
+		err:      err,
+	}
+}
 
-func (s *stardogClientImpl) doRequest(method, urlStr string, body io.Reader, contentType string, expectedCode int) ([]byte, int, error) {
-	return s.doRequestWithAccept(method, urlStr, body, contentType, contentType, expectedCode)
+func idempotent(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "PUT" || method == "DELETE"
 }
 
-func (s *stardogClientImpl) doRequestWithAccept(method, urlStr string, body io.Reader, contentType string, accept string, expectedCode int) ([]byte, int, error) {
-	req, err := http.NewRequest(method, urlStr, body)
-	if err != nil {
-		return nil, -1, err
+// do sends a request to the path below the server URL and returns the body
+// of a successful answer.
+func (s *stardogClientImpl) do(method string, urlPath string, body []byte, contentType string, accept string) ([]byte, error) {
+	urlStr := s.sdURL + urlPath
+	if s.err != nil {
+		return nil, s.err
 	}
-	req.SetBasicAuth(s.username, s.password)
-	client := &http.Client{}
-	req.Header.Set("Content-Type", contentType)
-	if accept != "" {
-		req.Header.Set("Accept", accept)
+	for i := 0; ; i++ {
+		req, err := http.NewRequest(method, urlStr, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(s.username, s.password)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			if i < s.opts.Retries && idempotent(method) {
+				s.logger.Logf(WARN, "Failed to send %s to %s, trying again: %s", method, urlStr, err)
+				time.Sleep(s.opts.RetryWait)
+				continue
+			}
+			return nil, fmt.Errorf("Failed to send %s to %s: %s", method, urlStr, err)
+		}
+		content, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusServiceUnavailable && i < s.opts.Retries {
+			s.logger.Logf(WARN, "Stardog is not available for %s to %s, trying again", method, urlStr)
+			time.Sleep(s.opts.RetryWait)
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, &StardogRequestError{Method: method, URL: urlStr, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(content))}
+		}
+		s.logger.Logf(DEBUG, "Completed %s to %s", method, urlStr)
+		return content, nil
+	}
+}
+
+func (s *stardogClientImpl) doJSON(method string, urlPath string, in interface{}, out interface{}) error {
+	var body []byte
+	var err error
+	contentType := ""
+	if in != nil {
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		contentType = "application/json"
 	}
-	resp, err := client.Do(req)
+	content, err := s.do(method, urlPath, body, contentType, "application/json")
 	if err != nil {
-		return nil, -1, fmt.Errorf("Failed do the post %s", err)
+		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != expectedCode {
-		return nil, resp.StatusCode, fmt.Errorf("Expected %d but got %d when %s to %s", expectedCode, resp.StatusCode, method, urlStr)
+	if out == nil {
+		return nil
 	}
-	content, err := ioutil.ReadAll(resp.Body)
-	s.logger.Logf(DEBUG, "Completed %s to %s", method, urlStr)
-	return content, resp.StatusCode, nil
+	return json.Unmarshal(content, out)
 }
 
-func (s *stardogClientImpl) GetClusterInfo() (*[]string, error) {
-	s.logger.Logf(DEBUG, "GetClusterInfo\n")
+func (s *stardogClientImpl) doForm(urlPath string, form url.Values, accept string) ([]byte, error) {
+	return s.do("POST", urlPath, []byte(form.Encode()), "application/x-www-form-urlencoded", accept)
+}
 
-	dbURL := fmt.Sprintf("%s/admin/cluster", s.sdURL)
-	bodyBuf := &bytes.Buffer{}
-	content, code, err := s.doRequest("GET", dbURL, bodyBuf, "application/json", 200)
-	for i := 0; code == 503; i++ {
-		if i > 10 {
-			return nil, errors.New("timeout waiting to get cluster information")
-		}
-		s.logger.Logf(WARN, "The first request to admin/cluster failed")
-		time.Sleep(2 * time.Second)
-		content, code, err = s.doRequest("GET", dbURL, bodyBuf, "application/json", 200)
-	}
+// listNames returns the strings listed under key in the JSON answer to a GET.
+func (s *stardogClientImpl) listNames(urlPath string, key string) ([]string, error) {
+	var doc map[string][]string
+	err := s.doJSON("GET", urlPath, nil, &doc)
 	if err != nil {
 		return nil, err
 	}
+	names, ok := doc[key]
+	if !ok {
+		return nil, fmt.Errorf("The answer from %s has no %s", urlPath, key)
+	}
+	return names, nil
+}
+
+func escape(name string) string {
+	return url.PathEscape(name)
+}
+
+func (s *stardogClientImpl) GetClusterInfo() (*[]string, error) {
+	s.logger.Logf(DEBUG, "GetClusterInfo\n")
+
 	var nodesMap map[string]interface{}
-	err = json.Unmarshal(content, &nodesMap)
+	err := s.doJSON("GET", "/admin/cluster", nil, &nodesMap)
 	if err != nil {
 		return nil, err
 	}
@@ -81,13 +257,162 @@ func (s *stardogClientImpl) GetClusterInfo() (*[]string, error) {
 		s.logger.Logf(DEBUG, "Interface list %s", v)
 		ifaceList = v
 	default:
-	// no match; here v has the same type as i
 		return nil, fmt.Errorf("The returned cluster information was not expected %s", v)
 	}
 
 	outSList := make([]string, len(ifaceList))
 	for i, nodeI := range ifaceList {
-		outSList[i] = nodeI.(string)
+		outSList[i] = fmt.Sprint(nodeI)
 	}
 	return &outSList, nil
 }
+
+// ServerStatus returns the server metrics reported by /admin/status.
+func (s *stardogClientImpl) ServerStatus() (map[string]interface{}, error) {
+	status := make(map[string]interface{})
+	err := s.doJSON("GET", "/admin/status", nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Healthy asks /admin/healthcheck once.  An unhealthy server is not an
+// error.
+func (s *stardogClientImpl) Healthy() (bool, error) {
+	req, err := http.NewRequest("GET", s.sdURL+"/admin/healthcheck", nil)
+	if err != nil {
+		return false, err
+	}
+	req.SetBasicAuth(s.username, s.password)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+func (s *stardogClientImpl) ListDatabases() ([]string, error) {
+	return s.listNames("/admin/databases", "databases")
+}
+
+// CreateDatabase creates an empty database.  options are Stardog database
+// options such as search.enabled.
+func (s *stardogClientImpl) CreateDatabase(name string, options map[string]interface{}) error {
+	if options == nil {
+		options = make(map[string]interface{})
+	}
+	root, err := json.Marshal(map[string]interface{}{"dbname": name, "options": options, "files": []string{}})
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	err = w.WriteField("root", string(root))
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	_, err = s.do("POST", "/admin/databases", body.Bytes(), w.FormDataContentType(), "application/json")
+	return err
+}
+
+func (s *stardogClientImpl) DropDatabase(name string) error {
+	return s.doJSON("DELETE", fmt.Sprintf("/admin/databases/%s", escape(name)), nil, nil)
+}
+
+func (s *stardogClientImpl) OnlineDatabase(name string) error {
+	return s.doJSON("PUT", fmt.Sprintf("/admin/databases/%s/online", escape(name)), nil, nil)
+}
+
+func (s *stardogClientImpl) OfflineDatabase(name string) error {
+	return s.doJSON("PUT", fmt.Sprintf("/admin/databases/%s/offline", escape(name)), nil, nil)
+}
+
+func (s *stardogClientImpl) ListUsers() ([]string, error) {
+	return s.listNames("/admin/users", "users")
+}
+
+// CreateUser adds a user.  Stardog takes the password as a list of
+// characters.
+func (s *stardogClientImpl) CreateUser(name string, password string, superuser bool) error {
+	chars := make([]string, 0, len(password))
+	for _, c := range password {
+		chars = append(chars, string(c))
+	}
+	user := map[string]interface{}{"username": name, "password": chars, "superuser": superuser}
+	return s.doJSON("POST", "/admin/users", user, nil)
+}
+
+func (s *stardogClientImpl) DeleteUser(name string) error {
+	return s.doJSON("DELETE", fmt.Sprintf("/admin/users/%s", escape(name)), nil, nil)
+}
+
+func (s *stardogClientImpl) ChangePassword(name string, password string) error {
+	return s.doJSON("PUT", fmt.Sprintf("/admin/users/%s/pwd", escape(name)), map[string]string{"password": password}, nil)
+}
+
+func (s *stardogClientImpl) ListRoles() ([]string, error) {
+	return s.listNames("/admin/roles", "roles")
+}
+
+func (s *stardogClientImpl) CreateRole(name string) error {
+	return s.doJSON("POST", "/admin/roles", map[string]string{"rolename": name}, nil)
+}
+
+func (s *stardogClientImpl) DeleteRole(name string) error {
+	return s.doJSON("DELETE", fmt.Sprintf("/admin/roles/%s", escape(name)), nil, nil)
+}
+
+func (s *stardogClientImpl) AssignRole(user string, role string) error {
+	return s.doJSON("POST", fmt.Sprintf("/admin/users/%s/roles", escape(user)), map[string]string{"rolename": role}, nil)
+}
+
+func (s *stardogClientImpl) UnassignRole(user string, role string) error {
+	return s.doJSON("DELETE", fmt.Sprintf("/admin/users/%s/roles/%s", escape(user), escape(role)), nil, nil)
+}
+
+func dbPath(db string, txID string, action string) string {
+	if txID == "" {
+		return fmt.Sprintf("/%s/%s", escape(db), action)
+	}
+	return fmt.Sprintf("/%s/%s/%s", escape(db), escape(txID), action)
+}
+
+// Query runs a SPARQL query and returns the results in the accept format,
+// for example application/sparql-results+json.
+func (s *stardogClientImpl) Query(db string, txID string, query string, accept string) ([]byte, error) {
+	return s.doForm(dbPath(db, txID, "query"), url.Values{"query": {query}}, accept)
+}
+
+func (s *stardogClientImpl) Update(db string, txID string, update string) error {
+	_, err := s.doForm(dbPath(db, txID, "update"), url.Values{"update": {update}}, "")
+	return err
+}
+
+func (s *stardogClientImpl) BeginTransaction(db string) (string, error) {
+	content, err := s.do("POST", fmt.Sprintf("/%s/transaction/begin", escape(db)), nil, "", "text/plain")
+	if err != nil {
+		return "", err
+	}
+	txID := strings.TrimSpace(string(content))
+	if txID == "" {
+		return "", fmt.Errorf("Stardog did not return a transaction for %s", db)
+	}
+	return txID, nil
+}
+
+func (s *stardogClientImpl) CommitTransaction(db string, txID string) error {
+	_, err := s.do("POST", fmt.Sprintf("/%s/transaction/commit/%s", escape(db), escape(txID)), nil, "", "")
+	return err
+}
+
+func (s *stardogClientImpl) RollbackTransaction(db string, txID string) error {
+	_, err := s.do("POST", fmt.Sprintf("/%s/transaction/rollback/%s", escape(db), escape(txID)), nil, "", "")
+	return err
+}
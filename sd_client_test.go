@@ -0,0 +1,360 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tstStardog keeps just enough state to answer the requests made by the
+// client.
+type tstStardog struct {
+	mutex     sync.Mutex
+	databases map[string]bool
+	users     map[string]string
+	roles     map[string]bool
+	userRoles map[string][]string
+	updates   []string
+	txs       map[string][]string
+	txCnt     int
+}
+
+func newTstStardog() *tstStardog {
+	return &tstStardog{
+		databases: make(map[string]bool),
+		users:     map[string]string{"admin": "admin"},
+		roles:     make(map[string]bool),
+		userRoles: make(map[string][]string),
+		txs:       make(map[string][]string),
+	}
+}
+
+func sortedBoolKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeTstJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (sd *tstStardog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sd.mutex.Lock()
+	defer sd.mutex.Unlock()
+
+	u, p, ok := r.BasicAuth()
+	if !ok || sd.users[u] != p {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	route := r.Method + " " + strings.Join(parts, "/")
+	var in map[string]interface{}
+	if r.Header.Get("Content-Type") == "application/json" {
+		json.NewDecoder(r.Body).Decode(&in)
+	}
+
+	switch {
+	case route == "GET admin/cluster":
+		writeTstJSON(w, map[string][]string{"nodes": {"10.0.0.1:5821", "10.0.0.2:5821"}})
+	case route == "GET admin/status":
+		writeTstJSON(w, map[string]interface{}{"dbms.memory.heap.used": map[string]int{"value": 1024}})
+	case route == "GET admin/healthcheck":
+		w.WriteHeader(http.StatusOK)
+	case route == "GET admin/databases":
+		writeTstJSON(w, map[string][]string{"databases": sortedBoolKeys(sd.databases)})
+	case route == "POST admin/databases":
+		var root map[string]interface{}
+		err := json.Unmarshal([]byte(r.FormValue("root")), &root)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sd.databases[root["dbname"].(string)] = true
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "DELETE" && len(parts) == 3 && parts[1] == "databases":
+		if !sd.databases[parts[2]] {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Database '%s' does not exist", parts[2])
+			return
+		}
+		delete(sd.databases, parts[2])
+	case r.Method == "PUT" && len(parts) == 4 && parts[1] == "databases":
+		sd.databases[parts[2]] = parts[3] == "online"
+	case route == "GET admin/users":
+		users := map[string]bool{}
+		for k := range sd.users {
+			users[k] = true
+		}
+		writeTstJSON(w, map[string][]string{"users": sortedBoolKeys(users)})
+	case route == "POST admin/users":
+		pw := ""
+		for _, c := range in["password"].([]interface{}) {
+			pw = pw + c.(string)
+		}
+		sd.users[in["username"].(string)] = pw
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "DELETE" && len(parts) == 3 && parts[1] == "users":
+		delete(sd.users, parts[2])
+	case r.Method == "PUT" && len(parts) == 4 && parts[3] == "pwd":
+		sd.users[parts[2]] = in["password"].(string)
+	case route == "GET admin/roles":
+		writeTstJSON(w, map[string][]string{"roles": sortedBoolKeys(sd.roles)})
+	case route == "POST admin/roles":
+		sd.roles[in["rolename"].(string)] = true
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "DELETE" && len(parts) == 3 && parts[1] == "roles":
+		delete(sd.roles, parts[2])
+	case r.Method == "POST" && len(parts) == 4 && parts[3] == "roles":
+		sd.userRoles[parts[2]] = append(sd.userRoles[parts[2]], in["rolename"].(string))
+	case r.Method == "DELETE" && len(parts) == 5 && parts[3] == "roles":
+		sd.userRoles[parts[2]] = nil
+	case r.Method == "POST" && len(parts) == 3 && parts[1] == "transaction" && parts[2] == "begin":
+		sd.txCnt++
+		txID := fmt.Sprintf("tx-%d", sd.txCnt)
+		sd.txs[txID] = []string{}
+		fmt.Fprint(w, txID)
+	case r.Method == "POST" && len(parts) == 4 && parts[1] == "transaction":
+		if parts[2] == "commit" {
+			sd.updates = append(sd.updates, sd.txs[parts[3]]...)
+		}
+		delete(sd.txs, parts[3])
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "query":
+		if r.Header.Get("Accept") != "application/sparql-results+json" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		fmt.Fprintf(w, `{"query": %q, "count": %d}`, r.FormValue("query"), len(sd.updates))
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "update":
+		sd.updates = append(sd.updates, r.FormValue("update"))
+	case r.Method == "POST" && len(parts) == 3 && parts[2] == "update":
+		sd.txs[parts[1]] = append(sd.txs[parts[1]], r.FormValue("update"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTstClient(url string, password string) StardogClient {
+	opts := &StardogClientOptions{Timeout: time.Second, Retries: 2, RetryWait: time.Millisecond}
+	return NewStardogClient(url, "admin", password, &TestContext{}, opts)
+}
+
+func TestStardogClientAdmin(t *testing.T) {
+	server := httptest.NewServer(newTstStardog())
+	defer server.Close()
+	client := newTstClient(server.URL+"/", "admin")
+
+	nodes, err := client.GetClusterInfo()
+	if err != nil || len(*nodes) != 2 || (*nodes)[0] != "10.0.0.1:5821" {
+		t.Fatalf("The cluster nodes were not returned %v %s", nodes, err)
+	}
+	status, err := client.ServerStatus()
+	if err != nil || status["dbms.memory.heap.used"] == nil {
+		t.Fatalf("The server status was not returned %v %s", status, err)
+	}
+	healthy, err := client.Healthy()
+	if err != nil || !healthy {
+		t.Fatalf("The server should be healthy %s", err)
+	}
+
+	for _, db := range []string{"db2", "db1"} {
+		err = client.CreateDatabase(db, map[string]interface{}{"search.enabled": true})
+		if err != nil {
+			t.Fatalf("Failed to create %s: %s", db, err)
+		}
+	}
+	err = client.OfflineDatabase("db1")
+	if err != nil {
+		t.Fatalf("Failed to take db1 offline %s", err)
+	}
+	err = client.OnlineDatabase("db1")
+	if err != nil {
+		t.Fatalf("Failed to bring db1 online %s", err)
+	}
+	err = client.DropDatabase("db2")
+	if err != nil {
+		t.Fatalf("Failed to drop db2 %s", err)
+	}
+	dbs, err := client.ListDatabases()
+	if err != nil || strings.Join(dbs, ",") != "db1" {
+		t.Fatalf("Only db1 should be left %v %s", dbs, err)
+	}
+	err = client.DropDatabase("nosuchdb")
+	sdErr, ok := err.(*StardogRequestError)
+	if !ok || sdErr.StatusCode != http.StatusNotFound || !strings.Contains(sdErr.Error(), "does not exist") {
+		t.Fatalf("Dropping a missing database should fail with 404 %s", err)
+	}
+
+	err = client.CreateUser("alice", "secret", false)
+	if err != nil {
+		t.Fatalf("Failed to create a user %s", err)
+	}
+	err = client.CreateRole("reader")
+	if err != nil {
+		t.Fatalf("Failed to create a role %s", err)
+	}
+	err = client.AssignRole("alice", "reader")
+	if err != nil {
+		t.Fatalf("Failed to assign a role %s", err)
+	}
+	err = client.UnassignRole("alice", "reader")
+	if err != nil {
+		t.Fatalf("Failed to unassign a role %s", err)
+	}
+	roles, err := client.ListRoles()
+	if err != nil || strings.Join(roles, ",") != "reader" {
+		t.Fatalf("The role was not listed %v %s", roles, err)
+	}
+	users, err := client.ListUsers()
+	if err != nil || strings.Join(users, ",") != "admin,alice" {
+		t.Fatalf("The user was not listed %v %s", users, err)
+	}
+	_, err = NewStardogClient(server.URL, "alice", "secret", &TestContext{}, nil).ListUsers()
+	if err != nil {
+		t.Fatalf("The new user should be able to log in %s", err)
+	}
+	err = client.DeleteRole("reader")
+	if err != nil {
+		t.Fatalf("Failed to delete a role %s", err)
+	}
+	err = client.DeleteUser("alice")
+	if err != nil {
+		t.Fatalf("Failed to delete a user %s", err)
+	}
+
+	err = client.ChangePassword("admin", "newpw")
+	if err != nil {
+		t.Fatalf("Failed to change the password %s", err)
+	}
+	_, err = client.ListUsers()
+	if err == nil {
+		t.Fatal("The old password should no longer work")
+	}
+	_, err = newTstClient(server.URL, "newpw").ListUsers()
+	if err != nil {
+		t.Fatalf("The new password should work %s", err)
+	}
+}
+
+func TestStardogClientQuery(t *testing.T) {
+	server := httptest.NewServer(newTstStardog())
+	defer server.Close()
+	client := newTstClient(server.URL, "admin")
+
+	err := client.Update("db", "", "INSERT DATA { <a> <b> <c> }")
+	if err != nil {
+		t.Fatalf("The update failed %s", err)
+	}
+	txID, err := client.BeginTransaction("db")
+	if err != nil || txID != "tx-1" {
+		t.Fatalf("The transaction did not begin %s %s", txID, err)
+	}
+	err = client.Update("db", txID, "INSERT DATA { <d> <e> <f> }")
+	if err != nil {
+		t.Fatalf("The update in the transaction failed %s", err)
+	}
+	err = client.CommitTransaction("db", txID)
+	if err != nil {
+		t.Fatalf("The commit failed %s", err)
+	}
+	txID, err = client.BeginTransaction("db")
+	if err != nil {
+		t.Fatalf("The second transaction did not begin %s", err)
+	}
+	err = client.Update("db", txID, "INSERT DATA { <g> <h> <i> }")
+	if err != nil {
+		t.Fatalf("The update in the transaction failed %s", err)
+	}
+	err = client.RollbackTransaction("db", txID)
+	if err != nil {
+		t.Fatalf("The rollback failed %s", err)
+	}
+
+	query := "SELECT * { ?s ?p ?o }"
+	content, err := client.Query("db", "", query, "application/sparql-results+json")
+	if err != nil {
+		t.Fatalf("The query failed %s", err)
+	}
+	var results map[string]interface{}
+	err = json.Unmarshal(content, &results)
+	if err != nil || results["query"] != query || results["count"] != float64(2) {
+		t.Fatalf("The committed updates should be seen %s %s", string(content), err)
+	}
+	_, err = client.Query("db", "", query, "text/csv")
+	if err == nil {
+		t.Fatal("An unsupported result format should fail")
+	}
+}
+
+func TestStardogClientRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeTstJSON(w, map[string][]string{"nodes": {"10.0.0.1:5821"}})
+	}))
+	defer server.Close()
+
+	nodes, err := newTstClient(server.URL, "admin").GetClusterInfo()
+	if err != nil || len(*nodes) != 1 || calls != 3 {
+		t.Fatalf("The request should have succeeded on the third try %d %s", calls, err)
+	}
+
+	calls = -10
+	_, err = newTstClient(server.URL, "admin").GetClusterInfo()
+	sdErr, ok := err.(*StardogRequestError)
+	if !ok || sdErr.StatusCode != http.StatusServiceUnavailable || calls != -7 {
+		t.Fatalf("The request should have given up after 2 retries %d %s", calls, err)
+	}
+}
+
+func TestStardogClientTimeout(t *testing.T) {
+	done := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	opts := &StardogClientOptions{Timeout: 50 * time.Millisecond, Retries: 0}
+	client := NewStardogClient(server.URL, "admin", "admin", &TestContext{}, opts)
+	start := time.Now()
+	_, err := client.ListDatabases()
+	if err == nil {
+		t.Fatal("The request should have timed out")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("The timeout was not used %s", time.Since(start))
+	}
+}
@@ -16,9 +16,15 @@
 package sdutils
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -37,6 +43,8 @@ var (
 	debugToStringMap = make(map[int]string)
 	// LogLevelNames is an array of strings that define all the valid log levels
 	LogLevelNames []string
+	// LogFormats are the formats in which log lines can be written
+	LogFormats = []string{"text", "json"}
 )
 
 func init() {
@@ -58,41 +66,203 @@ type SdVaLogger interface {
 	Logf(level int, format string, v ...interface{})
 }
 
+// LogFields are the structured values attached to a log line, for example
+// the deployment, the command or the program that produced the output.
+type LogFields map[string]string
+
+// SdFieldLogger is a SdVaLogger that can also attach structured fields to
+// each line.  With returns a logger that adds the fields to every line.
+type SdFieldLogger interface {
+	SdVaLogger
+	LogWith(level int, fields LogFields, format string, v ...interface{})
+	With(fields LogFields) SdFieldLogger
+}
+
 type sdLogger struct {
 	logLevel int
 	logger   *log.Logger
+	jsonOut  io.Writer
+	mutex    *sync.Mutex
+	fields   LogFields
 }
 
-// NewSdVaLogger creates a new Stardog logging object from a system logger
-func NewSdVaLogger(realLogger *log.Logger, logLevel string) (SdVaLogger, error) {
-	var logger sdLogger
-	logLevel = strings.ToUpper(logLevel)
-
-	switch logLevel {
+func parseLogLevel(logLevel string) (int, error) {
+	switch strings.ToUpper(logLevel) {
 	case "DEBUG":
-		logger.logLevel = DEBUG
+		return DEBUG, nil
 	case "INFO":
-		logger.logLevel = INFO
+		return INFO, nil
 	case "WARN":
-		logger.logLevel = WARN
+		return WARN, nil
 	case "ERROR":
-		logger.logLevel = ERROR
-	default:
-		return nil, fmt.Errorf("The log level must be one of DEBUG, INFO, WARN, or ERROR")
+		return ERROR, nil
+	}
+	return 0, fmt.Errorf("The log level must be one of DEBUG, INFO, WARN, or ERROR")
+}
+
+// NewSdVaLogger creates a new Stardog logging object from a system logger
+func NewSdVaLogger(realLogger *log.Logger, logLevel string) (SdVaLogger, error) {
+	level, err := parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
 	}
-	logger.logger = realLogger
+	return &sdLogger{logLevel: level, logger: realLogger, mutex: &sync.Mutex{}}, nil
+}
 
+// NewSdFieldLogger creates a logger that writes to w in the given format.
+// The text format is the one of NewSdVaLogger with the fields appended as
+// key=value pairs.  The json format writes one object per line.
+func NewSdFieldLogger(w io.Writer, logLevel string, logFormat string) (SdFieldLogger, error) {
+	level, err := parseLogLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+	logger := sdLogger{logLevel: level, mutex: &sync.Mutex{}}
+	switch logFormat {
+	case "", "text":
+		logger.logger = log.New(w, "", log.Ldate|log.Ltime)
+	case "json":
+		logger.jsonOut = w
+	default:
+		return nil, fmt.Errorf("The log format must be one of %s", strings.Join(LogFormats, ", "))
+	}
 	return &logger, nil
 }
 
-func (l *sdLogger) logit(lineLevel int, format string, v ...interface{}) {
+func (l *sdLogger) logit(lineLevel int, fields LogFields, format string, v ...interface{}) {
 	if lineLevel > l.logLevel {
 		return
 	}
-	format = fmt.Sprintf("[%s] ", debugToStringMap[lineLevel]) + format
-	l.logger.Printf(format, v...)
+	msg := strings.TrimRight(fmt.Sprintf(format, v...), "\n")
+	all := make(LogFields)
+	for k, val := range l.fields {
+		all[k] = val
+	}
+	for k, val := range fields {
+		all[k] = val
+	}
+
+	if l.jsonOut != nil {
+		line := make(map[string]string)
+		for k, val := range all {
+			line[k] = val
+		}
+		line["time"] = time.Now().Format(time.RFC3339Nano)
+		line["level"] = debugToStringMap[lineLevel]
+		line["msg"] = msg
+		data, err := json.Marshal(line)
+		if err != nil {
+			return
+		}
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.jsonOut.Write(append(data, '\n'))
+		return
+	}
+
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		msg = fmt.Sprintf("%s %s=%s", msg, k, all[k])
+	}
+	l.logger.Printf("[%s] %s", debugToStringMap[lineLevel], msg)
 }
 
 func (l *sdLogger) Logf(level int, format string, v ...interface{}) {
-	l.logit(level, format, v...)
+	l.logit(level, nil, format, v...)
+}
+
+func (l *sdLogger) LogWith(level int, fields LogFields, format string, v ...interface{}) {
+	l.logit(level, fields, format, v...)
+}
+
+func (l *sdLogger) With(fields LogFields) SdFieldLogger {
+	child := *l
+	child.fields = make(LogFields)
+	for k, val := range l.fields {
+		child.fields[k] = val
+	}
+	for k, val := range fields {
+		if val != "" {
+			child.fields[k] = val
+		}
+	}
+	return &child
+}
+
+// RotatingFile is a log file that is rotated once it reaches a maximum size.
+// The rotated files are named <path>.1 (the newest) to <path>.<keep>.
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	keep    int
+	size    int64
+	file    *os.File
+	mutex   sync.Mutex
+}
+
+// NewRotatingFile opens the file for appending.  A maxSize less than 1
+// disables the rotation.
+func NewRotatingFile(path string, maxSize int64, keep int) (*RotatingFile, error) {
+	rf := RotatingFile{path: path, maxSize: maxSize, keep: keep}
+	err := rf.open()
+	if err != nil {
+		return nil, err
+	}
+	return &rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	return nil
+}
+
+func (rf *RotatingFile) rotate() error {
+	rf.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.keep))
+	for i := rf.keep - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+	}
+	if rf.keep > 0 {
+		os.Rename(rf.path, fmt.Sprintf("%s.1", rf.path))
+	} else {
+		os.Remove(rf.path)
+	}
+	return rf.open()
+}
+
+// Write appends p to the file, first rotating the file if p would make it
+// larger than the maximum size.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		err := rf.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size = rf.size + int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (rf *RotatingFile) Close() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	return rf.file.Close()
 }
@@ -17,7 +17,12 @@ package sdutils
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path"
 	"strings"
 	"testing"
 )
@@ -29,7 +34,7 @@ func TestWarnLevel(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to load the logger %s", err)
 	}
-	msg := "Just Some message"
+	const msg = "Just Some message"
 	sdLog.Logf(WARN, msg)
 	sdLog.Logf(ERROR, msg)
 	sdLog.Logf(DEBUG, msg)
@@ -52,7 +57,7 @@ func TestErrorLevel(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to load the logger %s", err)
 	}
-	msg := "Just Some message"
+	const msg = "Just Some message"
 	sdLog.Logf(WARN, msg)
 	sdLog.Logf(ERROR, msg)
 	sdLog.Logf(INFO, msg)
@@ -79,7 +84,7 @@ func TestInfoLevel(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to load the logger %s", err)
 	}
-	msg := "Just Some message"
+	const msg = "Just Some message"
 	sdLog.Logf(WARN, msg)
 	sdLog.Logf(ERROR, msg)
 	sdLog.Logf(DEBUG, msg)
@@ -103,7 +108,7 @@ func TestDebugLevel(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to load the logger %s", err)
 	}
-	msg := "Just Some message"
+	const msg = "Just Some message"
 	sdLog.Logf(WARN, msg)
 	sdLog.Logf(ERROR, msg)
 	sdLog.Logf(DEBUG, msg)
@@ -131,3 +136,90 @@ func TestInvalidLevel(t *testing.T) {
 		t.Fatal("The logger should not have loaded")
 	}
 }
+
+func TestTextFields(t *testing.T) {
+	buf := bytes.NewBufferString("")
+	sdLog, err := NewSdFieldLogger(buf, "INFO", "text")
+	if err != nil {
+		t.Fatalf("Failed to load the logger %s", err)
+	}
+	child := sdLog.With(LogFields{"deployment": "dep1", "command": ""})
+	child.LogWith(INFO, LogFields{"source": "terraform"}, "line %d\n", 1)
+	child.Logf(DEBUG, "hidden")
+
+	if !strings.HasSuffix(buf.String(), "[INFO] line 1 deployment=dep1 source=terraform\n") {
+		t.Fatalf("The fields were not appended %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "command=") || strings.Contains(buf.String(), "hidden") {
+		t.Fatalf("Empty fields and debug lines should be left out %s", buf.String())
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	buf := bytes.NewBufferString("")
+	sdLog, err := NewSdFieldLogger(buf, "DEBUG", "json")
+	if err != nil {
+		t.Fatalf("Failed to load the logger %s", err)
+	}
+	sdLog.With(LogFields{"deployment": "dep1"}).LogWith(WARN, LogFields{"step": "apply"}, "STDERR %s", "oops")
+	sdLog.Logf(DEBUG, "plain")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("There should be one line per message %s", buf.String())
+	}
+	entry := make(map[string]string)
+	err = json.Unmarshal([]byte(lines[0]), &entry)
+	if err != nil {
+		t.Fatalf("The line is not json %s", err)
+	}
+	if entry["level"] != "WARN" || entry["msg"] != "STDERR oops" || entry["deployment"] != "dep1" || entry["step"] != "apply" || entry["time"] == "" {
+		t.Fatalf("The json line is wrong %v", entry)
+	}
+
+	_, err = NewSdFieldLogger(buf, "DEBUG", "xml")
+	if err == nil {
+		t.Fatal("xml is not a log format")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardogtests")
+	defer os.RemoveAll(dir)
+	logPath := path.Join(dir, "graviton.log")
+
+	rf, err := NewRotatingFile(logPath, 100, 2)
+	if err != nil {
+		t.Fatalf("Failed to open the log %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(rf, "%039d\n", i)
+	}
+	rf.Close()
+
+	for _, p := range []string{logPath, logPath + ".1", logPath + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("The file %s should exist", p)
+		}
+		if info.Size() > 100 {
+			t.Fatalf("The file %s is too large %d", p, info.Size())
+		}
+	}
+	if PathExists(logPath + ".3") {
+		t.Fatal("Only 2 rotated files should be kept")
+	}
+
+	// Reopening continues from the size on disk
+	rf, err = NewRotatingFile(logPath, 100, 2)
+	if err != nil {
+		t.Fatalf("Failed to open the log %s", err)
+	}
+	defer rf.Close()
+	before, _ := ioutil.ReadFile(logPath + ".1")
+	fmt.Fprintf(rf, "%039d\n", 10)
+	after, _ := ioutil.ReadFile(logPath + ".1")
+	if bytes.Equal(before, after) {
+		t.Fatal("The reopened file should have been rotated")
+	}
+}
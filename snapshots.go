@@ -0,0 +1,126 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// SnapshotSet records the snapshots taken of every volume of a deployment at
+// the same point in time.  The snapshot ids are in the order of the volumes.
+type SnapshotSet struct {
+	ID          string    `json:"id,omitempty"`
+	Deployment  string    `json:"deployment,omitempty"`
+	Type        string    `json:"type,omitempty"`
+	Version     string    `json:"version,omitempty"`
+	Tag         string    `json:"tag,omitempty"`
+	VolumeSize  int       `json:"volume_size,omitempty"`
+	SnapshotIDs []string  `json:"snapshot_ids,omitempty"`
+	TimeStamp   time.Time `json:"timestamp,omitempty"`
+}
+
+// SnapshotDir returns the directory where the snapshot sets of a deployment
+// are recorded.
+func SnapshotDir(confDir string, deploymentName string) string {
+	return path.Join(DeploymentDir(confDir, deploymentName), "snapshots")
+}
+
+// SnapshotVolumes snapshots every volume of the deployment and records the
+// resulting set in the deployment directory.
+func SnapshotVolumes(context AppContext, baseD *BaseDeployment, dep Deployment, tag string) (*SnapshotSet, error) {
+	if !dep.VolumeExists() {
+		return nil, fmt.Errorf("No volume information exists for %s", baseD.Name)
+	}
+	now := time.Now().UTC()
+	set := SnapshotSet{
+		ID:         fmt.Sprintf("%s-%s", baseD.Name, now.Format("20060102T150405Z")),
+		Deployment: baseD.Name,
+		Type:       baseD.Type,
+		Version:    baseD.Version,
+		Tag:        tag,
+		TimeStamp:  now,
+	}
+	if baseD.Launch != nil {
+		set.VolumeSize = baseD.Launch.VolumeSize
+	}
+	snapshotIDs, err := dep.SnapshotVolumeSet(tag)
+	if err != nil {
+		return nil, err
+	}
+	set.SnapshotIDs = snapshotIDs
+	snapshotDir := SnapshotDir(context.GetConfigDir(), baseD.Name)
+	err = os.MkdirAll(snapshotDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = WriteJSON(&set, path.Join(snapshotDir, fmt.Sprintf("%s.json", set.ID)))
+	if err != nil {
+		return nil, err
+	}
+	context.ConsoleLog(1, "Successfully created the snapshot set %s.\n", context.HighlightString(set.ID))
+	return &set, nil
+}
+
+// FindSnapshotSet looks through the snapshot sets of every known deployment
+// for the one with the given id.
+func FindSnapshotSet(context AppContext, id string) (*SnapshotSet, error) {
+	deployments, err := ioutil.ReadDir(path.Join(context.GetConfigDir(), "deployments"))
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments {
+		setPath := path.Join(SnapshotDir(context.GetConfigDir(), d.Name()), fmt.Sprintf("%s.json", id))
+		if !PathExists(setPath) {
+			continue
+		}
+		var set SnapshotSet
+		err = LoadJSON(&set, setPath)
+		if err != nil {
+			return nil, err
+		}
+		return &set, nil
+	}
+	return nil, fmt.Errorf("The snapshot set %s does not exist", id)
+}
+
+// CreateVolumesFromSnapshots creates the volumes of the deployment from a
+// snapshot set, which may have been taken from another deployment, and
+// records the step in the deployment lifecycle.
+func CreateVolumesFromSnapshots(context AppContext, baseD *BaseDeployment, dep Deployment, id string) error {
+	set, err := FindSnapshotSet(context, id)
+	if err != nil {
+		return err
+	}
+	if set.Type != baseD.Type {
+		return fmt.Errorf("The snapshot set %s was taken from a %s deployment and cannot be used by a %s deployment", id, set.Type, baseD.Type)
+	}
+	if set.Version != baseD.Version {
+		context.ConsoleLog(1, "The snapshot set was taken with Stardog %s and the deployment uses %s.\n", set.Version, baseD.Version)
+	}
+	lp := launchParameters(baseD)
+	lp.SnapshotSetID = id
+	lp.VolumeSize = set.VolumeSize
+	lp.ClusterSize = len(set.SnapshotIDs)
+	err = dep.CreateVolumeSetFromSnapshots(set.SnapshotIDs, set.VolumeSize)
+	if err != nil {
+		return err
+	}
+	return SetDeploymentState(context, baseD, StateVolumesCreated)
+}
@@ -0,0 +1,261 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SpecVersion is the version of the deployment spec format.
+const SpecVersion = 1
+
+// DeploymentSpec describes a whole deployment in a single document that can
+// be written as YAML or JSON.  Cloud holds the plugin options with the names
+// used in the cloud_options of default.json and Variables holds terraform
+// variables, for example root_volume_type, that are otherwise set with
+// TF_VAR_ environment variables.  Sizes that are left out keep their
+// defaults.
+type DeploymentSpec struct {
+	SpecVersion      int                    `json:"spec_version"`
+	Name             string                 `json:"name"`
+	Type             string                 `json:"type"`
+	Version          string                 `json:"stardog_version"`
+	License          string                 `json:"license,omitempty"`
+	PrivateKey       string                 `json:"private_key,omitempty"`
+	ClusterSize      int                    `json:"cluster_size,omitempty"`
+	ZookeeperSize    int                    `json:"zookeeper_size,omitempty"`
+	VolumeSize       int                    `json:"volume_size,omitempty"`
+	RootVolumeSize   int                    `json:"root_volume_size,omitempty"`
+	IdleTimeout      int                    `json:"idle_timeout,omitempty"`
+	HTTPMask         string                 `json:"http_mask,omitempty"`
+	Memory           string                 `json:"memory,omitempty"`
+	Environment      []string               `json:"environment,omitempty"`
+	CustomProperties string                 `json:"stardog_properties,omitempty"`
+	CustomLog4J      string                 `json:"custom_log4j,omitempty"`
+	CustomScript     string                 `json:"custom_script,omitempty"`
+	CustomZkScript   string                 `json:"custom_zk_script,omitempty"`
+	DisableSecurity  bool                   `json:"disable_security,omitempty"`
+	Cloud            map[string]interface{} `json:"cloud,omitempty"`
+	Variables        map[string]string      `json:"variables,omitempty"`
+}
+
+// SpecChange is a field of a deployment that differs from its spec.  Only
+// the changes that are InPlace can be applied to an existing deployment.
+type SpecChange struct {
+	Field   string `json:"field"`
+	Current string `json:"current"`
+	Desired string `json:"desired"`
+	InPlace bool   `json:"in_place"`
+}
+
+// jsonCompatible turns the maps made by the YAML decoder into maps with
+// string keys so that the document can be encoded as JSON.
+func jsonCompatible(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = jsonCompatible(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range t {
+			t[i] = jsonCompatible(e)
+		}
+	}
+	return v
+}
+
+// ParseSpec decodes a YAML or JSON deployment spec and checks it.  The YAML
+// form is converted to JSON first so that both formats use the same field
+// names.  Unknown fields are errors.
+func ParseSpec(data []byte) (*DeploymentSpec, error) {
+	var generic interface{}
+	err := yaml.Unmarshal(data, &generic)
+	if err != nil {
+		return nil, fmt.Errorf("The spec could not be parsed: %s", err)
+	}
+	jsonData, err := json.Marshal(jsonCompatible(generic))
+	if err != nil {
+		return nil, err
+	}
+	var spec DeploymentSpec
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&spec)
+	if err != nil {
+		return nil, fmt.Errorf("The spec is not valid: %s", err)
+	}
+	err = spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// ReadSpec loads the deployment spec at specPath.
+func ReadSpec(specPath string) (*DeploymentSpec, error) {
+	data, err := ioutil.ReadFile(specPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpec(data)
+}
+
+// Validate checks the fields that every spec needs.
+func (spec *DeploymentSpec) Validate() error {
+	if spec.SpecVersion != SpecVersion {
+		return fmt.Errorf("The spec version %d is not supported, it must be %d", spec.SpecVersion, SpecVersion)
+	}
+	if spec.Name == "" {
+		return errors.New("The spec must have a name")
+	}
+	if spec.Type == "" {
+		return errors.New("The spec must have a type")
+	}
+	if spec.Version == "" {
+		return errors.New("The spec must have a stardog_version")
+	}
+	if spec.ClusterSize < 0 || spec.ZookeeperSize < 0 || spec.VolumeSize < 0 || spec.RootVolumeSize < 0 {
+		return errors.New("The sizes in the spec cannot be negative")
+	}
+	if spec.ZookeeperSize > 0 && spec.ZookeeperSize%2 == 0 {
+		return errors.New("A ZooKeeper ensemble needs an odd number of nodes")
+	}
+	return nil
+}
+
+// SetVariables sets the terraform variables of the spec in the environment.
+func SetVariables(variables map[string]string) {
+	for k, v := range variables {
+		os.Setenv(fmt.Sprintf("TF_VAR_%s", k), v)
+	}
+}
+
+// ExportSpec describes an existing deployment as a spec.  The cluster and
+// ensemble sizes are read from the deployment when they exist, the rest
+// comes from what was recorded when it was launched.  The memory settings
+// are part of the environment.
+func ExportSpec(baseD *BaseDeployment, dep Deployment, plugin Plugin) *DeploymentSpec {
+	spec := DeploymentSpec{
+		SpecVersion:      SpecVersion,
+		Name:             baseD.Name,
+		Type:             baseD.Type,
+		Version:          baseD.Version,
+		PrivateKey:       baseD.PrivateKey,
+		Environment:      baseD.Environment,
+		CustomProperties: baseD.CustomPropsFile,
+		CustomLog4J:      baseD.CustomLog4J,
+		CustomScript:     baseD.CustomScript,
+		CustomZkScript:   baseD.CustomZkScript,
+		DisableSecurity:  baseD.DisableSecurity,
+		Cloud:            plugin.DeploymentOptions(baseD),
+		Variables:        baseD.Variables,
+	}
+	if lp := baseD.Launch; lp != nil {
+		spec.License = lp.LicensePath
+		spec.ClusterSize = lp.ClusterSize
+		spec.ZookeeperSize = lp.ZkSize
+		spec.VolumeSize = lp.VolumeSize
+		spec.RootVolumeSize = lp.RootVolumeSize
+		spec.IdleTimeout = lp.IdleTimeout
+		spec.HTTPMask = lp.HTTPMask
+	}
+	if dep.VolumeExists() {
+		if size, err := dep.ClusterSize(); err == nil {
+			spec.ClusterSize = size
+		}
+	}
+	if dep.InstanceExists() {
+		if size, err := dep.ZookeeperSize(); err == nil {
+			spec.ZookeeperSize = size
+		}
+	}
+	return &spec
+}
+
+// DiffSpec lists the fields where desired differs from current.  The sizes,
+// the idle timeout, the mask and the cloud options are only compared when
+// desired sets them.  The paths of the license and the private key are not
+// compared because they are only read when the deployment is made.  The
+// type, the volume sizes, the cloud options and the variables cannot be
+// changed in place, everything else can.
+func DiffSpec(current *DeploymentSpec, desired *DeploymentSpec) []SpecChange {
+	changes := []SpecChange{}
+	add := func(field string, c interface{}, d interface{}, inPlace bool) {
+		cs, ds := fmt.Sprint(c), fmt.Sprint(d)
+		if cs != ds {
+			changes = append(changes, SpecChange{Field: field, Current: cs, Desired: ds, InPlace: inPlace})
+		}
+	}
+	add("type", current.Type, desired.Type, false)
+	add("stardog_version", current.Version, desired.Version, true)
+	if desired.ClusterSize > 0 {
+		add("cluster_size", current.ClusterSize, desired.ClusterSize, true)
+	}
+	if desired.ZookeeperSize > 0 {
+		add("zookeeper_size", current.ZookeeperSize, desired.ZookeeperSize, true)
+	}
+	if desired.VolumeSize > 0 {
+		add("volume_size", current.VolumeSize, desired.VolumeSize, false)
+	}
+	if desired.RootVolumeSize > 0 {
+		add("root_volume_size", current.RootVolumeSize, desired.RootVolumeSize, false)
+	}
+	if desired.IdleTimeout > 0 {
+		add("idle_timeout", current.IdleTimeout, desired.IdleTimeout, true)
+	}
+	if desired.HTTPMask != "" {
+		add("http_mask", current.HTTPMask, desired.HTTPMask, true)
+	}
+	add("environment", strings.Join(current.Environment, " "), strings.Join(desired.Environment, " "), true)
+	add("stardog_properties", current.CustomProperties, desired.CustomProperties, true)
+	add("custom_log4j", current.CustomLog4J, desired.CustomLog4J, true)
+	add("custom_script", current.CustomScript, desired.CustomScript, true)
+	add("custom_zk_script", current.CustomZkScript, desired.CustomZkScript, true)
+	add("disable_security", current.DisableSecurity, desired.DisableSecurity, true)
+
+	keys := []string{}
+	for k := range desired.Cloud {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		c, ok := current.Cloud[k]
+		if !ok {
+			c = ""
+		}
+		add(fmt.Sprintf("cloud.%s", k), c, desired.Cloud[k], false)
+	}
+	keys = []string{}
+	for k := range desired.Variables {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add(fmt.Sprintf("variables.%s", k), current.Variables[k], desired.Variables[k], false)
+	}
+	return changes
+}
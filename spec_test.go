@@ -0,0 +1,130 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	yamlSpec := `
+spec_version: 1
+name: mydep
+type: aws
+stardog_version: "5.0"
+cluster_size: 3
+environment:
+  - A=b
+cloud:
+  region: us-west-2
+  port: 5821
+variables:
+  root_volume_type: gp2
+`
+	spec, err := ParseSpec([]byte(yamlSpec))
+	if err != nil {
+		t.Fatalf("The yaml spec should parse %s", err)
+	}
+	if spec.Name != "mydep" || spec.Version != "5.0" || spec.ClusterSize != 3 || spec.Environment[0] != "A=b" {
+		t.Fatalf("The spec was not read %v", spec)
+	}
+	if spec.Cloud["region"] != "us-west-2" || spec.Variables["root_volume_type"] != "gp2" {
+		t.Fatalf("The options were not read %v %v", spec.Cloud, spec.Variables)
+	}
+
+	spec, err = ParseSpec([]byte(`{"spec_version": 1, "name": "mydep", "type": "docker", "stardog_version": "5.0"}`))
+	if err != nil || spec.Type != "docker" {
+		t.Fatalf("The json spec should parse %v %s", spec, err)
+	}
+
+	bad := map[string]string{
+		"version":  `{"spec_version": 2, "name": "a", "type": "aws", "stardog_version": "5.0"}`,
+		"name":     `{"spec_version": 1, "type": "aws", "stardog_version": "5.0"}`,
+		"unknown":  `{"spec_version": 1, "name": "a", "type": "aws", "stardog_version": "5.0", "nodes": 3}`,
+		"zk":       `{"spec_version": 1, "name": "a", "type": "aws", "stardog_version": "5.0", "zookeeper_size": 2}`,
+		"negative": `{"spec_version": 1, "name": "a", "type": "aws", "stardog_version": "5.0", "volume_size": -1}`,
+	}
+	for k, data := range bad {
+		_, err = ParseSpec([]byte(data))
+		if err == nil {
+			t.Fatalf("The %s spec should be rejected", k)
+		}
+	}
+}
+
+func TestDiffSpec(t *testing.T) {
+	current := DeploymentSpec{
+		Name:          "mydep",
+		Type:          "aws",
+		Version:       "5.0",
+		ClusterSize:   3,
+		ZookeeperSize: 3,
+		VolumeSize:    10,
+		Environment:   []string{"A=b"},
+		Cloud:         map[string]interface{}{"region": "us-west-1", "port": 5821},
+	}
+	desired := current
+	desired.Cloud = map[string]interface{}{"port": float64(5821)}
+	desired.VolumeSize = 0
+	changes := DiffSpec(&current, &desired)
+	if len(changes) != 0 {
+		t.Fatalf("Nothing should have changed %v", changes)
+	}
+
+	desired.ClusterSize = 5
+	desired.Version = "5.1"
+	desired.VolumeSize = 20
+	desired.Environment = []string{"A=c"}
+	desired.Cloud = map[string]interface{}{"region": "us-east-1"}
+	changes = DiffSpec(&current, &desired)
+	fields := []string{}
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+		if c.InPlace != (c.Field != "volume_size" && c.Field != "cloud.region") {
+			t.Fatalf("Only the volume size and the region cannot change in place %v", c)
+		}
+	}
+	if strings.Join(fields, " ") != "stardog_version cluster_size volume_size environment cloud.region" {
+		t.Fatalf("The wrong fields changed %v", changes)
+	}
+}
+
+func TestExportSpec(t *testing.T) {
+	dep := tpDeployment{TstVolumeExists: true}
+	baseD := BaseDeployment{
+		Name:        "mydep",
+		Type:        "test1loaderror",
+		Version:     "5.0",
+		Environment: []string{"A=b"},
+		Variables:   map[string]string{"root_volume_type": "gp2"},
+		Launch:      &LaunchParameters{LicensePath: "/license", ClusterSize: 3, ZkSize: 5, HTTPMask: "0.0.0.0/0"},
+	}
+	spec := ExportSpec(&baseD, &dep, &tstPlugin{})
+	if spec.SpecVersion != SpecVersion || spec.Name != "mydep" || spec.License != "/license" || spec.HTTPMask != "0.0.0.0/0" {
+		t.Fatalf("The spec was not exported %v", spec)
+	}
+	if spec.ClusterSize != 1 || spec.ZookeeperSize != 5 {
+		t.Fatalf("The sizes should come from the deployment when it exists %v", spec)
+	}
+	if spec.Variables["root_volume_type"] != "gp2" {
+		t.Fatalf("The variables were not exported %v", spec.Variables)
+	}
+	err := spec.Validate()
+	if err != nil {
+		t.Fatalf("An exported spec should be valid %s", err)
+	}
+}
@@ -0,0 +1,111 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// LoadCABundle returns the system certificate pool with the PEM encoded
+// certificates in caBundle added to it.  An empty caBundle returns nil so
+// that only the system pool is used.
+func LoadCABundle(caBundle string) (*x509.CertPool, error) {
+	if caBundle == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(caBundle)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the CA bundle %s: %s", caBundle, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("The CA bundle %s does not contain any PEM certificates", caBundle)
+	}
+	return pool, nil
+}
+
+// NewHTTPClient returns a client that verifies the certificates of https
+// servers against the system roots and the certificates in caBundle.
+func NewHTTPClient(caBundle string, timeout time.Duration) (*http.Client, error) {
+	pool, err := LoadCABundle(caBundle)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// stardogClientOptions returns the default client options for talking to
+// the Stardog servers of a deployment.
+func stardogClientOptions(baseD *BaseDeployment) *StardogClientOptions {
+	opts := DefaultStardogClientOptions()
+	opts.CABundle = baseD.TLSCABundle
+	return opts
+}
+
+// CheckTLSCABundle makes sure that a CA bundle holds certificates and
+// returns its absolute path.
+func CheckTLSCABundle(caBundle string) (string, error) {
+	caBundle, err := filepath.Abs(caBundle)
+	if err != nil {
+		return "", err
+	}
+	_, err = LoadCABundle(caBundle)
+	if err != nil {
+		return "", err
+	}
+	return caBundle, nil
+}
+
+// RecordTLSCABundle checks the CA bundle used to verify the certificate of
+// the deployment and records it in its config.json.
+func RecordTLSCABundle(baseD *BaseDeployment, caBundle string) error {
+	caBundle, err := CheckTLSCABundle(caBundle)
+	if err != nil {
+		return err
+	}
+	baseD.TLSCABundle = caBundle
+	confPath := path.Join(baseD.Directory, "config.json")
+	data, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return err
+	}
+	conf := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return err
+	}
+	conf["tls_ca_bundle"], err = json.Marshal(caBundle)
+	if err != nil {
+		return err
+	}
+	return WriteJSON(conf, confPath)
+}
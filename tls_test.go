@@ -0,0 +1,114 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeServerCA saves the certificate of a TLS test server as a CA bundle.
+func writeServerCA(t *testing.T, server *httptest.Server, dir string) string {
+	caPath := path.Join(dir, "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	err := ioutil.WriteFile(caPath, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return caPath
+}
+
+func TestStardogClientCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardogtests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := httptest.NewTLSServer(newTstStardog())
+	defer server.Close()
+
+	opts := &StardogClientOptions{Timeout: time.Second}
+	_, err = NewStardogClient(server.URL, "admin", "admin", &TestContext{}, opts).ListDatabases()
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("An unknown certificate should be rejected %s", err)
+	}
+
+	opts.CABundle = writeServerCA(t, server, dir)
+	_, err = NewStardogClient(server.URL, "admin", "admin", &TestContext{}, opts).ListDatabases()
+	if err != nil {
+		t.Fatalf("The certificate should be trusted with the CA bundle %s", err)
+	}
+
+	opts.CABundle = path.Join(dir, "missing.pem")
+	_, err = NewStardogClient(server.URL, "admin", "admin", &TestContext{}, opts).ListDatabases()
+	if err == nil || !strings.Contains(err.Error(), "CA bundle") {
+		t.Fatalf("A missing CA bundle should be reported %s", err)
+	}
+}
+
+func TestCheckURLVerifiesCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardogtests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	baseD := &BaseDeployment{Name: "tlstest"}
+	sd := &StardogDescription{StardogURL: server.URL}
+	if checkURL(&TestContext{}, baseD, sd, server.URL, false) {
+		t.Fatal("A server with an unknown certificate should not be healthy")
+	}
+	baseD.TLSCABundle = writeServerCA(t, server, dir)
+	if !checkURL(&TestContext{}, baseD, sd, server.URL, false) {
+		t.Fatal("The server should be healthy with the CA bundle")
+	}
+}
+
+func TestRecordTLSCABundle(t *testing.T) {
+	context, baseD := newCredentialsDeployment(t, nil)
+	defer os.RemoveAll(context.ConfigDir)
+
+	notPEM := path.Join(context.ConfigDir, "notpem")
+	ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600)
+	err := RecordTLSCABundle(baseD, notPEM)
+	if err == nil {
+		t.Fatal("A file without certificates should be refused")
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	caPath := writeServerCA(t, server, context.ConfigDir)
+	err = RecordTLSCABundle(baseD, caPath)
+	if err != nil {
+		t.Fatalf("Failed to record the CA bundle %s", err)
+	}
+	stored, err := ReadBaseDeployment(context, baseD.Name)
+	if err != nil || stored.TLSCABundle != caPath {
+		t.Fatalf("The CA bundle should be recorded in config.json %v %s", stored, err)
+	}
+	if stored.Name != baseD.Name {
+		t.Fatalf("The rest of config.json should be kept %v", stored)
+	}
+}
@@ -24,6 +24,7 @@ import (
 type TestContext struct {
 	ConfigDir string
 	Version   string
+	Result    interface{}
 }
 
 
@@ -34,9 +35,16 @@ func (c *TestContext) GetInteractive() bool {
 func (c *TestContext) Logf(level int, format string, v ...interface{}) {
 }
 
+func (c *TestContext) LogWith(level int, fields LogFields, format string, v ...interface{}) {
+}
+
 func (c *TestContext) ConsoleLog(level int, format string, v ...interface{}) {
 }
 
+func (c *TestContext) SetResult(result interface{}) {
+	c.Result = result
+}
+
 func (c *TestContext) GetConfigDir() string {
 	return c.ConfigDir
 }
@@ -73,6 +81,13 @@ func (tp *tstPlugin) DeploymentLoader(context AppContext, baseD *BaseDeployment,
 	return tp.Dep, nil
 }
 
+func (tp *tstPlugin) PlanDeployment(context AppContext, baseD *BaseDeployment) (Deployment, *PlanSummary, error) {
+	if tp.Dep == nil {
+		return nil, nil, errors.New("This test plugin plans no deployment")
+	}
+	return tp.Dep, NewPlanSummary(), nil
+}
+
 func (tp *tstPlugin) LoadDefaults(defaultCliOpts interface{}) error {
 	return nil
 }
@@ -93,6 +108,26 @@ func (tp *tstPlugin) HaveImage(context AppContext) bool {
 	return tp.HasImage
 }
 
+func (tp *tstPlugin) CopyImage(context AppContext, regions []string) error {
+	return nil
+}
+
+func (tp *tstPlugin) GetRegion() string {
+	return ""
+}
+
+func (tp *tstPlugin) DeploymentRegion(baseD *BaseDeployment) string {
+	return ""
+}
+
+func (tp *tstPlugin) DeploymentImage(baseD *BaseDeployment) string {
+	return ""
+}
+
+func (tp *tstPlugin) DeploymentOptions(baseD *BaseDeployment) map[string]interface{} {
+	return nil
+}
+
 type tpDeployment struct {
 	TstInstanceExists bool
 	TstVolumeExists   bool
@@ -103,10 +138,18 @@ func (tstDep *tpDeployment) CreateVolumeSet(licensePath string, sizeOfEachVolume
 	return nil
 }
 
+func (tstDep *tpDeployment) PlanVolumeSet(licensePath string, sizeOfEachVolume int, clusterSize int) (*PlanSummary, error) {
+	return NewPlanSummary(), nil
+}
+
 func (tstDep *tpDeployment) DeleteVolumeSet() error {
 	return nil
 }
 
+func (tstDep *tpDeployment) PlanDeleteVolumeSet() (*PlanSummary, error) {
+	return NewPlanSummary(), nil
+}
+
 func (tstDep *tpDeployment) StatusVolumeSet() error {
 	return nil
 }
@@ -123,10 +166,18 @@ func (tstDep *tpDeployment) OpenInstance(rootSize int, zookeeperSize int, mask s
 	return nil
 }
 
+func (tstDep *tpDeployment) PlanInstance(clusterSize int, rootSize int, zookeeperSize int, idleTimeout int, bastionVolSnapshotId string) (*PlanSummary, error) {
+	return NewPlanSummary(), nil
+}
+
 func (tstDep *tpDeployment) DeleteInstance() error {
 	return nil
 }
 
+func (tstDep *tpDeployment) PlanDeleteInstance() (*PlanSummary, error) {
+	return NewPlanSummary(), nil
+}
+
 func (tstDep *tpDeployment) StatusInstance() error {
 	return nil
 }
@@ -139,14 +190,66 @@ func (tstDep *tpDeployment) InstanceExists() bool {
 	return tstDep.TstInstanceExists
 }
 
+func (tstDep *tpDeployment) StopInstance() error {
+	return nil
+}
+
+func (tstDep *tpDeployment) StartInstance() error {
+	return nil
+}
+
 func (tstDep *tpDeployment) FullStatus() (*StardogDescription, error) {
 	return tstDep.SdDesc, nil
 }
 
+func (tstDep *tpDeployment) Drift() ([]DriftItem, error) {
+	return []DriftItem{}, nil
+}
+
+func (tstDep *tpDeployment) EstimateCost(sizeOfEachVolume int, clusterSize int, rootVolumeSize int, zookeeperSize int) (*CostEstimate, error) {
+	e := NewCostEstimate("test", "USD")
+	e.AddHourly("stardog node", "", clusterSize, 1.0)
+	e.AddHourly("zookeeper node", "", zookeeperSize, 0.5)
+	e.AddMonthly("volume", fmt.Sprintf("%d GB", sizeOfEachVolume), clusterSize, float64(sizeOfEachVolume))
+	return e, nil
+}
+
 func (tstDep *tpDeployment) ClusterSize() (int, error) {
 	return 1, nil
 }
 
+func (tstDep *tpDeployment) ZookeeperSize() (int, error) {
+	return 1, nil
+}
+
+func (tstDep *tpDeployment) ReplaceZookeeperNode(zookeeperSize int, ndx int) error {
+	return nil
+}
+
+func (tstDep *tpDeployment) UpdateImage() error {
+	return nil
+}
+
+func (tstDep *tpDeployment) ReplaceStardogNode(ndx int) error {
+	return nil
+}
+
+func (tstDep *tpDeployment) ResizeCluster(clusterSize int) error {
+	return nil
+}
+
+func (tstDep *tpDeployment) SnapshotVolumeSet(tag string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (tstDep *tpDeployment) CreateVolumeSetFromSnapshots(snapshotIDs []string, sizeOfEachVolume int) error {
+	return nil
+}
+
+func (tstDep *tpDeployment) DeleteVolumeSnapshots(snapshotIDs []string) error {
+	return nil
+}
+
 func (tstDep *tpDeployment) DestroyDeployment() error {
 	return nil
 }
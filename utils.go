@@ -19,6 +19,7 @@ import (
 	"archive/zip"
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -36,6 +37,7 @@ import (
 
 	"github.com/fatih/color"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 type validatorFunc func(key string) (interface{}, error)
@@ -60,6 +62,42 @@ func AskUser(prompt string, defaultValue string) (string, error) {
 	return resultValue, nil
 }
 
+// ReadNewPassword reads a new password.  A console user is prompted twice
+// without echoing what is typed, otherwise the first line of stdin is used.
+func ReadNewPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		pw := strings.TrimRight(line, "\r\n")
+		if pw == "" {
+			return "", errors.New("No password was given on stdin")
+		}
+		return pw, nil
+	}
+	fmt.Print(color.WhiteString("%s: ", prompt))
+	pw, err := terminal.ReadPassword(fd)
+	fmt.Print("\n")
+	if err != nil {
+		return "", err
+	}
+	fmt.Print(color.WhiteString("Enter it again: "))
+	again, err := terminal.ReadPassword(fd)
+	fmt.Print("\n")
+	if err != nil {
+		return "", err
+	}
+	if string(pw) != string(again) {
+		return "", errors.New("The passwords do not match")
+	}
+	if len(pw) == 0 {
+		return "", errors.New("The password cannot be empty")
+	}
+	return string(pw), nil
+}
+
 // AskUserYesOrNo is just a convenience wrapper around AskUser that looks for
 // a yes or no answer.  A case insensitive yes will return true and all other
 // values will return false.
@@ -188,11 +226,18 @@ func RunCommand(cliContext AppContext, cmd exec.Cmd, lineScanner LineScanner, sp
 		return nil, err
 	}
 
+	// The output is tagged with the program and its subcommand, for example
+	// terraform apply, so that it can be told apart from graviton's lines.
+	fields := LogFields{"source": filepath.Base(cmd.Args[0])}
+	if len(cmd.Args) > 1 {
+		fields["step"] = cmd.Args[1]
+	}
+
 	stdErrScanner := bufio.NewScanner(stderr)
 	go func() {
 		for stdErrScanner.Scan() {
 			text := stdErrScanner.Text()
-			cliContext.Logf(WARN, "STDERR %s", text)
+			cliContext.LogWith(WARN, fields, "STDERR %s", text)
 		}
 	}()
 
@@ -209,7 +254,7 @@ func RunCommand(cliContext AppContext, cmd exec.Cmd, lineScanner LineScanner, sp
 		if spinner != nil {
 			spinner.EchoNext()
 		}
-		cliContext.Logf(DEBUG, "STDOUT %s", line)
+		cliContext.LogWith(DEBUG, fields, "STDOUT %s", line)
 		if lineScanner != nil {
 			rc := lineScanner(cliContext, line)
 			if rc != nil {
@@ -0,0 +1,166 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ZookeeperHealthy returns true if every node of the ZooKeeper ensemble
+// answers its health endpoint.  The endpoints are checked from the bastion
+// node when the deployment has one.
+func ZookeeperHealthy(context AppContext, baseD *BaseDeployment, dep Deployment) bool {
+	sd, err := dep.FullStatus()
+	if err != nil {
+		context.Logf(WARN, "Status failure %s", err)
+		return false
+	}
+	for _, url := range sd.ZookeeperHealthURLs {
+		if !checkURL(context, baseD, sd, url, true) {
+			context.Logf(INFO, "The ZooKeeper node at %s is not healthy", url)
+			return false
+		}
+	}
+	return true
+}
+
+// WaitForZookeeperQuorum blocks until every node of the ensemble reports that
+// it is serving requests, which ZooKeeper only does while it is part of a
+// quorum.
+func WaitForZookeeperQuorum(context AppContext, baseD *BaseDeployment, dep Deployment, waitTimeout int) error {
+	sd, err := dep.FullStatus()
+	if err != nil {
+		return err
+	}
+	if len(sd.ZookeeperHealthURLs) == 0 {
+		context.ConsoleLog(1, "The deployment does not expose ZooKeeper health endpoints, the quorum was not verified.\n")
+		return nil
+	}
+	pollInterval := 2
+	itCnt := waitTimeout / pollInterval
+	spin := NewSpinner(context, 1, "Waiting for the ZooKeeper quorum")
+	for i := 0; !ZookeeperHealthy(context, baseD, dep); i++ {
+		if i >= itCnt {
+			return errors.New("Timed out waiting for the ZooKeeper quorum")
+		}
+		spin.EchoNext()
+		time.Sleep(time.Duration(pollInterval) * time.Second)
+	}
+	spin.Close()
+	context.ConsoleLog(1, "%s\n", context.SuccessString("The ZooKeeper ensemble has a quorum"))
+	return nil
+}
+
+// zookeeperResizeSteps returns the indexes of the ZooKeeper nodes in the
+// order ResizeZookeeper handles them.  When growing, the new nodes are
+// started first so that the kept nodes can be replaced without losing the
+// quorum.  When shrinking, the kept nodes are replaced first, while the
+// extra nodes still vote in the old ensemble, and the extra nodes are
+// removed last.
+func zookeeperResizeSteps(current int, zkSize int) []int {
+	kept := current
+	if zkSize < current {
+		kept = zkSize
+	}
+	replaced := []int{}
+	for i := 0; i < kept; i++ {
+		replaced = append(replaced, i)
+	}
+	changed := []int{}
+	for i := kept; i < current || i < zkSize; i++ {
+		changed = append(changed, i)
+	}
+	if zkSize < current {
+		return append(replaced, changed...)
+	}
+	return append(changed, replaced...)
+}
+
+// ResizeZookeeper changes the number of nodes in the ZooKeeper ensemble.
+// Every node that is kept is replaced in turn so that it learns the new
+// server list, see zookeeperResizeSteps for the order.  The quorum is
+// verified after every step.  The Stardog nodes are then replaced one at a
+// time so that their pack.zookeeper.address lists the new ensemble.
+func ResizeZookeeper(context AppContext, baseD *BaseDeployment, dep Deployment, zkSize int, waitMaxTimeSec int) error {
+	if zkSize < 1 || zkSize%2 == 0 {
+		return errors.New("A ZooKeeper ensemble needs an odd number of nodes")
+	}
+	current, err := dep.ZookeeperSize()
+	if err != nil {
+		return err
+	}
+	if current == zkSize {
+		context.ConsoleLog(1, "The ZooKeeper ensemble already has %d nodes.\n", zkSize)
+		return nil
+	}
+	quorum := QuorumSize(current)
+	if zkSize < quorum {
+		return fmt.Errorf("Shrinking the ZooKeeper ensemble from %d to %d nodes would drop below the quorum of %d nodes", current, zkSize, quorum)
+	}
+	steps := zookeeperResizeSteps(current, zkSize)
+	for _, ndx := range steps {
+		if ndx < zkSize {
+			context.ConsoleLog(1, "Starting ZooKeeper node %d of %d...\n", ndx+1, zkSize)
+		} else {
+			context.ConsoleLog(1, "Removing ZooKeeper node %d...\n", ndx+1)
+		}
+		err = dep.ReplaceZookeeperNode(zkSize, ndx)
+		if err != nil {
+			return err
+		}
+		err = WaitForZookeeperQuorum(context, baseD, dep, waitMaxTimeSec)
+		if err != nil {
+			return err
+		}
+	}
+	launchParameters(baseD).ZkSize = zkSize
+	err = SetDeploymentState(context, baseD, CurrentState(baseD))
+	if err != nil {
+		return err
+	}
+	clusterSize, err := dep.ClusterSize()
+	if err != nil {
+		return err
+	}
+	context.ConsoleLog(1, "Replacing the Stardog nodes so that they use the new ZooKeeper ensemble...\n")
+	err = replaceStardogNodes(context, baseD, dep, clusterSize, waitMaxTimeSec)
+	if err != nil {
+		// The ensemble is already resized, so running zk resize again
+		// would do nothing.
+		return fmt.Errorf("The ZooKeeper ensemble now has %d nodes but not every Stardog node uses it, run instance reimage to replace them: %s", zkSize, err)
+	}
+	return nil
+}
+
+// ReplaceZookeeper recreates a single ZooKeeper node.  The node is identified
+// by its ZooKeeper id, the N in server.N of zoo.cfg.
+func ReplaceZookeeper(context AppContext, baseD *BaseDeployment, dep Deployment, id int, waitMaxTimeSec int) error {
+	zkSize, err := dep.ZookeeperSize()
+	if err != nil {
+		return err
+	}
+	if id < 1 || id > zkSize {
+		return fmt.Errorf("The ZooKeeper node id must be between 1 and %d", zkSize)
+	}
+	context.ConsoleLog(1, "Replacing ZooKeeper node %d...\n", id)
+	err = dep.ReplaceZookeeperNode(zkSize, id-1)
+	if err != nil {
+		return err
+	}
+	return WaitForZookeeperQuorum(context, baseD, dep, waitMaxTimeSec)
+}
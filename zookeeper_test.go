@@ -0,0 +1,42 @@
+//
+//  Copyright (c) 2017, Stardog Union. <http://stardog.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestZookeeperResizeSteps(t *testing.T) {
+	cases := []struct {
+		current int
+		zkSize  int
+		steps   []int
+	}{
+		// The new nodes start before the kept nodes learn about them.
+		{3, 5, []int{3, 4, 0, 1, 2}},
+		{1, 3, []int{1, 2, 0}},
+		// The extra nodes keep voting until the kept nodes are replaced.
+		{5, 3, []int{0, 1, 2, 3, 4}},
+		{7, 5, []int{0, 1, 2, 3, 4, 5, 6}},
+	}
+	for _, c := range cases {
+		steps := zookeeperResizeSteps(c.current, c.zkSize)
+		if !reflect.DeepEqual(steps, c.steps) {
+			t.Fatalf("Resizing from %d to %d should go %v not %v", c.current, c.zkSize, c.steps, steps)
+		}
+	}
+}